@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	appsCmd.AddCommand(appsScanCmd)
+	rootCmd.AddCommand(appsCmd)
+}
+
+var appsCmd = &cobra.Command{
+	Use:   "apps",
+	Short: "Inspect the installed apps",
+}
+
+var appsScanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "List the installed apps and suggest an apps config",
+	Long: `Inventory /Applications and ~/Applications, classify each app as installed
+from the App Store, with a Homebrew cask or as a direct download, and print an
+apps section for the config file that brings them back on restore.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		scanned, err := apps.ScanApps()
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		if len(scanned) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No apps found in /Applications or ~/Applications")
+			return
+		}
+
+		width := 0
+		for _, app := range scanned {
+			width = max(width, len(app.Name))
+		}
+		counts := make(map[string]int)
+		presets := make([]string, 0)
+		direct := make([]string, 0)
+		for _, app := range scanned {
+			source := app.Source
+			if app.Cask != "" {
+				source += " (" + app.Cask + ")"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "  %-*s  %s\n", width, app.Name, source)
+
+			counts[app.Source]++
+			if app.Source == apps.SourceDirect {
+				direct = append(direct, app.Name)
+			}
+			if app.Preset != "" && !slices.Contains(presets, app.Preset) {
+				presets = append(presets, app.Preset)
+			}
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "\n%d apps: %d from the App Store, %d from Homebrew casks, %d direct downloads\n",
+			len(scanned), counts[apps.SourceAppStore], counts[apps.SourceHomebrew], counts[apps.SourceDirect])
+
+		// Suggested config
+		var b strings.Builder
+		b.WriteString("apps:\n")
+		if counts[apps.SourceHomebrew] > 0 {
+			b.WriteString("  homebrew:\n    enabled: true\n")
+		}
+		if counts[apps.SourceAppStore] > 0 {
+			b.WriteString("  mas:\n    enabled: true\n")
+		}
+		if len(presets) > 0 {
+			slices.Sort(presets)
+			b.WriteString("  presets:\n")
+			for _, preset := range presets {
+				fmt.Fprintf(&b, "    - %s\n", preset)
+			}
+		}
+		if len(direct) > 0 {
+			b.WriteString("  # Not reinstalled automatically, check for a cask with `brew search`:\n")
+			for _, name := range direct {
+				fmt.Fprintf(&b, "  #   %s\n", name)
+			}
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "\nSuggested config:\n\n%s", b.String())
+	},
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hinkolas/macup/internal/launchd"
+	"github.com/hinkolas/macup/internal/notify"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+// autotriggerLabel is the launchd label of the auto-trigger agent
+const autotriggerLabel = "com.hinkolas.macup.autotrigger"
+
+func init() {
+
+	// Autotrigger-Install-Command Flags
+	autotriggerInstallCmd.Flags().StringP("volume", "v", "", "Name of the backup volume in /Volumes (required)")
+	autotriggerInstallCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	autotriggerInstallCmd.MarkFlagRequired("volume")
+
+	// Autotrigger-Run-Command Flags
+	autotriggerRunCmd.Flags().StringP("volume", "v", "", "Name of the backup volume in /Volumes (required)")
+	autotriggerRunCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	autotriggerRunCmd.MarkFlagRequired("volume")
+
+	autotriggerCmd.AddCommand(autotriggerInstallCmd, autotriggerUninstallCmd, autotriggerRunCmd)
+	rootCmd.AddCommand(autotriggerCmd)
+
+}
+
+var autotriggerCmd = &cobra.Command{
+	Use:   "autotrigger",
+	Short: "Back up automatically when the backup volume is plugged in",
+	Long: `Install a LaunchAgent that runs "macup create" as soon as the designated
+backup volume is mounted, and posts a notification when the backup is done.`,
+}
+
+var autotriggerInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the auto-trigger LaunchAgent",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		volume := cmd.Flag("volume").Value.String()
+
+		configPath, err := macup.NormalizePath(cmd.Flag("config").Value.String())
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Can't determine the macup executable: %v\n", err)
+			os.Exit(1)
+		}
+
+		logPath, err := macup.NormalizePath("~/Library/Logs/macup/autotrigger.log")
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		os.MkdirAll(filepath.Dir(logPath), 0755)
+
+		agent := launchd.Agent{
+			Label:             autotriggerLabel,
+			ProgramArguments:  []string{executable, "autotrigger", "run", "--volume", volume, "--config", configPath},
+			StartOnMount:      true,
+			StandardOutPath:   logPath,
+			StandardErrorPath: logPath,
+		}
+		if err := launchd.Install(agent); err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "✓ macup will back up automatically when /Volumes/%s is mounted\n", volume)
+		fmt.Fprintf(cmd.OutOrStdout(), "  Logs are written to %s\n", logPath)
+
+	},
+}
+
+var autotriggerUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the auto-trigger LaunchAgent",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if err := launchd.Uninstall(autotriggerLabel); err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), "✓ Auto-trigger removed")
+
+	},
+}
+
+var autotriggerRunCmd = &cobra.Command{
+	Use:    "run",
+	Short:  "Run a backup if the backup volume was just mounted (called by launchd)",
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		volume := cmd.Flag("volume").Value.String()
+		volumePath := filepath.Join("/Volumes", volume)
+
+		// launchd starts us on every mount, so remember whether the volume was
+		// already mounted last time to back up only once per plug-in
+		statePath, err := macup.NormalizePath(filepath.Join("~/.local/state/macup", "autotrigger-"+volume))
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		if info, err := os.Stat(volumePath); err != nil || !info.IsDir() {
+			os.Remove(statePath)
+			return
+		}
+		if _, err := os.Stat(statePath); err == nil {
+			return
+		}
+		os.MkdirAll(filepath.Dir(statePath), 0755)
+		if err := os.WriteFile(statePath, nil, 0644); err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Can't write auto-trigger state: %v\n", err)
+		}
+
+		configPath := cmd.Flag("config").Value.String()
+		config, err := macup.LoadConfig(configPath)
+		if err != nil {
+			notify.Notify("macup", "Backup failed: can't load config")
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		if err := macup.Create(interruptContext(), config, configPath, macup.ModuleFilter{}); err != nil {
+			notify.Notify("macup", "Backup to "+volume+" failed")
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		// When ejecting the backup already announced that the volume can be unplugged
+		if !config.EjectAfter && config.OutputVolume == "" {
+			notify.Notify("macup", "Backup to "+volume+" completed")
+		}
+
+	},
+}
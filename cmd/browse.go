@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Browse-Command Flags
+	browseCmd.Flags().StringP("backup", "b", "", "Path, URL (https, s3, webdav, sftp) or rclone remote of the backup (required)")
+	browseCmd.Flags().StringP("config", "c", "", "Config file to read storage credentials from")
+	browseCmd.Flags().String("to", ".", "Directory the selection is restored into")
+
+	browseCmd.MarkFlagRequired("backup")
+
+	browseCmd.RegisterFlagCompletionFunc("backup", completeBackups)
+
+	rootCmd.AddCommand(browseCmd)
+
+}
+
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Browse the files of a backup and restore a selection",
+	Long: `Show the files of a backup as a tree, with a folder for every archive and the
+size of every file and folder. Move with the arrow keys, select files and
+folders with space, search below the current folder with / and press r to
+restore the selection into the --to directory. Archives are only read once
+their folder is opened or searched.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		opts := storageOptions(cmd)
+
+		backupFS, err := macup.NewBackupFS(cmd.Flag("backup").Value.String(), opts)
+		if err != nil {
+			exit(err)
+		}
+
+		selection, err := tui.Browse(backupFS.String(), backupFS.BrowserNodes())
+		if errors.Is(err, tui.ErrCanceled) {
+			if err := backupFS.Close(); err != nil {
+				exit(err)
+			}
+			return
+		}
+		var extracted []string
+		if err == nil {
+			paths := make([]string, len(selection))
+			for i, node := range selection {
+				paths[i] = node.Path
+			}
+			extracted, err = backupFS.Extract(paths, cmd.Flag("to").Value.String())
+		}
+		if err := errors.Join(err, backupFS.Close()); err != nil {
+			exit(err)
+		}
+
+		for _, path := range extracted {
+			fmt.Fprintln(cmd.OutOrStdout(), path)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "✓ Restored %d entries\n", len(extracted))
+
+	},
+}
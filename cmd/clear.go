@@ -3,17 +3,20 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
-	"github.com/hinkolas/macup/internal/backup"
+	"github.com/hinkolas/macup/pkg/macup"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	// Clear-Command Flags
-	clearCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Specify the path to the config file")
+	clearCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
 	clearCmd.Flags().BoolP("yes", "y", false, "Skip confirmation prompt")
+	clearCmd.Flags().StringSlice("only", nil, "Only clear these locations, by path or name")
+	clearCmd.Flags().Bool("keep-root", false, "Empty the directories of the locations instead of removing them")
 
 	rootCmd.AddCommand(clearCmd)
 }
@@ -21,69 +24,99 @@ func init() {
 var clearCmd = &cobra.Command{
 	Use:   "clear",
 	Short: "Delete all configured backup locations (for testing restore)",
-	Long: `Delete all directories specified in the config file.
-This is primarily intended for testing the restore functionality.
+	Long: `Delete all directories specified in the config file, or only those given
+with --only. This is primarily intended for testing the restore functionality.
 
 WARNING: This will permanently delete all files and directories listed in your config!
-You will be asked to confirm before deletion unless --yes flag is used.`,
+You will be asked to retype the path of each location before deletion unless
+--yes flag is used.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		configPath := cmd.Flag("config").Value.String()
 		skipConfirmation := cmd.Flag("yes").Changed && cmd.Flag("yes").Value.String() == "true"
 
 		// Load config
-		config, err := backup.LoadConfig(configPath)
+		config, err := macup.LoadConfig(configPath)
 		if err != nil {
 			if os.IsNotExist(err) {
-				fmt.Printf("Can't find a config file at %s\n", configPath)
+				fmt.Fprintf(cmd.OutOrStdout(), "Can't find a config file at %s\n", configPath)
 			} else if os.IsPermission(err) {
-				fmt.Println("Can't access config file due to missing permissions.")
+				fmt.Fprintln(cmd.OutOrStdout(), "Can't access config file due to missing permissions.")
 			} else {
-				fmt.Println(err)
+				fmt.Fprintln(cmd.OutOrStdout(), err)
 			}
 			os.Exit(1)
 		}
 
+		only, _ := cmd.Flags().GetStringSlice("only")
+		paths, err := macup.ClearTargets(config, only)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		keepRoot := cmd.Flag("keep-root").Value.String() == "true"
+
 		// Show what will be deleted
-		fmt.Println("\n⚠️  WARNING: The following locations will be PERMANENTLY DELETED:")
-		fmt.Println()
-		for _, loc := range config.Data.Locations {
-			fmt.Printf("  - %s\n", loc.Path)
+		if keepRoot {
+			fmt.Fprintln(cmd.OutOrStdout(), "\n⚠️  WARNING: The contents of the following locations will be PERMANENTLY DELETED:")
+		} else {
+			fmt.Fprintln(cmd.OutOrStdout(), "\n⚠️  WARNING: The following locations will be PERMANENTLY DELETED:")
+		}
+		fmt.Fprintln(cmd.OutOrStdout())
+		for _, path := range paths {
+			fmt.Fprintf(cmd.OutOrStdout(), "  - %s\n", path)
 		}
-		fmt.Println()
+		fmt.Fprintln(cmd.OutOrStdout())
 
 		// Confirm deletion
 		if !skipConfirmation {
-			confirmed, err := confirmDeletion()
+			confirmed, err := confirmDeletion(cmd.OutOrStdout(), paths)
 			if err != nil {
-				fmt.Printf("Error reading confirmation: %v\n", err)
+				fmt.Fprintf(cmd.OutOrStdout(), "Error reading confirmation: %v\n", err)
 				os.Exit(1)
 			}
 			if !confirmed {
-				fmt.Println("Deletion cancelled.")
+				fmt.Fprintln(cmd.OutOrStdout(), "Deletion cancelled.")
 				os.Exit(0)
 			}
 		}
 
 		// Perform deletion
-		err = backup.ClearLocations(config)
-		if err != nil {
-			fmt.Printf("Error during deletion: %v\n", err)
-			os.Exit(1)
+		fmt.Fprintln(cmd.OutOrStdout(), "\nStarting deletion...")
+		for i, path := range paths {
+			fmt.Fprintf(cmd.OutOrStdout(), "[%d/%d] Deleting %s... ", i+1, len(paths), path)
+
+			// Check if path exists
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				fmt.Fprintln(cmd.OutOrStdout(), "(already deleted)")
+				continue
+			}
+
+			if err := macup.ClearSingleLocation(path, keepRoot); err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), "ERROR")
+				fmt.Fprintf(cmd.OutOrStdout(), "Error during deletion: failed to delete %s: %v\n", path, err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "✓")
 		}
 
-		fmt.Println("\n✓ All locations cleared successfully!")
+		fmt.Fprintln(cmd.OutOrStdout(), "\n✓ All locations cleared successfully!")
 	},
 }
 
-func confirmDeletion() (bool, error) {
+// confirmDeletion asks to retype each path, a single mismatch cancels everything
+func confirmDeletion(w io.Writer, paths []string) (bool, error) {
 	reader := bufio.NewReader(os.Stdin)
 
-	fmt.Print("Type 'DELETE' to confirm (case-sensitive): ")
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return false, err
-	}
+	for _, path := range paths {
+		fmt.Fprintf(w, "Type the path %s to confirm: ", path)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
 
-	input = strings.TrimSpace(input)
-	return input == "DELETE", nil
+		if strings.TrimSpace(input) != path {
+			return false, nil
+		}
+	}
+	return true, nil
 }
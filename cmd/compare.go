@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Compare-Command Flags
+	compareCmd.Flags().StringP("config", "c", "", "Config file to read storage credentials from")
+	compareCmd.Flags().Bool("summary", false, "Only show the changes per location, not per file")
+
+	compareCmd.ValidArgsFunction = completeBackups
+
+	rootCmd.AddCommand(compareCmd)
+
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <older> <newer>",
+	Short: "Show what changed between two backups",
+	Long: `Compare two backups, e.g. a copy made with "macup sync" last week and the
+current one, and show the files that were added, removed or changed in each
+location along with the change in size. Only archives whose checksum differs
+are read.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		opts := storageOptions(cmd)
+
+		comparison, err := macup.Compare(args[0], args[1], opts)
+		if err != nil {
+			exit(err)
+		}
+		if tui.JSONEnabled() {
+			tui.WriteJSON(comparison)
+			return
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Comparing the backups from %s and %s\n\n", comparison.Old.Local().Format("2006-01-02 15:04"), comparison.New.Local().Format("2006-01-02 15:04"))
+		summary := cmd.Flag("summary").Value.String() == "true"
+		for _, loc := range comparison.Locations {
+			if loc.Change == "unchanged" {
+				fmt.Fprintf(cmd.OutOrStdout(), "  %s: unchanged\n", loc.Location)
+				continue
+			}
+
+			counts := make(map[string]int)
+			var delta int64
+			for _, file := range loc.Files {
+				counts[file.Change]++
+				delta += file.NewSize - file.OldSize
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s: %s, %d added, %d removed, %d changed, %s\n",
+				changeSign(loc.Change), loc.Location, loc.Change, counts["added"], counts["removed"], counts["changed"], signedSize(delta))
+			if summary {
+				continue
+			}
+			for _, file := range loc.Files {
+				switch file.Change {
+				case "added":
+					fmt.Fprintf(cmd.OutOrStdout(), "    + %s (%s)\n", file.Name, units.FormatSize(file.NewSize))
+				case "removed":
+					fmt.Fprintf(cmd.OutOrStdout(), "    - %s (%s)\n", file.Name, units.FormatSize(file.OldSize))
+				default:
+					fmt.Fprintf(cmd.OutOrStdout(), "    ~ %s (%s → %s)\n", file.Name, units.FormatSize(file.OldSize), units.FormatSize(file.NewSize))
+				}
+			}
+		}
+		if len(comparison.Locations) == 0 {
+			fmt.Fprintln(os.Stderr, "⚠ Neither backup holds any archives")
+		}
+
+	},
+}
+
+// changeSign marks a change like a diff does
+func changeSign(change string) string {
+	switch change {
+	case "added":
+		return "+"
+	case "removed":
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// signedSize formats a size difference, e.g. "+1.2 MB" or "-300 B"
+func signedSize(delta int64) string {
+	if delta < 0 {
+		return "-" + units.FormatSize(-delta)
+	}
+	return "+" + units.FormatSize(delta)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	rootCmd.AddCommand(completionCmd)
+
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish",
+	Short: "Print the shell completion script",
+	Long: `Print the completion script for a shell. Besides commands and flags it
+completes module names, the profiles of the config, configured outputs for
+--backup and the locations and archives of a backup.
+
+  bash: macup completion bash > $(brew --prefix)/etc/bash_completion.d/macup
+  zsh:  macup completion zsh > "${fpath[1]}/_macup"
+  fish: macup completion fish > ~/.config/fish/completions/macup.fish`,
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		var err error
+		switch args[0] {
+		case "bash":
+			err = rootCmd.GenBashCompletionV2(cmd.OutOrStdout(), true)
+		case "zsh":
+			err = rootCmd.GenZshCompletion(cmd.OutOrStdout())
+		case "fish":
+			err = rootCmd.GenFishCompletion(cmd.OutOrStdout(), true)
+		}
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+	},
+}
+
+// completeModules completes the module names of --only and --skip
+func completeModules(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return completeList(macup.ModuleNames(), toComplete)
+}
+
+// completeProfiles completes the profiles of the config given by --config
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return macup.ProfileNames(cmd.Flag("config").Value.String()), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBackups completes the outputs of the default config for --backup,
+// and directories once the value looks like a path
+func completeBackups(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var matches []string
+	for _, target := range macup.ConfiguredOutputs("~/.config/macup/config.yaml") {
+		if strings.HasPrefix(target, toComplete) {
+			matches = append(matches, target)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeLocations completes the locations of the backup given by --backup
+func completeLocations(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	opts, _ := loadStorageOptions(cmd)
+	choices, err := macup.RestoreChoices(cmd.Flag("backup").Value.String(), opts)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, choice := range choices {
+		if choice.Location {
+			names = append(names, choice.Name)
+		}
+	}
+	return completeList(names, toComplete)
+}
+
+// completeArchives completes the archives and locations of the backup given
+// by --backup
+func completeArchives(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	opts, _ := loadStorageOptions(cmd)
+	archives, err := macup.ListArchives(cmd.Flag("backup").Value.String(), opts)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []string
+	for _, archive := range archives {
+		names = append(names, archive.Archive+"\t"+archive.Location)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeList completes the next value of a comma separated list flag, e.g.
+// "data,ap" to "data,apps"
+func completeList(values []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix = toComplete[:i+1]
+	}
+	given := strings.Split(prefix, ",")
+	completions := make([]string, 0, len(values))
+	for _, value := range values {
+		if !slices.Contains(given, value) {
+			completions = append(completions, prefix+value)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Config-Validate-Command Flags
+	configValidateCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	configValidateCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+
+	// Config-Migrate-Command Flags
+	configMigrateCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Specify the path to the config file")
+
+	// Config-Show-Command Flags
+	configShowCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	configShowCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+
+	configValidateCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	configShowCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the config file",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file for mistakes",
+	Long: `Check the config file for unknown keys, missing and invalid values, and
+report locations that don't exist on this Mac or lie inside other locations.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		configPath := cmd.Flag("config").Value.String()
+		config, err := macup.LoadProfile(configPath, cmd.Flag("profile").Value.String())
+		if err != nil {
+			if os.IsNotExist(err) {
+				fmt.Fprintln(cmd.OutOrStdout(), "Can't find a config file at", configPath)
+			} else if os.IsPermission(err) {
+				fmt.Fprintln(cmd.OutOrStdout(), "Can't access config file due to missing permissions.")
+			} else {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+			}
+			os.Exit(1)
+		}
+
+		for _, path := range config.MissingLocations() {
+			fmt.Fprintf(cmd.OutOrStdout(), "⚠ %s doesn't exist on this Mac\n", path)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "✓ %s is valid\n", configPath)
+
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the config file to the current version",
+	Long: `Upgrade the config file and the files it includes to the current config
+version. The old files are kept next to them with a .bak suffix.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		configPath := cmd.Flag("config").Value.String()
+		changes, err := macup.MigrateFile(configPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				fmt.Fprintln(cmd.OutOrStdout(), "Can't find a config file at", configPath)
+			} else {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+			}
+			os.Exit(1)
+		}
+
+		if len(changes) == 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "✓ %s is up to date\n", configPath)
+			return
+		}
+		for _, change := range changes {
+			fmt.Fprintf(cmd.OutOrStdout(), "  - %s\n", change)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "✓ %s upgraded\n", configPath)
+
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the config the way macup uses it",
+	Long: `Print the fully resolved config: with includes, the profile and hosts block,
+app presets and defaults applied, paths expanded and secrets redacted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		configPath := cmd.Flag("config").Value.String()
+		config, err := macup.LoadProfile(configPath, cmd.Flag("profile").Value.String())
+		if err != nil {
+			if os.IsNotExist(err) {
+				fmt.Fprintln(cmd.OutOrStdout(), "Can't find a config file at", configPath)
+			} else if os.IsPermission(err) {
+				fmt.Fprintln(cmd.OutOrStdout(), "Can't access config file due to missing permissions.")
+			} else {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+			}
+			os.Exit(1)
+		}
+
+		effective, err := config.Effective()
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		cmd.OutOrStdout().Write(effective)
+
+	},
+}
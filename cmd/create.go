@@ -1,19 +1,36 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"text/tabwriter"
 
-	"github.com/hinkolas/macup/internal/backup"
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"github.com/hinkolas/macup/pkg/macup"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 
 	// Create-Command Flags
-	createCmd.Flags().BoolP("debug", "d", false, "Enable debug mode")
-	createCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Specify the path to the config file")
-	createCmd.Flags().StringP("output", "o", "./backup", "Output path of the backup")
+	createCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	createCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+	createCmd.Flags().StringArrayP("output", "o", []string{"./backup"}, "Output path of the backup, repeat for multiple targets")
+	createCmd.Flags().Bool("verify", false, "Verify each archive before moving it into place")
+	createCmd.Flags().Bool("skip-unchanged", false, "Skip locations that did not change since the last backup")
+	createCmd.Flags().StringSlice("only", nil, "Only back up these modules, e.g. data,apps")
+	createCmd.Flags().StringSlice("skip", nil, "Don't back up these modules, e.g. defaults")
+	createCmd.Flags().Bool("dry-run", false, "Only scan the locations and report their size, without creating a backup")
+	createCmd.Flags().Bool("keep-going", false, "Back up the remaining locations when one fails, instead of aborting")
+
+	createCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	createCmd.RegisterFlagCompletionFunc("only", completeModules)
+	createCmd.RegisterFlagCompletionFunc("skip", completeModules)
 
 	rootCmd.AddCommand(createCmd)
 
@@ -22,31 +39,133 @@ func init() {
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a new backup with the specified configuration",
+	Long: `Create a new backup with the specified configuration.
+
+Exits with status 0 if the backup succeeded, 1 if it is incomplete because some
+locations or output targets failed, and 2 if it failed entirely.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		config, err := backup.LoadConfig(cmd.Flag("config").Value.String())
+		config, err := macup.LoadProfile(cmd.Flag("config").Value.String(), cmd.Flag("profile").Value.String())
 		if err != nil {
 			if os.IsNotExist(err) {
-				fmt.Println("Can't find a config file at", cmd.Flag("config").Value.String())
+				fmt.Fprintln(cmd.OutOrStdout(), "Can't find a config file at", cmd.Flag("config").Value.String())
 			} else if os.IsPermission(err) {
-				fmt.Println("Can't access config file due to missing permissions.")
+				fmt.Fprintln(cmd.OutOrStdout(), "Can't access config file due to missing permissions.")
 			} else {
-				fmt.Println(err)
+				fmt.Fprintln(cmd.OutOrStdout(), err)
 			}
-			os.Exit(1)
+			tui.Emit(tui.Event{Event: "error", Error: err.Error()})
+			os.Exit(2)
 		}
 
 		if cmd.Flag("output").Changed {
-			config.Output = cmd.Flag("output").Value.String()
+			config.Output, _ = cmd.Flags().GetStringArray("output")
+		}
+
+		if cmd.Flag("verify").Changed {
+			config.Verify = cmd.Flag("verify").Value.String() == "true"
 		}
 
+		if cmd.Flag("skip-unchanged").Changed {
+			config.SkipUnchanged = cmd.Flag("skip-unchanged").Value.String() == "true"
+		}
+
+		if cmd.Flag("keep-going").Changed {
+			config.KeepGoing = cmd.Flag("keep-going").Value.String() == "true"
+		}
+
+		if cmd.Flag("dry-run").Value.String() == "true" {
+			reports := macup.DryRun(config)
+			if tui.JSONEnabled() {
+				tui.WriteJSON(reports)
+				return
+			}
+			printDryRun(cmd.OutOrStdout(), reports)
+			return
+		}
+
+		only, _ := cmd.Flags().GetStringSlice("only")
+		skip, _ := cmd.Flags().GetStringSlice("skip")
+
 		// Create a new backup with the specified configuration
 		configPath := cmd.Flag("config").Value.String()
-		err = backup.Create(config, configPath)
+		err = macup.Create(interruptContext(), config, configPath, macup.ModuleFilter{Only: only, Skip: skip})
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			tui.Emit(tui.Event{Event: "error", Error: err.Error()})
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(exitCode(err))
 		}
+		tui.Emit(tui.Event{Event: "complete"})
 
 	},
 }
+
+// exitCode returns the exit status of a failed backup, 1 if parts of it were
+// stored, 2 if nothing was and 130 if it was canceled
+func exitCode(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return 130
+	}
+	var partial *macup.PartialError
+	if (errors.As(err, &partial) && !partial.Total()) || errors.Is(err, macup.ErrIncomplete) {
+		return 1
+	}
+	return 2
+}
+
+// printDryRun shows what a backup would archive per location
+func printDryRun(out io.Writer, reports []macup.ScanReport) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOCATION\tFILES\tSIZE\tCOMPRESSED")
+	var files int
+	var size, estimated int64
+	for _, r := range reports {
+		switch {
+		case r.Skipped != "":
+			fmt.Fprintf(w, "%s\t-\t-\tskipped, %s\n", r.Location, r.Skipped)
+			continue
+		case r.Error != "":
+			fmt.Fprintf(w, "%s\t-\t-\tfailed, %s\n", r.Location, r.Error)
+			continue
+		}
+		count := fmt.Sprint(r.Files)
+		if r.Repos > 0 {
+			count += fmt.Sprintf(" (+%d repos)", r.Repos)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t~%s (%s)\n", r.Location, count, units.FormatSize(r.Size), units.FormatSize(r.Estimated), r.Compression)
+		files += r.Files
+		size += r.Size
+		estimated += r.Estimated
+	}
+	fmt.Fprintf(w, "Total\t%d\t%s\t~%s\n", files, units.FormatSize(size), units.FormatSize(estimated))
+	w.Flush()
+
+	// Entries left out, to spot excludes that miss or catch too much
+	printed := false
+	for _, r := range reports {
+		if len(r.Excluded) == 0 {
+			continue
+		}
+		if !printed {
+			fmt.Fprintln(out, "\nExcluded:")
+			printed = true
+		}
+		matches := make([]string, len(r.Excluded))
+		for i, m := range r.Excluded {
+			matches[i] = fmt.Sprintf("%s (%d)", m.Pattern, m.Entries)
+		}
+		fmt.Fprintf(out, "  %s: %s\n", r.Location, strings.Join(matches, ", "))
+	}
+
+	// Entries a backup would leave out since they can't be read
+	printed = false
+	for _, r := range reports {
+		for _, warning := range r.Warnings {
+			if !printed {
+				fmt.Fprintln(out, "\nWarnings:")
+				printed = true
+			}
+			fmt.Fprintf(out, "  ⚠ %s\n", warning)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Daemon-Command Flags
+	daemonCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	daemonCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+	daemonCmd.Flags().Duration("interval", 0, "Back up this often, e.g. 6h")
+	daemonCmd.Flags().Bool("watch", false, "Also back up once locations changed")
+	daemonCmd.Flags().Duration("check-every", time.Hour, "How often watched locations are scanned for changes the file system events missed")
+	daemonCmd.Flags().Bool("skip-on-battery", false, "Postpone backups while the Mac runs on battery power")
+
+	daemonCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	rootCmd.AddCommand(daemonCmd)
+
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Stay running and back up on an interval or when locations change",
+	Long: `Stay running and back up on an interval, and with --watch once the locations
+changed and the changes settled for a minute. Changes are seen from file system
+events. The locations are also scanned on start and every --check-every, for
+changes made while the daemon wasn't running or in locations too large to
+watch. Only changed locations are archived again. The config is reloaded for
+each backup, and "macup status" shows the state of the running daemon.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		interval, _ := cmd.Flags().GetDuration("interval")
+		checkEvery, _ := cmd.Flags().GetDuration("check-every")
+
+		err := macup.RunDaemon(interruptContext(), macup.DaemonOptions{
+			ConfigPath:    cmd.Flag("config").Value.String(),
+			Profile:       cmd.Flag("profile").Value.String(),
+			Interval:      interval,
+			Watch:         cmd.Flag("watch").Value.String() == "true",
+			CheckEvery:    checkEvery,
+			SkipOnBattery: cmd.Flag("skip-on-battery").Value.String() == "true",
+		})
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+	},
+}
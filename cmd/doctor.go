@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Doctor-Command Flags
+	doctorCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	doctorCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+	doctorCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	rootCmd.AddCommand(doctorCmd)
+
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that backups can work on this Mac",
+	Long: `Check the config, Full Disk Access, the tools needed by the enabled modules,
+the outputs with their free space and the archives of the last backup, and
+tell how to fix what is wrong. Exits with 1 if a problem keeps backups from
+working.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		diagnoses := macup.Doctor(cmd.Flag("config").Value.String(), cmd.Flag("profile").Value.String())
+		tui.WriteJSON(diagnoses)
+
+		failed := false
+		for _, d := range diagnoses {
+			mark := "✓"
+			switch {
+			case d.Problem() && d.Warning:
+				mark = "⚠"
+			case d.Problem():
+				mark = "✗"
+				failed = true
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s: %s\n", mark, d.Check, d.Result)
+			if d.Problem() {
+				fmt.Fprintf(cmd.OutOrStdout(), "  → %s\n", d.Fix)
+			}
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+
+	},
+}
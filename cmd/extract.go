@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Extract-Command Flags
+	extractCmd.Flags().StringP("backup", "b", "", "Path, URL (https, s3, webdav, sftp) or rclone remote of the backup (required)")
+	extractCmd.Flags().String("path", "", "File or directory to extract, e.g. \"Projects/thesis/ch3.tex\" or \"~/Documents/*.pdf\" (required)")
+	extractCmd.Flags().String("to", ".", "Directory to extract into")
+	extractCmd.Flags().StringP("config", "c", "", "Config file to read storage credentials from")
+
+	extractCmd.MarkFlagRequired("backup")
+	extractCmd.MarkFlagRequired("path")
+
+	extractCmd.RegisterFlagCompletionFunc("backup", completeBackups)
+
+	rootCmd.AddCommand(extractCmd)
+
+}
+
+var extractCmd = &cobra.Command{
+	Use:   "extract",
+	Short: "Extract single files or directories from a backup",
+	Long: `Extract the files matching a path from a backup, without restoring the whole
+location. The path starts with the name or the directory name of a location,
+e.g. "Projects/thesis/ch3.tex", or is the full path, e.g. "~/Projects/thesis".
+Directories are extracted with everything below them, into the --to directory.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		opts := macup.ExtractOptions{
+			Path:    cmd.Flag("path").Value.String(),
+			To:      cmd.Flag("to").Value.String(),
+			Storage: storageOptions(cmd),
+		}
+		extracted, err := macup.Extract(cmd.Flag("backup").Value.String(), opts)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		for _, path := range extracted {
+			fmt.Fprintln(cmd.OutOrStdout(), path)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "✓ Extracted %d entries\n", len(extracted))
+
+	},
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// History-Command Flags
+	historyCmd.Flags().IntP("limit", "n", 20, "Number of runs to show, all if 0")
+	historyCmd.Flags().Bool("details", false, "Also show the locations, errors and warnings of each run")
+
+	rootCmd.AddCommand(historyCmd)
+
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past backups and restores with their outcome",
+	Long: `List the backups and restores that ran on this Mac, the latest first, with
+how long they took, the size of the backup and whether they failed. Every run
+is recorded in ~/.local/state/macup/history.jsonl, one JSON object per line.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		runs, err := macup.History()
+		if err != nil {
+			exit(err)
+		}
+		if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 && len(runs) > limit {
+			runs = runs[:limit]
+		}
+		if tui.JSONEnabled() {
+			tui.WriteJSON(runs)
+			return
+		}
+		if len(runs) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No runs recorded yet")
+			return
+		}
+
+		// With details every run is a block of its own
+		details := cmd.Flag("details").Value.String() == "true"
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		if !details {
+			fmt.Fprintln(w, "STARTED\tCOMMAND\tDURATION\tSIZE\tRESULT")
+		}
+		for i, run := range runs {
+			result := "✓ succeeded"
+			if run.Status != "success" {
+				reason, _, _ := strings.Cut(run.Error, "\n")
+				result = "✗ " + reason
+			}
+			started := run.StartedAt.Local().Format("2006-01-02 15:04")
+			if !details {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", started, run.Command, run.Duration().Round(time.Second), units.FormatSize(run.Bytes), result)
+				continue
+			}
+
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s %s, took %s, %s\n", started, run.Command, run.Duration().Round(time.Second), units.FormatSize(run.Bytes))
+			for _, loc := range run.Locations {
+				fmt.Fprintf(w, "  %s\t%s\t%s\n", loc.Location, units.FormatSize(loc.Size), loc.Status)
+			}
+			if run.Status == "success" {
+				fmt.Fprintf(w, "  %s\n", result)
+			} else {
+				fmt.Fprintf(w, "  ✗ %s\n", strings.ReplaceAll(run.Error, "\n", "\n  "))
+			}
+			for _, warning := range run.Warnings {
+				fmt.Fprintf(w, "  ⚠ %s\n", strings.ReplaceAll(warning, "\n", "\n  "))
+			}
+		}
+		w.Flush()
+
+	},
+}
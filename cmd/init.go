@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+// commonLocations are offered by init, with whether they are selected by default
+var commonLocations = []struct {
+	path     string
+	selected bool
+}{
+	{"~/Documents", true},
+	{"~/Desktop", true},
+	{"~/Pictures", false},
+	{"~/Movies", false},
+}
+
+// devLocations are the usual names of folders with source code
+var devLocations = []string{"~/Developer", "~/dev", "~/Projects", "~/code", "~/src"}
+
+func init() {
+
+	// Init-Command Flags
+	initCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path of the config file to write")
+	initCmd.Flags().BoolP("force", "f", false, "Overwrite an existing config file")
+	initCmd.Flags().BoolP("yes", "y", false, "Accept the suggested answers without asking")
+
+	rootCmd.AddCommand(initCmd)
+
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create a config file by answering a few questions",
+	Long: `Walk through the common locations, app modules and the output target, and
+write a commented config file to start from.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		configPath, err := macup.NormalizePath(cmd.Flag("config").Value.String())
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(configPath); err == nil && cmd.Flag("force").Value.String() != "true" {
+			fmt.Fprintf(cmd.OutOrStdout(), "A config file exists at %s already, use --force to overwrite it\n", configPath)
+			os.Exit(1)
+		}
+
+		p := prompter{reader: bufio.NewReader(os.Stdin), out: cmd.OutOrStdout(), yes: cmd.Flag("yes").Value.String() == "true"}
+		var opts macup.InitOptions
+
+		fmt.Fprintln(cmd.OutOrStdout(), "Locations to back up:")
+		for _, loc := range commonLocations {
+			if exists(loc.path) && p.confirm("  "+loc.path, loc.selected) {
+				opts.Locations = append(opts.Locations, loc.path)
+			}
+		}
+		for _, path := range devLocations {
+			if exists(path) && p.confirm("  "+path+" (without build output)", true) {
+				opts.DevLocations = append(opts.DevLocations, path)
+			}
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), "Apps to set up again on restore:")
+		opts.Homebrew = p.confirm("  Homebrew packages", apps.Installed("brew"))
+		opts.Mas = p.confirm("  App Store apps", apps.Installed("mas"))
+		opts.VSCode = p.confirm("  VS Code", apps.Installed("code"))
+		opts.SSH = p.confirm("  SSH keys and config", exists("~/.ssh"))
+		opts.Fonts = p.confirm("  Fonts", true)
+
+		// Suggest the presets of the installed apps
+		if scanned, err := apps.ScanApps(); err == nil {
+			for _, app := range scanned {
+				if app.Preset != "" && !slices.Contains(opts.Presets, app.Preset) {
+					opts.Presets = append(opts.Presets, app.Preset)
+				}
+			}
+		}
+		if len(opts.Presets) > 0 && !p.confirm("  Settings of "+strings.Join(opts.Presets, ", "), true) {
+			opts.Presets = nil
+		}
+
+		// External volumes are used by name, so they are found wherever they mount
+		volumes := externalVolumes()
+		suggestion := "~/Backups/macup"
+		if len(volumes) > 0 {
+			suggestion = volumes[0]
+		}
+		if len(volumes) > 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), "External volumes: %s\n", strings.Join(volumes, ", "))
+		}
+		output := p.ask("Where should backups go? Volume name, path or URL", suggestion)
+		switch {
+		case slices.Contains(volumes, output):
+			opts.OutputVolume = output
+		case storage.IsRemote(output):
+			opts.Output = output
+		default:
+			// Output paths are taken as they are, without expanding ~
+			if opts.Output, err = macup.NormalizePath(output); err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				os.Exit(1)
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(configPath, macup.RenderConfig(opts), 0644); err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		if _, err := macup.LoadConfig(configPath); err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "The written config is invalid, please edit %s:\n%v\n", configPath, err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "\n✓ Config written to %s\n", configPath)
+		fmt.Fprintln(cmd.OutOrStdout(), "  Review it, then run `macup create` for the first backup")
+
+	},
+}
+
+// prompter asks questions on the terminal
+type prompter struct {
+	reader *bufio.Reader
+	out    io.Writer
+	yes    bool // Take the suggested answers
+}
+
+// confirm asks a yes/no question, enter takes the suggestion
+func (p prompter) confirm(question string, suggestion bool) bool {
+	hint := "[y/N]"
+	if suggestion {
+		hint = "[Y/n]"
+	}
+	if p.yes {
+		fmt.Fprintf(p.out, "%s? %s %t\n", question, hint, suggestion)
+		return suggestion
+	}
+
+	fmt.Fprintf(p.out, "%s? %s ", question, hint)
+	line, _ := p.reader.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return suggestion
+	}
+}
+
+// ask asks for a value, enter takes the suggestion
+func (p prompter) ask(question, suggestion string) string {
+	if p.yes {
+		fmt.Fprintf(p.out, "%s [%s]\n", question, suggestion)
+		return suggestion
+	}
+
+	fmt.Fprintf(p.out, "%s [%s]: ", question, suggestion)
+	line, _ := p.reader.ReadString('\n')
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return suggestion
+}
+
+// exists reports whether a path, which may start with ~/, exists
+func exists(path string) bool {
+	path, err := macup.NormalizePath(path)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// externalVolumes returns the names of the mounted volumes other than the
+// startup disk
+func externalVolumes() []string {
+	entries, _ := os.ReadDir("/Volumes")
+	volumes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		// The startup disk is a symlink to /
+		if entry.Type()&os.ModeSymlink == 0 && entry.IsDir() {
+			volumes = append(volumes, entry.Name())
+		}
+	}
+	return volumes
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	rootCmd.AddCommand(inspectCmd)
+
+}
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <archive>",
+	Short: "Show where an archive comes from and what it contains",
+	Long: `Read an archive file without extracting it and show the metadata macup
+embedded in it (the location and source path it was created from, the host
+and time), the number of files, its compressed and uncompressed size, the
+compression and whether it is encrypted. Useful for a bare archive without
+the rest of its backup.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		inspection, err := macup.Inspect(args[0])
+		if err != nil {
+			exit(err)
+		}
+		if tui.JSONEnabled() {
+			tui.WriteJSON(inspection)
+			return
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Archive\t%s\n", inspection.Path)
+		if m := inspection.Metadata; m != nil {
+			location := m.Location
+			if m.Name != "" {
+				location = fmt.Sprintf("%s (%s)", m.Name, m.Location)
+			}
+			fmt.Fprintf(w, "Location\t%s\n", location)
+			fmt.Fprintf(w, "Source\t%s\n", m.Source)
+			fmt.Fprintf(w, "Created\t%s on %s\n", m.CreatedAt.Local().Format("2006-01-02 15:04"), m.Hostname)
+		} else if !inspection.Encrypted {
+			fmt.Fprintf(w, "Location\tunknown, the archive holds no metadata\n")
+		}
+
+		if inspection.Encrypted {
+			fmt.Fprintf(w, "Encrypted\tyes, with age\n")
+			fmt.Fprintf(w, "Size\t%s\n", units.FormatSize(inspection.CompressedSize))
+			w.Flush()
+			fmt.Fprintln(os.Stderr, "\n⚠ Decrypt the archive to see its contents")
+			return
+		}
+		fmt.Fprintf(w, "Compression\t%s\n", inspection.Compression)
+		fmt.Fprintf(w, "Encrypted\tno\n")
+		fmt.Fprintf(w, "Files\t%d, %s, %s\n", inspection.Files, plural(inspection.Dirs, "dir"), plural(inspection.Symlinks, "symlink"))
+		fmt.Fprintf(w, "Size\t%s compressed, %s uncompressed\n", units.FormatSize(inspection.CompressedSize), units.FormatSize(inspection.UncompressedSize))
+		w.Flush()
+
+	},
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// List-Command Flags
+	listCmd.Flags().StringP("backup", "b", "", "Path, URL (https, s3, webdav, sftp) or rclone remote of the backup (required)")
+	listCmd.Flags().Bool("files", false, "List the files of the archives, all of them or those given by archive or location")
+	listCmd.Flags().StringP("config", "c", "", "Config file to read storage credentials from")
+
+	listCmd.MarkFlagRequired("backup")
+
+	listCmd.RegisterFlagCompletionFunc("backup", completeBackups)
+	listCmd.ValidArgsFunction = completeArchives
+
+	rootCmd.AddCommand(listCmd)
+
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list [archive or location...]",
+	Short: "List the archives of a backup and the files inside them",
+	Long: `List the archives of a backup with their location and size. With --files the
+entries of the archives are listed with their size and modification time,
+read from the archives without extracting them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		backupDir := cmd.Flag("backup").Value.String()
+		opts := storageOptions(cmd)
+
+		archives, err := macup.ListArchives(backupDir, opts)
+		if err != nil {
+			exit(err)
+		}
+
+		// With --json the archives are printed as one array, files one per line
+		if cmd.Flag("files").Value.String() != "true" {
+			if tui.JSONEnabled() {
+				tui.WriteJSON(archives)
+				return
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			for _, archive := range archives {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", archive.Archive, units.FormatSize(archive.Size), archive.Location)
+			}
+			w.Flush()
+			return
+		}
+
+		// Entries are printed while the archives are read
+		if len(args) == 0 {
+			for _, archive := range archives {
+				args = append(args, archive.Archive)
+			}
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		for _, archive := range args {
+			err := macup.ListFiles(backupDir, archive, opts, func(file macup.FileInfo) error {
+				if tui.JSONEnabled() {
+					return tui.WriteJSON(file)
+				}
+				name := file.Name
+				if file.Link != "" {
+					name += " -> " + file.Link
+				}
+				_, err := fmt.Fprintf(w, "%s\t%s\t%s\n", units.FormatSize(file.Size), file.ModTime.Local().Format("2006-01-02 15:04"), name)
+				return err
+			})
+			w.Flush()
+			if err != nil {
+				exit(err)
+			}
+		}
+
+	},
+}
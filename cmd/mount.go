@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Mount-Command Flags
+	mountCmd.Flags().StringP("config", "c", "", "Config file to read storage credentials from")
+
+	mountCmd.ValidArgsFunction = completeBackups
+
+	rootCmd.AddCommand(mountCmd)
+
+}
+
+var mountCmd = &cobra.Command{
+	Use:   "mount <backup> <mountpoint>",
+	Short: "Mount a backup read-only to browse it in Finder",
+	Long: `Mount a backup as a read-only FUSE volume, with a folder for every archive, so
+single files can be browsed and copied in Finder without extracting anything.
+Mounting needs macFUSE (https://macfuse.github.io) on macOS. Files are streamed
+out of their archive when they are opened. Press Ctrl+C or eject the volume to
+unmount.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		opts := storageOptions(cmd)
+		ctx := interruptContext()
+
+		mountPoint, err := macup.NormalizePath(args[1])
+		if err != nil {
+			exit(err)
+		}
+		if err := os.MkdirAll(mountPoint, 0755); err != nil {
+			exit(err)
+		}
+
+		backupFS, err := macup.NewBackupFS(args[0], opts)
+		if err != nil {
+			exit(err)
+		}
+		mount, err := backupFS.Mount(mountPoint)
+		if err != nil {
+			exit(errors.Join(err, backupFS.Close()))
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "✓ Mounted %s read-only at %s, press Ctrl+C to unmount\n", backupFS, mountPoint)
+
+		select {
+		case <-ctx.Done():
+		case <-mount.Done():
+		}
+
+		// Unmounted before the streams are closed, so no file is read from
+		// a closed stream
+		if err := errors.Join(mount.Unmount(), backupFS.Close()); err != nil {
+			exit(err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "\n✓ Backup unmounted")
+
+	},
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Prune-Command Flags
+	pruneCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	pruneCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+	pruneCmd.Flags().StringArrayP("output", "o", nil, "Output path of the backup, repeat for multiple targets")
+	pruneCmd.Flags().Bool("dry-run", false, "Only show what would be removed and how much space it takes")
+
+	pruneCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	rootCmd.AddCommand(pruneCmd)
+
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove archives the last backup no longer needs",
+	Long: `Remove what the last backup left behind in the outputs: archives of locations
+that were removed from the config or renamed, and partial files and unfinished
+S3 uploads of interrupted runs. Run it with --dry-run first to see what would be removed and how much
+space it frees. Outputs without a manifest are skipped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		config, err := macup.LoadProfile(cmd.Flag("config").Value.String(), cmd.Flag("profile").Value.String())
+		if err != nil {
+			exit(err)
+		}
+
+		if cmd.Flag("output").Changed {
+			config.Output, _ = cmd.Flags().GetStringArray("output")
+		}
+
+		dryRun := cmd.Flag("dry-run").Value.String() == "true"
+		candidates, err := macup.Prune(config, dryRun)
+		if tui.JSONEnabled() {
+			tui.WriteJSON(candidates)
+		} else {
+			printPrune(cmd.OutOrStdout(), candidates, dryRun)
+		}
+		if err != nil {
+			exit(err)
+		}
+
+	},
+}
+
+// printPrune lists the removed objects and the space they took
+func printPrune(out io.Writer, candidates []macup.PruneCandidate, dryRun bool) {
+	if len(candidates) == 0 {
+		fmt.Fprintln(out, "✓ Nothing to prune")
+		return
+	}
+
+	var total int64
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OUTPUT\tOBJECT\tSIZE\tREASON")
+	for _, c := range candidates {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Target, c.Name, units.FormatSize(c.Size), c.Reason)
+		total += c.Size
+	}
+	w.Flush()
+
+	if dryRun {
+		fmt.Fprintf(out, "\nWould reclaim %s, run without --dry-run to remove %s\n", units.FormatSize(total), plural(len(candidates), "object"))
+		return
+	}
+	fmt.Fprintf(out, "\n✓ Removed %s, reclaimed %s\n", plural(len(candidates), "object"), units.FormatSize(total))
+}
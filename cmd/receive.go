@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/hinkolas/macup/internal/peer"
+	"github.com/hinkolas/macup/internal/server"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func init() {
+
+	// Receive-Command Flags
+	receiveCmd.Flags().StringP("output", "o", "~/macup-received", "Directory to store the received backup in")
+	receiveCmd.Flags().StringP("listen", "l", ":0", "Address to listen on (random port by default)")
+	receiveCmd.Flags().Bool("no-restore", false, "Only store the received backup without restoring it")
+
+	rootCmd.AddCommand(receiveCmd)
+
+}
+
+var receiveCmd = &cobra.Command{
+	Use:   "receive",
+	Short: "Receive a backup from another Mac on the local network and restore it",
+	Long: `Wait for a backup sent by 'macup send' on another Mac in the same network.
+The receiver is announced via Bonjour and secured with TLS. The pairing code
+shown here has to be entered on the sending Mac.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		store, err := macup.NormalizePath(cmd.Flag("output").Value.String())
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		cert, code, err := peer.NewCertificate()
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), "Can't create certificate:", err)
+			os.Exit(1)
+		}
+
+		srv, err := server.New(store, peer.NormalizeCode(code))
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		// The manifest is written last, so it marks the end of the transfer
+		received := make(chan string, 1)
+		srv.Stored = func(name, object string) {
+			if object == "manifest.json" {
+				received <- name
+			}
+		}
+
+		listener, err := net.Listen("tcp", cmd.Flag("listen").Value.String())
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		hostname, _ := os.Hostname()
+		stop, err := peer.Advertise("macup on "+hostname, port)
+		if err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "⚠ %v, the sender has to pass --to %s:%d\n", err, hostname, port)
+		} else {
+			defer stop()
+		}
+
+		httpServer := &http.Server{
+			Handler:   srv,
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		}
+		go func() {
+			if err := httpServer.ServeTLS(listener, "", ""); err != http.ErrServerClosed {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				os.Exit(1)
+			}
+		}()
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Waiting for a backup on %s:%d\n", hostname, port)
+		fmt.Fprintf(cmd.OutOrStdout(), "Pairing code: %s\n", code)
+		fmt.Fprintln(cmd.OutOrStdout(), "Run 'macup send' on the old Mac and enter the code there.")
+
+		name := <-received
+		httpServer.Shutdown(context.Background())
+		fmt.Fprintf(cmd.OutOrStdout(), "✓ Received backup of %s\n", name)
+
+		if cmd.Flag("no-restore").Value.String() == "true" {
+			fmt.Fprintln(cmd.OutOrStdout(), "Restore it later with: macup restore --backup", filepath.Join(store, name))
+			return
+		}
+
+		var opts macup.RestoreOptions
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			opts.PickApps = promptSkipApps(cmd.OutOrStdout())
+		}
+		if err := macup.Restore(interruptContext(), filepath.Join(store, name), opts); err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+	},
+}
@@ -1,22 +1,46 @@
 package cmd
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
-	"github.com/hinkolas/macup/internal/backup"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"github.com/hinkolas/macup/pkg/macup"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func init() {
 
 	// Restore-Command Flags
-	restoreCmd.Flags().BoolP("debug", "d", false, "Enable debug mode")
-	restoreCmd.Flags().StringP("backup", "b", "", "Path to the backup directory (required)")
+	restoreCmd.Flags().StringP("backup", "b", "", "Path, URL (https, s3, webdav, sftp) or rclone remote of the backup (required)")
+	restoreCmd.Flags().Bool("wait", false, "Wait for archives in cold storage to be retrieved")
+	restoreCmd.Flags().Bool("tools", false, "Reinstall the globally installed npm, pip, gem, cargo and go packages")
+	restoreCmd.Flags().Bool("tweaks", false, "Apply the system tweaks of the config")
+	restoreCmd.Flags().StringSlice("only", nil, "Only restore these modules, e.g. data,apps")
+	restoreCmd.Flags().StringSlice("skip", nil, "Don't restore these modules, e.g. defaults")
+	restoreCmd.Flags().StringSlice("location", nil, "Only restore these data locations, by name or path, e.g. Projects")
+	restoreCmd.Flags().BoolP("interactive", "i", false, "Pick the locations and modules to restore from a list")
+	restoreCmd.Flags().IntP("jobs", "j", 4, "Number of archives extracted at the same time")
+	restoreCmd.Flags().String("target", "", "Restore the data and dotfiles below this directory instead of their original paths")
+	restoreCmd.Flags().StringP("config", "c", "", "Config file to read storage credentials from")
 
 	// Mark backup flag as required
 	restoreCmd.MarkFlagRequired("backup")
 
+	restoreCmd.RegisterFlagCompletionFunc("backup", completeBackups)
+	restoreCmd.RegisterFlagCompletionFunc("only", completeModules)
+	restoreCmd.RegisterFlagCompletionFunc("skip", completeModules)
+	restoreCmd.RegisterFlagCompletionFunc("location", completeLocations)
+
 	rootCmd.AddCommand(restoreCmd)
 
 }
@@ -24,25 +48,135 @@ func init() {
 var restoreCmd = &cobra.Command{
 	Use:   "restore",
 	Short: "Restore a backup from the specified directory",
-	Long: `Restore a backup from a directory containing the backup archives and config.yaml.
-The restore command will read the config.yaml from the backup directory and extract
-each archive to its original location as specified in the config.`,
+	Long: `Restore a backup from a directory containing the backup archives and the config.
+The restore command will read the config (config.yaml, .json or .toml) from the backup
+directory and extract each archive to its original location as specified in the config.
+
+With --target the archives are extracted below another directory instead, paths in
+the home directory keep their path relative to it, e.g. ~/Documents is restored to
+<target>/Documents. Combine it with --only data,dotfiles to leave the apps alone.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		backupDir := cmd.Flag("backup").Value.String()
 
-		// Check if backup directory exists
-		if _, err := os.Stat(backupDir); os.IsNotExist(err) {
-			fmt.Printf("Backup directory not found: %s\n", backupDir)
-			os.Exit(1)
+		// Check if backup directory exists (remote backups are checked on open)
+		if _, err := os.Stat(backupDir); !storage.IsRemote(backupDir) && os.IsNotExist(err) {
+			exit(fmt.Errorf("Backup directory not found: %s", backupDir))
 		}
 
+		only, _ := cmd.Flags().GetStringSlice("only")
+		skip, _ := cmd.Flags().GetStringSlice("skip")
+		locations, _ := cmd.Flags().GetStringSlice("location")
+		jobs, _ := cmd.Flags().GetInt("jobs")
+
 		// Restore the backup
-		err := backup.Restore(backupDir)
+		opts := macup.RestoreOptions{
+			WaitForRetrieval: cmd.Flag("wait").Value.String() == "true",
+			Tools:            cmd.Flag("tools").Value.String() == "true",
+			Tweaks:           cmd.Flag("tweaks").Value.String() == "true",
+			Modules:          macup.ModuleFilter{Only: only, Skip: skip},
+			Locations:        locations,
+			Target:           cmd.Flag("target").Value.String(),
+			Jobs:             jobs,
+			Storage:          storageOptions(cmd),
+		}
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			opts.PickApps = promptSkipApps(cmd.OutOrStdout())
+		}
+		if cmd.Flag("interactive").Value.String() == "true" {
+			picked, err := pickRestore(backupDir, &opts)
+			if err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				os.Exit(1)
+			}
+			if !picked {
+				fmt.Fprintln(cmd.OutOrStdout(), "Nothing to restore")
+				return
+			}
+		}
+
+		err := macup.Restore(interruptContext(), backupDir, opts)
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			exit(err)
 		}
+		tui.Emit(tui.Event{Event: "complete"})
 
 	},
 }
+
+// pickRestore lets the user pick the locations and modules to restore and
+// reports whether anything was picked. Everything is selected at first.
+func pickRestore(backupDir string, opts *macup.RestoreOptions) (bool, error) {
+	choices, err := macup.RestoreChoices(backupDir, opts.Storage)
+	if err != nil {
+		return false, err
+	}
+
+	var items []tui.PickerItem
+	for i, choice := range choices {
+		if i == 0 && choice.Location {
+			items = append(items, tui.PickerItem{Label: "Locations", Header: true})
+		}
+		if !choice.Location && (i == 0 || choices[i-1].Location) {
+			items = append(items, tui.PickerItem{Label: "Modules", Header: true})
+		}
+		item := tui.PickerItem{Label: choice.Name, Selected: true}
+		if choice.Size > 0 {
+			item.Detail = units.FormatSize(choice.Size)
+		}
+		items = append(items, item)
+	}
+
+	items, err = tui.Pick("Pick what to restore from "+backupDir, items)
+	if errors.Is(err, tui.ErrCanceled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	opts.Locations, opts.Modules = nil, macup.ModuleFilter{}
+	selected := slices.DeleteFunc(items, func(item tui.PickerItem) bool { return item.Header })
+	for i, item := range selected {
+		if !item.Selected {
+			continue
+		}
+		if choices[i].Location {
+			opts.Locations = append(opts.Locations, choices[i].Name)
+		} else {
+			opts.Modules.Only = append(opts.Modules.Only, choices[i].Name)
+		}
+	}
+	if len(opts.Locations) > 0 {
+		opts.Modules.Only = append(opts.Modules.Only, "data")
+	}
+	return len(opts.Modules.Only) > 0, nil
+}
+
+// promptSkipApps lets the user deselect App Store apps that shouldn't be
+// reinstalled, asking on w, see RestoreOptions.PickApps
+func promptSkipApps(w io.Writer) func(list []macup.AppStoreApp) []macup.AppStoreApp {
+	return func(list []macup.AppStoreApp) []macup.AppStoreApp {
+		fmt.Fprintln(w, "App Store apps to reinstall:")
+		for i, app := range list {
+			fmt.Fprintf(w, "  %2d) %s\n", i+1, app.Name)
+		}
+		fmt.Fprint(w, "Numbers of apps to skip (separated by spaces, enter for none): ")
+
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		skip := make(map[int]bool)
+		for _, field := range strings.Fields(line) {
+			if n, err := strconv.Atoi(field); err == nil {
+				skip[n-1] = true
+			}
+		}
+
+		selected := make([]macup.AppStoreApp, 0, len(list))
+		for i, app := range list {
+			if !skip[i] {
+				selected = append(selected, app)
+			}
+		}
+		return selected
+	}
+}
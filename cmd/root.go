@@ -1,10 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/hinkolas/macup/internal/logging"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/pkg/macup"
 	"github.com/spf13/cobra"
 )
 
@@ -15,14 +26,130 @@ var rootCmd = &cobra.Command{
 	Long: `A Go-powered CLI to back up and restore your macOS setup.
 	Define folders, excludes, apps, dev tools, and system tweaks in a single
 	YAML config to then recreate a clean, personalized Mac in minutes.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+
+		level := logging.LevelDefault
+		switch {
+		case cmd.Flag("quiet").Value.String() == "true":
+			level = logging.LevelQuiet
+		case cmd.Flag("verbose").Value.String() == "true", cmd.Flag("debug").Value.String() == "true":
+			level = logging.LevelVerbose
+		}
+		logging.Setup(level)
+
+		// NO_COLOR turns colors off unless --color=always
+		if err := tui.SetColor(cmd.Flag("color").Value.String()); err != nil {
+			exit(err)
+		}
+
+		// Without a terminal progress is logged every so often instead
+		interval, _ := cmd.Flags().GetDuration("progress-interval")
+		tui.SetPlainInterval(interval)
+
+		// Only JSON goes to stdout, everything else to stderr
+		if cmd.Flag("json").Value.String() == "true" {
+			tui.EnableJSON(cmd.OutOrStdout())
+			cmd.Root().SetOut(cmd.ErrOrStderr())
+		}
+
+	},
+}
+
+func init() {
+
+	rootCmd.PersistentFlags().Bool("json", false, "Print JSON on stdout: events for create and restore, documents for list, status and doctor")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only print errors, e.g. when run by cron")
+	rootCmd.PersistentFlags().Bool("verbose", false, "Log every file and how long each step took, instead of drawing progress")
+	rootCmd.PersistentFlags().BoolP("debug", "d", false, "Same as --verbose")
+	rootCmd.PersistentFlags().String("color", "auto", "When to color output: auto (on a terminal unless NO_COLOR is set), always or never")
+	rootCmd.PersistentFlags().Duration("progress-interval", 30*time.Second, "How often progress is logged when not on a terminal, e.g. under launchd or piped into tee")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "debug")
+
+}
+
+// exit prints an error and exits with status 1, or 130 if the run was
+// canceled, with an error event in JSON mode
+func exit(err error) {
+	tui.Emit(tui.Event{Event: "error", Error: err.Error()})
+	fmt.Fprintln(stdout(), err)
+	if errors.Is(err, context.Canceled) {
+		os.Exit(130)
+	}
+	os.Exit(1)
+}
+
+// stdout is where human output outside of commands goes, stderr with --json
+// like that of the commands, see PersistentPreRun
+func stdout() io.Writer {
+	if tui.JSONEnabled() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// storageOptions returns the storage credentials of the config given with
+// --config, without one they come from the environment
+func storageOptions(cmd *cobra.Command) storage.Options {
+	opts, err := loadStorageOptions(cmd)
+	if err != nil {
+		exit(err)
+	}
+	return opts
+}
+
+// loadStorageOptions is storageOptions returning the error of the config,
+// e.g. for completions that must not exit
+func loadStorageOptions(cmd *cobra.Command) (storage.Options, error) {
+	flag := cmd.Flag("config")
+	if flag == nil || flag.Value.String() == "" {
+		return storage.Options{}, nil
+	}
+	config, err := macup.LoadConfig(flag.Value.String())
+	if err != nil {
+		return storage.Options{}, err
+	}
+	return config.StorageOptions(), nil
+}
+
+// cancelRun cancels the context of interruptContext, nil until a command
+// asked for one
+var cancelRun atomic.Pointer[context.CancelFunc]
+
+// handleInterrupts handles Ctrl+C and SIGTERM for the whole process. The
+// first cancels the context of interruptContext if there is one, the second
+// or one without a context puts the terminal back and quits right away.
+func handleInterrupts() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		if cancel := cancelRun.Load(); cancel != nil {
+			(*cancel)()
+			<-sigChan
+		}
+		tui.RestoreTerminal()
+		os.Exit(130) // Standard exit code for Ctrl+C
+	}()
+}
+
+// interruptContext returns a context canceled by Ctrl+C or SIGTERM, so a
+// backup or restore stops cleanly and keeps what it completed. A second
+// Ctrl+C quits right away.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelRun.Store(&cancel)
+	return ctx
 }
 
 // Execute adds all child commands to the root command and sets flags.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 
+	handleInterrupts()
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Printf("Error: %v\n", err)
+		fmt.Fprintf(stdout(), "Error: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/launchd"
+	"github.com/hinkolas/macup/internal/notify"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+// scheduleLabel is the launchd label of the scheduled backup agent
+const scheduleLabel = "com.hinkolas.macup.schedule"
+
+func init() {
+
+	// Schedule-Command Flags
+	scheduleCmd.Flags().String("daily", "", "Back up every day at this time, e.g. 02:00")
+	scheduleCmd.Flags().Bool("unschedule", false, "Remove the scheduled backup")
+	scheduleCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	scheduleCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+	scheduleCmd.Flags().Bool("run-at-load", false, "Also back up when the agent is loaded, e.g. at login")
+	scheduleCmd.Flags().Bool("skip-on-battery", false, "Skip scheduled backups while the Mac runs on battery power")
+	scheduleCmd.Flags().String("log", "~/Library/Logs/macup/schedule.log", "File the output of scheduled backups is written to")
+	scheduleCmd.Flags().String("error-log", "", "File errors of scheduled backups are written to, the log if empty")
+	scheduleCmd.MarkFlagsMutuallyExclusive("daily", "unschedule")
+	scheduleCmd.MarkFlagsOneRequired("daily", "unschedule")
+	scheduleCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	// Schedule-Run-Command Flags
+	scheduleRunCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	scheduleRunCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+	scheduleRunCmd.Flags().Bool("skip-on-battery", false, "Skip the backup while the Mac runs on battery power")
+
+	scheduleCmd.AddCommand(scheduleRunCmd)
+	rootCmd.AddCommand(scheduleCmd)
+
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Back up on a schedule with a LaunchAgent",
+	Long: `Install a LaunchAgent that runs "macup create" every day at the given time.
+Backups missed while the Mac was asleep run once it wakes up. Run the command
+again to change the schedule, or with --unschedule to remove it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if cmd.Flag("unschedule").Value.String() == "true" {
+			if err := launchd.Uninstall(scheduleLabel); err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "✓ Scheduled backup removed")
+			return
+		}
+
+		daily, err := time.Parse("15:04", cmd.Flag("daily").Value.String())
+		if err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Invalid time %q, expected e.g. 02:00\n", cmd.Flag("daily").Value.String())
+			os.Exit(1)
+		}
+
+		// Local configs are resolved now, launchd doesn't start in the
+		// current directory
+		configPath := cmd.Flag("config").Value.String()
+		if !macup.IsRemoteConfig(configPath) {
+			if configPath, err = macup.NormalizePath(configPath); err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				os.Exit(1)
+			}
+			if configPath, err = filepath.Abs(configPath); err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				os.Exit(1)
+			}
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Can't determine the macup executable: %v\n", err)
+			os.Exit(1)
+		}
+
+		logPath, err := macup.NormalizePath(cmd.Flag("log").Value.String())
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+		errorLogPath := logPath
+		if cmd.Flag("error-log").Value.String() != "" {
+			if errorLogPath, err = macup.NormalizePath(cmd.Flag("error-log").Value.String()); err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				os.Exit(1)
+			}
+		}
+		os.MkdirAll(filepath.Dir(logPath), 0755)
+		os.MkdirAll(filepath.Dir(errorLogPath), 0755)
+
+		arguments := []string{executable, "schedule", "run", "--config", configPath}
+		if profile := cmd.Flag("profile").Value.String(); profile != "" {
+			arguments = append(arguments, "--profile", profile)
+		}
+		if cmd.Flag("skip-on-battery").Value.String() == "true" {
+			arguments = append(arguments, "--skip-on-battery")
+		}
+
+		agent := launchd.Agent{
+			Label:             scheduleLabel,
+			ProgramArguments:  arguments,
+			RunAtLoad:         cmd.Flag("run-at-load").Value.String() == "true",
+			StartCalendar:     &launchd.CalendarInterval{Hour: daily.Hour(), Minute: daily.Minute()},
+			StandardOutPath:   logPath,
+			StandardErrorPath: errorLogPath,
+		}
+		if err := launchd.Install(agent); err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "✓ macup will back up every day at %s\n", daily.Format("15:04"))
+		fmt.Fprintf(cmd.OutOrStdout(), "  Logs are written to %s\n", logPath)
+
+	},
+}
+
+var scheduleRunCmd = &cobra.Command{
+	Use:    "run",
+	Short:  "Run a scheduled backup (called by launchd)",
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if cmd.Flag("skip-on-battery").Value.String() == "true" && apps.OnBattery() {
+			fmt.Fprintln(cmd.OutOrStdout(), "Skipping the scheduled backup on battery power")
+			return
+		}
+
+		configPath := cmd.Flag("config").Value.String()
+		config, err := macup.LoadProfile(configPath, cmd.Flag("profile").Value.String())
+		if err != nil {
+			notify.Notify("macup", "Scheduled backup failed: can't load config")
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		config.Notify.Desktop = cmp.Or(config.Notify.Desktop, macup.NotifyAlways)
+		if err := macup.Create(interruptContext(), config, configPath, macup.ModuleFilter{}); err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(exitCode(err))
+		}
+
+	},
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hinkolas/macup/internal/peer"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Send-Command Flags
+	sendCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	sendCmd.Flags().StringP("to", "t", "", "Address of the receiver (found via Bonjour by default)")
+	sendCmd.Flags().String("code", "", "Pairing code shown by the receiver (asked for by default)")
+
+	rootCmd.AddCommand(sendCmd)
+
+}
+
+var sendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "Send a backup directly to another Mac on the local network",
+	Long: `Create a backup and stream it straight to a Mac running 'macup receive',
+without an external drive in between. The receiver is found via Bonjour and
+verified with the pairing code it shows.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		configPath := cmd.Flag("config").Value.String()
+		config, err := macup.LoadConfig(configPath)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		stdin := bufio.NewReader(os.Stdin)
+
+		address := cmd.Flag("to").Value.String()
+		if address == "" {
+			fmt.Fprintln(cmd.OutOrStdout(), "Looking for receivers...")
+			peers, err := peer.Discover(3 * time.Second)
+			if err != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), err)
+				os.Exit(1)
+			}
+
+			switch len(peers) {
+			case 0:
+				fmt.Fprintln(cmd.OutOrStdout(), "No receiver found. Run 'macup receive' on the new Mac or pass --to.")
+				os.Exit(1)
+			case 1:
+				address = peers[0].Address()
+			default:
+				for i, p := range peers {
+					fmt.Fprintf(cmd.OutOrStdout(), "  %d) %s (%s)\n", i+1, p.Name, p.Address())
+				}
+				fmt.Fprint(cmd.OutOrStdout(), "Send to: ")
+				line, _ := stdin.ReadString('\n')
+				choice, err := strconv.Atoi(strings.TrimSpace(line))
+				if err != nil || choice < 1 || choice > len(peers) {
+					fmt.Fprintln(cmd.OutOrStdout(), "Invalid choice")
+					os.Exit(1)
+				}
+				address = peers[choice-1].Address()
+			}
+		}
+
+		code := cmd.Flag("code").Value.String()
+		if code == "" {
+			fmt.Fprint(cmd.OutOrStdout(), "Pairing code shown on the new Mac: ")
+			code, _ = stdin.ReadString('\n')
+		}
+		code = peer.NormalizeCode(code)
+
+		// Send everything, straight to the receiver only
+		hostname, _ := os.Hostname()
+		config.Output = []string{"macup://" + address + "/" + hostname}
+		config.OutputVolume = ""
+		config.EjectAfter = false
+		config.SkipUnchanged = false
+		config.Server = storage.ServerOptions{Token: code, Fingerprint: code}
+
+		if err := macup.Create(interruptContext(), config, configPath, macup.ModuleFilter{}); err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+	},
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/hinkolas/macup/internal/server"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Serve-Command Flags
+	serveCmd.Flags().StringP("listen", "l", ":8443", "Address to listen on")
+	serveCmd.Flags().StringP("store", "s", "", "Directory to store the received backups in (required)")
+	serveCmd.Flags().String("token", "", "Token clients have to send (default $MACUP_SERVER_TOKEN)")
+	serveCmd.Flags().String("tls-cert", "", "TLS certificate file")
+	serveCmd.Flags().String("tls-key", "", "TLS private key file")
+
+	serveCmd.MarkFlagRequired("store")
+
+	rootCmd.AddCommand(serveCmd)
+
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Receive and store backups from other Macs",
+	Long: `Run a small HTTP server that stores the backups of several Macs in one place.
+Every Mac backs up to its own backup on the server by using an output like
+macup://server.local:8443/macbook (macup+http:// without TLS) and the same token.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		token := cmd.Flag("token").Value.String()
+		if token == "" {
+			token = os.Getenv("MACUP_SERVER_TOKEN")
+		}
+
+		store, err := macup.NormalizePath(cmd.Flag("store").Value.String())
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		srv, err := server.New(store, token)
+		if err != nil {
+			fmt.Fprintln(cmd.OutOrStdout(), err)
+			os.Exit(1)
+		}
+
+		listen := cmd.Flag("listen").Value.String()
+		cert, key := cmd.Flag("tls-cert").Value.String(), cmd.Flag("tls-key").Value.String()
+
+		if cert != "" && key != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "✓ Serving backups in %s on https://%s\n", store, listen)
+			err = http.ListenAndServeTLS(listen, cert, key, srv)
+		} else {
+			fmt.Fprintln(cmd.OutOrStdout(), "⚠ No TLS certificate given, tokens and backups are sent unencrypted")
+			fmt.Fprintf(cmd.OutOrStdout(), "✓ Serving backups in %s on http://%s\n", store, listen)
+			err = http.ListenAndServe(listen, srv)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), err)
+		os.Exit(1)
+
+	},
+}
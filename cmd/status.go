@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Status-Command Flags
+	statusCmd.Flags().StringP("config", "c", "~/.config/macup/config.yaml", "Path or URL (https, git+ssh) of the config file")
+	statusCmd.Flags().StringP("profile", "p", "", "Apply a profile of the config, instead of the one picked by hostname")
+	statusCmd.Flags().StringArrayP("output", "o", nil, "Output path of the backup, repeat for multiple targets")
+
+	statusCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+
+	rootCmd.AddCommand(statusCmd)
+
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show when each location was backed up last",
+	Long: `Show when each location of the config was backed up last and how large its
+archive is, along with the free space of the outputs. Locations that were
+never backed up are pointed out.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		config, err := macup.LoadProfile(cmd.Flag("config").Value.String(), cmd.Flag("profile").Value.String())
+		if err != nil {
+			exit(err)
+		}
+
+		if cmd.Flag("output").Changed {
+			config.Output, _ = cmd.Flags().GetStringArray("output")
+		}
+
+		status := config.Status()
+		if tui.JSONEnabled() {
+			tui.WriteJSON(status)
+			return
+		}
+
+		if daemon := status.Daemon; daemon != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "Daemon running since %s", ago(daemon.StartedAt))
+			if !daemon.NextRun.IsZero() {
+				fmt.Fprintf(cmd.OutOrStdout(), ", next backup at %s", daemon.NextRun.Local().Format("2006-01-02 15:04"))
+			}
+			if daemon.Watching {
+				fmt.Fprint(cmd.OutOrStdout(), ", watching for changes")
+			}
+			fmt.Fprintln(cmd.OutOrStdout())
+			if daemon.Waiting != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "  Backup postponed, %s\n", daemon.Waiting)
+			}
+			if daemon.LastError != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "  Last backup failed: %s\n", daemon.LastError)
+			}
+			fmt.Fprintln(cmd.OutOrStdout())
+		}
+
+		for _, output := range status.Outputs {
+			switch {
+			case output.Error != "":
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", output.Target, output.Error)
+				continue
+			case output.LastBackup.IsZero():
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: no backup yet", output.Target)
+			default:
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: last backup %s", output.Target, ago(output.LastBackup))
+			}
+			if output.Free >= 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), ", %s free", units.FormatSize(output.Free))
+			}
+			fmt.Fprintln(cmd.OutOrStdout())
+		}
+		fmt.Fprintln(cmd.OutOrStdout())
+
+		never := 0
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "LOCATION\tLAST BACKUP\tSIZE")
+		for _, loc := range status.Locations {
+			switch {
+			case !loc.LastBackup.IsZero():
+				fmt.Fprintf(w, "%s\t%s\t%s\n", loc.Location, ago(loc.LastBackup), units.FormatSize(loc.Size))
+			case loc.Missing:
+				fmt.Fprintf(w, "%s\tnot on this Mac\t-\n", loc.Location)
+			default:
+				fmt.Fprintf(w, "%s\tnever\t-\n", loc.Location)
+				never++
+			}
+		}
+		w.Flush()
+
+		if never > 0 {
+			fmt.Fprintf(os.Stderr, "\n⚠ %d of %d locations were never backed up\n", never, len(status.Locations))
+		}
+
+	},
+}
+
+// ago formats a time relative to now, e.g. "3 hours ago (2024-05-01 14:03)"
+func ago(t time.Time) string {
+	d := time.Since(t)
+	var relative string
+	switch {
+	case d < time.Minute:
+		relative = "just now"
+	case d < time.Hour:
+		relative = plural(int(d.Minutes()), "minute") + " ago"
+	case d < 24*time.Hour:
+		relative = plural(int(d.Hours()), "hour") + " ago"
+	default:
+		relative = plural(int(d.Hours()/24), "day") + " ago"
+	}
+	return fmt.Sprintf("%s (%s)", relative, t.Local().Format("2006-01-02 15:04"))
+}
+
+// plural formats a count with its unit, e.g. "1 day" or "3 days"
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
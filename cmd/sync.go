@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"github.com/hinkolas/macup/pkg/macup"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+
+	// Sync-Command Flags
+	syncCmd.Flags().StringP("backup", "b", "", "Path, URL or rclone remote of the source backup (required)")
+	syncCmd.Flags().StringP("to", "t", "", "Path, URL or rclone remote of the destination (required)")
+	syncCmd.Flags().StringP("config", "c", "", "Config file to read storage credentials from")
+
+	syncCmd.MarkFlagRequired("backup")
+	syncCmd.MarkFlagRequired("to")
+
+	syncCmd.RegisterFlagCompletionFunc("backup", completeBackups)
+
+	rootCmd.AddCommand(syncCmd)
+
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Replicate a backup to another location",
+	Long: `Copy a backup to another local directory or remote storage (and back).
+Archives that already exist at the destination are skipped, and every copied
+archive is verified against the size and checksum recorded in the manifest.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		err := macup.Sync(cmd.Flag("backup").Value.String(), cmd.Flag("to").Value.String(), storageOptions(cmd))
+		if err != nil {
+			exit(err)
+		}
+
+	},
+}
@@ -0,0 +1,59 @@
+package apps
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Config selects the apps whose setup is captured alongside the data
+type Config struct {
+	Presets  []string        `yaml:"presets"` // Settings of popular apps, e.g. "iterm2" or "raycast"
+	Homebrew HomebrewOptions `yaml:"homebrew"`
+	Mas      MasOptions      `yaml:"mas"`
+	VSCode   VSCodeOptions   `yaml:"vscode"`
+	Packages PackagesOptions `yaml:"packages"` // Global npm, pip, gem, cargo and go packages
+	Runtimes RuntimesOptions `yaml:"runtimes"` // Versions installed with asdf, mise, nvm and pyenv
+	Browsers BrowsersOptions `yaml:"browsers"` // Safari, Chrome and Firefox profiles
+	Network  NetworkOptions  `yaml:"network"`  // Wi-Fi networks, VPNs and network locations
+	SSH      SSHOptions      `yaml:"ssh"`      // SSH config, known hosts and keys
+	Jobs     JobsOptions     `yaml:"jobs"`     // Crontab and LaunchAgents
+	Mail     MailOptions     `yaml:"mail"`     // Mail accounts, rules and signatures
+	Printers PrintersOptions `yaml:"printers"` // CUPS printer queues and their drivers
+	Keyboard KeyboardOptions `yaml:"keyboard"` // Shortcuts, input sources and text replacements
+	Docker   DockerOptions   `yaml:"docker"`   // Image list and selected volumes
+}
+
+// lookPath finds an executable, also in the Homebrew prefixes which aren't
+// on the PATH of launchd jobs
+func lookPath(name string) (string, bool) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, true
+	}
+	for _, prefix := range []string{"/opt/homebrew/bin", "/usr/local/bin"} {
+		path := filepath.Join(prefix, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Running reports whether a process with the exact name is running, e.g. "Photos"
+func Running(process string) bool {
+	return exec.Command("pgrep", "-x", process).Run() == nil
+}
+
+// Installed reports whether a command line tool is installed, e.g. "brew"
+func Installed(name string) bool {
+	_, ok := lookPath(name)
+	return ok
+}
+
+// OnBattery reports whether the Mac runs on battery power. Macs without a
+// battery and failing checks count as on AC power.
+func OnBattery() bool {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	return err == nil && strings.Contains(string(out), "'Battery Power'")
+}
@@ -0,0 +1,443 @@
+package apps
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/klauspost/pgzip"
+)
+
+// BrowsersArchive is the name of the archive holding the browser profiles
+const BrowsersArchive = "browsers.tar.gz"
+
+// BrowsersOptions configures the browser profile module
+type BrowsersOptions struct {
+	Enabled  bool     `yaml:"enabled"`
+	Browsers []string `yaml:"browsers"` // safari, chrome and/or firefox, all installed ones if empty
+}
+
+// browser knows where a browser keeps its profiles
+type browser struct {
+	name       string
+	label      string
+	process    string                                 // Name of the running process
+	dir        string                                 // Relative to the home directory
+	shared     []string                               // Files in dir describing the profiles
+	profiles   func(dir string) ([]string, error)     // Profile directories relative to dir
+	files      []string                               // Files and directories of every profile
+	extensions func(profile string) ([]string, error) // Installed extensions of a profile
+}
+
+var browsers = []browser{
+	{
+		name:    "safari",
+		label:   "Safari",
+		process: "Safari",
+		dir:     "Library/Safari",
+		// Bookmarks.plist also holds the reading list
+		files:      []string{"Bookmarks.plist", "History.db"},
+		profiles:   func(string) ([]string, error) { return []string{"."}, nil },
+		extensions: safariExtensions,
+	},
+	{
+		name:       "chrome",
+		label:      "Google Chrome",
+		process:    "Google Chrome",
+		dir:        "Library/Application Support/Google/Chrome",
+		shared:     []string{"Local State"},
+		profiles:   chromeProfiles,
+		files:      []string{"Bookmarks", "History", "Favicons"},
+		extensions: chromeExtensions,
+	},
+	{
+		name:       "firefox",
+		label:      "Firefox",
+		process:    "firefox",
+		dir:        "Library/Application Support/Firefox",
+		shared:     []string{"profiles.ini", "installs.ini"},
+		profiles:   firefoxProfiles,
+		files:      []string{"places.sqlite", "favicons.sqlite", "extensions.json", "extensions"},
+		extensions: firefoxExtensions,
+	},
+}
+
+// sqliteFile reports whether a profile file is a SQLite database
+func sqliteFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".db", ".sqlite":
+		return true
+	}
+	return name == "History" || name == "Favicons"
+}
+
+// running reports whether the browser is running
+func (b browser) running() bool {
+	return Running(b.process)
+}
+
+// selectedBrowsers returns the browsers the options apply to
+func selectedBrowsers(names []string) ([]browser, error) {
+	if len(names) == 0 {
+		return browsers, nil
+	}
+	list := make([]browser, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(browsers, func(b browser) bool { return b.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown browser %q, expected safari, chrome or firefox", name)
+		}
+		list = append(list, browsers[i])
+	}
+	return list, nil
+}
+
+// BackupBrowsers archives the bookmarks, reading list, history and
+// extensions of every selected browser and returns the installed extensions
+// by browser. Browsers that aren't installed are skipped, unless they were
+// selected explicitly.
+func BackupBrowsers(store storage.Storage, opts BrowsersOptions) (map[string][]string, error) {
+	list, err := selectedBrowsers(opts.Browsers)
+	if err != nil {
+		return nil, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "macup-browsers")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	w, err := store.Create(BrowsersArchive)
+	if err != nil {
+		return nil, err
+	}
+	gzipWriter := pgzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	abort := func(err error) (map[string][]string, error) {
+		tarWriter.Close()
+		gzipWriter.Close()
+		w.Abort()
+		return nil, err
+	}
+
+	extensions := make(map[string][]string)
+	for _, b := range list {
+		dir := filepath.Join(home, b.dir)
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			if len(opts.Browsers) == 0 {
+				continue
+			}
+			return abort(fmt.Errorf("%s is not installed", b.label))
+		} else if errors.Is(err, fs.ErrPermission) {
+			return abort(fmt.Errorf("no access to %s, grant macup Full Disk Access in System Settings", dir))
+		}
+
+		// Profile files first, the shared files name the profiles
+		profiles, err := b.profiles(dir)
+		if err != nil {
+			return abort(fmt.Errorf("failed to list %s profiles: %w", b.label, err))
+		}
+		paths := slices.Clone(b.shared)
+		for _, profile := range profiles {
+			for _, file := range b.files {
+				paths = append(paths, filepath.Join(profile, file))
+			}
+		}
+
+		installed := make([]string, 0)
+		for _, profile := range profiles {
+			ids, err := b.extensions(filepath.Join(dir, profile))
+			if err != nil {
+				return abort(fmt.Errorf("failed to list %s extensions: %w", b.label, err))
+			}
+			for _, id := range ids {
+				if !slices.Contains(installed, id) {
+					installed = append(installed, id)
+				}
+			}
+		}
+		extensions[b.name] = installed
+
+		for _, path := range paths {
+			src := filepath.Join(dir, path)
+			if _, err := os.Stat(src); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if sqliteFile(path) {
+				snapshot := filepath.Join(tmp, b.name+"-"+strings.ReplaceAll(path, "/", "-"))
+				if err := snapshotSQLite(src, snapshot); err != nil {
+					if b.running() {
+						return abort(fmt.Errorf("failed to copy %s while %s is running, quit it and try again: %w", path, b.label, err))
+					}
+					return abort(fmt.Errorf("failed to copy %s: %w", src, err))
+				}
+				src = snapshot
+			}
+			if err := addToArchive(tarWriter, src, filepath.Join(b.dir, path)); err != nil {
+				return abort(fmt.Errorf("failed to archive %s: %w", path, err))
+			}
+		}
+	}
+
+	if err := errors.Join(tarWriter.Close(), gzipWriter.Close()); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return extensions, nil
+}
+
+// snapshotSQLite copies a database with the SQLite backup API, which is safe
+// while the browser has it open
+func snapshotSQLite(src, dst string) error {
+	out, err := exec.Command("sqlite3", "-readonly", src, ".backup '"+strings.ReplaceAll(dst, "'", "''")+"'").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sqlite3: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// addToArchive adds a file or directory tree under name to the archive
+func addToArchive(w *tar.Writer, src, name string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(name, rel))
+		hdr.Format = tar.FormatPAX
+		if err := w.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(w, file)
+		return err
+	})
+}
+
+// RestoreBrowsers puts the archived profiles of the named browsers back in
+// place. The browsers have to be closed, they would overwrite the files.
+func RestoreBrowsers(store storage.Storage, names []string) error {
+	list, err := selectedBrowsers(names)
+	if err != nil {
+		return err
+	}
+	for _, b := range list {
+		if b.running() {
+			return fmt.Errorf("%s is running, quit it before restoring its profile", b.label)
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	r, err := store.Open(BrowsersArchive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	gzipReader, err := pgzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		// Only paths inside the profile directories are accepted
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) || !slices.ContainsFunc(list, func(b browser) bool {
+			return strings.HasPrefix(name, filepath.FromSlash(b.dir)+string(filepath.Separator))
+		}) {
+			return fmt.Errorf("illegal file path in archive: %s", header.Name)
+		}
+		path := filepath.Join(home, name)
+
+		if header.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		_, err = io.Copy(file, tarReader)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+
+		// Journals of the replaced database would corrupt the restored one
+		if sqliteFile(filepath.Base(path)) {
+			os.Remove(path + "-wal")
+			os.Remove(path + "-shm")
+			os.Remove(path + "-journal")
+		}
+	}
+}
+
+// ExtensionHint returns how an extension that isn't part of the restored
+// profile can be reinstalled, or an empty string if the profile includes it
+func ExtensionHint(browser, id string) string {
+	switch browser {
+	case "chrome":
+		return "https://chromewebstore.google.com/detail/" + id
+	case "safari":
+		return id + " (comes with its app from the App Store)"
+	}
+	return ""
+}
+
+// chromeProfiles lists the profile directories of Chrome
+func chromeProfiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() && (entry.Name() == "Default" || strings.HasPrefix(entry.Name(), "Profile ")) {
+			profiles = append(profiles, entry.Name())
+		}
+	}
+	return profiles, nil
+}
+
+// chromeExtensions lists the ids of the extensions installed in a profile
+func chromeExtensions(profile string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(profile, "Extensions"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && len(entry.Name()) == 32 {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
+
+// firefoxProfiles lists the profile directories of Firefox
+func firefoxProfiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, "Profiles"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			profiles = append(profiles, filepath.Join("Profiles", entry.Name()))
+		}
+	}
+	return profiles, nil
+}
+
+// firefoxExtensions lists the add-ons the user installed into a profile
+func firefoxExtensions(profile string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(profile, "extensions.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Addons []struct {
+			ID       string `json:"id"`
+			Location string `json:"location"`
+		} `json:"addons"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode extensions.json: %w", err)
+	}
+	ids := make([]string, 0)
+	for _, addon := range result.Addons {
+		if addon.Location == "app-profile" {
+			ids = append(ids, addon.ID)
+		}
+	}
+	return ids, nil
+}
+
+// safariExtensions lists the Safari web extensions registered with the system
+func safariExtensions(string) ([]string, error) {
+	out, err := exec.Command("pluginkit", "-m", "-p", "com.apple.Safari.web-extension").Output()
+	if err != nil {
+		return nil, nil // pluginkit is missing outside of macOS
+	}
+	ids := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		// Lines look like "+    com.example.extension(1.2)"
+		line = strings.TrimSpace(strings.TrimLeft(line, "+-=!? "))
+		if id, _, ok := strings.Cut(line, "("); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,176 @@
+package apps
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// DefaultsDomain selects a preferences domain, or only some of its keys
+type DefaultsDomain struct {
+	Domain string   `yaml:"domain"` // e.g. "com.apple.dock" or "NSGlobalDomain"
+	Keys   []string `yaml:"keys"`   // Only these keys, the whole domain if empty
+	// Domains of app presets are skipped if the app isn't installed
+	optional bool
+}
+
+// defaultsServices maps domains to the processes that only pick up changes
+// after a restart
+var defaultsServices = map[string]string{
+	"com.apple.dock":            "Dock",
+	"com.apple.finder":          "Finder",
+	"com.apple.systemuiserver":  "SystemUIServer",
+	"com.apple.screencapture":   "SystemUIServer",
+	"com.apple.menuextra.clock": "SystemUIServer",
+}
+
+// objectName returns the name of the object holding the exported domain
+func (d DefaultsDomain) objectName() string {
+	if len(d.Keys) == 0 {
+		return "defaults-" + d.Domain + ".plist"
+	}
+	return "defaults-" + d.Domain + ".keys.json"
+}
+
+// BackupDefaults exports the selected preferences domains into the backup
+func BackupDefaults(store storage.Storage, domains []DefaultsDomain) error {
+	for _, d := range domains {
+		data, err := exec.Command("defaults", "export", d.Domain, "-").Output()
+		if err != nil && d.optional {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("defaults export %s: %w", d.Domain, err)
+		}
+
+		// Keep only the selected keys, as plist fragments defaults can write back
+		if len(d.Keys) > 0 {
+			values, err := plistValues(data, d.Keys)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", d.Domain, err)
+			}
+			if data, err = json.MarshalIndent(values, "", "  "); err != nil {
+				return err
+			}
+		}
+
+		w, err := store.Create(d.objectName())
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			w.Abort()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestoreDefaults applies the preferences domains stored in the backup and
+// restarts the processes they belong to
+func RestoreDefaults(store storage.Storage, domains []DefaultsDomain) error {
+	var restart []string
+	for _, d := range domains {
+		r, err := store.Open(d.objectName())
+		if errors.Is(err, fs.ErrNotExist) && d.optional {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		if len(d.Keys) == 0 {
+			cmd := exec.Command("defaults", "import", d.Domain, "-")
+			cmd.Stdin = bytes.NewReader(data)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("defaults import %s: %s", d.Domain, strings.TrimSpace(string(out)))
+			}
+		} else {
+			var values map[string]string
+			if err := json.Unmarshal(data, &values); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", d.objectName(), err)
+			}
+			for key, value := range values {
+				if out, err := exec.Command("defaults", "write", d.Domain, key, value).CombinedOutput(); err != nil {
+					return fmt.Errorf("defaults write %s %s: %s", d.Domain, key, strings.TrimSpace(string(out)))
+				}
+			}
+		}
+
+		if service, ok := defaultsServices[d.Domain]; ok && !slices.Contains(restart, service) {
+			restart = append(restart, service)
+		}
+	}
+
+	// The processes are relaunched by launchd right away
+	for _, service := range restart {
+		exec.Command("killall", service).Run()
+	}
+
+	return nil
+}
+
+// plistValues returns the raw XML of the values of the given keys in the
+// top-level dictionary of an XML property list. Missing keys are left out.
+func plistValues(data []byte, keys []string) (map[string]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	values := make(map[string]string)
+
+	depth := 0
+	key := ""
+	for {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			// Depth 3 are the keys and values of the top-level <plist><dict>
+			if depth != 3 {
+				continue
+			}
+			if t.Name.Local == "key" {
+				var name string
+				if err := decoder.DecodeElement(&name, &t); err != nil {
+					return nil, err
+				}
+				depth--
+				key = name
+				continue
+			}
+			if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+			depth--
+			if slices.Contains(keys, key) {
+				values[key] = string(data[start:decoder.InputOffset()])
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
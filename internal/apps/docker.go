@@ -0,0 +1,161 @@
+package apps
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/klauspost/pgzip"
+)
+
+// dockerHelper is the image that reads and writes the volumes
+const dockerHelper = "busybox"
+
+// DockerOptions configures the Docker module. It works with every engine
+// the docker CLI talks to, e.g. Docker Desktop, OrbStack or colima.
+type DockerOptions struct {
+	Enabled bool     `yaml:"enabled"`
+	Volumes []string `yaml:"volumes"` // Volumes to export, only the image list is kept if empty
+}
+
+// Docker lists what was captured from Docker
+type Docker struct {
+	Images  []string `json:"images"`
+	Volumes []string `json:"volumes"`
+}
+
+// dockerBin finds the docker CLI, OrbStack keeps it in its own directory
+func dockerBin() (string, error) {
+	if bin, ok := lookPath("docker"); ok {
+		return bin, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		bin := filepath.Join(home, ".orbstack", "bin", "docker")
+		if _, err := os.Stat(bin); err == nil {
+			return bin, nil
+		}
+	}
+	return "", errors.New("docker not found")
+}
+
+// volumeObject returns the name of the object holding a volume
+func volumeObject(volume string) string {
+	return "docker-" + volume + ".tar.gz"
+}
+
+// BackupDocker records the pulled images and exports the selected volumes
+// into the backup. The engine has to be running.
+func BackupDocker(store storage.Storage, opts DockerOptions) (*Docker, error) {
+	bin, err := dockerBin()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := output(bin, "image", "ls", "--format", "{{.Repository}}:{{.Tag}}")
+	if err != nil {
+		return nil, err
+	}
+	docker := &Docker{Images: make([]string, 0), Volumes: make([]string, 0)}
+	for _, image := range lines(out) {
+		// Dangling images can't be pulled again
+		if !strings.Contains(image, "<none>") && !slices.Contains(docker.Images, image) {
+			docker.Images = append(docker.Images, image)
+		}
+	}
+
+	for _, volume := range opts.Volumes {
+		if err := backupVolume(store, bin, volume); err != nil {
+			return nil, fmt.Errorf("failed to export volume %s: %w", volume, err)
+		}
+		docker.Volumes = append(docker.Volumes, volume)
+	}
+
+	return docker, nil
+}
+
+// backupVolume streams a tarball of a volume, created in a throwaway
+// container, into a compressed object
+func backupVolume(store storage.Storage, bin, volume string) error {
+	if err := run(bin, "volume", "inspect", volume); err != nil {
+		return err
+	}
+
+	w, err := store.Create(volumeObject(volume))
+	if err != nil {
+		return err
+	}
+	gzipWriter := pgzip.NewWriter(w)
+
+	cmd := exec.Command(bin, "run", "--rm", "-v", volume+":/data:ro", dockerHelper, "tar", "-C", "/data", "-cf", "-", ".")
+	cmd.Stdout = gzipWriter
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil && stderr.Len() > 0 {
+		err = errors.New(lastLine([]byte(stderr.String())))
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if err != nil {
+		gzipWriter.Close()
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// RestoreDockerVolume creates a volume and fills it with the exported
+// contents. Existing volumes are kept, it returns whether it was created.
+func RestoreDockerVolume(store storage.Storage, volume string) (bool, error) {
+	bin, err := dockerBin()
+	if err != nil {
+		return false, err
+	}
+	if run(bin, "volume", "inspect", volume) == nil {
+		return false, nil
+	}
+
+	r, err := store.Open(volumeObject(volume))
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	gzipReader, err := pgzip.NewReader(r)
+	if err != nil {
+		return false, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	if err := run(bin, "volume", "create", volume); err != nil {
+		return false, err
+	}
+	cmd := exec.Command(bin, "run", "--rm", "-i", "-v", volume+":/data", dockerHelper, "tar", "-C", "/data", "-xf", "-")
+	cmd.Stdin = gzipReader
+	if out, err := cmd.CombinedOutput(); err != nil {
+		// A half-filled volume would be kept by the next restore
+		run(bin, "volume", "rm", volume)
+		if len(out) == 0 {
+			return false, err
+		}
+		return false, errors.New(lastLine(out))
+	}
+	return true, nil
+}
+
+// PullImage pulls an image
+func PullImage(image string) error {
+	bin, err := dockerBin()
+	if err != nil {
+		return err
+	}
+	if out, err := exec.Command(bin, "pull", "-q", image).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", image, lastLine(out))
+	}
+	return nil
+}
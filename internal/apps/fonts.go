@@ -0,0 +1,176 @@
+package apps
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/klauspost/pgzip"
+)
+
+// FontsArchive is the name of the archive holding the fonts
+const FontsArchive = "fonts.tar.gz"
+
+// systemFontsDir holds the fonts installed for all users
+const systemFontsDir = "/Library/Fonts"
+
+// userFontsDir returns the fonts directory of the user
+func userFontsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Fonts"), nil
+}
+
+// BackupFonts archives the fonts of the user. With system, fonts added to
+// /Library/Fonts are included, except those that come with macOS.
+func BackupFonts(store storage.Storage, system bool) error {
+	dir, err := userFontsDir()
+	if err != nil {
+		return err
+	}
+
+	w, err := store.Create(FontsArchive)
+	if err != nil {
+		return err
+	}
+	gzipWriter := pgzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	abort := func(err error) error {
+		tarWriter.Close()
+		gzipWriter.Close()
+		w.Abort()
+		return err
+	}
+
+	if _, err := os.Stat(dir); err == nil {
+		if err := addToArchive(tarWriter, dir, "user"); err != nil {
+			return abort(fmt.Errorf("failed to archive %s: %w", dir, err))
+		}
+	}
+
+	if system {
+		entries, err := os.ReadDir(systemFontsDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return abort(err)
+		}
+		for _, entry := range entries {
+			path := filepath.Join(systemFontsDir, entry.Name())
+			if appleFont(path) {
+				continue
+			}
+			if err := addToArchive(tarWriter, path, filepath.Join("system", entry.Name())); err != nil {
+				return abort(fmt.Errorf("failed to archive %s: %w", path, err))
+			}
+		}
+	}
+
+	if err := errors.Join(tarWriter.Close(), gzipWriter.Close()); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// appleFont reports whether a font was installed by a macOS package
+func appleFont(path string) bool {
+	out, err := exec.Command("pkgutil", "--file-info", path).Output()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if id, ok := strings.CutPrefix(line, "pkgid: "); ok && strings.HasPrefix(id, "com.apple.") {
+			return true
+		}
+	}
+	return false
+}
+
+// RestoreFonts installs the fonts of the backup and refreshes the font cache.
+// Fonts of /Library/Fonts go to the user's fonts if it isn't writable. It
+// returns the number of installed fonts, fonts already present are skipped.
+func RestoreFonts(store storage.Storage) (int, error) {
+	userDir, err := userFontsDir()
+	if err != nil {
+		return 0, err
+	}
+	systemDir := systemFontsDir
+	if syscall.Access(systemDir, 0x2) != nil { // Not writable (W_OK) without admin rights
+		systemDir = userDir
+	}
+
+	r, err := store.Open(FontsArchive)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	gzipReader, err := pgzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	installed := 0
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return installed, fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		kind, name, _ := strings.Cut(header.Name, "/")
+		name = filepath.FromSlash(name)
+		if header.Typeflag != tar.TypeReg || name == "" {
+			continue
+		}
+		var path string
+		switch {
+		case !filepath.IsLocal(name):
+			return installed, fmt.Errorf("illegal file path in archive: %s", header.Name)
+		case kind == "user":
+			path = filepath.Join(userDir, name)
+		case kind == "system":
+			path = filepath.Join(systemDir, name)
+		default:
+			return installed, fmt.Errorf("illegal file path in archive: %s", header.Name)
+		}
+
+		if info, err := os.Stat(path); err == nil && info.Size() == header.Size {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return installed, err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return installed, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		_, err = io.Copy(file, tarReader)
+		file.Close()
+		if err != nil {
+			return installed, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		installed++
+	}
+
+	// New fonts only show up in running apps once the cache is rebuilt
+	if installed > 0 {
+		exec.Command("atsutil", "databases", "-removeUser").Run()
+		exec.Command("atsutil", "server", "-shutdown").Run()
+		exec.Command("atsutil", "server", "-ping").Run()
+	}
+
+	return installed, nil
+}
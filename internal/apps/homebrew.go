@@ -0,0 +1,178 @@
+package apps
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// BrewfileName is the name of the Brewfile object inside a backup
+const BrewfileName = "Brewfile"
+
+// homebrewInstaller is the official Homebrew install script
+const homebrewInstaller = "https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh"
+
+// HomebrewOptions configures the Homebrew module
+type HomebrewOptions struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// BackupHomebrew dumps all taps, formulae, casks and App Store apps into a
+// Brewfile inside the backup. App Store apps are left out with skipMas, when
+// the mas module takes care of them.
+func BackupHomebrew(store storage.Storage, skipMas bool) error {
+	brew, ok := lookPath("brew")
+	if !ok {
+		return errors.New("brew not found")
+	}
+
+	dir, err := os.MkdirTemp("", "macup-brew")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	brewfile := filepath.Join(dir, BrewfileName)
+	out, err := exec.Command(brew, "bundle", "dump", "--force", "--file="+brewfile).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("brew bundle dump: %s", strings.TrimSpace(string(out)))
+	}
+
+	data, err := os.ReadFile(brewfile)
+	if err != nil {
+		return err
+	}
+	if skipMas {
+		lines := strings.Split(string(data), "\n")
+		lines = slices.DeleteFunc(lines, func(line string) bool { return strings.HasPrefix(line, "mas ") })
+		data = []byte(strings.Join(lines, "\n"))
+	}
+
+	w, err := store.Create(BrewfileName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// InstallHomebrew runs the official installer if brew is missing. It is
+// interactive, since the installer asks for an administrator password.
+func InstallHomebrew() error {
+	if _, ok := lookPath("brew"); ok {
+		return nil
+	}
+
+	slog.Info("Homebrew is not installed, running the Homebrew installer...")
+	cmd := exec.Command("/bin/bash", "-c", `/bin/bash -c "$(curl -fsSL `+homebrewInstaller+`)"`)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to install Homebrew: %w", err)
+	}
+
+	if _, ok := lookPath("brew"); !ok {
+		return errors.New("brew not found after installing Homebrew")
+	}
+	return nil
+}
+
+// RestoreHomebrew installs everything listed in the Brewfile of the backup.
+// progress is called with the fraction of processed entries and the entry
+// being worked on. Entries that fail don't stop the others.
+func RestoreHomebrew(store storage.Storage, progress func(done float64, entry string)) error {
+	brew, ok := lookPath("brew")
+	if !ok {
+		return errors.New("brew not found")
+	}
+
+	r, err := store.Open(BrewfileName)
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	_, err = data.ReadFrom(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read Brewfile: %w", err)
+	}
+
+	total := countBrewfileEntries(data.Bytes())
+
+	dir, err := os.MkdirTemp("", "macup-brew")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	brewfile := filepath.Join(dir, BrewfileName)
+	if err := os.WriteFile(brewfile, data.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(brew, "bundle", "install", "--file="+brewfile)
+	cmd.Env = append(os.Environ(), "HOMEBREW_NO_AUTO_UPDATE=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start brew bundle: %w", err)
+	}
+
+	// brew bundle reports every entry on its own line
+	processed := 0
+	var failed []string
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasSuffix(line, "has failed!") {
+			failed = append(failed, line)
+			continue
+		}
+		for _, prefix := range []string{"Using ", "Installing ", "Upgrading ", "Tapping ", "Skipping "} {
+			if entry, ok := strings.CutPrefix(line, prefix); ok {
+				processed++
+				if total > 0 {
+					progress(min(float64(processed)/float64(total), 1), entry)
+				}
+				break
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if len(failed) > 0 {
+			return fmt.Errorf("brew bundle: %s", strings.Join(failed, ", "))
+		}
+		return fmt.Errorf("brew bundle: %w", err)
+	}
+
+	progress(1, "")
+	return nil
+}
+
+// countBrewfileEntries counts the installable entries of a Brewfile
+func countBrewfileEntries(data []byte) int {
+	count := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		kind, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch kind {
+		case "tap", "brew", "cask", "mas", "vscode", "whalebrew":
+			count++
+		}
+	}
+	return count
+}
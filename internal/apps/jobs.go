@@ -0,0 +1,175 @@
+package apps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/launchd"
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// JobsName is the name of the object holding the scheduled jobs
+const JobsName = "jobs.json"
+
+// macupLabel prefixes the labels of macup's own agents, they are set up by
+// macup itself rather than restored
+const macupLabel = "com.hinkolas.macup."
+
+// JobsOptions configures the module for scheduled jobs
+type JobsOptions struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// LaunchAgent is a user launchd job
+type LaunchAgent struct {
+	Label    string `json:"label"`
+	File     string `json:"file"`  // Name of the plist in ~/Library/LaunchAgents
+	Plist    []byte `json:"plist"` // May be a binary property list
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// Jobs are the scheduled jobs of a user
+type Jobs struct {
+	Crontab string        `json:"crontab"`
+	Agents  []LaunchAgent `json:"agents"`
+}
+
+// BackupJobs stores the user's crontab and LaunchAgents in the backup
+func BackupJobs(store storage.Storage) error {
+	jobs := Jobs{Agents: make([]LaunchAgent, 0)}
+
+	// crontab fails if the user has none
+	if out, err := exec.Command("crontab", "-l").Output(); err == nil {
+		jobs.Crontab = string(out)
+	}
+
+	dir, err := launchd.Dir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(entries) > 0 {
+		disabled, err := launchd.Disabled()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) != ".plist" {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			label := agentLabel(path)
+			if strings.HasPrefix(label, macupLabel) {
+				continue
+			}
+			jobs.Agents = append(jobs.Agents, LaunchAgent{
+				Label:    label,
+				File:     entry.Name(),
+				Plist:    data,
+				Disabled: disabled[label],
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := store.Create(JobsName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// agentLabel reads the label of a LaunchAgent, which is usually but not
+// necessarily the name of its plist
+func agentLabel(path string) string {
+	out, err := exec.Command("plutil", "-extract", "Label", "raw", "-o", "-", path).Output()
+	if label := strings.TrimSpace(string(out)); err == nil && label != "" {
+		return label
+	}
+	return strings.TrimSuffix(filepath.Base(path), ".plist")
+}
+
+// RestoreJobs installs the crontab and LaunchAgents of the backup. Agents
+// that were disabled stay disabled and aren't loaded. It returns the number
+// of restored agents.
+func RestoreJobs(store storage.Storage) (int, error) {
+	r, err := store.Open(JobsName)
+	if err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return 0, err
+	}
+	var jobs Jobs
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return 0, fmt.Errorf("failed to decode %s: %w", JobsName, err)
+	}
+
+	var errs []error
+	if strings.TrimSpace(jobs.Crontab) != "" {
+		cmd := exec.Command("crontab", "-")
+		cmd.Stdin = strings.NewReader(jobs.Crontab)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to install crontab: %s", lastLine(out)))
+		}
+	}
+
+	dir, err := launchd.Dir()
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, agent := range jobs.Agents {
+		if filepath.Base(agent.File) != agent.File || filepath.Ext(agent.File) != ".plist" {
+			errs = append(errs, fmt.Errorf("invalid LaunchAgent file name %q", agent.File))
+			continue
+		}
+		path := filepath.Join(dir, agent.File)
+		if err := os.WriteFile(path, agent.Plist, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write %s: %w", path, err))
+			continue
+		}
+
+		if err := launchd.SetEnabled(agent.Label, !agent.Disabled); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !agent.Disabled {
+			if err := launchd.Load(path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to load %s: %w", agent.Label, err))
+				continue
+			}
+		}
+		restored++
+	}
+
+	return restored, errors.Join(errs...)
+}
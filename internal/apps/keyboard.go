@@ -0,0 +1,194 @@
+package apps
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// KeyboardName is the name of the object holding the keyboard settings
+const KeyboardName = "keyboard.json"
+
+// keyboardKeys are the preferences holding shortcuts and input sources by domain
+var keyboardKeys = map[string][]string{
+	"NSGlobalDomain":            {"NSUserKeyEquivalents"}, // App shortcuts for all apps
+	"com.apple.symbolichotkeys": {"AppleSymbolicHotKeys"},
+	"com.apple.HIToolbox":       {"AppleEnabledInputSources", "AppleSelectedInputSources", "AppleCurrentKeyboardLayoutInputSourceID"},
+}
+
+// KeyboardOptions configures the keyboard module
+type KeyboardOptions struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// TextReplacement replaces a shortcut with a phrase while typing
+type TextReplacement struct {
+	Shortcut string `json:"shortcut"`
+	Phrase   string `json:"phrase"`
+}
+
+// Keyboard are the keyboard settings of a user
+type Keyboard struct {
+	Settings         map[string]map[string]string `json:"settings"` // Raw plist values by domain and key
+	TextReplacements []TextReplacement            `json:"text_replacements"`
+}
+
+// BackupKeyboard stores the keyboard shortcuts, input sources and text
+// replacements in the backup
+func BackupKeyboard(store storage.Storage) error {
+	keyboard := Keyboard{Settings: make(map[string]map[string]string), TextReplacements: make([]TextReplacement, 0)}
+
+	// Shortcuts for single apps live in the domains of the apps
+	domains := make(map[string][]string)
+	for domain, keys := range keyboardKeys {
+		domains[domain] = keys
+	}
+	out, err := output("defaults", "domains")
+	if err != nil {
+		return err
+	}
+	for _, domain := range strings.Split(strings.TrimSpace(string(out)), ", ") {
+		if _, ok := domains[domain]; ok || domain == "" {
+			continue
+		}
+		if exec.Command("defaults", "read", domain, "NSUserKeyEquivalents").Run() == nil {
+			domains[domain] = []string{"NSUserKeyEquivalents"}
+		}
+	}
+
+	for domain, keys := range domains {
+		data, err := exec.Command("defaults", "export", domain, "-").Output()
+		if err != nil {
+			continue // Not set on this Mac
+		}
+		values, err := plistValues(data, keys)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", domain, err)
+		}
+		if len(values) > 0 {
+			keyboard.Settings[domain] = values
+		}
+	}
+
+	replacements, err := textReplacements()
+	if err != nil {
+		return err
+	}
+	keyboard.TextReplacements = replacements
+
+	data, err := json.MarshalIndent(keyboard, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := store.Create(KeyboardName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// textReplacements reads the text replacements from the database macOS
+// syncs them with
+func textReplacements() ([]TextReplacement, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	db := filepath.Join(home, "Library", "KeyboardServices", "TextReplacements.db")
+	if _, err := os.Stat(db); errors.Is(err, fs.ErrNotExist) {
+		return make([]TextReplacement, 0), nil
+	}
+
+	out, err := output("sqlite3", "-readonly", "-json", db,
+		"SELECT ZSHORTCUT AS shortcut, ZPHRASE AS phrase FROM ZTEXTREPLACEMENTENTRY WHERE ZWASDELETED = 0 ORDER BY ZSHORTCUT")
+	if err != nil {
+		return nil, err
+	}
+	replacements := make([]TextReplacement, 0)
+	// sqlite3 prints nothing instead of [] without rows
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return replacements, nil
+	}
+	if err := json.Unmarshal(out, &replacements); err != nil {
+		return nil, fmt.Errorf("failed to read text replacements: %w", err)
+	}
+	return replacements, nil
+}
+
+// RestoreKeyboard writes the keyboard shortcuts and input sources of the
+// backup. The text replacements can only be imported in System Settings, so
+// they are written to a plist on the desktop whose path is returned.
+func RestoreKeyboard(store storage.Storage) (string, error) {
+	r, err := store.Open(KeyboardName)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return "", err
+	}
+	var keyboard Keyboard
+	if err := json.Unmarshal(data, &keyboard); err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", KeyboardName, err)
+	}
+
+	for domain, values := range keyboard.Settings {
+		for key, value := range values {
+			if out, err := exec.Command("defaults", "write", domain, key, value).CombinedOutput(); err != nil {
+				return "", fmt.Errorf("defaults write %s %s: %s", domain, key, lastLine(out))
+			}
+		}
+	}
+	// Makes changed system shortcuts take effect without logging out
+	exec.Command("/System/Library/PrivateFrameworks/SystemAdministration.framework/Resources/activateSettings", "-u").Run()
+
+	if len(keyboard.TextReplacements) == 0 {
+		return "", nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(home, "Desktop", "Text Replacements.plist")
+	if err := os.WriteFile(path, textReplacementsPlist(keyboard.TextReplacements), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// textReplacementsPlist renders text replacements in the format System
+// Settings exports and imports them with
+func textReplacementsPlist(replacements []TextReplacement) []byte {
+	escape := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<array>
+`)
+	for _, r := range replacements {
+		fmt.Fprintf(&b, "\t<dict>\n\t\t<key>phrase</key>\n\t\t<string>%s</string>\n\t\t<key>shortcut</key>\n\t\t<string>%s</string>\n\t</dict>\n",
+			escape(r.Phrase), escape(r.Shortcut))
+	}
+	b.WriteString("</array>\n</plist>\n")
+	return []byte(b.String())
+}
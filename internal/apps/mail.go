@@ -0,0 +1,266 @@
+package apps
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/klauspost/pgzip"
+)
+
+// MailArchive is the name of the archive holding the rules and signatures of Mail
+const MailArchive = "mail.tar.gz"
+
+// mailFiles are the files in MailData that hold the rules and signatures
+var mailFiles = []string{"Signatures", "SyncedRules.plist", "UnsyncedRules.plist", "RulesActiveState.plist"}
+
+// MailOptions configures the Mail module
+type MailOptions struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// MailAccount is an account set up in Mail. Passwords stay in the Keychain.
+type MailAccount struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"` // imap, pop, iCloud, ...
+	User   string   `json:"user"`
+	Server string   `json:"server"`
+	Port   int      `json:"port"`
+	SSL    bool     `json:"ssl"`
+	Emails []string `json:"emails"`
+	SMTP   string   `json:"smtp,omitempty"` // Server of the outgoing mail
+}
+
+// Manual reports whether the account has to be added in System Settings,
+// Mail can only create IMAP and POP accounts itself
+func (a MailAccount) Manual() bool {
+	return a.Type != "imap" && a.Type != "pop"
+}
+
+// mailAccountsScript prints one tab separated line per Mail account
+const mailAccountsScript = `set out to ""
+set AppleScript's text item delimiters to ","
+tell application "Mail"
+	repeat with a in every account
+		set smtp to ""
+		try
+			set smtp to server name of delivery account of a
+		end try
+		set out to out & name of a & tab & (account type of a as text) & tab & user name of a & tab & server name of a & tab & port of a & tab & uses ssl of a & tab & (email addresses of a as text) & tab & smtp & linefeed
+	end repeat
+end tell
+return out`
+
+// osascript runs an AppleScript and returns what it prints
+func osascript(script string) ([]byte, error) {
+	out, err := exec.Command("osascript", "-e", script).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("osascript: %s", lastLine(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("osascript: %w", err)
+	}
+	return out, nil
+}
+
+// mailDir returns the data directory of the newest Mail version, e.g.
+// ~/Library/Mail/V10. It is created by Mail on its first launch.
+func mailDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dirs, _ := filepath.Glob(filepath.Join(home, "Library", "Mail", "V*"))
+	if len(dirs) == 0 {
+		return "", fs.ErrNotExist
+	}
+	// V10 sorts before V9
+	slices.SortFunc(dirs, func(a, b string) int {
+		va, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(a), "V"))
+		vb, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(b), "V"))
+		return va - vb
+	})
+	return dirs[len(dirs)-1], nil
+}
+
+// ListMailAccounts returns the accounts set up in Mail. macOS asks to allow
+// controlling Mail the first time.
+func ListMailAccounts() ([]MailAccount, error) {
+	out, err := osascript(mailAccountsScript)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]MailAccount, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 {
+			continue
+		}
+		port, _ := strconv.Atoi(fields[4])
+		account := MailAccount{
+			Name:   fields[0],
+			Type:   fields[1],
+			User:   fields[2],
+			Server: fields[3],
+			Port:   port,
+			SSL:    fields[5] == "true",
+			Emails: make([]string, 0),
+			SMTP:   fields[7],
+		}
+		for _, email := range strings.Split(fields[6], ",") {
+			if email = strings.TrimSpace(email); email != "" {
+				account.Emails = append(account.Emails, email)
+			}
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// BackupMail archives the rules and signatures of Mail. Reading
+// ~/Library/Mail needs Full Disk Access for the terminal.
+func BackupMail(store storage.Storage) error {
+	dir, err := mailDir()
+	if errors.Is(err, fs.ErrNotExist) {
+		return errors.New("no Mail data found, Mail was never opened")
+	}
+	if err != nil {
+		return err
+	}
+	dataDir := filepath.Join(dir, "MailData")
+
+	w, err := store.Create(MailArchive)
+	if err != nil {
+		return err
+	}
+	gzipWriter := pgzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	abort := func(err error) error {
+		tarWriter.Close()
+		gzipWriter.Close()
+		w.Abort()
+		return err
+	}
+
+	for _, name := range mailFiles {
+		path := filepath.Join(dataDir, name)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := addToArchive(tarWriter, path, filepath.Join("MailData", name)); err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				err = fmt.Errorf("%w, grant the terminal Full Disk Access", err)
+			}
+			return abort(fmt.Errorf("failed to archive %s: %w", path, err))
+		}
+	}
+
+	if err := errors.Join(tarWriter.Close(), gzipWriter.Close()); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// RestoreMail puts the archived rules and signatures back in place. Mail has
+// to be closed, it would overwrite them.
+func RestoreMail(store storage.Storage) error {
+	if Running("Mail") {
+		return errors.New("Mail is running, quit it before restoring its rules and signatures")
+	}
+	dir, err := mailDir()
+	if errors.Is(err, fs.ErrNotExist) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(home, "Library", "Mail", "V10")
+	} else if err != nil {
+		return err
+	}
+
+	r, err := store.Open(MailArchive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	gzipReader, err := pgzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) || !strings.HasPrefix(name, "MailData"+string(filepath.Separator)) {
+			return fmt.Errorf("illegal file path in archive: %s", header.Name)
+		}
+		path := filepath.Join(dir, name)
+
+		if header.Typeflag == tar.TypeDir {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		_, err = io.Copy(file, tarReader)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+}
+
+// AddMailAccount creates an IMAP or POP account in Mail. Mail asks for the
+// password when it first connects. Accounts that already exist are skipped.
+func AddMailAccount(account MailAccount) error {
+	emails := make([]string, 0, len(account.Emails))
+	for _, email := range account.Emails {
+		emails = append(emails, strconv.Quote(email))
+	}
+
+	script := fmt.Sprintf(`tell application "Mail"
+	if (count of (every account whose name is %[1]s)) > 0 then return
+	set a to make new %[2]s account with properties {name:%[1]s, user name:%[3]s, server name:%[4]s, port:%[5]d, uses ssl:%[6]t, email addresses:{%[7]s}}
+	try
+		set delivery account of a to first smtp server whose server name is %[8]s
+	end try
+end tell`, strconv.Quote(account.Name), account.Type, strconv.Quote(account.User), strconv.Quote(account.Server),
+		account.Port, account.SSL, strings.Join(emails, ", "), strconv.Quote(account.SMTP))
+
+	if _, err := osascript(script); err != nil {
+		return fmt.Errorf("failed to add %s: %w", account.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package apps
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MasOptions configures the Mac App Store module
+type MasOptions struct {
+	Enabled bool     `yaml:"enabled"`
+	Skip    []string `yaml:"skip"` // Names or ids of apps not to reinstall
+}
+
+// App is an app installed from the Mac App Store
+type App struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// masLine matches a line of `mas list`, e.g. "497799835  Xcode  (15.0)"
+var masLine = regexp.MustCompile(`^\s*(\d+)\s+(.+?)\s+\((.*)\)\s*$`)
+
+// ListAppStoreApps returns all apps installed from the Mac App Store
+func ListAppStoreApps() ([]App, error) {
+	mas, ok := lookPath("mas")
+	if !ok {
+		return nil, errors.New("mas not found, install it with `brew install mas`")
+	}
+
+	out, err := exec.Command(mas, "list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("mas list: %w", err)
+	}
+
+	apps := make([]App, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		match := masLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		id, _ := strconv.ParseInt(match[1], 10, 64)
+		apps = append(apps, App{ID: id, Name: match[2], Version: match[3]})
+	}
+
+	return apps, nil
+}
+
+// Skipped reports whether an app is on the skip list, by name or id
+func (o MasOptions) Skipped(app App) bool {
+	for _, skip := range o.Skip {
+		if strings.EqualFold(skip, app.Name) || skip == strconv.FormatInt(app.ID, 10) {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallMas installs mas through Homebrew if it is missing
+func InstallMas() error {
+	if _, ok := lookPath("mas"); ok {
+		return nil
+	}
+	brew, ok := lookPath("brew")
+	if !ok {
+		return errors.New("mas not found and Homebrew is not available to install it")
+	}
+	if out, err := exec.Command(brew, "install", "mas").CombinedOutput(); err != nil {
+		return fmt.Errorf("brew install mas: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// InstallAppStoreApp installs an app from the Mac App Store. The user has to
+// be signed in to the App Store.
+func InstallAppStoreApp(app App) error {
+	mas, ok := lookPath("mas")
+	if !ok {
+		return errors.New("mas not found")
+	}
+
+	out, err := exec.Command(mas, "install", strconv.FormatInt(app.ID, 10)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", app.Name, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
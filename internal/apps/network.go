@@ -0,0 +1,255 @@
+package apps
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// NetworkName is the name of the object holding the network settings
+const NetworkName = "network.json"
+
+// NetworkOptions configures the network module
+type NetworkOptions struct {
+	Enabled bool `yaml:"enabled"`
+	// Read Wi-Fi passwords from the Keychain. macup doesn't encrypt backups,
+	// they are stored in plain text in network.json, so only use this for
+	// outputs on an encrypted volume.
+	Passwords bool `yaml:"passwords"`
+}
+
+// WifiNetwork is a known Wi-Fi network
+type WifiNetwork struct {
+	SSID     string `json:"ssid"`
+	Password string `json:"password,omitempty"`
+}
+
+// VPN is a configured VPN service
+type VPN struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Network are the network settings of a Mac
+type Network struct {
+	Wifi      []WifiNetwork `json:"wifi"`
+	VPNs      []VPN         `json:"vpns"`
+	Locations []string      `json:"locations"`
+	Location  string        `json:"location"` // Current network location
+}
+
+// wifiDevice returns the interface of the Wi-Fi hardware port, e.g. "en0"
+func wifiDevice() (string, error) {
+	out, err := output("networksetup", "-listallhardwareports")
+	if err != nil {
+		return "", err
+	}
+
+	wifi := false
+	for _, line := range strings.Split(string(out), "\n") {
+		if port, ok := strings.CutPrefix(line, "Hardware Port: "); ok {
+			wifi = port == "Wi-Fi" || port == "AirPort"
+		}
+		if device, ok := strings.CutPrefix(line, "Device: "); ok && wifi {
+			return strings.TrimSpace(device), nil
+		}
+	}
+	return "", errors.New("no Wi-Fi interface found")
+}
+
+// BackupNetwork stores the known Wi-Fi networks, VPN services and network
+// locations in the backup
+func BackupNetwork(store storage.Storage, opts NetworkOptions) error {
+	network := Network{Wifi: make([]WifiNetwork, 0), VPNs: make([]VPN, 0)}
+
+	// Macs without Wi-Fi (e.g. a Mac mini on ethernet) just have no networks
+	if device, err := wifiDevice(); err == nil {
+		out, err := output("networksetup", "-listpreferredwirelessnetworks", device)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			// The networks are indented below a "Preferred networks on en0:" header
+			if !strings.HasPrefix(line, "\t") || strings.TrimSpace(line) == "" {
+				continue
+			}
+			wifi := WifiNetwork{SSID: strings.TrimSpace(line)}
+			if opts.Passwords {
+				wifi.Password = wifiPassword(wifi.SSID)
+			}
+			network.Wifi = append(network.Wifi, wifi)
+		}
+	}
+
+	vpns, err := listVPNs()
+	if err != nil {
+		return err
+	}
+	network.VPNs = vpns
+
+	out, err := output("networksetup", "-listlocations")
+	if err != nil {
+		return err
+	}
+	network.Locations = lines(out)
+	out, err = output("networksetup", "-getcurrentlocation")
+	if err != nil {
+		return err
+	}
+	network.Location = strings.TrimSpace(string(out))
+
+	data, err := json.MarshalIndent(network, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := store.Create(NetworkName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// lines returns the non-empty lines of a command's output
+func lines(out []byte) []string {
+	list := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, line)
+		}
+	}
+	return list
+}
+
+// wifiPassword reads the password of a Wi-Fi network from the Keychain. macOS
+// asks the user to allow every access. Open networks have no password.
+func wifiPassword(ssid string) string {
+	out, err := exec.Command("security", "find-generic-password", "-D", "AirPort network password", "-a", ssid, "-w").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// listVPNs returns the VPN services listed by `scutil --nc list`, e.g.
+// `* (Disconnected)   1E5...  IPSec   "Office"   [IPSec]`
+func listVPNs() ([]VPN, error) {
+	out, err := output("scutil", "--nc", "list")
+	if err != nil {
+		return nil, err
+	}
+
+	vpns := make([]VPN, 0)
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		start := strings.Index(line, `"`)
+		end := strings.LastIndex(line, `"`)
+		if !strings.HasPrefix(line, "*") || start < 0 || end <= start {
+			continue
+		}
+		vpn := VPN{Name: line[start+1 : end]}
+		if open := strings.LastIndex(line, "["); open > end {
+			vpn.Type = strings.Trim(line[open:], "[] ")
+		}
+		vpns = append(vpns, vpn)
+	}
+	return vpns, nil
+}
+
+// RestoreNetwork recreates the network locations and adds the Wi-Fi networks
+// with a known password. It returns the networks and VPNs that have to be
+// set up by hand.
+func RestoreNetwork(store storage.Storage) ([]string, error) {
+	r, err := store.Open(NetworkName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	var network Network
+	if err := json.Unmarshal(data, &network); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", NetworkName, err)
+	}
+
+	var errs []error
+	var manual []string
+
+	// Locations first, Wi-Fi networks are added to the current one
+	out, err := output("networksetup", "-listlocations")
+	if err != nil {
+		return nil, err
+	}
+	existing := lines(out)
+	for _, location := range network.Locations {
+		if slices.Contains(existing, location) {
+			continue
+		}
+		if err := run("networksetup", "-createlocation", location, "populate"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if network.Location != "" {
+		if err := run("networksetup", "-switchtolocation", network.Location); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(network.Wifi) > 0 {
+		device, err := wifiDevice()
+		if err != nil {
+			return nil, err
+		}
+		for i, wifi := range network.Wifi {
+			if wifi.Password == "" {
+				manual = append(manual, "Wi-Fi "+wifi.SSID)
+				continue
+			}
+			// The preferred order of the old Mac is kept. Errors leave out the
+			// command line, it holds the password.
+			cmd := exec.Command("networksetup", "-addpreferredwirelessnetworkatindex", device, wifi.SSID, fmt.Sprint(i), "WPA2", wifi.Password)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to add Wi-Fi %s: %s", wifi.SSID, lastLine(out)))
+			}
+		}
+	}
+
+	// VPNs can only be created from their configuration profiles
+	for _, vpn := range network.VPNs {
+		manual = append(manual, fmt.Sprintf("VPN %s (%s)", vpn.Name, vpn.Type))
+	}
+
+	return manual, errors.Join(errs...)
+}
+
+// hotspotGateway is the router of an iPhone's Personal Hotspot, which always
+// hands out addresses of 172.20.10.0/28
+const hotspotGateway = "172.20.10.1"
+
+// Metered reports whether the Mac is online through a Personal Hotspot, told
+// by its default gateway. Failing checks count as not metered.
+func Metered() bool {
+	out, err := output("route", "-n", "get", "default")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if gateway, ok := strings.CutPrefix(strings.TrimSpace(line), "gateway: "); ok {
+			return strings.TrimSpace(gateway) == hotspotGateway
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package apps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PackagesOptions configures the snapshot of globally installed packages
+type PackagesOptions struct {
+	Enabled  bool     `yaml:"enabled"`
+	Managers []string `yaml:"managers"` // e.g. ["npm", "cargo"], all installed ones if empty
+}
+
+// packageManager lists and installs the global packages of one ecosystem
+type packageManager struct {
+	name    string
+	command string
+	list    func(bin string) ([]string, error)
+	install func(pkg string) []string // Arguments installing a package
+}
+
+var packageManagers = []packageManager{
+	{name: "npm", command: "npm", list: listNpm, install: func(pkg string) []string { return []string{"install", "-g", pkg} }},
+	{name: "pnpm", command: "pnpm", list: listPnpm, install: func(pkg string) []string { return []string{"add", "-g", pkg} }},
+	{name: "yarn", command: "yarn", list: listYarn, install: func(pkg string) []string { return []string{"global", "add", pkg} }},
+	{name: "pipx", command: "pipx", list: listPipx, install: func(pkg string) []string { return []string{"install", pkg} }},
+	{name: "pip", command: "pip3", list: listPip, install: func(pkg string) []string { return []string{"install", "--user", pkg} }},
+	{name: "gem", command: "gem", list: listGem, install: func(pkg string) []string { return []string{"install", pkg} }},
+	{name: "cargo", command: "cargo", list: listCargo, install: func(pkg string) []string { return []string{"install", pkg} }},
+	{name: "go", command: "go", list: listGo, install: func(pkg string) []string { return []string{"install", pkg + "@latest"} }},
+}
+
+// ListPackages returns the globally installed packages of every selected
+// package manager. Managers that aren't installed are skipped, unless they
+// were selected explicitly.
+func ListPackages(opts PackagesOptions) (map[string][]string, error) {
+	for _, name := range opts.Managers {
+		if !slices.ContainsFunc(packageManagers, func(m packageManager) bool { return m.name == name }) {
+			return nil, fmt.Errorf("unknown package manager %q", name)
+		}
+	}
+
+	packages := make(map[string][]string)
+	for _, m := range packageManagers {
+		if len(opts.Managers) > 0 && !slices.Contains(opts.Managers, m.name) {
+			continue
+		}
+
+		bin, ok := lookPath(m.command)
+		if !ok {
+			if len(opts.Managers) > 0 {
+				return nil, fmt.Errorf("%s not found", m.command)
+			}
+			continue
+		}
+
+		list, err := m.list(bin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s packages: %w", m.name, err)
+		}
+		if len(list) > 0 {
+			packages[m.name] = list
+		}
+	}
+
+	return packages, nil
+}
+
+// InstallPackage installs a global package with the named package manager
+func InstallPackage(manager, pkg string) error {
+	i := slices.IndexFunc(packageManagers, func(m packageManager) bool { return m.name == manager })
+	if i < 0 {
+		return fmt.Errorf("unknown package manager %q", manager)
+	}
+	m := packageManagers[i]
+
+	bin, ok := lookPath(m.command)
+	if !ok {
+		return fmt.Errorf("%s not found", m.command)
+	}
+	if out, err := exec.Command(bin, m.install(pkg)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", pkg, lastLine(out))
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of a command's output, which
+// usually holds the reason it failed
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// output runs a command and returns its standard output
+func output(bin string, args ...string) ([]byte, error) {
+	out, err := exec.Command(bin, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s %s: %s", filepath.Base(bin), strings.Join(args, " "), lastLine(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("%s %s: %w", filepath.Base(bin), strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// listNpm lists global npm packages, without npm itself
+func listNpm(bin string) ([]string, error) {
+	out, err := output(bin, "ls", "-g", "--depth=0", "--json")
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(result.Dependencies))
+	for name := range result.Dependencies {
+		if name != "npm" && name != "corepack" {
+			list = append(list, name)
+		}
+	}
+	slices.Sort(list)
+	return list, nil
+}
+
+// listPnpm lists global pnpm packages
+func listPnpm(bin string) ([]string, error) {
+	out, err := output(bin, "ls", "-g", "--json")
+	if err != nil {
+		return nil, err
+	}
+	var result []struct {
+		Dependencies map[string]json.RawMessage `json:"dependencies"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0)
+	for _, project := range result {
+		for name := range project.Dependencies {
+			list = append(list, name)
+		}
+	}
+	slices.Sort(list)
+	return list, nil
+}
+
+// yarnLine matches a package of `yarn global list`, e.g. `info "serve@14.2.0" has binaries:`
+var yarnLine = regexp.MustCompile(`^info "(.+)@[^@"]+" has binaries`)
+
+// listYarn lists global packages of yarn classic
+func listYarn(bin string) ([]string, error) {
+	out, err := output(bin, "global", "list")
+	if err != nil {
+		return nil, err
+	}
+	list := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if match := yarnLine.FindStringSubmatch(line); match != nil {
+			list = append(list, match[1])
+		}
+	}
+	return list, nil
+}
+
+// listPipx lists applications installed with pipx
+func listPipx(bin string) ([]string, error) {
+	out, err := output(bin, "list", "--short")
+	if err != nil {
+		return nil, err
+	}
+	return firstFields(out, " "), nil
+}
+
+// listPip lists packages installed into the user site that no other
+// package depends on
+func listPip(bin string) ([]string, error) {
+	out, err := output(bin, "list", "--user", "--not-required", "--format=freeze")
+	if err != nil {
+		return nil, err
+	}
+	return firstFields(out, "=="), nil
+}
+
+// gemLine matches a line of `gem list`, e.g. "rake (13.1.0, default: 13.0.6)"
+var gemLine = regexp.MustCompile(`^(\S+) \((.*)\)$`)
+
+// listGem lists installed gems, except those that only come with Ruby
+func listGem(bin string) ([]string, error) {
+	out, err := output(bin, "list", "--local")
+	if err != nil {
+		return nil, err
+	}
+	list := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		match := gemLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		versions := strings.Split(match[2], ", ")
+		if !slices.ContainsFunc(versions, func(v string) bool { return !strings.HasPrefix(v, "default: ") }) {
+			continue
+		}
+		list = append(list, match[1])
+	}
+	return list, nil
+}
+
+// listCargo lists crates installed with cargo install
+func listCargo(bin string) ([]string, error) {
+	out, err := output(bin, "install", "--list")
+	if err != nil {
+		return nil, err
+	}
+	list := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		// Crates start at the beginning of the line, their binaries are indented
+		if line == "" || strings.HasPrefix(line, " ") {
+			continue
+		}
+		name, _, _ := strings.Cut(line, " ")
+		list = append(list, name)
+	}
+	return list, nil
+}
+
+// listGo lists the packages of the binaries installed with go install
+func listGo(bin string) ([]string, error) {
+	out, err := output(bin, "env", "GOBIN", "GOPATH")
+	if err != nil {
+		return nil, err
+	}
+	env := strings.Split(strings.TrimSpace(string(out)), "\n")
+	dir := strings.TrimSpace(env[0])
+	if dir == "" && len(env) > 1 {
+		dir = filepath.Join(strings.TrimSpace(filepath.SplitList(env[1])[0]), "bin")
+	}
+
+	// go version -m prints the package path of every binary in the directory
+	out, err = exec.Command(bin, "version", "-m", dir).Output()
+	if err != nil {
+		return make([]string, 0), nil // No binaries installed yet
+	}
+	list := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if path, ok := strings.CutPrefix(strings.TrimSpace(line), "path\t"); ok && !slices.Contains(list, path) {
+			list = append(list, path)
+		}
+	}
+	return list, nil
+}
+
+// firstFields returns the text before sep of every non-empty line
+func firstFields(out []byte, sep string) []string {
+	list := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			name, _, _ := strings.Cut(line, sep)
+			list = append(list, name)
+		}
+	}
+	return list
+}
@@ -0,0 +1,97 @@
+package apps
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Preset lists where an app keeps its settings
+type Preset struct {
+	Paths    []string `yaml:"paths"`    // Directories, backed up like data locations
+	Ignore   []string `yaml:"ignore"`   // Patterns to skip in the directories, e.g. caches
+	Defaults []string `yaml:"defaults"` // Preferences domains
+}
+
+// presets are the settings of popular apps. The config can override them
+// and add its own.
+var presets = map[string]Preset{
+	"alacritty": {Paths: []string{"~/.config/alacritty"}},
+	"alfred": {
+		Paths:    []string{"~/Library/Application Support/Alfred"},
+		Defaults: []string{"com.runningwithcrayons.Alfred", "com.runningwithcrayons.Alfred-Preferences"},
+	},
+	"bartender": {Defaults: []string{"com.surteesstudios.Bartender"}},
+	"bettertouchtool": {
+		Paths:    []string{"~/Library/Application Support/BetterTouchTool"},
+		Defaults: []string{"com.hegenberg.BetterTouchTool"},
+	},
+	"ghostty":     {Paths: []string{"~/.config/ghostty"}},
+	"hammerspoon": {Paths: []string{"~/.hammerspoon"}, Defaults: []string{"org.hammerspoon.Hammerspoon"}},
+	"iina": {
+		Paths:    []string{"~/Library/Application Support/com.colliderli.iina"},
+		Ignore:   []string{"watch_later"},
+		Defaults: []string{"com.colliderli.iina"},
+	},
+	"iterm2": {
+		Paths:    []string{"~/Library/Application Support/iTerm2"},
+		Defaults: []string{"com.googlecode.iterm2"},
+	},
+	"karabiner": {Paths: []string{"~/.config/karabiner"}, Ignore: []string{"automatic_backups"}},
+	"keyboard-maestro": {
+		Paths:    []string{"~/Library/Application Support/Keyboard Maestro"},
+		Defaults: []string{"com.stairways.keyboardmaestro.editor", "com.stairways.keyboardmaestro.engine"},
+	},
+	"kitty":  {Paths: []string{"~/.config/kitty"}},
+	"magnet": {Defaults: []string{"com.crowdcafe.windowmagnet"}},
+	"moom":   {Defaults: []string{"com.manytricks.Moom"}},
+	"obsidian": {
+		Paths:  []string{"~/Library/Application Support/obsidian"},
+		Ignore: []string{"Cache", "Code Cache", "GPUCache", "logs"},
+	},
+	"raycast": {
+		Paths:    []string{"~/Library/Application Support/com.raycast.macos"},
+		Defaults: []string{"com.raycast.macos"},
+	},
+	"rectangle":    {Defaults: []string{"com.knollsoft.Rectangle"}},
+	"sublime-text": {Paths: []string{"~/Library/Application Support/Sublime Text/Packages"}},
+	"transmit": {
+		Paths:    []string{"~/Library/Application Support/Transmit"},
+		Defaults: []string{"com.panic.Transmit"},
+	},
+	"wezterm": {Paths: []string{"~/.config/wezterm"}},
+	"zed":     {Paths: []string{"~/.config/zed"}},
+}
+
+// LookupPreset returns the preset of an app. Presets of the config replace
+// the built-in ones of the same name.
+func LookupPreset(name string, overrides map[string]Preset) (Preset, error) {
+	name = strings.ToLower(name)
+	if preset, ok := overrides[name]; ok {
+		return preset, nil
+	}
+	if preset, ok := presets[name]; ok {
+		return preset, nil
+	}
+	return Preset{}, fmt.Errorf("unknown app preset %q, available are %s", name, strings.Join(PresetNames(), ", "))
+}
+
+// PresetNames returns the names of the built-in presets
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Domains returns the preferences domains of the preset. They are skipped if
+// the app isn't installed.
+func (p Preset) Domains() []DefaultsDomain {
+	domains := make([]DefaultsDomain, 0, len(p.Defaults))
+	for _, domain := range p.Defaults {
+		domains = append(domains, DefaultsDomain{Domain: domain, optional: true})
+	}
+	return domains
+}
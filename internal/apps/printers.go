@@ -0,0 +1,225 @@
+package apps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// PrintersName is the name of the object holding the printer definitions
+const PrintersName = "printers.json"
+
+// ppdDir holds the drivers of the installed printers
+const ppdDir = "/etc/cups/ppd"
+
+// PrintersOptions configures the printers module
+type PrintersOptions struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// Printer is a CUPS printer queue
+type Printer struct {
+	Name     string `json:"name"`
+	URI      string `json:"uri"` // Device URI, e.g. "ipp://printer.local/ipp/print"
+	Info     string `json:"info"`
+	Location string `json:"location"`
+	Model    string `json:"model"`
+	PPD      []byte `json:"ppd,omitempty"` // Driver of the queue, driverless queues have none
+	Default  bool   `json:"default,omitempty"`
+}
+
+// listPrinters returns the printer queues with their device URIs, as defined
+// in /etc/cups/printers.conf which only root can read
+func listPrinters() []Printer {
+	printers := make([]Printer, 0)
+
+	// lpstat fails if there are no printers
+	out, err := output("lpstat", "-v")
+	if err != nil {
+		return printers
+	}
+	for _, line := range lines(out) {
+		// Lines look like "device for Office: ipp://10.0.0.5/ipp/print"
+		rest, ok := strings.CutPrefix(line, "device for ")
+		if !ok {
+			continue
+		}
+		name, uri, ok := strings.Cut(rest, ": ")
+		if ok {
+			printers = append(printers, Printer{Name: name, URI: uri})
+		}
+	}
+	return printers
+}
+
+// BackupPrinters stores the printer queues and their drivers in the backup
+func BackupPrinters(store storage.Storage) error {
+	printers := listPrinters()
+
+	defaultPrinter := ""
+	if out, err := output("lpstat", "-d"); err == nil {
+		_, name, _ := strings.Cut(strings.TrimSpace(string(out)), ": ")
+		defaultPrinter = name
+	}
+
+	for i, printer := range printers {
+		out, err := output("lpoptions", "-p", printer.Name)
+		if err != nil {
+			return err
+		}
+		options := parseOptions(strings.TrimSpace(string(out)))
+		printers[i].Info = options["printer-info"]
+		printers[i].Location = options["printer-location"]
+		printers[i].Model = options["printer-make-and-model"]
+		printers[i].Default = printer.Name == defaultPrinter
+
+		ppd, err := os.ReadFile(filepath.Join(ppdDir, printer.Name+".ppd"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		printers[i].PPD = ppd
+	}
+
+	data, err := json.MarshalIndent(printers, "", "  ")
+	if err != nil {
+		return err
+	}
+	w, err := store.Create(PrintersName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// parseOptions parses the options printed by lpoptions, e.g.
+// `printer-info='Office Printer' device-uri=ipp://10.0.0.5/ipp/print`
+func parseOptions(s string) map[string]string {
+	options := make(map[string]string)
+	var key, value strings.Builder
+	inValue := false
+	quote := rune(0)
+	escaped := false
+
+	flush := func() {
+		if key.Len() > 0 {
+			options[key.String()] = value.String()
+		}
+		key.Reset()
+		value.Reset()
+		inValue = false
+	}
+	for _, r := range s {
+		switch {
+		case escaped:
+			value.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				value.WriteRune(r)
+			}
+		case inValue && (r == '\'' || r == '"'):
+			quote = r
+		case r == ' ':
+			flush()
+		case !inValue && r == '=':
+			inValue = true
+		case inValue:
+			value.WriteRune(r)
+		default:
+			key.WriteRune(r)
+		}
+	}
+	flush()
+	return options
+}
+
+// RestorePrinters adds the printer queues of the backup with lpadmin, which
+// needs an admin user. Queues that exist already are kept. It returns the
+// number of added printers.
+func RestorePrinters(store storage.Storage) (int, error) {
+	r, err := store.Open(PrintersName)
+	if err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return 0, err
+	}
+	var printers []Printer
+	if err := json.Unmarshal(data, &printers); err != nil {
+		return 0, fmt.Errorf("failed to decode %s: %w", PrintersName, err)
+	}
+
+	existing := listPrinters()
+	var errs []error
+	added := 0
+	for _, printer := range printers {
+		if slices.ContainsFunc(existing, func(p Printer) bool { return p.Name == printer.Name }) {
+			continue
+		}
+		if err := addPrinter(printer); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		added++
+	}
+
+	for _, printer := range printers {
+		if printer.Default {
+			if err := run("lpadmin", "-d", printer.Name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return added, errors.Join(errs...)
+}
+
+// addPrinter creates a printer queue with the driver of the backup. Queues
+// without one are set up driverless (AirPrint / IPP Everywhere).
+func addPrinter(printer Printer) error {
+	args := []string{"-p", printer.Name, "-E", "-v", printer.URI}
+	if printer.Info != "" {
+		args = append(args, "-D", printer.Info)
+	}
+	if printer.Location != "" {
+		args = append(args, "-L", printer.Location)
+	}
+
+	if len(printer.PPD) > 0 {
+		file, err := os.CreateTemp("", "macup-*.ppd")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file.Name())
+		_, err = file.Write(printer.PPD)
+		if err := errors.Join(err, file.Close()); err != nil {
+			return err
+		}
+		args = append(args, "-P", file.Name())
+	} else {
+		args = append(args, "-m", "everywhere")
+	}
+
+	if err := run("lpadmin", args...); err != nil {
+		return fmt.Errorf("failed to add printer %s: %w", printer.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package apps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// RuntimesOptions configures the capture of runtime versions
+type RuntimesOptions struct {
+	Enabled  bool     `yaml:"enabled"`
+	Managers []string `yaml:"managers"` // asdf, mise, nvm and/or pyenv, all installed ones if empty
+}
+
+// Runtime is an installed version of a language runtime
+type Runtime struct {
+	Manager string `json:"manager"`
+	Tool    string `json:"tool"` // e.g. "nodejs", "python"
+	Version string `json:"version"`
+	Global  bool   `json:"global,omitempty"` // Selected as the global version
+}
+
+// runtimeManager lists and installs the runtimes of one version manager
+type runtimeManager struct {
+	name      string
+	found     func() bool
+	list      func() ([]Runtime, error)
+	install   func(r Runtime) error
+	setGlobal func(list []Runtime) error // Selects the global versions
+}
+
+var runtimeManagers = []runtimeManager{
+	{name: "asdf", found: found("asdf"), list: listAsdf, install: installAsdf, setGlobal: globalAsdf},
+	{name: "mise", found: found("mise"), list: listMise, install: installMise, setGlobal: globalMise},
+	{name: "nvm", found: foundNvm, list: listNvm, install: installNvm, setGlobal: globalNvm},
+	{name: "pyenv", found: found("pyenv"), list: listPyenv, install: installPyenv, setGlobal: globalPyenv},
+}
+
+// found returns a check for an executable
+func found(name string) func() bool {
+	return func() bool {
+		_, ok := lookPath(name)
+		return ok
+	}
+}
+
+// ListRuntimes returns the installed runtimes of every selected version
+// manager. Managers that aren't installed are skipped, unless they were
+// selected explicitly.
+func ListRuntimes(opts RuntimesOptions) ([]Runtime, error) {
+	for _, name := range opts.Managers {
+		if !slices.ContainsFunc(runtimeManagers, func(m runtimeManager) bool { return m.name == name }) {
+			return nil, fmt.Errorf("unknown version manager %q", name)
+		}
+	}
+
+	runtimes := make([]Runtime, 0)
+	for _, m := range runtimeManagers {
+		if len(opts.Managers) > 0 && !slices.Contains(opts.Managers, m.name) {
+			continue
+		}
+		if !m.found() {
+			if len(opts.Managers) > 0 {
+				return nil, fmt.Errorf("%s not found", m.name)
+			}
+			continue
+		}
+
+		list, err := m.list()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s runtimes: %w", m.name, err)
+		}
+		runtimes = append(runtimes, list...)
+	}
+
+	return runtimes, nil
+}
+
+// InstallRuntime installs a runtime version with its version manager
+func InstallRuntime(r Runtime) error {
+	m, err := runtimeManagerOf(r.Manager)
+	if err != nil {
+		return err
+	}
+	if !m.found() {
+		return fmt.Errorf("%s not found", m.name)
+	}
+	return m.install(r)
+}
+
+// SetGlobalRuntimes selects the global versions of every version manager
+// in the list
+func SetGlobalRuntimes(runtimes []Runtime) error {
+	var errs []error
+	for _, m := range runtimeManagers {
+		list := slices.DeleteFunc(slices.Clone(runtimes), func(r Runtime) bool { return r.Manager != m.name || !r.Global })
+		if len(list) == 0 {
+			continue
+		}
+		if err := m.setGlobal(list); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set global %s versions: %w", m.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runtimeManagerOf looks up a version manager by name
+func runtimeManagerOf(name string) (runtimeManager, error) {
+	i := slices.IndexFunc(runtimeManagers, func(m runtimeManager) bool { return m.name == name })
+	if i < 0 {
+		return runtimeManager{}, fmt.Errorf("unknown version manager %q", name)
+	}
+	return runtimeManagers[i], nil
+}
+
+// run runs a command and reports the last line of its output on failure
+func run(bin string, args ...string) error {
+	if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+		if len(strings.TrimSpace(string(out))) == 0 {
+			return fmt.Errorf("%s %s: %w", filepath.Base(bin), strings.Join(args, " "), err)
+		}
+		return fmt.Errorf("%s %s: %s", filepath.Base(bin), strings.Join(args, " "), lastLine(out))
+	}
+	return nil
+}
+
+// toolVersionsPath returns the global .tool-versions file of asdf
+func toolVersionsPath() (string, error) {
+	if path := os.Getenv("ASDF_DEFAULT_TOOL_VERSIONS_FILENAME"); filepath.IsAbs(path) {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".tool-versions"), nil
+}
+
+// listAsdf lists the versions of every asdf plugin, the global ones are
+// read from ~/.tool-versions
+func listAsdf() ([]Runtime, error) {
+	bin, _ := lookPath("asdf")
+	out, err := output(bin, "plugin", "list")
+	if err != nil {
+		return nil, err
+	}
+
+	global := make(map[string][]string)
+	if path, err := toolVersionsPath(); err == nil {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && !strings.HasPrefix(fields[0], "#") {
+				global[fields[0]] = fields[1:]
+			}
+		}
+	}
+
+	runtimes := make([]Runtime, 0)
+	for _, tool := range strings.Fields(string(out)) {
+		versions, err := output(bin, "list", tool)
+		if err != nil {
+			continue // Plugins without installed versions fail to list
+		}
+		for _, line := range strings.Split(string(versions), "\n") {
+			version := strings.TrimPrefix(strings.TrimSpace(line), "*")
+			if version == "" || strings.Contains(version, " ") {
+				continue
+			}
+			runtimes = append(runtimes, Runtime{
+				Manager: "asdf",
+				Tool:    tool,
+				Version: version,
+				Global:  slices.Contains(global[tool], version),
+			})
+		}
+	}
+	return runtimes, nil
+}
+
+// installAsdf adds the plugin if needed and installs the version
+func installAsdf(r Runtime) error {
+	bin, _ := lookPath("asdf")
+	exec.Command(bin, "plugin", "add", r.Tool).Run() // Fails if the plugin already exists
+	return run(bin, "install", r.Tool, r.Version)
+}
+
+// globalAsdf writes the global versions to ~/.tool-versions
+func globalAsdf(list []Runtime) error {
+	path, err := toolVersionsPath()
+	if err != nil {
+		return err
+	}
+
+	var tools []string
+	versions := make(map[string][]string)
+	for _, r := range list {
+		if !slices.Contains(tools, r.Tool) {
+			tools = append(tools, r.Tool)
+		}
+		versions[r.Tool] = append(versions[r.Tool], r.Version)
+	}
+
+	var content strings.Builder
+	for _, tool := range tools {
+		fmt.Fprintf(&content, "%s %s\n", tool, strings.Join(versions[tool], " "))
+	}
+	return os.WriteFile(path, []byte(content.String()), 0644)
+}
+
+// miseVersion is an entry of `mise ls --json`
+type miseVersion struct {
+	Version   string `json:"version"`
+	Installed bool   `json:"installed"`
+}
+
+// listMise lists the installed versions of all mise tools
+func listMise() ([]Runtime, error) {
+	bin, _ := lookPath("mise")
+	installed, err := miseList(bin, "ls", "--installed", "--json")
+	if err != nil {
+		return nil, err
+	}
+	global, err := miseList(bin, "ls", "--global", "--json")
+	if err != nil {
+		return nil, err
+	}
+
+	runtimes := make([]Runtime, 0)
+	for tool, versions := range installed {
+		for _, v := range versions {
+			runtimes = append(runtimes, Runtime{
+				Manager: "mise",
+				Tool:    tool,
+				Version: v.Version,
+				Global:  slices.ContainsFunc(global[tool], func(g miseVersion) bool { return g.Version == v.Version }),
+			})
+		}
+	}
+	slices.SortFunc(runtimes, func(a, b Runtime) int { return strings.Compare(a.Tool+"@"+a.Version, b.Tool+"@"+b.Version) })
+	return runtimes, nil
+}
+
+// miseList decodes the output of a `mise ls --json` call
+func miseList(bin string, args ...string) (map[string][]miseVersion, error) {
+	out, err := output(bin, args...)
+	if err != nil {
+		return nil, err
+	}
+	var versions map[string][]miseVersion
+	if err := json.Unmarshal(out, &versions); err != nil {
+		return nil, fmt.Errorf("failed to decode mise output: %w", err)
+	}
+	return versions, nil
+}
+
+// installMise installs a tool version with mise
+func installMise(r Runtime) error {
+	bin, _ := lookPath("mise")
+	return run(bin, "install", r.Tool+"@"+r.Version)
+}
+
+// globalMise selects the global versions in the global mise config
+func globalMise(list []Runtime) error {
+	bin, _ := lookPath("mise")
+	args := []string{"use", "--global"}
+	for _, r := range list {
+		args = append(args, r.Tool+"@"+r.Version)
+	}
+	return run(bin, args...)
+}
+
+// nvmDir returns the directory nvm is installed to
+func nvmDir() string {
+	if dir := os.Getenv("NVM_DIR"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".nvm")
+}
+
+// foundNvm reports whether nvm is installed. It is a shell function, so it
+// can't be found on the PATH.
+func foundNvm() bool {
+	_, err := os.Stat(filepath.Join(nvmDir(), "nvm.sh"))
+	return err == nil
+}
+
+// nvm runs an nvm command in a shell that loaded nvm
+func nvm(args ...string) error {
+	script := `. "$NVM_DIR/nvm.sh" && nvm "$@"`
+	cmd := exec.Command("/bin/bash", append([]string{"-c", script, "nvm"}, args...)...)
+	cmd.Env = append(os.Environ(), "NVM_DIR="+nvmDir())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nvm %s: %s", strings.Join(args, " "), lastLine(out))
+	}
+	return nil
+}
+
+// listNvm lists the installed node versions and the default alias
+func listNvm() ([]Runtime, error) {
+	entries, err := os.ReadDir(filepath.Join(nvmDir(), "versions", "node"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return make([]Runtime, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The default alias may be a version prefix like "20" or "v20.1.0"
+	data, _ := os.ReadFile(filepath.Join(nvmDir(), "alias", "default"))
+	alias := strings.TrimPrefix(strings.TrimSpace(string(data)), "v")
+
+	runtimes := make([]Runtime, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		version := strings.TrimPrefix(entry.Name(), "v")
+		runtimes = append(runtimes, Runtime{
+			Manager: "nvm",
+			Tool:    "node",
+			Version: version,
+			Global:  alias != "" && (version == alias || strings.HasPrefix(version, alias+".")),
+		})
+	}
+	return runtimes, nil
+}
+
+// installNvm installs a node version with nvm, unless it is already there
+func installNvm(r Runtime) error {
+	if _, err := os.Stat(filepath.Join(nvmDir(), "versions", "node", "v"+r.Version)); err == nil {
+		return nil
+	}
+	return nvm("install", r.Version)
+}
+
+// globalNvm points the default alias at the global version
+func globalNvm(list []Runtime) error {
+	return nvm("alias", "default", list[len(list)-1].Version)
+}
+
+// listPyenv lists the installed Python versions and the global ones
+func listPyenv() ([]Runtime, error) {
+	bin, _ := lookPath("pyenv")
+	out, err := output(bin, "versions", "--bare", "--skip-aliases")
+	if err != nil {
+		return nil, err
+	}
+	global, err := output(bin, "global")
+	if err != nil {
+		return nil, err
+	}
+
+	runtimes := make([]Runtime, 0)
+	for _, version := range strings.Fields(string(out)) {
+		runtimes = append(runtimes, Runtime{
+			Manager: "pyenv",
+			Tool:    "python",
+			Version: version,
+			Global:  slices.Contains(strings.Fields(string(global)), version),
+		})
+	}
+	return runtimes, nil
+}
+
+// installPyenv installs a Python version with pyenv, skipping it if present
+func installPyenv(r Runtime) error {
+	bin, _ := lookPath("pyenv")
+	return run(bin, "install", "--skip-existing", r.Version)
+}
+
+// globalPyenv selects the global Python versions
+func globalPyenv(list []Runtime) error {
+	bin, _ := lookPath("pyenv")
+	args := []string{"global"}
+	for _, r := range list {
+		args = append(args, r.Version)
+	}
+	return run(bin, args...)
+}
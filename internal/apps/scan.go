@@ -0,0 +1,144 @@
+package apps
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Sources an installed app can come from
+const (
+	SourceAppStore = "App Store"
+	SourceHomebrew = "Homebrew cask"
+	SourceDirect   = "Direct download"
+)
+
+// ScannedApp is an app found in one of the Applications folders
+type ScannedApp struct {
+	Name   string // Without the .app extension
+	Path   string
+	ID     string // Bundle identifier, empty if unreadable
+	Source string
+	Cask   string // Token of the Homebrew cask that installed it
+	Preset string // Name of the preset for its settings
+}
+
+// caskInfo is the part of `brew info --json=v2` that names the installed apps
+type caskInfo struct {
+	Casks []struct {
+		Token     string                       `json:"token"`
+		Artifacts []map[string]json.RawMessage `json:"artifacts"`
+	} `json:"casks"`
+}
+
+// ScanApps inventories /Applications and ~/Applications and classifies each
+// app by where it was installed from
+func ScanApps() ([]ScannedApp, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	casks := caskApps()
+
+	apps := make([]ScannedApp, 0)
+	for _, dir := range []string{"/Applications", filepath.Join(home, "Applications")} {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), ".app") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			app := ScannedApp{Name: strings.TrimSuffix(entry.Name(), ".app"), Path: path, ID: bundleID(path), Source: SourceDirect}
+			if _, err := os.Stat(filepath.Join(path, "Contents", "_MASReceipt")); err == nil {
+				app.Source = SourceAppStore
+			} else if cask, ok := casks[entry.Name()]; ok {
+				app.Source = SourceHomebrew
+				app.Cask = cask
+			}
+			app.Preset = matchPreset(app)
+			apps = append(apps, app)
+		}
+	}
+
+	slices.SortFunc(apps, func(a, b ScannedApp) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return apps, nil
+}
+
+// caskApps maps the app bundles installed by Homebrew casks to their tokens.
+// It is empty when brew is missing.
+func caskApps() map[string]string {
+	apps := make(map[string]string)
+	brew, ok := lookPath("brew")
+	if !ok {
+		return apps
+	}
+	out, err := exec.Command(brew, "info", "--json=v2", "--installed", "--cask").Output()
+	if err != nil {
+		return apps
+	}
+	var info caskInfo
+	if err := json.Unmarshal(out, &info); err != nil {
+		return apps
+	}
+
+	for _, cask := range info.Casks {
+		for _, artifact := range cask.Artifacts {
+			raw, ok := artifact["app"]
+			if !ok {
+				continue
+			}
+			// Entries are file names, or objects with a target to rename to
+			var entries []any
+			json.Unmarshal(raw, &entries)
+			for _, entry := range entries {
+				switch entry := entry.(type) {
+				case string:
+					apps[filepath.Base(entry)] = cask.Token
+				case map[string]any:
+					if target, ok := entry["target"].(string); ok {
+						apps[filepath.Base(target)] = cask.Token
+					}
+				}
+			}
+		}
+	}
+	return apps
+}
+
+// bundleID reads the bundle identifier of an app, e.g. "com.googlecode.iterm2"
+func bundleID(path string) string {
+	out, err := exec.Command("plutil", "-extract", "CFBundleIdentifier", "raw", "-o", "-", filepath.Join(path, "Contents", "Info.plist")).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// matchPreset finds the preset of an app by its preferences domain or name
+func matchPreset(app ScannedApp) string {
+	key := func(s string) string {
+		return strings.NewReplacer(" ", "", "-", "", ".", "").Replace(strings.ToLower(s))
+	}
+	for _, name := range PresetNames() {
+		if app.ID != "" && slices.Contains(presets[name].Defaults, app.ID) {
+			return name
+		}
+		if key(name) == key(app.Name) {
+			return name
+		}
+	}
+	return ""
+}
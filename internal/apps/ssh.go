@@ -0,0 +1,230 @@
+package apps
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/klauspost/pgzip"
+)
+
+// SSHArchive is the name of the archive holding ~/.ssh
+const SSHArchive = "ssh.tar.gz"
+
+// SSHOptions configures the SSH module
+type SSHOptions struct {
+	Enabled bool `yaml:"enabled"`
+	// Also back up private keys. They are stored as they are, so keys
+	// without a passphrase are readable by anyone with access to the backup.
+	PrivateKeys bool `yaml:"private_keys" mapstructure:"private_keys"`
+}
+
+// SSHReport summarizes a restored SSH setup
+type SSHReport struct {
+	Hosts  []string // Hosts with a known host key
+	Hashed int      // Known host keys with a hashed host name
+	Keys   []string // Private keys added to the agent
+	Failed []string // Private keys that couldn't be added to the agent
+}
+
+// sshDir returns the SSH directory of the user
+func sshDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh"), nil
+}
+
+// privateKey reports whether a file holds a private key
+func privateKey(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("-----BEGIN")) && bytes.Contains(data[:min(len(data), 64)], []byte("PRIVATE KEY"))
+}
+
+// BackupSSH archives the config, known hosts and public keys in ~/.ssh,
+// and the private keys if enabled
+func BackupSSH(store storage.Storage, opts SSHOptions) error {
+	dir, err := sshDir()
+	if err != nil {
+		return err
+	}
+
+	w, err := store.Create(SSHArchive)
+	if err != nil {
+		return err
+	}
+	gzipWriter := pgzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return filepath.SkipAll // No SSH setup yet
+		}
+		if err != nil {
+			return err
+		}
+		// Sockets of multiplexed connections and the like are skipped
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if !opts.PrivateKeys {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if privateKey(data) {
+				return nil
+			}
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return addToArchive(tarWriter, path, filepath.Join("ssh", rel))
+	})
+	if err == nil {
+		err = errors.Join(tarWriter.Close(), gzipWriter.Close())
+	}
+	if err != nil {
+		tarWriter.Close()
+		gzipWriter.Close()
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// RestoreSSH puts the archived files back into ~/.ssh with the permissions
+// ssh insists on and adds the private keys to the agent and the Keychain.
+// Adding a key may ask for its passphrase.
+func RestoreSSH(store storage.Storage) (*SSHReport, error) {
+	dir, err := sshDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	r, err := store.Open(SSHArchive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	gzipReader, err := pgzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	report := &SSHReport{}
+	var keys []string
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := strings.CutPrefix(header.Name, "ssh/")
+		if !ok || !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil, fmt.Errorf("illegal file path in archive: %s", header.Name)
+		}
+
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+
+		// Private keys and files others could abuse must only be readable by the user
+		mode := os.FileMode(0644)
+		switch {
+		case privateKey(data):
+			mode = 0600
+			keys = append(keys, path)
+		case slices.Contains([]string{"config", "authorized_keys"}, filepath.Base(path)):
+			mode = 0600
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, mode); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		// WriteFile keeps the mode of existing files
+		if err := os.Chmod(path, mode); err != nil {
+			return nil, err
+		}
+
+		if filepath.Base(path) == "known_hosts" {
+			hosts, hashed := knownHosts(data)
+			for _, host := range hosts {
+				if !slices.Contains(report.Hosts, host) {
+					report.Hosts = append(report.Hosts, host)
+				}
+			}
+			report.Hashed += hashed
+		}
+	}
+
+	for _, key := range keys {
+		// ssh-add asks for passphrases on the terminal
+		cmd := exec.Command("ssh-add", "--apple-use-keychain", key)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+		if err := cmd.Run(); err != nil {
+			report.Failed = append(report.Failed, key)
+		} else {
+			report.Keys = append(report.Keys, key)
+		}
+	}
+
+	return report, nil
+}
+
+// knownHosts returns the host names of a known_hosts file and the number of
+// entries with a hashed host name
+func knownHosts(data []byte) ([]string, int) {
+	hosts := make([]string, 0)
+	hashed := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		// Markers like @cert-authority precede the host names
+		if strings.HasPrefix(fields[0], "@") {
+			fields = fields[1:]
+		}
+		if strings.HasPrefix(fields[0], "|1|") {
+			hashed++
+			continue
+		}
+		for _, host := range strings.Split(fields[0], ",") {
+			if !slices.Contains(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts, hashed
+}
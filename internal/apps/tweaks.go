@@ -0,0 +1,66 @@
+package apps
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Tweak is a shell snippet that adjusts the system on restore
+type Tweak struct {
+	Name  string `yaml:"name"`
+	Run   string `yaml:"run"`   // Run with /bin/sh, e.g. "scutil --set HostName mac"
+	Check string `yaml:"check"` // Skips the tweak if it succeeds, i.e. it is applied already
+	Sudo  bool   `yaml:"sudo"`  // Run as root, e.g. for systemsetup
+}
+
+// Label returns the name of the tweak, or its command if it has none
+func (t Tweak) Label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	label, _, _ := strings.Cut(strings.TrimSpace(t.Run), "\n")
+	if len(label) > 60 {
+		label = label[:57] + "..."
+	}
+	return label
+}
+
+// command returns the command running a snippet of the tweak. Sudo must not
+// prompt, the progress view owns the terminal.
+func (t Tweak) command(snippet string) *exec.Cmd {
+	if t.Sudo {
+		return exec.Command("sudo", "-n", "/bin/sh", "-c", snippet)
+	}
+	return exec.Command("/bin/sh", "-c", snippet)
+}
+
+// ApplyTweak runs a tweak unless its check reports it as applied. It returns
+// whether the tweak ran.
+func ApplyTweak(t Tweak) (bool, error) {
+	if strings.TrimSpace(t.Run) == "" {
+		return false, fmt.Errorf("tweak %q has nothing to run", t.Label())
+	}
+	if t.Check != "" && t.command(t.Check).Run() == nil {
+		return false, nil
+	}
+	if out, err := t.command(t.Run).CombinedOutput(); err != nil {
+		if len(strings.TrimSpace(string(out))) == 0 {
+			return false, fmt.Errorf("%s: %w", t.Label(), err)
+		}
+		return false, fmt.Errorf("%s: %s", t.Label(), lastLine(out))
+	}
+	return true, nil
+}
+
+// AuthorizeSudo asks for the password of the user once, so tweaks can run
+// as root without prompting
+func AuthorizeSudo() error {
+	cmd := exec.Command("sudo", "-v")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sudo: %w", err)
+	}
+	return nil
+}
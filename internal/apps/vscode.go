@@ -0,0 +1,283 @@
+package apps
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// VSCodeOptions configures the module for VS Code and its forks
+type VSCodeOptions struct {
+	Enabled bool     `yaml:"enabled"`
+	Editors []string `yaml:"editors"` // "code" and/or "cursor", all installed ones if empty
+}
+
+// editor is a VS Code flavour with its own settings and extensions
+type editor struct {
+	name  string // Name of the command line tool
+	label string
+	dir   string // Directory below ~/Library/Application Support
+	app   string // App bundle in /Applications
+}
+
+var editors = []editor{
+	{name: "code", label: "VS Code", dir: "Code", app: "Visual Studio Code.app"},
+	{name: "cursor", label: "Cursor", dir: "Cursor", app: "Cursor.app"},
+}
+
+// editorFiles are the files of the user directory that are backed up, next
+// to everything in snippets/
+var editorFiles = []string{"settings.json", "keybindings.json"}
+
+// editorBackup is the object stored for an editor
+type editorBackup struct {
+	Files      map[string]string `json:"files"` // Relative to the user directory
+	Extensions []string          `json:"extensions"`
+}
+
+// objectName returns the name of the object holding the editor's setup
+func (e editor) objectName() string {
+	return "vscode-" + e.name + ".json"
+}
+
+// userDir returns the directory holding the editor's settings
+func (e editor) userDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Application Support", e.dir, "User"), nil
+}
+
+// cli finds the editor's command line tool, which isn't necessarily linked
+// into the PATH
+func (e editor) cli() (string, bool) {
+	if path, ok := lookPath(e.name); ok {
+		return path, true
+	}
+	home, _ := os.UserHomeDir()
+	for _, apps := range []string{"/Applications", filepath.Join(home, "Applications")} {
+		path := filepath.Join(apps, e.app, "Contents", "Resources", "app", "bin", e.name)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// selected returns the editors the options apply to
+func (o VSCodeOptions) selected() ([]editor, error) {
+	if len(o.Editors) == 0 {
+		return editors, nil
+	}
+
+	list := make([]editor, 0, len(o.Editors))
+	for _, name := range o.Editors {
+		i := slices.IndexFunc(editors, func(e editor) bool { return e.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown editor %q, expected code or cursor", name)
+		}
+		list = append(list, editors[i])
+	}
+	return list, nil
+}
+
+// BackupVSCode stores the settings, keybindings, snippets and the extension
+// list of every selected editor. Editors that aren't installed are skipped,
+// unless they were selected explicitly.
+func BackupVSCode(store storage.Storage, opts VSCodeOptions) error {
+	list, err := opts.selected()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range list {
+		dir, err := e.userDir()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			if len(opts.Editors) == 0 {
+				continue
+			}
+			return fmt.Errorf("%s is not installed", e.label)
+		}
+
+		backup, err := readEditor(e, dir)
+		if err != nil {
+			return fmt.Errorf("failed to read %s setup: %w", e.label, err)
+		}
+
+		data, err := json.MarshalIndent(backup, "", "  ")
+		if err != nil {
+			return err
+		}
+		w, err := store.Create(e.objectName())
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			w.Abort()
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readEditor collects the config files and extensions of an editor
+func readEditor(e editor, dir string) (*editorBackup, error) {
+	backup := &editorBackup{Files: make(map[string]string), Extensions: make([]string, 0)}
+
+	for _, name := range editorFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		backup.Files[name] = string(data)
+	}
+
+	snippets, err := os.ReadDir(filepath.Join(dir, "snippets"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range snippets {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := "snippets/" + entry.Name()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		backup.Files[name] = string(data)
+	}
+
+	// Without the command line tool only the files can be restored
+	cli, ok := e.cli()
+	if !ok {
+		return backup, nil
+	}
+	out, err := exec.Command(cli, "--list-extensions").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s --list-extensions: %w", e.name, err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if id := strings.TrimSpace(line); id != "" {
+			backup.Extensions = append(backup.Extensions, id)
+		}
+	}
+
+	return backup, nil
+}
+
+// RestoreVSCode places the config files of every editor in the backup and
+// reinstalls its extensions. progress is called with the fraction of
+// installed extensions and the extension being installed. Extensions that
+// fail don't stop the others.
+func RestoreVSCode(store storage.Storage, opts VSCodeOptions, progress func(done float64, entry string)) error {
+	list, err := opts.selected()
+	if err != nil {
+		return err
+	}
+
+	backups := make(map[string]*editorBackup)
+	total := 0
+	for _, e := range list {
+		backup, err := openEditor(store, e)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		backups[e.name] = backup
+		total += len(backup.Extensions)
+	}
+
+	var failed []error
+	installed, missed := 0, 0
+	for _, e := range list {
+		backup, ok := backups[e.name]
+		if !ok {
+			continue
+		}
+
+		dir, err := e.userDir()
+		if err != nil {
+			return err
+		}
+		for name, content := range backup.Files {
+			if !filepath.IsLocal(filepath.FromSlash(name)) {
+				return fmt.Errorf("invalid file name %q in %s", name, e.objectName())
+			}
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+		}
+
+		if len(backup.Extensions) == 0 {
+			continue
+		}
+		cli, ok := e.cli()
+		if !ok {
+			failed = append(failed, fmt.Errorf("  - %s command not found, install %s to restore its extensions", e.name, e.label))
+			installed += len(backup.Extensions)
+			missed += len(backup.Extensions)
+			continue
+		}
+		for _, id := range backup.Extensions {
+			progress(float64(installed)/float64(total), id)
+			if out, err := exec.Command(cli, "--install-extension", id).CombinedOutput(); err != nil {
+				failed = append(failed, fmt.Errorf("  - %s: %s", id, strings.TrimSpace(string(out))))
+				missed++
+			}
+			installed++
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d extensions failed to install:\n%w", missed, total, errors.Join(failed...))
+	}
+
+	progress(1, "")
+	return nil
+}
+
+// openEditor reads the stored setup of an editor
+func openEditor(store storage.Storage, e editor) (*editorBackup, error) {
+	r, err := store.Open(e.objectName())
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var backup editorBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", e.objectName(), err)
+	}
+	return &backup, nil
+}
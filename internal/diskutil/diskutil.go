@@ -0,0 +1,22 @@
+package diskutil
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// Eject flushes all pending writes and ejects the volume mounted at mountPoint
+func Eject(mountPoint string) error {
+	syscall.Sync()
+
+	out, err := exec.Command("diskutil", "eject", mountPoint).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("diskutil eject: %s", msg)
+		}
+		return fmt.Errorf("diskutil eject: %w", err)
+	}
+	return nil
+}
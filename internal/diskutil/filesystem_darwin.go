@@ -0,0 +1,20 @@
+package diskutil
+
+import "syscall"
+
+// Filesystem returns the filesystem type of the volume at mountPoint, e.g. "apfs"
+func Filesystem(mountPoint string) (string, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(mountPoint, &stat); err != nil {
+		return "", err
+	}
+
+	name := make([]byte, 0, len(stat.Fstypename))
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), nil
+}
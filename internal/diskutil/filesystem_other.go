@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package diskutil
+
+// Filesystem returns the filesystem type of the volume at mountPoint. It is
+// only known on macOS.
+func Filesystem(mountPoint string) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,200 @@
+package launchd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Agent describes a per-user launchd job (LaunchAgent)
+type Agent struct {
+	Label             string
+	ProgramArguments  []string
+	RunAtLoad         bool
+	StartOnMount      bool              // Start whenever any filesystem is mounted
+	StartCalendar     *CalendarInterval // Start at a time of day, missed starts run after waking up
+	StandardOutPath   string
+	StandardErrorPath string
+}
+
+// CalendarInterval is a time of day a job is started at
+type CalendarInterval struct {
+	Hour   int
+	Minute int
+}
+
+// Path returns the location of the agent's plist
+func Path(label string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, label+".plist"), nil
+}
+
+// Plist renders the agent as a property list
+func (a Agent) Plist() []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+
+	writeKey(&b, "Label")
+	writeString(&b, a.Label)
+
+	writeKey(&b, "ProgramArguments")
+	b.WriteString("\t<array>\n")
+	for _, arg := range a.ProgramArguments {
+		b.WriteString("\t")
+		writeString(&b, arg)
+	}
+	b.WriteString("\t</array>\n")
+
+	if a.RunAtLoad {
+		writeKey(&b, "RunAtLoad")
+		b.WriteString("\t<true/>\n")
+	}
+	if a.StartOnMount {
+		writeKey(&b, "StartOnMount")
+		b.WriteString("\t<true/>\n")
+	}
+	if a.StartCalendar != nil {
+		writeKey(&b, "StartCalendarInterval")
+		b.WriteString("\t<dict>\n")
+		fmt.Fprintf(&b, "\t\t<key>Hour</key>\n\t\t<integer>%d</integer>\n", a.StartCalendar.Hour)
+		fmt.Fprintf(&b, "\t\t<key>Minute</key>\n\t\t<integer>%d</integer>\n", a.StartCalendar.Minute)
+		b.WriteString("\t</dict>\n")
+	}
+	if a.StandardOutPath != "" {
+		writeKey(&b, "StandardOutPath")
+		writeString(&b, a.StandardOutPath)
+	}
+	if a.StandardErrorPath != "" {
+		writeKey(&b, "StandardErrorPath")
+		writeString(&b, a.StandardErrorPath)
+	}
+
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// Install writes the agent's plist and loads it into the user's launchd domain,
+// replacing a previously installed version
+func Install(a Agent) error {
+	path, err := Path(a.Label)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create LaunchAgents directory: %w", err)
+	}
+
+	// Unload an existing version first, launchd doesn't pick up changes otherwise
+	if _, err := os.Stat(path); err == nil {
+		launchctl("bootout", domain(), path)
+	}
+
+	if err := os.WriteFile(path, a.Plist(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := launchctl("bootstrap", domain(), path); err != nil {
+		return fmt.Errorf("failed to load agent: %w", err)
+	}
+
+	return nil
+}
+
+// Uninstall unloads the agent and removes its plist
+func Uninstall(label string) error {
+	path, err := Path(label)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("agent %s is not installed", label)
+	}
+
+	launchctl("bootout", domain(), path)
+
+	return os.Remove(path)
+}
+
+// Dir returns the directory holding the user's LaunchAgents
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home dir: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents"), nil
+}
+
+// Load loads a plist into the user's launchd domain, replacing a loaded
+// version of the same job
+func Load(path string) error {
+	launchctl("bootout", domain(), path)
+	return launchctl("bootstrap", domain(), path)
+}
+
+// SetEnabled enables or disables a job. Disabled jobs aren't loaded, not
+// even at login.
+func SetEnabled(label string, enabled bool) error {
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+	return launchctl(action, domain()+"/"+label)
+}
+
+// Disabled returns the labels of all disabled jobs of the user
+func Disabled() (map[string]bool, error) {
+	out, err := exec.Command("launchctl", "print-disabled", domain()).Output()
+	if err != nil {
+		return nil, fmt.Errorf("launchctl print-disabled: %w", err)
+	}
+
+	// Lines look like `"com.example.job" => disabled` (or "=> true" before macOS 13)
+	disabled := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		label, state, ok := strings.Cut(strings.TrimSpace(line), " => ")
+		if !ok {
+			continue
+		}
+		state = strings.TrimSpace(state)
+		disabled[strings.Trim(label, `"`)] = state == "disabled" || state == "true"
+	}
+	return disabled, nil
+}
+
+// domain returns the launchd domain of the current GUI user
+func domain() string {
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+// launchctl runs launchctl and includes its output in errors
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s: %s", args[0], bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func writeKey(b *bytes.Buffer, key string) {
+	b.WriteString("\t<key>")
+	xml.EscapeText(b, []byte(key))
+	b.WriteString("</key>\n")
+}
+
+func writeString(b *bytes.Buffer, value string) {
+	b.WriteString("\t<string>")
+	xml.EscapeText(b, []byte(value))
+	b.WriteString("</string>\n")
+}
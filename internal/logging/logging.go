@@ -0,0 +1,164 @@
+// Package logging writes the leveled logs of macup as plain lines to stderr
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Levels selected by the global verbosity flags
+const (
+	LevelQuiet   = slog.LevelError // --quiet, e.g. for cron: errors only
+	LevelDefault = slog.LevelInfo  // Interactive use
+	LevelVerbose = slog.LevelDebug // --verbose: every file and timings
+)
+
+// Setup makes the logs from the given level on go to stderr
+func Setup(level slog.Level) {
+	slog.SetDefault(slog.New(&handler{w: os.Stderr, level: level, mu: new(sync.Mutex)}))
+}
+
+// handler formats records the way macup prints everything else: warnings
+// start with ⚠, debug lines with the time, attributes follow as key=value
+type handler struct {
+	w      io.Writer
+	level  slog.Level
+	attrs  []slog.Attr
+	prefix string // Of the keys in the current group
+	mu     *sync.Mutex
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("✗ ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("⚠ ")
+	case r.Level < slog.LevelInfo:
+		b.WriteString(r.Time.Format("15:04:05.000 "))
+	}
+	b.WriteString(r.Message)
+
+	for _, a := range h.attrs {
+		writeAttr(&b, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.prefix, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		next.attrs = append(next.attrs, a)
+	}
+	return &next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.prefix = h.prefix + name + "."
+	return &next
+}
+
+// writeAttr appends an attribute as key=value, quoting values with spaces
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, child := range a.Value.Group() {
+			writeAttr(b, prefix+a.Key+".", child)
+		}
+		return
+	}
+
+	var value string
+	switch a.Value.Kind() {
+	case slog.KindDuration:
+		d := a.Value.Duration()
+		if d > time.Millisecond {
+			d = d.Round(time.Millisecond)
+		}
+		value = d.String()
+	default:
+		value = a.Value.String()
+	}
+	if strings.ContainsAny(value, " \"=") || value == "" {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, a.Key, value)
+}
+
+// Capture records the warnings and errors logged from now on, also those the
+// level leaves out, until the returned function is called. It returns their
+// messages.
+func Capture() func() []string {
+	previous := slog.Default()
+	c := &capture{next: previous.Handler(), mu: new(sync.Mutex), messages: new([]string)}
+	slog.SetDefault(slog.New(c))
+	return func() []string {
+		slog.SetDefault(previous)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return *c.messages
+	}
+}
+
+// capture records warnings for Capture and passes records on to the handler
+// it replaced
+type capture struct {
+	next     slog.Handler
+	mu       *sync.Mutex
+	messages *[]string
+}
+
+func (c *capture) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || c.next.Enabled(ctx, level)
+}
+
+func (c *capture) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		c.mu.Lock()
+		*c.messages = append(*c.messages, r.Message)
+		c.mu.Unlock()
+	}
+	if !c.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return c.next.Handle(ctx, r)
+}
+
+func (c *capture) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *c
+	next.next = c.next.WithAttrs(attrs)
+	return &next
+}
+
+func (c *capture) WithGroup(name string) slog.Handler {
+	next := *c
+	next.next = c.next.WithGroup(name)
+	return &next
+}
@@ -0,0 +1,12 @@
+package notify
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// Notify posts a macOS Notification Center notification
+func Notify(title, message string) error {
+	script := "display notification " + strconv.Quote(message) + " with title " + strconv.Quote(title)
+	return exec.Command("osascript", "-e", script).Run()
+}
@@ -0,0 +1,103 @@
+package peer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// serviceType is the Bonjour service type receivers advertise
+const serviceType = "_macup._tcp"
+
+// Peer is a receiver found on the local network
+type Peer struct {
+	Name string
+	Host string
+	Port int
+}
+
+var (
+	browseLine  = regexp.MustCompile(`^\S+\s+Add\s+\d+\s+\d+\s+\S+\s+\S+\s+(.+)$`)
+	resolveLine = regexp.MustCompile(`can be reached at (\S+?)\.?:(\d+)`)
+)
+
+// Address returns the host and port of the peer
+func (p Peer) Address() string {
+	return p.Host + ":" + strconv.Itoa(p.Port)
+}
+
+// Advertise announces a receiver via Bonjour until the returned stop
+// function is called
+func Advertise(name string, port int) (func(), error) {
+	cmd := exec.Command("dns-sd", "-R", name, serviceType, "local", strconv.Itoa(port))
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to advertise receiver: %w", err)
+	}
+
+	return func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}, nil
+}
+
+// Discover browses the local network for receivers for the given duration
+func Discover(timeout time.Duration) ([]Peer, error) {
+	names, err := scan(timeout, browseLine, "-B", serviceType, "local")
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]Peer, 0, len(names))
+	seen := make(map[string]bool)
+	for _, match := range names {
+		name := match[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		found, err := scan(timeout, resolveLine, "-L", name, serviceType, "local")
+		if err != nil || len(found) == 0 {
+			continue
+		}
+		port, _ := strconv.Atoi(found[0][2])
+		peers = append(peers, Peer{Name: name, Host: found[0][1], Port: port})
+	}
+
+	return peers, nil
+}
+
+// scan runs dns-sd, which never exits by itself, and collects the matches of
+// pattern in its output until the timeout. Resolving stops at the first match.
+func scan(timeout time.Duration, pattern *regexp.Regexp, args ...string) ([][]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "dns-sd", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start dns-sd: %w", err)
+	}
+	defer cmd.Wait()
+	defer cancel()
+
+	var matches [][]string
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if match := pattern.FindStringSubmatch(scanner.Text()); match != nil {
+			matches = append(matches, match)
+			if args[0] == "-L" {
+				break
+			}
+		}
+	}
+
+	return matches, nil
+}
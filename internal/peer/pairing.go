@@ -0,0 +1,68 @@
+package peer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// codeLength is the number of fingerprint digits that make up a pairing code
+const codeLength = 12
+
+// Fingerprint returns the hex encoded SHA-256 of a DER encoded certificate
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// NewCertificate creates a throwaway self-signed certificate and the pairing
+// code derived from it. The sender pins the certificate by the code, so no
+// certificate authority is needed.
+func NewCertificate() (tls.Certificate, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "macup receive"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, "", err
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, FormatCode(Fingerprint(der)[:codeLength]), nil
+}
+
+// FormatCode groups a pairing code in blocks of four for reading it out
+func FormatCode(code string) string {
+	code = NormalizeCode(code)
+
+	var blocks []string
+	for len(code) > 4 {
+		blocks = append(blocks, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(blocks, code), "-")
+}
+
+// NormalizeCode strips separators and case from a typed pairing code
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
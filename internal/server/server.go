@@ -0,0 +1,249 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// Server receives and serves the backups of several Macs. Every backup is a
+// directory below the store, usually named after the Mac it belongs to.
+type Server struct {
+	// Stored is called after an object was stored, if set
+	Stored func(backup, object string)
+
+	store string
+	token string
+	mux   *http.ServeMux
+}
+
+// New creates a server storing backups in the store directory. Every request
+// has to carry token as bearer token.
+func New(store, token string) (*Server, error) {
+	if token == "" {
+		return nil, errors.New("a token is required")
+	}
+	if err := os.MkdirAll(store, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Server{store: store, token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /v1/health", s.health)
+	s.mux.HandleFunc("GET /v1/backups", s.listBackups)
+	s.mux.HandleFunc("GET /v1/backups/{backup}", s.listObjects)
+	s.mux.HandleFunc("DELETE /v1/backups/{backup}", s.removeBackup)
+	s.mux.HandleFunc("PUT /v1/backups/{backup}/{object}", s.putObject)
+	s.mux.HandleFunc("GET /v1/backups/{backup}/{object}", s.getObject)
+	s.mux.HandleFunc("HEAD /v1/backups/{backup}/{object}", s.getObject)
+	s.mux.HandleFunc("DELETE /v1/backups/{backup}/{object}", s.removeObject)
+
+	return s, nil
+}
+
+// ServeHTTP checks the token and dispatches the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// validName reports whether a backup or object name is safe to use as a
+// file name inside the store
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, ".tmp")
+}
+
+// backup opens the storage of the backup named in the request
+func (s *Server) backup(w http.ResponseWriter, r *http.Request) (*storage.Local, bool) {
+	name := r.PathValue("backup")
+	if !validName(name) {
+		http.Error(w, "invalid backup name", http.StatusBadRequest)
+		return nil, false
+	}
+
+	store, err := storage.NewLocal(filepath.Join(s.store, name))
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	return store, true
+}
+
+// object returns the object name of the request
+func object(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("object")
+	if !validName(name) {
+		http.Error(w, "invalid object name", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+// writeError maps an error to a status code
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// writeJSON sends a JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// health reports the free space of the store
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(s.store, &stat); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]int64{"free": int64(stat.Bavail) * int64(stat.Bsize)})
+}
+
+// listBackups returns the names of all backups in the store
+func (s *Server) listBackups(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(s.store)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && validName(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	writeJSON(w, names)
+}
+
+// listObjects returns the names of all objects of a backup
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.backup(w, r)
+	if !ok {
+		return
+	}
+
+	names, err := store.List()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, names)
+}
+
+// removeBackup deletes a backup with all of its objects
+func (s *Server) removeBackup(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.backup(w, r); !ok {
+		return
+	}
+
+	dir := filepath.Join(s.store, r.PathValue("backup"))
+	if _, err := os.Stat(dir); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// putObject stores the request body as an object. It only becomes visible
+// once the whole body arrived.
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.backup(w, r)
+	if !ok {
+		return
+	}
+	name, ok := object(w, r)
+	if !ok {
+		return
+	}
+
+	writer, err := store.Create(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if _, err := io.Copy(writer, r.Body); err != nil {
+		writer.Abort()
+		writeError(w, err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+
+	if s.Stored != nil {
+		s.Stored(r.PathValue("backup"), name)
+	}
+}
+
+// getObject streams an object, or only reports its size for HEAD requests
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.backup(w, r)
+	if !ok {
+		return
+	}
+	name, ok := object(w, r)
+	if !ok {
+		return
+	}
+
+	size, err := store.Stat(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	file, err := store.Open(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer file.Close()
+	io.Copy(w, file)
+}
+
+// removeObject deletes an object
+func (s *Server) removeObject(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.backup(w, r)
+	if !ok {
+		return
+	}
+	name, ok := object(w, r)
+	if !ok {
+		return
+	}
+
+	if err := store.Remove(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
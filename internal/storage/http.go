@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errReadOnly is returned when writing to a read-only storage
+var errReadOnly = errors.New("storage is read-only")
+
+// HTTP reads a backup served by any web server. It is read-only and, since
+// plain HTTP can't list a directory, derives its contents from the manifest.
+type HTTP struct {
+	base   *url.URL // Directory URL, always ending in "/"
+	client *http.Client
+}
+
+// NewHTTP creates a read-only storage for an http(s) directory URL. Basic auth
+// credentials can be part of the URL.
+func NewHTTP(rawURL string) (*HTTP, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	return &HTTP{base: base, client: http.DefaultClient}, nil
+}
+
+// url returns the absolute URL of an object
+func (h *HTTP) url(name string) string {
+	u := *h.base
+	u.Path = h.base.Path + name
+	return u.String()
+}
+
+// do sends a request and maps the status code to an error
+func (h *HTTP) do(method, name string) (*http.Response, error) {
+	req, err := http.NewRequest(method, h.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: %w", h.Path(name), fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, h.Path(name), resp.Status)
+	}
+
+	return resp, nil
+}
+
+// Create fails, HTTP backups are read-only
+func (h *HTTP) Create(name string) (Writer, error) {
+	return nil, errReadOnly
+}
+
+// Open streams an object from the server
+func (h *HTTP) Open(name string) (io.ReadCloser, error) {
+	resp, err := h.do(http.MethodGet, name)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat returns the size of an object
+func (h *HTTP) Stat(name string) (int64, error) {
+	resp, err := h.do(http.MethodHead, name)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// List returns the config, the manifest and all archives listed in it
+func (h *HTTP) List() ([]string, error) {
+	r, err := h.Open("manifest.json")
+	if err != nil {
+		return nil, fmt.Errorf("can't list a backup without manifest: %w", err)
+	}
+	defer r.Close()
+
+	var manifest struct {
+		Config    string `json:"config"`
+		Locations []struct {
+			Archive string `json:"archive"`
+		} `json:"locations"`
+	}
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	// Backups of older versions always bundle a config.yaml
+	config := cmp.Or(manifest.Config, "config.yaml")
+	names := []string{config, "manifest.json"}
+	for _, loc := range manifest.Locations {
+		names = append(names, loc.Archive)
+	}
+	return names, nil
+}
+
+// Remove fails, HTTP backups are read-only
+func (h *HTTP) Remove(name string) error {
+	return errReadOnly
+}
+
+// Path returns the URL of an object without credentials
+func (h *HTTP) Path(name string) string {
+	u, _ := url.Parse(h.url(name))
+	return u.Redacted()
+}
+
+// String returns the directory URL without credentials
+func (h *HTTP) String() string {
+	return h.Path("")
+}
+
+// Check fails, HTTP backups are read-only
+func (h *HTTP) Check(need int64) error {
+	return errReadOnly
+}
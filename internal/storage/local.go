@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Local stores objects as files in a directory
+type Local struct {
+	dir string
+}
+
+// localWriter writes to a temporary file that is renamed into place on Close
+type localWriter struct {
+	file *os.File
+	path string
+}
+
+// NewLocal creates a storage backed by the directory at dir
+func NewLocal(dir string) (*Local, error) {
+	// Don't silently write to the system disk when an external drive is
+	// not mounted, MkdirAll would happily create its mount point
+	if volume, ok := Volume(dir); ok {
+		if _, err := os.Stat(volume); err != nil {
+			return nil, fmt.Errorf("volume %s is not mounted", filepath.Base(volume))
+		}
+	}
+
+	return &Local{dir: dir}, nil
+}
+
+// Volume returns the mount point of the external volume a local path is on
+func Volume(dir string) (string, bool) {
+	rest, ok := strings.CutPrefix(filepath.Clean(dir), "/Volumes/")
+	if !ok || rest == "" {
+		return "", false
+	}
+	volume, _, _ := strings.Cut(rest, "/")
+	return filepath.Join("/Volumes", volume), true
+}
+
+// Create creates a temporary file next to the final object path
+func (l *Local) Create(name string) (Writer, error) {
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(l.dir, name)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &localWriter{file: file, path: path}, nil
+}
+
+// Open opens an object file for reading
+func (l *Local) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(l.dir, name))
+}
+
+// Stat returns the size of an object file
+func (l *Local) Stat(name string) (int64, error) {
+	info, err := os.Stat(filepath.Join(l.dir, name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// List returns all finished object files in the directory
+func (l *Local) List() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+
+	return names, nil
+}
+
+// Remove deletes an object file
+func (l *Local) Remove(name string) error {
+	return os.Remove(filepath.Join(l.dir, name))
+}
+
+// Path returns the file path of an object
+func (l *Local) Path(name string) string {
+	return filepath.Join(l.dir, name)
+}
+
+// String returns the directory path
+func (l *Local) String() string {
+	return l.dir
+}
+
+// Write writes data to the temporary file
+func (w *localWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+// Close flushes the temporary file to disk and renames it into place
+func (w *localWriter) Close() error {
+	if err := errors.Join(w.file.Sync(), w.file.Close()); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	return os.Rename(w.file.Name(), w.path)
+}
+
+// Abort removes the temporary file
+func (w *localWriter) Abort() error {
+	w.file.Close()
+	return os.Remove(w.file.Name())
+}
+
+// Check makes sure the free space of the filesystem holding the directory
+// covers need
+func (l *Local) Check(need int64) error {
+	free, err := l.Free()
+	if err != nil {
+		return err
+	}
+	return checkSpace(free, need)
+}
+
+// Free returns the free space of the filesystem holding the directory. The
+// directory may not exist yet, the closest existing parent is checked then.
+func (l *Local) Free() (int64, error) {
+	dir := l.dir
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, fmt.Errorf("can't determine free space: %w", err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Multi fans every write out to several storages. A target that fails is
+// dropped with its error recorded, the others carry on.
+type Multi struct {
+	targets []Storage
+	names   []string
+
+	mu     sync.Mutex
+	failed map[int]error
+}
+
+// multiWriter writes the same object to all healthy targets
+type multiWriter struct {
+	m       *Multi
+	writers map[int]Writer
+}
+
+// NewMulti opens all targets. Targets that can't be opened are recorded as
+// failed, opening only fails if none of them is available.
+func NewMulti(targets []string, opts Options) (*Multi, error) {
+	m := &Multi{
+		targets: make([]Storage, len(targets)),
+		names:   targets,
+		failed:  make(map[int]error),
+	}
+
+	for i, target := range targets {
+		store, err := New(target, opts)
+		if err != nil {
+			m.failed[i] = err
+			continue
+		}
+		m.targets[i] = store
+	}
+
+	if len(m.healthy()) == 0 {
+		return nil, fmt.Errorf("no output target available:\n%w", errors.Join(m.Failures()...))
+	}
+
+	return m, nil
+}
+
+// Failures returns one error per failed target
+func (m *Multi) Failures() []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := make([]error, 0, len(m.failed))
+	for i, name := range m.names {
+		if err, ok := m.failed[i]; ok {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// Targets returns the targets that haven't failed
+func (m *Multi) Targets() []string {
+	healthy := m.healthy()
+	names := make([]string, 0, len(healthy))
+	for _, i := range healthy {
+		names = append(names, m.names[i])
+	}
+	return names
+}
+
+// fail marks a target as failed, keeping its first error
+func (m *Multi) fail(i int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.failed[i]; !ok {
+		m.failed[i] = err
+	}
+}
+
+// healthy returns the indices of all targets that haven't failed
+func (m *Multi) healthy() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	indices := make([]int, 0, len(m.targets))
+	for i := range m.targets {
+		if _, ok := m.failed[i]; !ok {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// Check checks every healthy target that supports it, dropping the ones that
+// fail. It only fails if no target passes.
+func (m *Multi) Check(need int64) error {
+	for _, i := range m.healthy() {
+		if checker, ok := m.targets[i].(Checker); ok {
+			if err := checker.Check(need); err != nil {
+				m.fail(i, err)
+			}
+		}
+	}
+
+	if len(m.healthy()) == 0 {
+		return fmt.Errorf("no output target available:\n%w", errors.Join(m.Failures()...))
+	}
+	return nil
+}
+
+// Create opens the object on every healthy target
+func (m *Multi) Create(name string) (Writer, error) {
+	w := &multiWriter{m: m, writers: make(map[int]Writer)}
+	for _, i := range m.healthy() {
+		writer, err := m.targets[i].Create(name)
+		if err != nil {
+			m.fail(i, err)
+			continue
+		}
+		w.writers[i] = writer
+	}
+
+	if len(w.writers) == 0 {
+		return nil, fmt.Errorf("all output targets failed")
+	}
+	return w, nil
+}
+
+// Open reads the object from the first healthy target
+func (m *Multi) Open(name string) (io.ReadCloser, error) {
+	return m.targets[m.healthy()[0]].Open(name)
+}
+
+// Stat returns the size of an object only if every healthy target has it
+// with the same size, so a target that lacks it gets a fresh copy
+func (m *Multi) Stat(name string) (int64, error) {
+	size := int64(-1)
+	for _, i := range m.healthy() {
+		s, err := m.targets[i].Stat(name)
+		if err != nil {
+			return 0, err
+		}
+		if size >= 0 && s != size {
+			return 0, fmt.Errorf("%s differs between output targets", name)
+		}
+		size = s
+	}
+	return size, nil
+}
+
+// List returns the objects of the first healthy target
+func (m *Multi) List() ([]string, error) {
+	return m.targets[m.healthy()[0]].List()
+}
+
+// Remove deletes an object from every healthy target
+func (m *Multi) Remove(name string) error {
+	var errs []error
+	for _, i := range m.healthy() {
+		if err := m.targets[i].Remove(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Path returns the location of an object on the first healthy target
+func (m *Multi) Path(name string) string {
+	return m.targets[m.healthy()[0]].Path(name)
+}
+
+// String lists all healthy targets
+func (m *Multi) String() string {
+	names := make([]string, 0, len(m.targets))
+	for _, i := range m.healthy() {
+		names = append(names, m.targets[i].String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// Write writes to every target, dropping targets whose write fails
+func (w *multiWriter) Write(p []byte) (int, error) {
+	for i, writer := range w.writers {
+		if _, err := writer.Write(p); err != nil {
+			w.m.fail(i, err)
+			writer.Abort()
+			delete(w.writers, i)
+		}
+	}
+
+	if len(w.writers) == 0 {
+		return 0, fmt.Errorf("all output targets failed")
+	}
+	return len(p), nil
+}
+
+// Close commits the object on every remaining target
+func (w *multiWriter) Close() error {
+	committed := 0
+	for i, writer := range w.writers {
+		if err := writer.Close(); err != nil {
+			w.m.fail(i, err)
+			continue
+		}
+		committed++
+	}
+
+	if committed == 0 {
+		return fmt.Errorf("all output targets failed")
+	}
+	return nil
+}
+
+// Suspend keeps what was written on every remaining target that can resume
+// it and discards it on the others
+func (w *multiWriter) Suspend() error {
+	var errs []error
+	for _, writer := range w.writers {
+		if s, ok := writer.(Suspender); ok {
+			errs = append(errs, s.Suspend())
+		} else {
+			errs = append(errs, writer.Abort())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Abort discards the object on every remaining target
+func (w *multiWriter) Abort() error {
+	var errs []error
+	for _, writer := range w.writers {
+		if err := writer.Abort(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
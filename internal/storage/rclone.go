@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+// RcloneOptions configures the rclone backend
+type RcloneOptions struct {
+	Binary string   `yaml:"binary"` // Path to the rclone executable (default "rclone")
+	Config string   `yaml:"config"` // Alternative rclone.conf
+	Flags  []string `yaml:"flags"`  // Extra flags passed to every rclone call
+}
+
+// Rclone stores objects on any rclone remote by shelling out to rclone, reusing
+// the remotes the user already configured (Google Drive, OneDrive, Dropbox, ...)
+type Rclone struct {
+	remote string // e.g. "gdrive:backups"
+	opts   RcloneOptions
+}
+
+// rcloneWriter streams into `rclone rcat` and moves the temporary object into
+// place on Close
+type rcloneWriter struct {
+	r      *Rclone
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+}
+
+// rcloneReader streams the output of `rclone cat`
+type rcloneReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// NewRclone creates a storage for an rclone "remote:path" location
+func NewRclone(remote string, opts RcloneOptions) (*Rclone, error) {
+	if !strings.Contains(remote, ":") {
+		return nil, fmt.Errorf("invalid rclone location %q, expected remote:path", remote)
+	}
+	if opts.Binary == "" {
+		opts.Binary = "rclone"
+	}
+	if _, err := exec.LookPath(opts.Binary); err != nil {
+		return nil, fmt.Errorf("rclone not found: %w", err)
+	}
+
+	return &Rclone{remote: strings.TrimSuffix(remote, "/"), opts: opts}, nil
+}
+
+// object returns the rclone path of an object
+func (r *Rclone) object(name string) string {
+	if strings.HasSuffix(r.remote, ":") {
+		return r.remote + name
+	}
+	return r.remote + "/" + name
+}
+
+// command builds an rclone command with the configured global flags
+func (r *Rclone) command(args ...string) *exec.Cmd {
+	all := make([]string, 0, len(args)+len(r.opts.Flags)+2)
+	if r.opts.Config != "" {
+		all = append(all, "--config", r.opts.Config)
+	}
+	all = append(all, r.opts.Flags...)
+	all = append(all, args...)
+	return exec.Command(r.opts.Binary, all...)
+}
+
+// run executes an rclone command and returns its stdout
+func (r *Rclone) run(args ...string) ([]byte, error) {
+	cmd := r.command(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, rcloneError(args[0], err, stderr.String())
+	}
+	return out, nil
+}
+
+// rcloneError converts rclone's exit codes into errors (3 and 4 mean not found)
+func rcloneError(op string, err error, stderr string) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && (exitErr.ExitCode() == 3 || exitErr.ExitCode() == 4) {
+		return fmt.Errorf("rclone %s: %w", op, fs.ErrNotExist)
+	}
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return fmt.Errorf("rclone %s: %s", op, msg)
+	}
+	return fmt.Errorf("rclone %s: %w", op, err)
+}
+
+// Create starts streaming a new object to a temporary name
+func (r *Rclone) Create(name string) (Writer, error) {
+	w := &rcloneWriter{r: r, name: name}
+	w.cmd = r.command("rcat", r.object(name+".tmp"))
+	w.cmd.Stderr = &w.stderr
+
+	stdin, err := w.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	w.stdin = stdin
+
+	if err := w.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start rclone: %w", err)
+	}
+
+	return w, nil
+}
+
+// Open streams an object from the remote
+func (r *Rclone) Open(name string) (io.ReadCloser, error) {
+	// Check existence first, `rclone cat` only fails once reading starts
+	if _, err := r.Stat(name); err != nil {
+		return nil, err
+	}
+
+	cmd := r.command("cat", r.object(name))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start rclone: %w", err)
+	}
+
+	return &rcloneReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// Stat returns the size of an object
+func (r *Rclone) Stat(name string) (int64, error) {
+	out, err := r.run("lsjson", "--stat", r.object(name))
+	if err != nil {
+		return 0, err
+	}
+
+	var entry struct {
+		Size int64 `json:"Size"`
+	}
+	if err := json.Unmarshal(out, &entry); err != nil {
+		return 0, fmt.Errorf("failed to decode rclone output: %w", err)
+	}
+
+	return entry.Size, nil
+}
+
+// List returns the names of all finished objects
+func (r *Rclone) List() ([]string, error) {
+	out, err := r.run("lsf", "--files-only", r.remote)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" && !strings.HasSuffix(line, ".tmp") {
+			names = append(names, line)
+		}
+	}
+
+	return names, nil
+}
+
+// Remove deletes an object
+func (r *Rclone) Remove(name string) error {
+	_, err := r.run("deletefile", r.object(name))
+	return err
+}
+
+// Path returns the rclone path of an object
+func (r *Rclone) Path(name string) string {
+	return "rclone:" + r.object(name)
+}
+
+// String returns the rclone remote
+func (r *Rclone) String() string {
+	return "rclone:" + r.remote
+}
+
+// Write streams data to rclone
+func (w *rcloneWriter) Write(p []byte) (int, error) {
+	return w.stdin.Write(p)
+}
+
+// Close waits for the upload to finish and moves it to its final name
+func (w *rcloneWriter) Close() error {
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		w.r.Remove(w.name + ".tmp")
+		return rcloneError("rcat", err, w.stderr.String())
+	}
+
+	_, err := w.r.run("moveto", w.r.object(w.name+".tmp"), w.r.object(w.name))
+	return err
+}
+
+// Abort kills the upload and removes whatever reached the remote
+func (w *rcloneWriter) Abort() error {
+	w.stdin.Close()
+	w.cmd.Process.Kill()
+	w.cmd.Wait()
+
+	if err := w.r.Remove(w.name + ".tmp"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Close stops rclone and reports its exit status
+func (r *rcloneReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// Check asks the remote for its free space, which also verifies that it is
+// reachable. Remotes that don't support `rclone about` only get the latter.
+func (r *Rclone) Check(need int64) error {
+	free, err := r.Free()
+	if err != nil {
+		return err
+	}
+	return checkSpace(free, need)
+}
+
+// Free asks the remote for its free space, -1 if it doesn't report it
+func (r *Rclone) Free() (int64, error) {
+	root, _, _ := strings.Cut(r.remote, ":")
+	out, err := r.run("about", "--json", root+":")
+	if err != nil {
+		if strings.Contains(err.Error(), "doesn't support about") {
+			_, err = r.run("lsf", "--max-depth", "1", root+":")
+		}
+		return -1, err
+	}
+
+	var about struct {
+		Free *int64 `json:"free"`
+	}
+	if err := json.Unmarshal(out, &about); err != nil || about.Free == nil {
+		return -1, nil
+	}
+	return *about.Free, nil
+}
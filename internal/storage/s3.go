@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// S3Options configures an S3-compatible backend (AWS, MinIO, Backblaze B2)
+type S3Options struct {
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access_key_id" mapstructure:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" mapstructure:"secret_access_key"`
+	Keychain        string `yaml:"keychain"` // Keychain service holding the secret key
+	PathStyle       *bool  `yaml:"path_style" mapstructure:"path_style"`
+	ColdAfter       int    `yaml:"cold_after" mapstructure:"cold_after"`         // Days after which archives move to cold storage, 0 keeps them
+	ColdClass       string `yaml:"cold_class" mapstructure:"cold_class"`         // Storage class for cold archives (default GLACIER)
+	RetrievalTier   string `yaml:"retrieval_tier" mapstructure:"retrieval_tier"` // Glacier retrieval tier used by restore (default Standard)
+}
+
+// S3 stores objects under a key prefix in an S3 bucket
+type S3 struct {
+	bucket    string
+	prefix    string
+	endpoint  string // Scheme and host, e.g. https://s3.eu-central-1.amazonaws.com
+	region    string
+	pathStyle bool
+	creds     s3Credentials
+	client    *http.Client
+	limiter   *rateLimiter // Upload bandwidth limit, nil if unlimited
+	parallel  int          // Number of parts uploaded concurrently
+	coldAfter int          // Days after which archives move to coldClass, 0 disables it
+	coldClass string
+	tier      string // Glacier retrieval tier
+	lifecycle bool   // Whether the lifecycle rule is known to be in place
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// NewS3 creates a storage for a "bucket/prefix" location
+func NewS3(location string, opts S3Options) (*S3, error) {
+	bucket, prefix, _ := strings.Cut(location, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("missing bucket in s3 location")
+	}
+
+	region := opts.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+
+	// Custom endpoints (MinIO, B2) default to path-style addressing
+	pathStyle := endpoint != ""
+	if opts.PathStyle != nil {
+		pathStyle = *opts.PathStyle
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	coldClass := opts.ColdClass
+	if coldClass == "" {
+		coldClass = "GLACIER"
+	}
+	tier := opts.RetrievalTier
+	if tier == "" {
+		tier = "Standard"
+	}
+
+	creds, err := resolveCredentials(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{
+		bucket:    bucket,
+		prefix:    strings.Trim(prefix, "/"),
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		region:    region,
+		pathStyle: pathStyle,
+		creds:     creds,
+		client:    http.DefaultClient,
+		parallel:  1,
+		coldAfter: opts.ColdAfter,
+		coldClass: coldClass,
+		tier:      tier,
+	}, nil
+}
+
+// key returns the full object key for a name
+func (s *S3) key(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+// do sends a signed request for key with the given query and body
+func (s *S3) do(method, key string, query map[string]string, body []byte) (*http.Response, error) {
+	return s.doWithHeaders(method, key, query, nil, body)
+}
+
+// doWithHeaders is do with additional request headers
+func (s *S3) doWithHeaders(method, key string, query, headers map[string]string, body []byte) (*http.Response, error) {
+	scheme, host, _ := strings.Cut(s.endpoint, "://")
+	path := "/" + uriEncode(key, false)
+	if s.pathStyle {
+		path = "/" + s.bucket + path
+	} else {
+		host = s.bucket + "." + host
+	}
+	if key == "" {
+		path = strings.TrimSuffix(path, "/")
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	url := scheme + "://" + host + path
+	if len(query) > 0 {
+		url += "?" + canonicalQuery(query)
+	}
+
+	var reader io.Reader = bytes.NewReader(body)
+	if len(body) > 0 {
+		reader = s.limiter.reader(reader)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	s.sign(req, hashHex(body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("s3://%s/%s: %w", s.bucket, key, fs.ErrNotExist)
+		}
+		var apiErr s3Error
+		data, _ := io.ReadAll(resp.Body)
+		if xml.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, apiErr.Code, apiErr.Message)
+		}
+		return nil, fmt.Errorf("s3 %s %s: %s", method, key, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// Create starts streaming a new object
+func (s *S3) Create(name string) (Writer, error) {
+	if err := s.ensureLifecycle(); err != nil {
+		return nil, err
+	}
+
+	return &s3Writer{
+		s:   s,
+		key: s.key(name),
+		sem: make(chan struct{}, s.parallel),
+	}, nil
+}
+
+// Open streams an object from the bucket
+func (s *S3) Open(name string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, s.key(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat returns the size of an object
+func (s *S3) Stat(name string) (int64, error) {
+	resp, err := s.do(http.MethodHead, s.key(name), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// List returns the names of all objects below the prefix
+func (s *S3) List() ([]string, error) {
+	type listResult struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+
+	prefix := s.key("")
+	names := make([]string, 0)
+	token := ""
+
+	for {
+		query := map[string]string{"list-type": "2", "prefix": prefix, "delimiter": "/"}
+		if token != "" {
+			query["continuation-token"] = token
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode object list: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			names = append(names, strings.TrimPrefix(obj.Key, prefix))
+		}
+
+		if !result.IsTruncated {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Remove deletes an object
+func (s *S3) Remove(name string) error {
+	resp, err := s.do(http.MethodDelete, s.key(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Path returns the s3:// URL of an object
+func (s *S3) Path(name string) string {
+	return "s3://" + s.bucket + "/" + s.key(name)
+}
+
+// String returns the s3:// URL of the prefix
+func (s *S3) String() string {
+	return strings.TrimSuffix("s3://"+s.bucket+"/"+s.prefix, "/")
+}
+
+// Check lists a single key to make sure the bucket is reachable and the
+// credentials are valid. S3 has no quota to check.
+func (s *S3) Check(need int64) error {
+	resp, err := s.do(http.MethodGet, "", map[string]string{"list-type": "2", "prefix": s.key(""), "max-keys": "1"}, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Credentials holds the keys used to sign requests
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// resolveCredentials looks up credentials in the config, then the environment
+// and finally the macOS Keychain (secret only, looked up by access key id)
+func resolveCredentials(opts S3Options) (s3Credentials, error) {
+	creds := s3Credentials{
+		accessKeyID:     opts.AccessKeyID,
+		secretAccessKey: opts.SecretAccessKey,
+	}
+
+	if creds.accessKeyID == "" {
+		creds.accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if creds.secretAccessKey == "" {
+		creds.secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		creds.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if creds.accessKeyID == "" {
+		return creds, fmt.Errorf("no S3 access key configured (set s3.access_key_id or AWS_ACCESS_KEY_ID)")
+	}
+
+	if creds.secretAccessKey == "" {
+		service := opts.Keychain
+		if service == "" {
+			service = "macup"
+		}
+		secret, err := keychainSecret(service, creds.accessKeyID)
+		if err != nil {
+			return creds, fmt.Errorf("no S3 secret key configured and none found in Keychain service %q: %w", service, err)
+		}
+		creds.secretAccessKey = secret
+	}
+
+	return creds, nil
+}
+
+// keychainSecret reads a generic password from the login Keychain
+func keychainSecret(service, account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to the request
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	s.signAt(req, payloadHash, time.Now())
+}
+
+// signAt signs the request as sent at a given time
+func (s *S3) signAt(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if s.creds.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.creds.sessionToken)
+	}
+
+	// Canonical headers (host plus every x-amz-* and content-* header)
+	headers := map[string]string{"host": req.Host}
+	for key, values := range req.Header {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "x-amz-") || strings.HasPrefix(lower, "content-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := signingKey(s.creds.secretAccessKey, date, s.region, "s3")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.creds.accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// signingKey derives the key of a day, region and service from the secret key
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// canonicalQuery encodes query parameters sorted by key as required by SigV4
+func canonicalQuery(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, uriEncode(key, true)+"="+uriEncode(params[key], true))
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything except unreserved characters
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
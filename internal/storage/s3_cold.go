@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// s3ColdTag marks objects that the lifecycle rule moves to cold storage
+const s3ColdTag = "macup-tier=cold"
+
+// lifecycleRule is a rule of a bucket lifecycle configuration, kept as raw
+// XML so rules of other tools survive the round trip
+type lifecycleRule struct {
+	XMLName xml.Name `xml:"Rule"`
+	Inner   string   `xml:",innerxml"`
+}
+
+// coldTagging returns the tagging header for an upload of key. Only archives
+// move to cold storage, the config and manifest have to stay readable.
+func (s *S3) coldTagging(key string) map[string]string {
+	if s.coldAfter <= 0 || !isArchive(key) {
+		return nil
+	}
+	return map[string]string{"x-amz-tagging": s3ColdTag}
+}
+
+// isArchive reports whether a key is an archive, in any compression format,
+// or a part of a split one, e.g. "Projects.tar.zst.001"
+func isArchive(key string) bool {
+	if i := strings.LastIndex(key, "."); i >= 0 && i < len(key)-1 && strings.Trim(key[i+1:], "0123456789") == "" {
+		key = key[:i]
+	}
+	return strings.HasSuffix(key, ".tar.gz") || strings.HasSuffix(key, ".tar.zst") || strings.HasSuffix(key, ".tar")
+}
+
+// lifecycleID returns the ID of the lifecycle rule managing this prefix
+func (s *S3) lifecycleID() string {
+	return "macup-" + strings.ReplaceAll(s.prefix, "/", "-")
+}
+
+// ensureLifecycle installs a bucket lifecycle rule transitioning tagged
+// archives below the prefix to the cold storage class, keeping other rules
+func (s *S3) ensureLifecycle() error {
+	if s.coldAfter <= 0 || s.lifecycle {
+		return nil
+	}
+
+	var existing struct {
+		Rules []struct {
+			ID    string `xml:"ID"`
+			Inner string `xml:",innerxml"`
+		} `xml:"Rule"`
+	}
+	resp, err := s.do(http.MethodGet, "", map[string]string{"lifecycle": ""}, nil)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// No lifecycle configuration yet
+	case err != nil:
+		return fmt.Errorf("failed to read bucket lifecycle: %w", err)
+	default:
+		err = xml.NewDecoder(resp.Body).Decode(&existing)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode bucket lifecycle: %w", err)
+		}
+	}
+
+	var ours bytes.Buffer
+	ours.WriteString("<ID>")
+	xml.EscapeText(&ours, []byte(s.lifecycleID()))
+	ours.WriteString("</ID><Filter><And><Prefix>")
+	xml.EscapeText(&ours, []byte(s.key("")))
+	fmt.Fprintf(&ours, "</Prefix><Tag><Key>macup-tier</Key><Value>cold</Value></Tag></And></Filter>"+
+		"<Status>Enabled</Status><Transition><Days>%d</Days><StorageClass>%s</StorageClass></Transition>",
+		s.coldAfter, s.coldClass)
+
+	config := struct {
+		XMLName xml.Name        `xml:"LifecycleConfiguration"`
+		Rules   []lifecycleRule `xml:"Rule"`
+	}{}
+	for _, rule := range existing.Rules {
+		if rule.ID != s.lifecycleID() {
+			config.Rules = append(config.Rules, lifecycleRule{Inner: rule.Inner})
+		}
+	}
+	config.Rules = append(config.Rules, lifecycleRule{Inner: ours.String()})
+
+	body, err := xml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	// S3 insists on a checksum for lifecycle configurations
+	sum := md5.Sum(body)
+	resp, err = s.doWithHeaders(http.MethodPut, "", map[string]string{"lifecycle": ""},
+		map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(sum[:])}, body)
+	if err != nil {
+		return fmt.Errorf("failed to set bucket lifecycle: %w", err)
+	}
+	resp.Body.Close()
+
+	s.lifecycle = true
+	return nil
+}
+
+// Frozen reports whether an object sits in a cold storage class and has to
+// be retrieved before it can be read. A retrieval in progress still counts.
+func (s *S3) Frozen(name string) (bool, error) {
+	resp, err := s.do(http.MethodHead, s.key(name), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.Header.Get("x-amz-storage-class") {
+	case "GLACIER", "DEEP_ARCHIVE":
+		return !strings.Contains(resp.Header.Get("x-amz-restore"), `ongoing-request="false"`), nil
+	default:
+		return false, nil
+	}
+}
+
+// Retrieve requests a temporary readable copy of a frozen object. Requests
+// for objects that are already being retrieved are ignored.
+func (s *S3) Retrieve(name string) error {
+	body := fmt.Sprintf("<RestoreRequest><Days>7</Days><GlacierJobParameters><Tier>%s</Tier></GlacierJobParameters></RestoreRequest>", s.tier)
+	resp, err := s.do(http.MethodPost, s.key(name), map[string]string{"restore": ""}, []byte(body))
+	if err != nil {
+		if strings.Contains(err.Error(), "RestoreAlreadyInProgress") {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
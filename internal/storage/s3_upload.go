@@ -0,0 +1,407 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// s3PartSize is the size of a single multipart upload chunk. Archives are
+	// streamed in parts of this size, so memory usage stays bounded.
+	s3PartSize = 16 << 20
+	// s3PartAttempts is how often a failing part upload is tried
+	s3PartAttempts = 3
+)
+
+// s3Writer streams an object as a multipart upload. Parts left over from an
+// interrupted upload of the same key are reused if their content matches.
+type s3Writer struct {
+	s        *S3
+	key      string
+	buf      bytes.Buffer
+	uploadID string
+	existing map[int]string // ETags of parts uploaded by an interrupted run
+	next     int            // Number of the next part
+	stopped  bool           // Suspended, later writes are dropped
+
+	sem   chan struct{} // Limits concurrent part uploads
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	parts []s3Part
+	err   error
+}
+
+type s3Part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+}
+
+// s3ListedPart is a part of an unfinished upload as listed by S3
+type s3ListedPart struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+	Size   int64  `xml:"Size"`
+}
+
+// s3Upload is an unfinished multipart upload as listed by S3
+type s3Upload struct {
+	Key       string    `xml:"Key"`
+	UploadID  string    `xml:"UploadId"`
+	Initiated time.Time `xml:"Initiated"`
+}
+
+// Write buffers data and uploads every full part in the background
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if err := w.failed(); err != nil {
+		return 0, err
+	}
+	if w.stopped {
+		return len(p), nil
+	}
+
+	n, _ := w.buf.Write(p)
+	for w.buf.Len() >= s3PartSize {
+		part := make([]byte, s3PartSize)
+		copy(part, w.buf.Next(s3PartSize))
+		if err := w.startPart(part); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Close uploads the remaining data and completes the upload. Objects smaller
+// than a single part are sent with a plain PUT instead.
+func (w *s3Writer) Close() error {
+	if w.uploadID == "" {
+		resp, err := w.s.doWithHeaders(http.MethodPut, w.key, nil, w.s.coldTagging(w.key), w.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if w.buf.Len() > 0 {
+		if err := w.startPart(bytes.Clone(w.buf.Bytes())); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	w.wg.Wait()
+	if err := w.failed(); err != nil {
+		return err
+	}
+
+	type completeUpload struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}
+	sort.Slice(w.parts, func(i, j int) bool { return w.parts[i].Number < w.parts[j].Number })
+	body, err := xml.Marshal(completeUpload{Parts: w.parts})
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.s.do(http.MethodPost, w.key, map[string]string{"uploadId": w.uploadID}, body)
+	if err != nil {
+		w.Abort()
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// S3 may report errors in the body of a 200 response
+	var apiErr s3Error
+	if data, _ := io.ReadAll(resp.Body); xml.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+		w.Abort()
+		return fmt.Errorf("failed to complete upload: %s: %s", apiErr.Code, apiErr.Message)
+	}
+
+	return nil
+}
+
+// Suspend waits for the parts in flight and keeps the multipart upload, so
+// the next upload of the key resumes it. Unfinished uploads are cleaned up by
+// prune once they are old.
+func (w *s3Writer) Suspend() error {
+	w.stopped = true
+	w.buf.Reset()
+	w.wg.Wait()
+	return nil
+}
+
+// Abort cancels the multipart upload so no partial object remains. Uploads
+// that broke off because a part failed are kept, so the next run can resume.
+func (w *s3Writer) Abort() error {
+	w.buf.Reset()
+	w.wg.Wait()
+	if w.uploadID == "" || w.failed() != nil {
+		return nil
+	}
+
+	resp, err := w.s.do(http.MethodDelete, w.key, map[string]string{"uploadId": w.uploadID}, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// failed returns the first error of a background part upload
+func (w *s3Writer) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// startPart starts or resumes the multipart upload if needed and uploads one
+// part in the background, blocking while too many uploads are in flight
+func (w *s3Writer) startPart(data []byte) error {
+	if w.uploadID == "" {
+		if err := w.resumeOrCreate(); err != nil {
+			return err
+		}
+	}
+
+	w.next++
+	number := w.next
+	w.sem <- struct{}{}
+	w.wg.Add(1)
+
+	go func() {
+		defer func() {
+			<-w.sem
+			w.wg.Done()
+		}()
+
+		etag, err := w.uploadPart(number, data)
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err != nil {
+			if w.err == nil {
+				w.err = err
+			}
+			return
+		}
+		w.parts = append(w.parts, s3Part{Number: number, ETag: etag})
+	}()
+
+	return w.failed()
+}
+
+// uploadPart sends one part, skipping it if an interrupted upload already
+// stored identical content under the same part number
+func (w *s3Writer) uploadPart(number int, data []byte) (string, error) {
+	sum := md5.Sum(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if w.existing[number] == etag {
+		return etag, nil
+	}
+
+	query := map[string]string{
+		"partNumber": strconv.Itoa(number),
+		"uploadId":   w.uploadID,
+	}
+
+	var err error
+	for attempt := 1; attempt <= s3PartAttempts; attempt++ {
+		var resp *http.Response
+		resp, err = w.s.do(http.MethodPut, w.key, query, data)
+		if err == nil {
+			resp.Body.Close()
+			return resp.Header.Get("ETag"), nil
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+
+	return "", fmt.Errorf("failed to upload part %d: %w", number, err)
+}
+
+// resumeOrCreate continues the most recent unfinished upload of the key or
+// initiates a new multipart upload
+func (w *s3Writer) resumeOrCreate() error {
+	// Some S3 implementations answer 404 if there are no uploads at all
+	id, err := w.findUpload()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to look up unfinished uploads: %w", err)
+	}
+
+	if id != "" {
+		parts, err := w.listParts(id)
+		if err != nil {
+			return fmt.Errorf("failed to list uploaded parts: %w", err)
+		}
+		w.uploadID = id
+		w.existing = parts
+		return nil
+	}
+
+	resp, err := w.s.doWithHeaders(http.MethodPost, w.key, map[string]string{"uploads": ""}, w.s.coldTagging(w.key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to start upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to start upload: %w", err)
+	}
+
+	w.uploadID = result.UploadID
+	return nil
+}
+
+// findUpload returns the id of the latest unfinished upload of the key
+func (w *s3Writer) findUpload() (string, error) {
+	uploads, err := w.s.listUploads(w.key)
+	if err != nil {
+		return "", err
+	}
+
+	id := ""
+	var latest time.Time
+	for _, upload := range uploads {
+		if upload.Key == w.key && upload.Initiated.After(latest) {
+			id, latest = upload.UploadID, upload.Initiated
+		}
+	}
+
+	return id, nil
+}
+
+// listParts returns the ETags of all parts of an unfinished upload
+func (w *s3Writer) listParts(id string) (map[int]string, error) {
+	listed, err := w.s.listParts(w.key, id)
+	if err != nil {
+		return nil, err
+	}
+	parts := make(map[int]string, len(listed))
+	for _, part := range listed {
+		parts[part.Number] = part.ETag
+	}
+	return parts, nil
+}
+
+// listUploads returns the unfinished uploads of keys starting with prefix
+func (s *S3) listUploads(prefix string) ([]s3Upload, error) {
+	var uploads []s3Upload
+	keyMarker, idMarker := "", ""
+
+	for {
+		query := map[string]string{"uploads": "", "prefix": prefix}
+		if keyMarker != "" {
+			query["key-marker"], query["upload-id-marker"] = keyMarker, idMarker
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Uploads            []s3Upload `xml:"Upload"`
+			IsTruncated        bool       `xml:"IsTruncated"`
+			NextKeyMarker      string     `xml:"NextKeyMarker"`
+			NextUploadIDMarker string     `xml:"NextUploadIdMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, result.Uploads...)
+		if !result.IsTruncated {
+			return uploads, nil
+		}
+		keyMarker, idMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+// listParts returns all parts of an unfinished upload of key
+func (s *S3) listParts(key, id string) ([]s3ListedPart, error) {
+	var parts []s3ListedPart
+	marker := ""
+
+	for {
+		query := map[string]string{"uploadId": id}
+		if marker != "" {
+			query["part-number-marker"] = marker
+		}
+
+		resp, err := s.do(http.MethodGet, key, query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Parts                []s3ListedPart `xml:"Part"`
+			IsTruncated          bool           `xml:"IsTruncated"`
+			NextPartNumberMarker string         `xml:"NextPartNumberMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, result.Parts...)
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// Uploads returns the unfinished multipart uploads below the prefix, e.g. of
+// runs that were interrupted and not resumed since
+func (s *S3) Uploads() ([]Upload, error) {
+	prefix := s.key("")
+	listed, err := s.listUploads(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := make([]Upload, 0, len(listed))
+	for _, upload := range listed {
+		name := strings.TrimPrefix(upload.Key, prefix)
+		if strings.Contains(name, "/") {
+			continue // Below another prefix
+		}
+		parts, err := s.listParts(upload.Key, upload.UploadID)
+		if err != nil {
+			return nil, err
+		}
+		var size int64
+		for _, part := range parts {
+			size += part.Size
+		}
+		uploads = append(uploads, Upload{Name: name, ID: upload.UploadID, Initiated: upload.Initiated, Size: size})
+	}
+	return uploads, nil
+}
+
+// AbortUpload discards an unfinished upload and its parts
+func (s *S3) AbortUpload(upload Upload) error {
+	resp, err := s.do(http.MethodDelete, s.key(upload.Name), map[string]string{"uploadId": upload.ID}, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
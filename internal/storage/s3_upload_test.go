@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 serves the multipart upload API of S3 for a single bucket
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]*fakeUpload
+	uploaded []int // Numbers of the parts that were sent
+	ids      int
+}
+
+type fakeUpload struct {
+	key       string
+	initiated time.Time
+	parts     map[int][]byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3) {
+	t.Helper()
+	fake := &fakeS3{objects: make(map[string][]byte), uploads: make(map[string]*fakeUpload)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s3, err := NewS3("bucket/prefix", S3Options{Endpoint: server.URL, AccessKeyID: exampleAccessKey, SecretAccessKey: exampleSecretKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, s3
+}
+
+// start adds an unfinished upload of key with parts, as left by an earlier run
+func (f *fakeS3) start(key string, initiated time.Time, parts ...[]byte) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ids++
+	id := "upload-" + strconv.Itoa(f.ids)
+	upload := &fakeUpload{key: key, initiated: initiated, parts: make(map[int][]byte)}
+	for i, part := range parts {
+		upload.parts[i+1] = part
+	}
+	f.uploads[id] = upload
+	return id
+}
+
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bucket"), "/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	id := query.Get("uploadId")
+	upload := f.uploads[id]
+	if id != "" && upload == nil {
+		http.Error(w, "NoSuchUpload", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && query.Has("uploads"):
+		type listed struct {
+			Key       string
+			UploadId  string
+			Initiated time.Time
+		}
+		var result struct {
+			XMLName xml.Name `xml:"ListMultipartUploadsResult"`
+			Uploads []listed `xml:"Upload"`
+		}
+		for id, upload := range f.uploads {
+			if strings.HasPrefix(upload.key, query.Get("prefix")) {
+				result.Uploads = append(result.Uploads, listed{upload.key, id, upload.initiated})
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.ids++
+		id := "upload-" + strconv.Itoa(f.ids)
+		f.uploads[id] = &fakeUpload{key: key, initiated: time.Now(), parts: make(map[int][]byte)}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodGet && id != "":
+		type part struct {
+			PartNumber int
+			ETag       string
+			Size       int
+		}
+		var result struct {
+			XMLName xml.Name `xml:"ListPartsResult"`
+			Parts   []part   `xml:"Part"`
+		}
+		for number, data := range upload.parts {
+			result.Parts = append(result.Parts, part{number, etagOf(data), len(data)})
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut && id != "":
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		upload.parts[number] = body
+		f.uploaded = append(f.uploaded, number)
+		w.Header().Set("ETag", etagOf(body))
+	case r.Method == http.MethodPost && id != "":
+		var complete struct {
+			Parts []s3Part `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var object []byte
+		for i, part := range complete.Parts {
+			data, ok := upload.parts[part.Number]
+			if part.Number != i+1 || !ok || etagOf(data) != part.ETag {
+				http.Error(w, "InvalidPart", http.StatusBadRequest)
+				return
+			}
+			object = append(object, data...)
+		}
+		f.objects[key] = object
+		delete(f.uploads, id)
+	case r.Method == http.MethodDelete && id != "":
+		delete(f.uploads, id)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	default:
+		http.Error(w, "NotImplemented", http.StatusNotImplemented)
+	}
+}
+
+// testData returns n bytes that differ from part to part
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i / 4096)
+	}
+	return data
+}
+
+func writeObject(t *testing.T, s3 *S3, name string, data []byte) Writer {
+	t.Helper()
+	w, err := s3.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestS3UploadResume(t *testing.T) {
+	data := testData(2*s3PartSize + 1000)
+	first, second := data[:s3PartSize], data[s3PartSize:2*s3PartSize]
+
+	tests := []struct {
+		name     string
+		parts    [][]byte // Parts of the interrupted upload
+		uploaded []int    // Parts the writer has to send
+	}{
+		{"no earlier upload", nil, []int{1, 2, 3}},
+		{"matching parts are skipped", [][]byte{first, second}, []int{3}},
+		{"changed parts are sent again", [][]byte{first, bytes.Repeat([]byte{1}, s3PartSize)}, []int{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, s3 := newFakeS3(t)
+			if tt.parts != nil {
+				fake.start("prefix/Projects.tar.zst", time.Now().Add(-time.Hour), tt.parts...)
+			}
+
+			w := writeObject(t, s3, "Projects.tar.zst", data)
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() = %v", err)
+			}
+
+			slices.Sort(fake.uploaded)
+			if !slices.Equal(fake.uploaded, tt.uploaded) {
+				t.Errorf("uploaded parts %v, want %v", fake.uploaded, tt.uploaded)
+			}
+			if !bytes.Equal(fake.objects["prefix/Projects.tar.zst"], data) {
+				t.Errorf("object differs from the written data")
+			}
+			if len(fake.uploads) != 0 {
+				t.Errorf("%d uploads left unfinished", len(fake.uploads))
+			}
+		})
+	}
+}
+
+func TestS3UploadResumesLatest(t *testing.T) {
+	data := testData(s3PartSize + 1000)
+	fake, s3 := newFakeS3(t)
+	fake.start("prefix/Projects.tar.zst", time.Now().Add(-2*time.Hour), bytes.Repeat([]byte{1}, s3PartSize))
+	fake.start("prefix/Projects.tar.zst", time.Now().Add(-time.Hour), data[:s3PartSize])
+
+	w := writeObject(t, s3, "Projects.tar.zst", data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if !slices.Equal(fake.uploaded, []int{2}) {
+		t.Errorf("uploaded parts %v, want [2]", fake.uploaded)
+	}
+}
+
+func TestS3UploadSuspendAndAbort(t *testing.T) {
+	data := testData(s3PartSize + 1000)
+
+	fake, s3 := newFakeS3(t)
+	w := writeObject(t, s3, "Projects.tar.zst", data)
+	if err := w.(Suspender).Suspend(); err != nil {
+		t.Fatalf("Suspend() = %v", err)
+	}
+	w.Write(data) // Dropped, e.g. the flush of the compressor
+	if len(fake.uploads) != 1 || !slices.Equal(fake.uploaded, []int{1}) {
+		t.Fatalf("Suspend() left %d uploads with parts %v, want 1 with [1]", len(fake.uploads), fake.uploaded)
+	}
+
+	w = writeObject(t, s3, "Projects.tar.zst", data)
+	if err := w.Abort(); err != nil {
+		t.Fatalf("Abort() = %v", err)
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("Abort() left %d uploads", len(fake.uploads))
+	}
+	if _, ok := fake.objects["prefix/Projects.tar.zst"]; ok {
+		t.Errorf("Abort() committed the object")
+	}
+}
+
+func TestS3Uploads(t *testing.T) {
+	fake, s3 := newFakeS3(t)
+	initiated := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	id := fake.start("prefix/Projects.tar.zst", initiated, testData(100), testData(50))
+	fake.start("prefix/other/Documents.tar.zst", initiated, testData(100))
+	fake.start("elsewhere/Photos.tar.zst", initiated, testData(100))
+
+	uploads, err := s3.Uploads()
+	if err != nil {
+		t.Fatalf("Uploads() = %v", err)
+	}
+	want := []Upload{{Name: "Projects.tar.zst", ID: id, Initiated: initiated, Size: 150}}
+	if !slices.EqualFunc(uploads, want, func(a, b Upload) bool {
+		return a.Name == b.Name && a.ID == b.ID && a.Initiated.Equal(b.Initiated) && a.Size == b.Size
+	}) {
+		t.Fatalf("Uploads() = %+v, want %+v", uploads, want)
+	}
+
+	if err := s3.AbortUpload(uploads[0]); err != nil {
+		t.Fatalf("AbortUpload() = %v", err)
+	}
+	if _, ok := fake.uploads[id]; ok || len(fake.uploads) != 2 {
+		t.Errorf("AbortUpload() left %d uploads, want the 2 of other prefixes", len(fake.uploads))
+	}
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// ServerOptions configures the backend for a `macup serve` instance
+type ServerOptions struct {
+	Token       string `yaml:"token"`
+	Fingerprint string `yaml:"fingerprint"` // Pins a self-signed certificate by (a prefix of) its SHA-256
+}
+
+// Server stores objects on a `macup serve` instance, in the backup named by
+// the last element of the URL path (e.g. "macup://nas.local:8443/macbook")
+type Server struct {
+	base    *url.URL // Server root URL
+	backup  string
+	token   string
+	client  *http.Client
+	limiter *rateLimiter // Upload bandwidth limit, nil if unlimited
+}
+
+// serverWriter streams an object with a single PUT
+type serverWriter struct {
+	pipe *io.PipeWriter
+	done chan error
+}
+
+// NewServer creates a storage for a backup on a macup server. rawURL is the
+// http(s) URL of the server followed by the backup name.
+func NewServer(rawURL string, opts ServerOptions) (*Server, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	backup := path.Base(strings.TrimSuffix(base.Path, "/"))
+	if backup == "." || backup == "/" {
+		return nil, fmt.Errorf("invalid server URL %q, expected macup://host:port/name", rawURL)
+	}
+	base.Path = path.Dir(strings.TrimSuffix(base.Path, "/"))
+
+	if opts.Token == "" {
+		opts.Token = os.Getenv("MACUP_SERVER_TOKEN")
+	}
+
+	client := http.DefaultClient
+	if opts.Fingerprint != "" {
+		client = pinnedClient(opts.Fingerprint)
+	}
+
+	return &Server{base: base, backup: backup, token: opts.Token, client: client}, nil
+}
+
+// pinnedClient returns a client that only trusts the certificate whose
+// SHA-256 starts with fingerprint, regardless of who signed it
+func pinnedClient(fingerprint string) *http.Client {
+	fingerprint = strings.ToUpper(strings.NewReplacer(":", "", "-", "", " ", "").Replace(fingerprint))
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true, // Replaced by the pin check below
+		VerifyPeerCertificate: func(certs [][]byte, _ [][]*x509.Certificate) error {
+			if len(certs) == 0 {
+				return fmt.Errorf("server sent no certificate")
+			}
+			sum := sha256.Sum256(certs[0])
+			if !strings.HasPrefix(strings.ToUpper(hex.EncodeToString(sum[:])), fingerprint) {
+				return fmt.Errorf("server certificate doesn't match fingerprint %s", fingerprint)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// url returns the API URL of an object of the backup, or of the backup itself
+func (s *Server) url(name string) string {
+	u := *s.base
+	u.Path = path.Join(s.base.Path, "v1/backups", s.backup, name)
+	return u.String()
+}
+
+// do sends an authenticated request and checks the status code
+func (s *Server) do(method, target string, body io.Reader) (*http.Response, error) {
+	if body != nil {
+		body = s.limiter.reader(body)
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: %w", target, fs.ErrNotExist)
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("server %s %s: %s: %s", method, target, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+// Create starts uploading a new object. The server only makes it visible
+// once the upload completed.
+func (s *Server) Create(name string) (Writer, error) {
+	pr, pw := io.Pipe()
+	w := &serverWriter{pipe: pw, done: make(chan error, 1)}
+	go func() {
+		resp, err := s.do(http.MethodPut, s.url(name), pr)
+		if err == nil {
+			resp.Body.Close()
+		}
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+// Open downloads an object
+func (s *Server) Open(name string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, s.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat returns the size of an object
+func (s *Server) Stat(name string) (int64, error) {
+	resp, err := s.do(http.MethodHead, s.url(name), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// List returns the names of all objects of the backup
+func (s *Server) List() ([]string, error) {
+	resp, err := s.do(http.MethodGet, s.url(""), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var names []string
+	if err := json.NewDecoder(resp.Body).Decode(&names); err != nil {
+		return nil, fmt.Errorf("failed to decode object list: %w", err)
+	}
+	return names, nil
+}
+
+// Remove deletes an object
+func (s *Server) Remove(name string) error {
+	resp, err := s.do(http.MethodDelete, s.url(name), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Check asks the server for its free space, which also verifies the token
+func (s *Server) Check(need int64) error {
+	free, err := s.Free()
+	if err != nil {
+		return err
+	}
+	return checkSpace(free, need)
+}
+
+// Free asks the server for its free space
+func (s *Server) Free() (int64, error) {
+	u := *s.base
+	u.Path = path.Join(s.base.Path, "v1/health")
+	resp, err := s.do(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Free int64 `json:"free"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return 0, fmt.Errorf("failed to decode server health: %w", err)
+	}
+	return health.Free, nil
+}
+
+// Path returns the URL of an object
+func (s *Server) Path(name string) string {
+	return s.url(name)
+}
+
+// String returns the server and backup name
+func (s *Server) String() string {
+	return s.base.Host + "/" + s.backup
+}
+
+// Write streams data into the PUT request body
+func (w *serverWriter) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+// Close finishes the upload
+func (w *serverWriter) Close() error {
+	w.pipe.Close()
+	return <-w.done
+}
+
+// Abort cancels the upload, the server discards the partial object
+func (w *serverWriter) Abort() error {
+	w.pipe.CloseWithError(fmt.Errorf("upload aborted"))
+	<-w.done
+	return nil
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hinkolas/macup/internal/units"
+)
+
+// Storage is a flat namespace of objects (archives, configs) that make up a backup
+type Storage interface {
+	// Create opens a new object for writing. The object only becomes visible
+	// under its name once Close returns without error.
+	Create(name string) (Writer, error)
+	// Open opens an existing object for reading
+	Open(name string) (io.ReadCloser, error)
+	// Stat returns the size of an object in bytes
+	Stat(name string) (int64, error)
+	// List returns the names of all objects
+	List() ([]string, error)
+	// Remove deletes an object
+	Remove(name string) error
+	// Path returns a human readable location of an object
+	Path(name string) string
+	// String returns a human readable location of the storage itself
+	String() string
+}
+
+// Writer is an object that is being written. Close commits it, Abort discards it.
+type Writer interface {
+	io.Writer
+	Close() error
+	Abort() error
+}
+
+// Suspender is implemented by writers that can keep what was written so far,
+// so the next write of the same object resumes it, e.g. after Ctrl+C
+type Suspender interface {
+	// Suspend stops writing without committing or discarding the object
+	Suspend() error
+}
+
+// Upload is an unfinished upload that a storage keeps for resuming
+type Upload struct {
+	Name      string
+	ID        string
+	Initiated time.Time
+	Size      int64 // Size of the parts uploaded so far
+}
+
+// UploadLister is implemented by storages that keep unfinished uploads, which
+// take up space until they are resumed or aborted
+type UploadLister interface {
+	// Uploads returns the unfinished uploads
+	Uploads() ([]Upload, error)
+	// AbortUpload discards an unfinished upload and its parts
+	AbortUpload(upload Upload) error
+}
+
+// ErrInsufficientSpace is returned by Check if a backup won't fit
+var ErrInsufficientSpace = errors.New("not enough space")
+
+// Checker is implemented by storages that can check their health up front
+type Checker interface {
+	// Check verifies that the storage is reachable, accepts the credentials
+	// and has room for need more bytes, if it can tell
+	Check(need int64) error
+}
+
+// SpaceReporter is implemented by storages that can tell their free space
+type SpaceReporter interface {
+	// Free returns the free space in bytes, or -1 if the storage can't tell
+	Free() (int64, error)
+}
+
+// ColdStorage is implemented by storages that move objects to an archive tier
+// from which they have to be retrieved before reading
+type ColdStorage interface {
+	// Frozen reports whether an object can't be read before it is retrieved
+	Frozen(name string) (bool, error)
+	// Retrieve requests an object to be made readable again
+	Retrieve(name string) error
+}
+
+// Options contains backend specific settings
+type Options struct {
+	S3                S3Options     `yaml:"s3"`
+	Rclone            RcloneOptions `yaml:"rclone"`
+	WebDAV            WebDAVOptions `yaml:"webdav"`
+	Server            ServerOptions `yaml:"server"`
+	UploadLimit       string        `yaml:"upload_limit"`       // Bandwidth limit for remote uploads, e.g. "5MB/s"
+	UploadConcurrency int           `yaml:"upload_concurrency"` // Parallel part uploads for remote backends
+}
+
+// New opens the storage behind target, which is either a local path, a URL or
+// an rclone remote ("rclone:remote:path"). http(s) URLs are read-only.
+func New(target string, opts Options) (Storage, error) {
+	var limit int64
+	if opts.UploadLimit != "" {
+		var err error
+		if limit, err = units.ParseRate(opts.UploadLimit); err != nil {
+			return nil, fmt.Errorf("invalid upload_limit: %w", err)
+		}
+	}
+	limiter := newRateLimiter(limit)
+	concurrency := max(opts.UploadConcurrency, 1)
+
+	if remote, ok := strings.CutPrefix(target, "rclone:"); ok {
+		if opts.UploadLimit != "" {
+			opts.Rclone.Flags = append(opts.Rclone.Flags, "--bwlimit", strconv.FormatInt(limit, 10)+"B")
+		}
+		return NewRclone(remote, opts.Rclone)
+	}
+
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok {
+		return NewLocal(target)
+	}
+
+	switch scheme {
+	case "s3":
+		s, err := NewS3(rest, opts.S3)
+		if err != nil {
+			return nil, err
+		}
+		s.limiter = limiter
+		s.parallel = concurrency
+		return s, nil
+	case "webdav", "webdav+https", "webdav+http":
+		base := "https://" + rest
+		if scheme == "webdav+http" {
+			base = "http://" + rest
+		}
+		d, err := NewWebDAV(base, opts.WebDAV)
+		if err != nil {
+			return nil, err
+		}
+		d.limiter = limiter
+		return d, nil
+	case "macup", "macup+https", "macup+http":
+		base := "https://" + rest
+		if scheme == "macup+http" {
+			base = "http://" + rest
+		}
+		s, err := NewServer(base, opts.Server)
+		if err != nil {
+			return nil, err
+		}
+		s.limiter = limiter
+		return s, nil
+	case "http", "https":
+		return NewHTTP(target)
+	case "sftp":
+		// Let rclone handle SFTP through an on-the-fly remote, it picks up
+		// keys from the ssh agent
+		remote, err := sftpRemote(target)
+		if err != nil {
+			return nil, err
+		}
+		if opts.UploadLimit != "" {
+			opts.Rclone.Flags = append(opts.Rclone.Flags, "--bwlimit", strconv.FormatInt(limit, 10)+"B")
+		}
+		return NewRclone(remote, opts.Rclone)
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme: %s", scheme)
+	}
+}
+
+// checkSpace reports an error if free is known and less than need
+func checkSpace(free, need int64) error {
+	if free >= 0 && free < need {
+		return fmt.Errorf("%w: %s free, about %s needed", ErrInsufficientSpace, units.FormatSize(free), units.FormatSize(need))
+	}
+	return nil
+}
+
+// sftpRemote converts sftp://user@host:port/path into an rclone connection string
+func sftpRemote(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid SFTP URL: %w", err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid SFTP URL %q, expected sftp://user@host/path", target)
+	}
+
+	remote := ":sftp,host=" + u.Hostname()
+	if u.User != nil {
+		remote += ",user=" + u.User.Username()
+	}
+	if u.Port() != "" {
+		remote += ",port=" + u.Port()
+	}
+	return remote + ":" + u.Path, nil
+}
+
+// IsRemote reports whether target refers to a remote storage backend
+func IsRemote(target string) bool {
+	return strings.Contains(target, "://") || strings.HasPrefix(target, "rclone:")
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter spreads transfers of all uploads over time so their combined
+// throughput stays below a fixed number of bytes per second
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64     // Bytes per second
+	next time.Time // Earliest time the next transfer may start
+}
+
+// throttledReader delays reads from an upload body according to a rate limiter
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+// newRateLimiter creates a limiter, or nil if rate is 0 (unlimited)
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate}
+}
+
+// wait blocks until n more bytes may be transferred
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// reader wraps an upload body, or returns it unchanged without a limit
+func (l *rateLimiter) reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: l}
+}
+
+// Read reads at most a tenth of a second's worth of data and waits for its turn
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if limit := max(int(t.limiter.rate/10), 1); len(p) > limit {
+		p = p[:limit]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.limiter.wait(n)
+	}
+	return n, err
+}
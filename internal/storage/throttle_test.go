@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	for _, rate := range []int64{0, -1} {
+		if l := newRateLimiter(rate); l != nil {
+			t.Errorf("newRateLimiter(%d) = %v, want nil", rate, l)
+		}
+	}
+
+	// Without a limit bodies are passed through unchanged
+	var l *rateLimiter
+	r := bytes.NewReader(nil)
+	if got := l.reader(r); got != r {
+		t.Errorf("reader() of a nil limiter wrapped the body")
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	data := bytes.Repeat([]byte("macup"), 1000)
+	l := newRateLimiter(20_000) // Reads of at most 2000 bytes
+
+	r := l.reader(bytes.NewReader(data))
+	buf := make([]byte, len(data))
+	n, err := r.Read(buf)
+	if err != nil || n != 2000 {
+		t.Errorf("Read() = %d, %v, want 2000 bytes", n, err)
+	}
+
+	start := time.Now()
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := append(buf[:n], rest...); !bytes.Equal(got, data) {
+		t.Errorf("throttled reader changed the data")
+	}
+
+	// The first read went through right away, the two reads of the remaining
+	// 3000 bytes wait 100ms each for the read before them
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("reading 3000 more bytes at 20000 bytes/s took %v, want about 200ms", elapsed)
+	}
+}
+
+func TestRateLimiterShared(t *testing.T) {
+	l := newRateLimiter(100_000)
+
+	// Concurrent transfers share the rate: 4 × 10000 bytes take 0.3s after
+	// the first went through
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.wait(10_000)
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 280*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("4 concurrent transfers of 10000 bytes at 100000 bytes/s took %v, want about 300ms", elapsed)
+	}
+}
+
+func TestRateLimiterIdle(t *testing.T) {
+	l := newRateLimiter(100_000)
+	l.wait(10_000)
+	time.Sleep(150 * time.Millisecond)
+
+	// Time spent idle earns no credit beyond the present, but the next
+	// transfer doesn't wait either
+	start := time.Now()
+	l.wait(10_000)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("transfer after an idle limiter waited %v, want none", elapsed)
+	}
+	start = time.Now()
+	l.wait(10_000)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("second transfer waited %v, want about 100ms", elapsed)
+	}
+}
@@ -0,0 +1,440 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// webdavChunkSize is the default chunk size for Nextcloud chunked uploads
+const webdavChunkSize = 10 << 20
+
+// WebDAVOptions configures the WebDAV backend (e.g. Nextcloud, ownCloud)
+type WebDAVOptions struct {
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	Token     string `yaml:"token"` // Bearer token, used instead of basic auth
+	ChunkSize int64  `yaml:"chunk_size" mapstructure:"chunk_size"`
+}
+
+// WebDAV stores objects in a WebDAV collection
+type WebDAV struct {
+	base      *url.URL // Collection URL, always ending in "/"
+	opts      WebDAVOptions
+	uploads   string // Nextcloud chunked upload collection, empty if unsupported
+	client    *http.Client
+	limiter   *rateLimiter // Upload bandwidth limit, nil if unlimited
+	collected bool         // Whether the collection is known to exist
+}
+
+// webdavWriter streams an object with a single PUT to a temporary name
+type webdavWriter struct {
+	d    *WebDAV
+	name string
+	pipe *io.PipeWriter
+	done chan error
+}
+
+// webdavChunkWriter uploads an object in chunks using the Nextcloud chunking API
+type webdavChunkWriter struct {
+	d      *WebDAV
+	name   string
+	dir    string // Upload collection URL
+	buf    bytes.Buffer
+	chunks int
+}
+
+// NewWebDAV creates a storage for a WebDAV collection URL
+func NewWebDAV(rawURL string, opts WebDAVOptions) (*WebDAV, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebDAV URL: %w", err)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	if opts.Username == "" {
+		opts.Username = os.Getenv("MACUP_WEBDAV_USERNAME")
+	}
+	if opts.Password == "" {
+		opts.Password = os.Getenv("MACUP_WEBDAV_PASSWORD")
+	}
+	if opts.Token == "" {
+		opts.Token = os.Getenv("MACUP_WEBDAV_TOKEN")
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = webdavChunkSize
+	}
+
+	d := &WebDAV{base: base, opts: opts, client: http.DefaultClient}
+
+	// Nextcloud exposes files at /remote.php/dav/files/<user>/ and accepts
+	// chunked uploads at /remote.php/dav/uploads/<user>/
+	if root, rest, ok := strings.Cut(base.Path, "/remote.php/dav/files/"); ok {
+		user, _, _ := strings.Cut(rest, "/")
+		d.uploads = root + "/remote.php/dav/uploads/" + user + "/"
+	}
+
+	return d, nil
+}
+
+// url returns the absolute URL for a path relative to the collection
+func (d *WebDAV) url(name string) string {
+	u := *d.base
+	u.Path = d.base.Path + name
+	return u.String()
+}
+
+// absolute returns the absolute URL for a server path
+func (d *WebDAV) absolute(p string) string {
+	u := *d.base
+	u.Path = p
+	return u.String()
+}
+
+// do sends an authenticated request and checks the status code
+func (d *WebDAV) do(method, target string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	// Throttle uploads, keeping the length of buffered chunks known
+	length := int64(-1)
+	if r, ok := body.(*bytes.Reader); ok {
+		length = int64(r.Len())
+	}
+	if body != nil && method == http.MethodPut {
+		body = d.limiter.reader(body)
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if length >= 0 {
+		req.ContentLength = length
+	}
+	if d.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.opts.Token)
+	} else if d.opts.Username != "" {
+		req.SetBasicAuth(d.opts.Username, d.opts.Password)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: %w", target, fs.ErrNotExist)
+		}
+		return resp, fmt.Errorf("webdav %s %s: %s", method, target, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// mkcol creates a collection and its missing parents
+func (d *WebDAV) mkcol(target string) error {
+	resp, err := d.do("MKCOL", target, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+	if resp == nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusMethodNotAllowed:
+		return nil // Already exists
+	case http.StatusConflict:
+		// Parent is missing, create it first
+		u, _ := url.Parse(target)
+		parent := path.Dir(strings.TrimSuffix(u.Path, "/")) + "/"
+		if parent == u.Path || parent == "/" {
+			return err
+		}
+		if err := d.mkcol(d.absolute(parent)); err != nil {
+			return err
+		}
+		return d.mkcol(target)
+	default:
+		return err
+	}
+}
+
+// ensureCollection creates the backup collection on first write
+func (d *WebDAV) ensureCollection() error {
+	if d.collected {
+		return nil
+	}
+	if err := d.mkcol(d.url("")); err != nil {
+		return fmt.Errorf("failed to create collection: %w", err)
+	}
+	d.collected = true
+	return nil
+}
+
+// move renames a resource, replacing an existing destination
+func (d *WebDAV) move(from, to string) error {
+	resp, err := d.do("MOVE", from, nil, map[string]string{
+		"Destination": to,
+		"Overwrite":   "T",
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Create starts uploading a new object
+func (d *WebDAV) Create(name string) (Writer, error) {
+	if err := d.ensureCollection(); err != nil {
+		return nil, err
+	}
+
+	if d.uploads != "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		return &webdavChunkWriter{
+			d:    d,
+			name: name,
+			dir:  d.absolute(d.uploads + "macup-" + hex.EncodeToString(id) + "/"),
+		}, nil
+	}
+
+	pr, pw := io.Pipe()
+	w := &webdavWriter{d: d, name: name, pipe: pw, done: make(chan error, 1)}
+	go func() {
+		resp, err := d.do(http.MethodPut, d.url(name+".tmp"), pr, nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+// Open downloads an object
+func (d *WebDAV) Open(name string) (io.ReadCloser, error) {
+	resp, err := d.do(http.MethodGet, d.url(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat returns the size of an object
+func (d *WebDAV) Stat(name string) (int64, error) {
+	resp, err := d.do(http.MethodHead, d.url(name), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// List returns the names of all finished objects in the collection
+func (d *WebDAV) List() ([]string, error) {
+	body := `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`
+	resp, err := d.do("PROPFIND", d.url(""), strings.NewReader(body), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Responses []struct {
+			Href       string    `xml:"href"`
+			Collection *xml.Name `xml:"propstat>prop>resourcetype>collection"`
+		} `xml:"response"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode collection listing: %w", err)
+	}
+
+	names := make([]string, 0, len(result.Responses))
+	for _, entry := range result.Responses {
+		if entry.Collection != nil {
+			continue
+		}
+		href, err := url.PathUnescape(entry.Href)
+		if err != nil {
+			continue
+		}
+		name := path.Base(href)
+		if !strings.HasSuffix(name, ".tmp") {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// Remove deletes an object
+func (d *WebDAV) Remove(name string) error {
+	resp, err := d.do(http.MethodDelete, d.url(name), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Path returns the URL of an object
+func (d *WebDAV) Path(name string) string {
+	return d.url(name)
+}
+
+// String returns the collection URL
+func (d *WebDAV) String() string {
+	return d.url("")
+}
+
+// Write streams data into the PUT request body
+func (w *webdavWriter) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+// Close finishes the upload and moves the temporary object into place
+func (w *webdavWriter) Close() error {
+	w.pipe.Close()
+	if err := <-w.done; err != nil {
+		return err
+	}
+	return w.d.move(w.d.url(w.name+".tmp"), w.d.url(w.name))
+}
+
+// Abort cancels the upload and removes the temporary object
+func (w *webdavWriter) Abort() error {
+	w.pipe.CloseWithError(fmt.Errorf("upload aborted"))
+	<-w.done
+	w.d.Remove(w.name + ".tmp")
+	return nil
+}
+
+// Write buffers data and uploads every full chunk
+func (w *webdavChunkWriter) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	for int64(w.buf.Len()) >= w.d.opts.ChunkSize {
+		if err := w.uploadChunk(w.buf.Next(int(w.d.opts.ChunkSize))); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Close uploads the last chunk and lets the server assemble the object
+func (w *webdavChunkWriter) Close() error {
+	if w.buf.Len() > 0 || w.chunks == 0 {
+		if err := w.uploadChunk(w.buf.Bytes()); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+
+	resp, err := w.d.do("MOVE", w.dir+".file", nil, map[string]string{
+		"Destination": w.d.url(w.name),
+		"Overwrite":   "T",
+	})
+	if err != nil {
+		w.Abort()
+		return fmt.Errorf("failed to assemble chunks: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Abort deletes the upload collection with all uploaded chunks
+func (w *webdavChunkWriter) Abort() error {
+	w.buf.Reset()
+	if w.chunks == 0 {
+		return nil
+	}
+	resp, err := w.d.do(http.MethodDelete, w.dir, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// uploadChunk creates the upload collection if needed and sends one chunk
+func (w *webdavChunkWriter) uploadChunk(data []byte) error {
+	destination := map[string]string{"Destination": w.d.url(w.name)}
+
+	if w.chunks == 0 {
+		resp, err := w.d.do("MKCOL", w.dir, nil, destination)
+		if err != nil {
+			return fmt.Errorf("failed to start chunked upload: %w", err)
+		}
+		resp.Body.Close()
+	}
+
+	w.chunks++
+	resp, err := w.d.do(http.MethodPut, fmt.Sprintf("%s%05d", w.dir, w.chunks), bytes.NewReader(data), destination)
+	if err != nil {
+		return fmt.Errorf("failed to upload chunk %d: %w", w.chunks, err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Check queries the quota of the collection (RFC 4331), which also verifies
+// the credentials. Servers that don't report a quota only get the latter.
+func (d *WebDAV) Check(need int64) error {
+	body := `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:quota-available-bytes/></d:prop></d:propfind>`
+
+	// The collection may not exist yet, ask the closest existing parent
+	target := d.base.Path
+	for {
+		resp, err := d.do("PROPFIND", d.absolute(target), strings.NewReader(body), map[string]string{
+			"Depth":        "0",
+			"Content-Type": "application/xml",
+		})
+		if errors.Is(err, fs.ErrNotExist) && target != "/" {
+			target = path.Dir(strings.TrimSuffix(target, "/")) + "/"
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var result struct {
+			Available string `xml:"response>propstat>prop>quota-available-bytes"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("failed to decode quota: %w", err)
+		}
+
+		// Negative values mean the quota is unknown or unlimited
+		free, err := strconv.ParseInt(strings.TrimSpace(result.Available), 10, 64)
+		if err != nil || free < 0 {
+			return nil
+		}
+		return checkSpace(free, need)
+	}
+}
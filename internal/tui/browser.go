@@ -0,0 +1,382 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hinkolas/macup/internal/units"
+	"golang.org/x/term"
+)
+
+// BrowserNode is a file or directory shown by Browse
+type BrowserNode struct {
+	Name string
+	Path string // Identifies the node to the caller
+	Size int64  // Of the file or everything below the directory, unknown if negative
+	Dir  bool
+
+	// Load returns the children of a directory once it is first opened, the
+	// directory has the Children it was created with if nil
+	Load     func() ([]*BrowserNode, error)
+	Children []*BrowserNode
+
+	parent *BrowserNode
+}
+
+// Browse shows a tree of files on the terminal, with the arrow keys to move
+// through it, space to select files and directories and / to search below
+// the current directory. r returns the selection, a directory stands for
+// everything below it. q and Esc cancel with ErrCanceled.
+func Browse(title string, nodes []*BrowserNode) ([]*BrowserNode, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !IsTerminal() {
+		return nil, errors.New("the browser needs a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer term.Restore(fd, state)
+
+	root := &BrowserNode{Dir: true, Children: nodes}
+	root.adopt()
+	b := &browser{title: title, dir: root, selected: make(map[*BrowserNode]bool)}
+	b.refresh()
+
+	// The browser takes the whole screen and leaves it as it was
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+
+	buf := make([]byte, 16)
+	for {
+		b.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		key := string(buf[:n])
+
+		if b.typing {
+			b.search(key)
+			continue
+		}
+		switch key {
+		case "\033[A", "k":
+			b.move(-1)
+		case "\033[B", "j":
+			b.move(1)
+		case "\033[5~":
+			b.move(-b.height())
+		case "\033[6~":
+			b.move(b.height())
+		case "\033[C", "l", "\r", "\n":
+			if node := b.current(); node != nil && node.Dir {
+				b.open(node)
+			}
+		case "\033[D", "h", "\x7f":
+			b.up()
+		case " ":
+			if node := b.current(); node != nil {
+				b.toggle(node)
+				b.move(1)
+			}
+		case "/":
+			b.typing = true
+		case "r":
+			if selection := b.selection(); len(selection) > 0 {
+				return selection, nil
+			}
+			b.status = "Nothing selected, select files with space"
+		case "q", "\033", "\x03":
+			if b.query != "" && key == "\033" {
+				b.query = ""
+				b.refresh()
+				continue
+			}
+			return nil, ErrCanceled
+		}
+	}
+}
+
+// browser is the state of a running Browse
+type browser struct {
+	title    string
+	dir      *BrowserNode // Directory shown
+	rows     []*BrowserNode
+	cursor   int
+	offset   int // First row on the screen
+	selected map[*BrowserNode]bool
+	query    string // Search below dir, rows are the matches if not empty
+	typing   bool   // Keys go to the query
+	status   string // Shown below the rows until the next key
+}
+
+// adopt links the children of a node to it
+func (n *BrowserNode) adopt() {
+	for _, child := range n.Children {
+		child.parent = n
+	}
+}
+
+// load reads the children of a directory if they weren't yet
+func (n *BrowserNode) load() error {
+	if !n.Dir || n.Load == nil {
+		return nil
+	}
+	children, err := n.Load()
+	if err != nil {
+		return err
+	}
+	n.Children, n.Load = children, nil
+	n.adopt()
+	if n.Size < 0 {
+		n.Size = 0
+		for _, child := range children {
+			n.Size += max(child.Size, 0)
+		}
+	}
+	return nil
+}
+
+// walk calls fn for everything below a node, loading directories on the way
+func (n *BrowserNode) walk(fn func(*BrowserNode)) error {
+	if err := n.load(); err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		fn(child)
+		if err := child.walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relative returns the path of a node below a directory, e.g. "thesis/ch3.tex"
+func (n *BrowserNode) relative(dir *BrowserNode) string {
+	var elems []string
+	for node := n; node != nil && node != dir; node = node.parent {
+		elems = append(elems, node.Name)
+	}
+	slices.Reverse(elems)
+	return path.Join(elems...)
+}
+
+// refresh lists the rows of the directory or the matches of the search
+func (b *browser) refresh() {
+	b.rows, b.cursor, b.offset = nil, 0, 0
+	if err := b.dir.load(); err != nil {
+		b.status = err.Error()
+	}
+	if b.query == "" {
+		b.rows = append(b.rows, b.dir.Children...)
+	} else {
+		query := strings.ToLower(b.query)
+		err := b.dir.walk(func(node *BrowserNode) {
+			if strings.Contains(strings.ToLower(node.Name), query) {
+				b.rows = append(b.rows, node)
+			}
+		})
+		if err != nil {
+			b.status = err.Error()
+		}
+	}
+	slices.SortStableFunc(b.rows, func(x, y *BrowserNode) int {
+		if x.Dir != y.Dir && b.query == "" {
+			if x.Dir {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(x.relative(b.dir), y.relative(b.dir))
+	})
+}
+
+// search edits the query with a key while it is typed
+func (b *browser) search(key string) {
+	switch key {
+	case "\r", "\n":
+		b.typing = false
+		return
+	case "\033", "\x03":
+		b.typing, b.query = false, ""
+	case "\x7f":
+		if b.query == "" {
+			return
+		}
+		_, size := utf8.DecodeLastRuneInString(b.query)
+		b.query = b.query[:len(b.query)-size]
+	default:
+		if !utf8.ValidString(key) || strings.ContainsFunc(key, func(r rune) bool { return r < ' ' }) {
+			return
+		}
+		b.query += key
+	}
+	b.refresh()
+}
+
+// current returns the node under the cursor
+func (b *browser) current() *BrowserNode {
+	if b.cursor < 0 || b.cursor >= len(b.rows) {
+		return nil
+	}
+	return b.rows[b.cursor]
+}
+
+// move moves the cursor by a number of rows
+func (b *browser) move(delta int) {
+	b.cursor = max(min(b.cursor+delta, len(b.rows)-1), 0)
+}
+
+// open shows a directory, leaving the search
+func (b *browser) open(dir *BrowserNode) {
+	b.dir, b.query = dir, ""
+	b.refresh()
+}
+
+// up shows the parent directory with the cursor on the one left
+func (b *browser) up() {
+	if b.query != "" {
+		b.query = ""
+		b.refresh()
+		return
+	}
+	if b.dir.parent == nil {
+		return
+	}
+	left := b.dir
+	b.dir = left.parent
+	b.refresh()
+	if i := slices.Index(b.rows, left); i >= 0 {
+		b.cursor = i
+	}
+}
+
+// toggle selects or deselects a node. Nodes below a selected directory are
+// selected with it, so they can't be toggled on their own.
+func (b *browser) toggle(node *BrowserNode) {
+	if b.inherited(node) {
+		b.status = "Selected with its directory, deselect the directory first"
+		return
+	}
+	if b.selected[node] {
+		delete(b.selected, node)
+	} else {
+		b.selected[node] = true
+	}
+}
+
+// inherited reports whether a directory above a node is selected
+func (b *browser) inherited(node *BrowserNode) bool {
+	for parent := node.parent; parent != nil; parent = parent.parent {
+		if b.selected[parent] {
+			return true
+		}
+	}
+	return false
+}
+
+// selection returns the selected nodes that aren't below another one, in the
+// order of the tree
+func (b *browser) selection() []*BrowserNode {
+	var selection []*BrowserNode
+	var visit func(nodes []*BrowserNode)
+	visit = func(nodes []*BrowserNode) {
+		for _, node := range nodes {
+			if b.selected[node] {
+				selection = append(selection, node)
+				continue
+			}
+			visit(node.Children)
+		}
+	}
+	root := b.dir
+	for root.parent != nil {
+		root = root.parent
+	}
+	visit(root.Children)
+	return selection
+}
+
+// height returns the number of rows that fit on the screen
+func (b *browser) height() int {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 20
+	}
+	return max(height-5, 1)
+}
+
+// render draws the screen
+func (b *browser) render() {
+	var s strings.Builder
+	s.WriteString("\033[H\033[J")
+	fmt.Fprintf(&s, "%s  %s/%s%s\r\n", b.title, colorGray, b.dir.relative(nil), colorReset)
+	fmt.Fprintf(&s, "%s↑/↓ move, →/← open and leave directories, space selects, / searches, r restores the selection, q quits%s\r\n", colorGray, colorReset)
+	switch {
+	case b.typing:
+		fmt.Fprintf(&s, "/%s\033[7m \033[0m\r\n", b.query)
+	case b.query != "":
+		fmt.Fprintf(&s, "%d matches for %q, esc clears the search\r\n", len(b.rows), b.query)
+	default:
+		s.WriteString("\r\n")
+	}
+
+	// Rows scroll with the cursor
+	height := b.height()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+height {
+		b.offset = b.cursor - height + 1
+	}
+	if len(b.rows) == 0 {
+		fmt.Fprintf(&s, "%s  (empty)%s\r\n", colorGray, colorReset)
+	}
+	for i := b.offset; i < len(b.rows) && i < b.offset+height; i++ {
+		node := b.rows[i]
+		cursor, box := "  ", "[ ]"
+		if i == b.cursor {
+			cursor = "> "
+		}
+		switch {
+		case b.selected[node]:
+			box = colorAccent + "[x]" + colorReset
+		case b.inherited(node):
+			box = colorAccent + "[-]" + colorReset
+		}
+		size := ""
+		if node.Size >= 0 {
+			size = units.FormatSize(node.Size)
+		}
+		name := node.Name
+		if b.query != "" {
+			name = node.relative(b.dir)
+		}
+		if node.Dir {
+			name += "/"
+		}
+		fmt.Fprintf(&s, "%s%s %s%10s%s  %s\r\n", cursor, box, colorGray, size, colorReset, name)
+	}
+
+	// The status line totals the selection unless there is news
+	status := b.status
+	if status == "" {
+		var size int64
+		selection := b.selection()
+		for _, node := range selection {
+			size += max(node.Size, 0)
+		}
+		if len(selection) > 0 {
+			status = fmt.Sprintf("%d selected, %s", len(selection), units.FormatSize(size))
+		}
+	}
+	b.status = ""
+	fmt.Fprintf(&s, "\r\n%s%s%s", colorGray, status, colorReset)
+	fmt.Print(s.String())
+}
@@ -0,0 +1,209 @@
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a line of the JSON output, e.g. the progress of a location
+type Event struct {
+	Event           string    `json:"event"` // e.g. "pending", "scanning", "progress", "done", "failed", "skipped", "canceled", "error"
+	Time            time.Time `json:"time"`
+	Phase           string    `json:"phase,omitempty"` // e.g. "Archiving" or "Extracting"
+	Location        string    `json:"location,omitempty"`
+	Progress        float64   `json:"progress,omitempty"`    // 0.0 to 1.0
+	ETASeconds      int       `json:"eta_seconds,omitempty"` // Estimated time left
+	RawBytes        int64     `json:"raw_bytes,omitempty"`
+	CompressedBytes int64     `json:"compressed_bytes,omitempty"`
+	Bytes           int64     `json:"bytes,omitempty"`            // Processed so far
+	TotalBytes      int64     `json:"total_bytes,omitempty"`      // Expected in total
+	BytesPerSecond  int64     `json:"bytes_per_second,omitempty"` // Current speed
+	Files           int       `json:"files,omitempty"`            // Found by the scan so far
+	Reason          string    `json:"reason,omitempty"`           // Why a location was skipped
+	Message         string    `json:"message,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+var (
+	jsonMu  sync.Mutex
+	jsonOut io.Writer // Receives the JSON output, nil unless enabled
+)
+
+// EnableJSON makes the reporters of NewReporter emit events as JSON lines to w instead of
+// drawing progress bars
+func EnableJSON(w io.Writer) {
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	jsonOut = w
+}
+
+// JSONEnabled reports whether the JSON output is enabled
+func JSONEnabled() bool {
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	return jsonOut != nil
+}
+
+// Emit writes an event as a JSON line, if the JSON output is enabled
+func Emit(e Event) {
+	e.Time = time.Now().UTC()
+	e.Message = strings.TrimSpace(strings.TrimPrefix(e.Message, "✓"))
+	WriteJSON(e)
+}
+
+// WriteJSON writes a value as a JSON line, if the JSON output is enabled
+func WriteJSON(v any) error {
+	jsonMu.Lock()
+	defer jsonMu.Unlock()
+	if jsonOut == nil {
+		return nil
+	}
+	return json.NewEncoder(jsonOut).Encode(v)
+}
+
+// JSONReporter emits the progress of a run as JSON events instead of drawing
+// it, see EnableJSON
+type JSONReporter struct {
+	locations
+	phase string
+	mu    sync.Mutex
+}
+
+// NewJSONReporter creates a reporter that emits events of a phase, e.g.
+// "Archiving"
+func NewJSONReporter(phase string) *JSONReporter {
+	return &JSONReporter{locations: newLocations(), phase: phase}
+}
+
+// emit writes an event of a location
+func (r *JSONReporter) emit(event string, item *ProgressItem) {
+	Emit(Event{
+		Event:           event,
+		Phase:           r.phase,
+		Location:        item.Location,
+		Progress:        item.Progress,
+		ETASeconds:      int(item.ETA.Seconds()),
+		RawBytes:        item.RawBytes,
+		CompressedBytes: item.CompressedBytes,
+		Bytes:           item.Bytes,
+		TotalBytes:      item.TotalBytes,
+		BytesPerSecond:  int64(item.Rate),
+		Files:           item.ScannedFiles,
+		Reason:          item.Skipped,
+	})
+}
+
+// update runs f on a location under the lock, if it was added
+func (r *JSONReporter) update(location string, f func(item *ProgressItem)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if item, exists := r.items[location]; exists {
+		f(item)
+	}
+}
+
+func (r *JSONReporter) Add(location string, progress float64, eta time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.emit("pending", r.add(location, progress, eta))
+}
+
+// Set emits the progress of a location once per percent
+func (r *JSONReporter) Set(location string, progress float64, eta time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item := r.item(location)
+	item.set(progress, eta)
+	if percent := int(progress * 100); percent != item.lastPercent && progress < 1.0 {
+		item.lastPercent = percent
+		r.emit("progress", item)
+	}
+}
+
+func (r *JSONReporter) Expect(location string, total int64) {
+	r.update(location, func(item *ProgressItem) { item.TotalBytes = total })
+}
+
+// Scan emits that the scan of a location started
+func (r *JSONReporter) Scan(location string, files int, size int64) {
+	r.update(location, func(item *ProgressItem) {
+		if item.scan(files, size) {
+			r.emit("scanning", item)
+		}
+	})
+}
+
+func (r *JSONReporter) Bytes(location string, done, total int64) {
+	r.update(location, func(item *ProgressItem) { item.bytes(done, total) })
+}
+
+func (r *JSONReporter) Compression(location string, raw, compressed int64) {
+	r.update(location, func(item *ProgressItem) { item.RawBytes, item.CompressedBytes = raw, compressed })
+}
+
+func (r *JSONReporter) Totals(location string, files int, size, compressed int64) {
+	r.update(location, func(item *ProgressItem) { item.totals(files, size, compressed) })
+}
+
+func (r *JSONReporter) Warn(location string) {
+	r.update(location, func(item *ProgressItem) { item.Warnings++ })
+}
+
+func (r *JSONReporter) Done(location string, done bool) {
+	r.update(location, func(item *ProgressItem) {
+		item.done(done)
+		if done {
+			r.emit("done", item)
+		}
+	})
+}
+
+func (r *JSONReporter) Fail(location string) {
+	r.update(location, func(item *ProgressItem) {
+		item.Failed, item.Done = true, false
+		r.emit("failed", item)
+	})
+}
+
+func (r *JSONReporter) Skip(location string, reason string) {
+	r.update(location, func(item *ProgressItem) {
+		item.skip(reason)
+		r.emit("skipped", item)
+	})
+}
+
+func (r *JSONReporter) Reset(location string) {
+	r.update(location, func(item *ProgressItem) {
+		*item = ProgressItem{Location: location}
+		r.emit("retry", item)
+	})
+}
+
+func (r *JSONReporter) Message(message string)                 {}
+func (r *JSONReporter) Completed(path string, size int64)      {}
+func (r *JSONReporter) Controls(cancel func())                 {}
+func (r *JSONReporter) Skippable(skip func())                  {}
+func (r *JSONReporter) Wait(ctx context.Context) time.Duration { return 0 }
+func (r *JSONReporter) Clear()                                 {}
+func (r *JSONReporter) Stored(from, to string)                 {}
+
+func (r *JSONReporter) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, item := range r.cancel() {
+		r.emit("canceled", item)
+	}
+	Emit(Event{Event: "finished", Phase: r.phase})
+}
+
+func (r *JSONReporter) Finish(successMessage string) {
+	Emit(Event{Event: "finished", Phase: r.phase, Message: successMessage})
+}
@@ -0,0 +1,170 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/term"
+)
+
+// keys is the key handling of a progress view, see Controls
+type keys struct {
+	restore func()        // Puts the terminal back the way it was
+	stop    chan struct{} // Closed to stop reading keys
+	cancel  func()        // Cancels the run, on q
+	skip    func()        // Skips the running location, on s, nil if there is none
+	resumed chan struct{} // Closed on resume, nil unless paused
+	paused  time.Time     // When the run was paused
+}
+
+// Controls lets the keys of the terminal steer the run while the view is
+// drawn: p pauses it, r resumes it, s skips the running location, see
+// Skippable, and q cancels the run like Ctrl+C. The run has to call Wait
+// between steps to pause. Without a terminal on stdin and the view drawn on
+// one it does nothing.
+func (pv *ProgressView) Controls(cancel func()) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	fd := int(os.Stdin.Fd())
+	if pv.keys != nil || pv.plain || !term.IsTerminal(fd) {
+		return
+	}
+	restore, err := cbreak(fd)
+	if err != nil {
+		return
+	}
+	pv.keys = &keys{restore: restore, stop: make(chan struct{}), cancel: cancel}
+	go pv.readKeys(pv.keys)
+	pv.render()
+}
+
+// Skippable sets how the running location is skipped with s, nil once none
+// is running
+func (pv *ProgressView) Skippable(skip func()) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if pv.keys != nil {
+		pv.keys.skip = skip
+	}
+}
+
+// Wait blocks while the run is paused, or until ctx is canceled, and returns
+// how long it waited, so ETAs can leave the pause out
+func (pv *ProgressView) Wait(ctx context.Context) time.Duration {
+	pv.mu.RLock()
+	var resumed chan struct{}
+	if pv.keys != nil {
+		resumed = pv.keys.resumed
+	}
+	pv.mu.RUnlock()
+	if resumed == nil {
+		return 0
+	}
+
+	start := time.Now()
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+	return time.Since(start)
+}
+
+// readKeys handles the keys pressed until the key handling is stopped. Reads
+// time out, so it notices that soon.
+func (pv *ProgressView) readKeys(k *keys) {
+	buf := make([]byte, 1)
+	for {
+		select {
+		case <-k.stop:
+			return
+		default:
+		}
+		// Reads that timed out end with io.EOF
+		n, err := os.Stdin.Read(buf)
+		if n == 0 && (err == nil || errors.Is(err, io.EOF)) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		pv.mu.Lock()
+		if pv.keys != k {
+			pv.mu.Unlock()
+			return
+		}
+		switch buf[0] {
+		case 'p', 'P':
+			if k.resumed == nil {
+				k.resumed, k.paused = make(chan struct{}), time.Now()
+			}
+		case 'r', 'R':
+			if k.resumed != nil {
+				close(k.resumed)
+				k.resumed = nil
+			}
+		case 's', 'S':
+			if k.skip != nil {
+				k.skip()
+				k.skip = nil
+			}
+		case 'q', 'Q':
+			k.cancel()
+		}
+		pv.renderNow()
+		pv.mu.Unlock()
+	}
+}
+
+// stopKeys ends the key handling and restores the terminal, the caller
+// holds the lock. A paused run resumes.
+func (pv *ProgressView) stopKeys() {
+	if pv.keys == nil {
+		return
+	}
+	close(pv.keys.stop)
+	if pv.keys.resumed != nil {
+		close(pv.keys.resumed)
+	}
+	pv.keys.restore()
+	pv.keys = nil
+}
+
+// renderControls creates the line below the progress bars showing the keys,
+// or that the run is paused
+func (pv *ProgressView) renderControls() string {
+	switch {
+	case pv.keys == nil:
+		return ""
+	case pv.keys.resumed != nil:
+		return "Paused since " + pv.keys.paused.Format("15:04") + ", press r to resume"
+	default:
+		return colorGray + "p pause · s skip location · q quit" + colorReset
+	}
+}
+
+// cbreak turns off line buffering and echo of the terminal, so keys can be
+// read as they are pressed, while Ctrl+C and output work as before. Reads
+// return after 100ms without a key.
+func cbreak(fd int) (func(), error) {
+	var old syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlGetTermios, uintptr(unsafe.Pointer(&old))); errno != 0 {
+		return nil, errno
+	}
+	state := old
+	state.Lflag &^= syscall.ICANON | syscall.ECHO
+	state.Cc[syscall.VMIN], state.Cc[syscall.VTIME] = 0, 1
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlSetTermios, uintptr(unsafe.Pointer(&state))); errno != 0 {
+		return nil, errno
+	}
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlSetTermios, uintptr(unsafe.Pointer(&old)))
+	}, nil
+}
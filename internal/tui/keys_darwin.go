@@ -0,0 +1,9 @@
+package tui
+
+import "syscall"
+
+// Requests reading and setting the terminal state
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
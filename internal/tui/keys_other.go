@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package tui
+
+import "syscall"
+
+// Requests reading and setting the terminal state on Linux
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"time"
+)
+
+// locations is the state of the locations of a run in the order they were
+// added, kept by every reporter
+type locations struct {
+	items   map[string]*ProgressItem
+	order   []string  // Maintain insertion order
+	started time.Time // Creation of the reporter, for the elapsed time of the summary
+}
+
+// newLocations returns the state of a run starting now
+func newLocations() locations {
+	return locations{items: make(map[string]*ProgressItem), started: time.Now()}
+}
+
+// add adds a location or starts it over if it was added before
+func (l *locations) add(location string, progress float64, eta time.Duration) *ProgressItem {
+	if _, exists := l.items[location]; !exists {
+		l.order = append(l.order, location)
+	}
+	item := &ProgressItem{Location: location, Progress: progress, ETA: eta}
+	l.items[location] = item
+	return item
+}
+
+// item returns a location, adding it if it wasn't added yet
+func (l *locations) item(location string) *ProgressItem {
+	if item, exists := l.items[location]; exists {
+		return item
+	}
+	return l.add(location, 0, 0)
+}
+
+// cancel marks the locations that aren't done yet as canceled and returns
+// them
+func (l *locations) cancel() []*ProgressItem {
+	var canceled []*ProgressItem
+	for _, location := range l.order {
+		if item := l.items[location]; !item.Done && !item.Failed {
+			item.Canceled = true
+			canceled = append(canceled, item)
+		}
+	}
+	return canceled
+}
+
+// begin records when a location started, for its duration in the summary
+// table
+func (item *ProgressItem) begin() {
+	if item.begun.IsZero() {
+		item.begun = time.Now()
+	}
+}
+
+// set updates the progress of a location, which is done at 1.0
+func (item *ProgressItem) set(progress float64, eta time.Duration) {
+	item.begin()
+	item.Progress = progress
+	item.ETA = eta
+	item.Scanning = false
+	if progress >= 1.0 {
+		item.Done = true
+		item.Progress = 1.0
+		item.finished = time.Now()
+	}
+}
+
+// done marks a location as complete or incomplete
+func (item *ProgressItem) done(done bool) {
+	item.Done = done
+	if done {
+		item.Progress = 1.0
+		item.finished = time.Now()
+	}
+}
+
+// scan updates what the scan of a location found so far and reports whether
+// the scan just started
+func (item *ProgressItem) scan(files int, size int64) bool {
+	item.begin()
+	started := !item.Scanning
+	item.Scanning = true
+	item.ScannedFiles = files
+	item.ScannedBytes = size
+	return started
+}
+
+// bytes updates the bytes processed of a location and measures its current
+// speed over the last rateWindow
+func (item *ProgressItem) bytes(done, total int64) {
+	item.begin()
+	now := time.Now()
+	if item.started.IsZero() {
+		item.started, item.rateStart, item.rateBytes = now, now, done
+	}
+	if elapsed := now.Sub(item.rateStart); elapsed >= rateWindow {
+		item.Rate = float64(done-item.rateBytes) / elapsed.Seconds()
+		item.rateStart, item.rateBytes = now, done
+	}
+	item.updated = now
+	item.Bytes = done
+	item.TotalBytes = total
+}
+
+// skip marks a location as skipped, one skipped while running drops what it
+// had written
+func (item *ProgressItem) skip(reason string) {
+	*item = ProgressItem{Location: item.Location, Skipped: reason, Done: true, Progress: 1.0, Warnings: item.Warnings}
+}
+
+// totals sets what a location processed in all
+func (item *ProgressItem) totals(files int, size, compressed int64) {
+	item.Files, item.Size, item.Compressed = files, size, compressed
+	item.hasTotals = true
+}
@@ -0,0 +1,135 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrCanceled is returned by Pick if the picker was left without confirming
+var ErrCanceled = errors.New("canceled")
+
+// PickerItem is an entry of a picker. Headers group the entries below them
+// and can't be selected.
+type PickerItem struct {
+	Label    string
+	Detail   string // Shown next to the label in gray, e.g. a size
+	Selected bool
+	Header   bool
+}
+
+// Pick shows a checkbox list on the terminal and returns the items with the
+// selection made with the arrow keys and space. Enter confirms, q and Esc
+// cancel with ErrCanceled.
+func Pick(title string, items []PickerItem) ([]PickerItem, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !IsTerminal() {
+		return nil, errors.New("the picker needs a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer term.Restore(fd, state)
+
+	p := &picker{title: title, items: append([]PickerItem(nil), items...), cursor: -1}
+	p.move(1)
+	fmt.Print("\033[?25l")
+	defer fmt.Print("\033[?25h")
+
+	buf := make([]byte, 3)
+	for {
+		p.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		switch string(buf[:n]) {
+		case "\033[A", "k":
+			p.move(-1)
+		case "\033[B", "j":
+			p.move(1)
+		case " ":
+			if p.cursor >= 0 {
+				p.items[p.cursor].Selected = !p.items[p.cursor].Selected
+			}
+		case "a":
+			p.toggleAll()
+		case "\r", "\n":
+			p.clear()
+			return p.items, nil
+		case "q", "\033", "\x03":
+			p.clear()
+			return nil, ErrCanceled
+		}
+	}
+}
+
+// picker is the state of a running Pick
+type picker struct {
+	title  string
+	items  []PickerItem
+	cursor int
+	lines  int // Lines drawn by the last render
+}
+
+// move moves the cursor to the next item in a direction, skipping headers
+func (p *picker) move(delta int) {
+	for i := p.cursor + delta; i >= 0 && i < len(p.items); i += delta {
+		if !p.items[i].Header {
+			p.cursor = i
+			return
+		}
+	}
+}
+
+// toggleAll selects all items, or none if all are selected already
+func (p *picker) toggleAll() {
+	all := true
+	for _, item := range p.items {
+		all = all && (item.Header || item.Selected)
+	}
+	for i := range p.items {
+		p.items[i].Selected = !all && !p.items[i].Header
+	}
+}
+
+// render draws the list in place of the last one
+func (p *picker) render() {
+	p.clear()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\r\n", p.title)
+	fmt.Fprintf(&b, "%s↑/↓ move, space toggles, a toggles all, enter restores, q cancels%s\r\n", colorGray, colorReset)
+	for i, item := range p.items {
+		if item.Header {
+			fmt.Fprintf(&b, "\r\n%s\r\n", item.Label)
+			continue
+		}
+		cursor, box := "  ", "[ ]"
+		if i == p.cursor {
+			cursor = "> "
+		}
+		if item.Selected {
+			box = colorAccent + "[x]" + colorReset
+		}
+		fmt.Fprintf(&b, "%s%s %s", cursor, box, item.Label)
+		if item.Detail != "" {
+			fmt.Fprintf(&b, " %s%s%s", colorGray, item.Detail, colorReset)
+		}
+		b.WriteString("\r\n")
+	}
+	out := b.String()
+	p.lines = strings.Count(out, "\n")
+	fmt.Print(out)
+}
+
+// clear removes the drawn list
+func (p *picker) clear() {
+	if p.lines > 0 {
+		fmt.Printf("\033[%dA\r\033[J", p.lines)
+	}
+	p.lines = 0
+}
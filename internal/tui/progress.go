@@ -4,27 +4,25 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/signal"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
+	"github.com/hinkolas/macup/internal/units"
 	"golang.org/x/term"
 )
 
 const (
-	// Braille character for filled progress
-	brailleFilled = "⣿"
-	// Space for empty progress
-	brailleEmpty = " "
 	// Progress bar width in characters
 	progressBarWidth = 42
 	// Minimum time between screen updates (rate limiting)
 	updateInterval = 10 * time.Millisecond
-	// ANSI color codes
-	colorGreen = "\033[32m"
-	colorReset = "\033[0m"
+	// Number of recently completed files shown below the status message
+	tickerSize = 4
+	// Time over which the current transfer speed is measured
+	rateWindow = 2 * time.Second
+	// Time each frame of the scan spinner is shown
+	spinnerInterval = 100 * time.Millisecond
 )
 
 // ProgressItem represents a single progress bar entry
@@ -33,59 +31,128 @@ type ProgressItem struct {
 	Progress        float64 // 0.0 to 1.0
 	ETA             time.Duration
 	Done            bool
+	Failed          bool
+	Skipped         string        // Reason the location was skipped, empty if not skipped
+	Canceled        bool          // The run was canceled before the location was done
+	Scanning        bool          // Files are being counted before the progress is known
+	ScannedFiles    int           // Files found by the scan so far
+	ScannedBytes    int64         // Size of the files found by the scan so far
+	RawBytes        int64         // Uncompressed bytes (0 if not compressing)
+	CompressedBytes int64         // Compressed bytes emitted so far
+	Bytes           int64         // Bytes processed so far
+	TotalBytes      int64         // Bytes expected in total (0 if unknown)
+	Rate            float64       // Current speed in bytes per second, over the last rateWindow
+	Files           int           // Files processed in all, see Totals
+	Size            int64         // Size of the files processed in all, see Totals
+	Compressed      int64         // Size of the archive of the files, see Totals
+	Warnings        int           // Warnings about the location, see Warn
+	hasTotals       bool          // Totals were set
+	begun           time.Time     // First update of the scan, progress or byte count
+	finished        time.Time     // When the location was done
+	started         time.Time     // First update of the byte count
+	updated         time.Time     // Last update of the byte count
+	rateStart       time.Time     // Start of the current rate sample
+	rateBytes       int64         // Byte count at the start of the current rate sample
 	lastRenderedBar int           // Last rendered bar length
 	lastRenderedETA time.Duration // Last rendered ETA
+	lastPercent     int           // Last percentage emitted by the JSON reporter
+	lastPlainState  string        // Last state logged in plain mode, e.g. "done"
 }
 
 // ProgressView manages multiple progress bars
 type ProgressView struct {
-	items               map[string]*ProgressItem
-	order               []string  // Maintain insertion order
+	locations
 	message             string    // Current status message
 	messagePrefix       string    // Prefix for status messages (e.g., "Writing", "Extracting")
 	lastRenderedState   string    // Last rendered output (progress bars only)
 	lastRenderedMessage string    // Last rendered message
+	ticker              []string  // Recently completed files, oldest first
+	lastRenderedTicker  int       // Ticker generation that was last rendered
+	lastRenderedKeys    string    // Controls line that was last rendered
+	tickerGeneration    int       // Incremented on every completed file
 	lastUpdateTime      time.Time // Last screen update time
 	writer              io.Writer
 	mu                  sync.RWMutex
-	lastLines           int  // Track how many lines were printed last time
-	cursorHidden        bool // Track if cursor is hidden
+	lastLines           int       // Track how many lines were printed last time
+	cursorHidden        bool      // Track if cursor is hidden
+	plain               bool      // Not a terminal, progress is logged line by line
+	keys                *keys     // Key handling, nil unless enabled with Controls
+	lastPlainTime       time.Time // Last time progress was logged in plain mode
+	style               style     // Colors and characters of the theme
 }
 
-// NewProgressView creates a new progress view with a custom message prefix
-func NewProgressView(messagePrefix string) *ProgressView {
+// views are the progress views that haven't finished, whose terminal
+// RestoreTerminal puts back
+var (
+	views   = map[*ProgressView]struct{}{}
+	viewsMu sync.Mutex
+)
+
+// RestoreTerminal shows the cursor and leaves raw mode of the progress views
+// still drawing, before the process exits on Ctrl+C
+func RestoreTerminal() {
+	viewsMu.Lock()
+	running := make([]*ProgressView, 0, len(views))
+	for pv := range views {
+		running = append(running, pv)
+	}
+	viewsMu.Unlock()
+
+	for _, pv := range running {
+		pv.mu.Lock()
+		if pv.cursorHidden {
+			pv.showCursor()
+		}
+		if pv.keys != nil {
+			pv.keys.restore()
+		}
+		pv.mu.Unlock()
+	}
+}
+
+// untrack removes a finished progress view from those RestoreTerminal puts
+// back
+func (pv *ProgressView) untrack() {
+	viewsMu.Lock()
+	delete(views, pv)
+	viewsMu.Unlock()
+}
+
+// plainInterval is how often progress is logged in plain mode
+var plainInterval = 30 * time.Second
+
+// SetPlainInterval sets how often progress is logged when the progress view
+// isn't drawn on a terminal, e.g. under launchd or piped into tee
+func SetPlainInterval(interval time.Duration) {
+	if interval > 0 {
+		plainInterval = interval
+	}
+}
+
+// NewProgressView creates a new progress view with a custom message prefix,
+// drawn with a theme
+func NewProgressView(messagePrefix string, theme Theme) *ProgressView {
 	if messagePrefix == "" {
 		messagePrefix = "Processing"
 	}
 
 	pv := &ProgressView{
-		items:         make(map[string]*ProgressItem),
-		order:         make([]string, 0),
-		writer:        os.Stdout,
+		locations:     newLocations(),
+		writer:        progressWriter(),
 		messagePrefix: messagePrefix,
+		style:         theme.style(),
 	}
 
-	// Set up signal handler for Ctrl+C
-	pv.setupSignalHandler()
-
-	return pv
-}
+	if f, ok := pv.writer.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+		// Cursor movements would end up as garbage in logs
+		pv.plain, pv.lastPlainTime = true, pv.started
+	}
 
-// setupSignalHandler sets up handling for interrupt signals
-func (pv *ProgressView) setupSignalHandler() {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	viewsMu.Lock()
+	views[pv] = struct{}{}
+	viewsMu.Unlock()
 
-	go func() {
-		<-sigChan
-		// Show cursor before exiting
-		pv.mu.Lock()
-		if pv.cursorHidden {
-			pv.showCursor()
-		}
-		pv.mu.Unlock()
-		os.Exit(130) // Standard exit code for Ctrl+C
-	}()
+	return pv
 }
 
 // IsTerminal checks if stdout is a terminal (TTY)
@@ -93,27 +160,35 @@ func IsTerminal() bool {
 	return term.IsTerminal(int(os.Stdout.Fd()))
 }
 
+// progressWriter picks the stream for interactive output. When stdout is piped
+// but stderr is still a terminal, progress is drawn on stderr so stdout stays
+// clean for machine-readable output.
+func progressWriter() io.Writer {
+	if !IsTerminal() && term.IsTerminal(int(os.Stderr.Fd())) {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Stored prints where a location went on stdout when the progress view is
+// drawn on stderr, so scripts reading stdout get the result
+func (pv *ProgressView) Stored(from, to string) {
+	if pv.writer != os.Stdout {
+		fmt.Printf("%s\t%s\n", from, to)
+	}
+}
+
 // Add adds a new progress bar for a location
 func (pv *ProgressView) Add(location string, progress float64, eta time.Duration) {
 	pv.mu.Lock()
 	defer pv.mu.Unlock()
 
 	// Hide cursor on first add
-	if !pv.cursorHidden {
+	if !pv.cursorHidden && !pv.plain {
 		pv.hideCursor()
 	}
 
-	if _, exists := pv.items[location]; !exists {
-		pv.order = append(pv.order, location)
-	}
-
-	pv.items[location] = &ProgressItem{
-		Location: location,
-		Progress: progress,
-		ETA:      eta,
-		Done:     false,
-	}
-
+	pv.add(location, progress, eta)
 	pv.render()
 }
 
@@ -122,33 +197,17 @@ func (pv *ProgressView) Set(location string, progress float64, eta time.Duration
 	pv.mu.Lock()
 	defer pv.mu.Unlock()
 
-	item, exists := pv.items[location]
-	if !exists {
-		// If it doesn't exist, add it
-		pv.order = append(pv.order, location)
-		item = &ProgressItem{
-			Location: location,
-		}
-		pv.items[location] = item
-	}
+	item := pv.item(location)
 
 	// Check if we need to update
 	newBarLength := min(int(progress*float64(progressBarWidth)), progressBarWidth)
 	etaSeconds := int(eta.Seconds())
 	lastEtaSeconds := int(item.lastRenderedETA.Seconds())
 
-	// Only update if braille character changed or ETA changed by at least 1 second
-	shouldUpdate := newBarLength != item.lastRenderedBar || etaSeconds != lastEtaSeconds
-
-	item.Progress = progress
-	item.ETA = eta
-
-	// Mark as done if progress is 1.0
-	if progress >= 1.0 {
-		item.Done = true
-		item.Progress = 1.0
-		shouldUpdate = true // Always update when done
-	}
+	// Only update if bar character changed or ETA changed by at least 1
+	// second, the scan ended or the location is done
+	shouldUpdate := newBarLength != item.lastRenderedBar || etaSeconds != lastEtaSeconds || item.Scanning || progress >= 1.0
+	item.set(progress, eta)
 
 	if shouldUpdate {
 		item.lastRenderedBar = newBarLength
@@ -157,6 +216,68 @@ func (pv *ProgressView) Set(location string, progress float64, eta time.Duration
 	}
 }
 
+// Compression updates the raw and compressed byte counts of a location
+func (pv *ProgressView) Compression(location string, raw, compressed int64) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	item, exists := pv.items[location]
+	if !exists {
+		return
+	}
+
+	// Only re-render if the displayed values changed
+	before := pv.renderCompression(item)
+	item.RawBytes = raw
+	item.CompressedBytes = compressed
+	if pv.renderCompression(item) != before {
+		pv.render()
+	}
+}
+
+// Scan updates the files and bytes a location's scan found so far. The
+// location shows a spinner with them until its progress is set.
+func (pv *ProgressView) Scan(location string, files int, size int64) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if item, exists := pv.items[location]; exists {
+		item.scan(files, size)
+		pv.render()
+	}
+}
+
+// Expect sets the bytes a location is expected to process before it started,
+// e.g. its size in the last backup, so the summary knows the total up front
+func (pv *ProgressView) Expect(location string, total int64) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if item, exists := pv.items[location]; exists && item.Bytes == 0 {
+		item.TotalBytes = total
+		pv.render()
+	}
+}
+
+// Bytes updates the bytes processed of a location out of the expected total,
+// from which its current and average speed are derived
+func (pv *ProgressView) Bytes(location string, done, total int64) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	item, exists := pv.items[location]
+	if !exists {
+		return
+	}
+
+	// Only re-render if the displayed values changed
+	before := pv.renderThroughput(item)
+	item.bytes(done, total)
+	if pv.renderThroughput(item) != before {
+		pv.render()
+	}
+}
+
 // Message sets a status message (typically the currently processing file path)
 func (pv *ProgressView) Message(message string) {
 	pv.mu.Lock()
@@ -169,36 +290,117 @@ func (pv *ProgressView) Message(message string) {
 	}
 }
 
+// Completed adds a finished file to the rolling ticker of recent files
+func (pv *ProgressView) Completed(path string, size int64) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	pv.ticker = append(pv.ticker, fmt.Sprintf("%9s  %s", FormatBytes(size), path))
+	if len(pv.ticker) > tickerSize {
+		pv.ticker = pv.ticker[len(pv.ticker)-tickerSize:]
+	}
+	pv.tickerGeneration++
+
+	pv.render()
+}
+
 // Done marks a location as complete or incomplete
 func (pv *ProgressView) Done(location string, done bool) {
 	pv.mu.Lock()
 	defer pv.mu.Unlock()
 
 	if item, exists := pv.items[location]; exists {
-		item.Done = done
-		if done {
-			item.Progress = 1.0
-		}
+		item.done(done)
 		pv.render()
 	}
 }
 
+// Fail marks a location as failed
+func (pv *ProgressView) Fail(location string) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if item, exists := pv.items[location]; exists {
+		item.Failed = true
+		item.Done = false
+		pv.renderNow()
+	}
+}
+
+// Skip marks a location as skipped with a short reason (e.g. "unchanged")
+func (pv *ProgressView) Skip(location string, reason string) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if item, exists := pv.items[location]; exists {
+		item.skip(reason)
+		pv.renderNow()
+	}
+}
+
+// Reset clears the progress of a location, e.g. before retrying it
+func (pv *ProgressView) Reset(location string) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if item, exists := pv.items[location]; exists {
+		*item = ProgressItem{Location: location}
+		if pv.plain {
+			fmt.Fprintf(pv.writer, "%s %s: retrying\n", pv.messagePrefix, location)
+		}
+		pv.renderNow()
+	}
+}
+
+// Cancel marks the locations that aren't done yet as canceled and completes
+// the progress view, keeping the finished ones on screen
+func (pv *ProgressView) Cancel() {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	pv.cancel()
+	pv.message = ""
+	pv.finish("")
+}
+
 // Finish completes the progress view and shows cursor
 func (pv *ProgressView) Finish(successMessage string) {
 	pv.mu.Lock()
 	defer pv.mu.Unlock()
 
+	pv.finish(successMessage)
+}
+
+// finish completes the progress view, the caller holds the lock
+func (pv *ProgressView) finish(successMessage string) {
+	defer pv.untrack()
+	report := pv.report()
+	if pv.plain {
+		pv.renderPlain()
+		fmt.Fprint(pv.writer, report)
+		if successMessage != "" {
+			fmt.Fprintln(pv.writer, successMessage)
+		}
+		return
+	}
+
 	// Force a final render to show completed state
+	pv.stopKeys()
 	pv.message = ""
+	pv.ticker = nil
+	pv.tickerGeneration++
 	pv.renderNow()
 
-	// Print success message on a new line with green checkmark
+	// The summary table goes below the bars, the success message below it
+	// with the checkmark in the accent color
+	fmt.Fprint(pv.writer, "\n")
+	if report != "" {
+		fmt.Fprintf(pv.writer, "\n%s", report)
+	}
 	if successMessage != "" {
 		// Replace the checkmark with a colored version
-		coloredMessage := strings.Replace(successMessage, "✓", colorGreen+"✓"+colorReset, 1)
-		fmt.Fprintf(pv.writer, "\n\n%s\n", coloredMessage)
-	} else {
-		fmt.Fprint(pv.writer, "\n")
+		coloredMessage := strings.Replace(successMessage, "✓", pv.style.accent+"✓"+colorReset, 1)
+		fmt.Fprintf(pv.writer, "\n%s\n", coloredMessage)
 	}
 
 	// Show cursor again
@@ -211,11 +413,14 @@ func (pv *ProgressView) Finish(successMessage string) {
 func (pv *ProgressView) Clear() {
 	pv.mu.Lock()
 	defer pv.mu.Unlock()
+	defer pv.untrack()
 
+	pv.stopKeys()
 	pv.clearLines()
 	pv.lastRenderedState = ""
 	pv.lastRenderedMessage = ""
 	pv.message = ""
+	pv.ticker = nil
 
 	// Show cursor again
 	if pv.cursorHidden {
@@ -225,6 +430,11 @@ func (pv *ProgressView) Clear() {
 
 // render renders the entire progress view with rate limiting
 func (pv *ProgressView) render() {
+	if pv.plain {
+		pv.renderPlain()
+		return
+	}
+
 	// Rate limit: only update if enough time has passed
 	now := time.Now()
 	if !pv.lastUpdateTime.IsZero() && now.Sub(pv.lastUpdateTime) < updateInterval {
@@ -236,7 +446,12 @@ func (pv *ProgressView) render() {
 
 // renderNow renders immediately without rate limiting
 func (pv *ProgressView) renderNow() {
-	lines := make([]string, 0)
+	if pv.plain {
+		pv.renderPlain()
+		return
+	}
+
+	lines := pv.renderSummary()
 
 	// Render each progress item
 	for _, location := range pv.order {
@@ -257,8 +472,10 @@ func (pv *ProgressView) renderNow() {
 	// Build output for progress bars only
 	output := strings.Join(lines, "\n")
 
-	// Only update if progress bars or message changed
-	if output == pv.lastRenderedState && pv.message == pv.lastRenderedMessage {
+	// Only update if progress bars, message or ticker changed
+	controls := pv.renderControls()
+	if output == pv.lastRenderedState && pv.message == pv.lastRenderedMessage &&
+		pv.tickerGeneration == pv.lastRenderedTicker && controls == pv.lastRenderedKeys {
 		return
 	}
 
@@ -275,46 +492,271 @@ func (pv *ProgressView) renderNow() {
 	// This handles messages that wrap across multiple lines
 	fmt.Fprint(pv.writer, "\033[J")
 
+	// Write the keys or the pause below the progress bars
+	if controls != "" {
+		fmt.Fprintf(pv.writer, "\n%s\n", controls)
+	}
+
 	// Write message on new line if present
 	if pv.message != "" {
 		fmt.Fprintf(pv.writer, "\n%s: %s", pv.messagePrefix, pv.message)
 	}
 
+	// Write recently completed files below the message
+	for _, line := range pv.ticker {
+		fmt.Fprintf(pv.writer, "\n%s%s%s", colorGray, line, colorReset)
+	}
+
 	// Restore cursor position (back to end of progress bars)
 	fmt.Fprint(pv.writer, "\033[u")
 
 	// Track state - only track progress bar lines
 	pv.lastRenderedState = output
 	pv.lastRenderedMessage = pv.message
+	pv.lastRenderedTicker = pv.tickerGeneration
+	pv.lastRenderedKeys = controls
 	pv.lastLines = len(lines)
 	pv.lastUpdateTime = time.Now()
 }
 
-// renderProgressBar creates the braille progress bar
+// renderPlain logs the progress view line by line for logs and pipes: every
+// change of a location's state right away, the progress of the running ones
+// and the summary every plainInterval. Compression stats are left out once a
+// location is done, they are only final after its archive is closed.
+func (pv *ProgressView) renderPlain() {
+	for _, location := range pv.order {
+		item := pv.items[location]
+		state := ""
+		switch {
+		case item.Failed:
+			state = "failed"
+		case item.Canceled:
+			state = "canceled"
+		case item.Skipped != "":
+			state = "skipped (" + item.Skipped + ")"
+		case item.Done:
+			state = "done"
+		}
+		if state == "" || state == item.lastPlainState {
+			continue
+		}
+		item.lastPlainState = state
+		if throughput := pv.renderThroughput(item); state == "done" && throughput != "" {
+			state += ", " + throughput
+		}
+		if item.Warnings > 0 {
+			state += ", " + formatWarnings(item.Warnings)
+		}
+		fmt.Fprintf(pv.writer, "%s %s: %s\n", pv.messagePrefix, location, state)
+	}
+
+	if time.Since(pv.lastPlainTime) < plainInterval {
+		return
+	}
+	pv.lastPlainTime = time.Now()
+	for _, location := range pv.order {
+		item := pv.items[location]
+		if item.Done || item.Failed || item.Canceled {
+			continue
+		}
+		if item.Scanning {
+			fmt.Fprintf(pv.writer, "%s %s: scanning, %s\n", pv.messagePrefix, location, pv.renderScan(item))
+			continue
+		}
+		if item.Progress == 0 && item.Bytes == 0 {
+			continue
+		}
+		status := fmt.Sprintf("%.0f%%", item.Progress*100)
+		if item.ETA > 0 {
+			status += ", ETA " + formatDuration(item.ETA)
+		}
+		if details := pv.plainDetails(item); details != "" {
+			status += ", " + details
+		}
+		fmt.Fprintf(pv.writer, "%s %s: %s\n", pv.messagePrefix, location, status)
+	}
+	if progress, status, ok := pv.summary(); ok {
+		fmt.Fprintf(pv.writer, "%s all locations: %.0f%%, %s\n", pv.messagePrefix, progress*100, status)
+	}
+}
+
+// plainDetails returns the throughput, compression and warnings of a running
+// location for the plain log
+func (pv *ProgressView) plainDetails(item *ProgressItem) string {
+	var details []string
+	if throughput := pv.renderThroughput(item); throughput != "" {
+		details = append(details, throughput)
+	}
+	if compression := pv.renderCompression(item); compression != "" {
+		details = append(details, compression)
+	}
+	if item.Warnings > 0 {
+		details = append(details, formatWarnings(item.Warnings))
+	}
+	return strings.Join(details, ", ")
+}
+
+// renderSummary creates the summary bar above the locations
+func (pv *ProgressView) renderSummary() []string {
+	progress, status, ok := pv.summary()
+	if !ok {
+		return nil
+	}
+	bar := pv.renderProgressBar(&ProgressItem{Progress: progress})
+	return []string{"All locations", fmt.Sprintf("[%s] %s", bar, status), ""}
+}
+
+// summary returns the progress of all locations with the bytes done of them,
+// the elapsed time and a combined ETA. There is only a summary for more than
+// one location with a known size. Skipped, failed and canceled locations don't
+// count.
+func (pv *ProgressView) summary() (float64, string, bool) {
+	var done, total int64
+	sized := 0
+	for _, location := range pv.order {
+		item := pv.items[location]
+		if item.Failed || item.Canceled || item.Skipped != "" || (item.TotalBytes == 0 && item.Bytes == 0) {
+			continue
+		}
+		sized++
+		size := max(item.TotalBytes, item.Bytes)
+		total += size
+		if item.Done {
+			done += size
+		} else {
+			done += item.Bytes
+		}
+	}
+	if sized < 2 || total == 0 {
+		return 0, "", false
+	}
+
+	progress := min(float64(done)/float64(total), 1.0)
+	elapsed := time.Since(pv.started)
+	status := fmt.Sprintf("%s / %s, %s elapsed", FormatBytes(done), FormatBytes(total), formatDuration(elapsed))
+	if done > 0 && done < total && elapsed >= time.Second {
+		eta := time.Duration(float64(elapsed) * float64(total-done) / float64(done))
+		status += ", ETA " + formatDuration(eta)
+	}
+	return progress, status, true
+}
+
+// renderProgressBar creates the progress bar from the characters of the theme
 func (pv *ProgressView) renderProgressBar(item *ProgressItem) string {
 	filled := min(int(item.Progress*float64(progressBarWidth)), progressBarWidth)
 
-	bar := strings.Repeat(brailleFilled, filled)
-	empty := strings.Repeat(brailleEmpty, progressBarWidth-filled)
+	bar := strings.Repeat(pv.style.barFilled, filled)
+	empty := strings.Repeat(pv.style.barEmpty, progressBarWidth-filled)
 
 	return bar + empty
 }
 
-// renderStatus creates the status message (ETA or DONE)
+// renderStatus creates the status message (ETA or DONE) followed by throughput and compression stats
 func (pv *ProgressView) renderStatus(item *ProgressItem) string {
+	status := "Calculating..."
+	if item.Failed {
+		status = colorRed + "FAILED ✘" + colorReset
+	} else if item.Canceled {
+		status = colorGray + "CANCELED" + colorReset
+	} else if item.Skipped != "" {
+		status = colorGray + "SKIPPED (" + item.Skipped + ")" + colorReset
+	} else if item.Done {
+		status = pv.style.accent + "DONE ✔" + colorReset
+	} else if item.Scanning {
+		frame := pv.style.spinnerFrames[int(time.Since(pv.started)/spinnerInterval)%len(pv.style.spinnerFrames)]
+		status = fmt.Sprintf("%s Scanning… %s", frame, pv.renderScan(item))
+	} else if item.ETA > 0 {
+		status = fmt.Sprintf("ETA %s", formatDuration(item.ETA))
+	}
+
+	if item.Warnings > 0 {
+		status += "  " + colorYellow + "⚠ " + formatWarnings(item.Warnings) + colorReset
+	}
+	if throughput := pv.renderThroughput(item); throughput != "" && !item.Failed && !item.Canceled && item.Skipped == "" {
+		status += "  " + throughput
+	}
+	if compression := pv.renderCompression(item); compression != "" {
+		status += "  " + colorGray + compression + colorReset
+	}
+
+	return status
+}
+
+// renderCompression creates the compression summary (e.g. "1.2 GB → 400.0 MB (33%), saved 800.0 MB")
+func (pv *ProgressView) renderCompression(item *ProgressItem) string {
+	if item.RawBytes == 0 || item.CompressedBytes == 0 {
+		return ""
+	}
+
+	ratio := float64(item.CompressedBytes) * 100 / float64(item.RawBytes)
+	saved := max(item.RawBytes-item.CompressedBytes, 0)
+	return fmt.Sprintf("%s → %s (%.0f%%), saved %s",
+		FormatBytes(item.RawBytes), FormatBytes(item.CompressedBytes), ratio, FormatBytes(saved))
+}
+
+// renderScan creates the scan summary, e.g. "120,000 files, 85.0 GB"
+func (pv *ProgressView) renderScan(item *ProgressItem) string {
+	files := "files"
+	if item.ScannedFiles == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%s %s, %s", formatCount(item.ScannedFiles), files, FormatBytes(item.ScannedBytes))
+}
+
+// formatCount formats a count with thousands separators, e.g. "120,000"
+func formatCount(n int) string {
+	s := fmt.Sprint(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// renderThroughput creates the transfer summary, e.g. "1.2 GB / 3.4 GB, 45.1 MB/s
+// (avg 38.2 MB/s)" while running and "avg 38.2 MB/s" once done
+func (pv *ProgressView) renderThroughput(item *ProgressItem) string {
+	if item.Bytes == 0 || item.started.IsZero() {
+		return ""
+	}
+
+	// Done locations keep the average they ended with
+	end := time.Now()
+	if item.Done {
+		end = item.updated
+	}
+	var average float64
+	if elapsed := end.Sub(item.started).Seconds(); elapsed >= 1 {
+		average = float64(item.Bytes) / elapsed
+	}
 	if item.Done {
-		return colorGreen + "DONE ✔" + colorReset
+		if average == 0 {
+			return ""
+		}
+		return "avg " + formatRate(average)
 	}
 
-	if item.ETA > 0 {
-		return fmt.Sprintf("ETA %s", pv.formatDuration(item.ETA))
+	summary := FormatBytes(item.Bytes)
+	if item.TotalBytes > 0 {
+		summary += " / " + FormatBytes(item.TotalBytes)
+	}
+	if item.Rate > 0 {
+		summary += ", " + formatRate(item.Rate)
+		if average > 0 {
+			summary += " (avg " + formatRate(average) + ")"
+		}
+	} else if average > 0 {
+		summary += ", avg " + formatRate(average)
 	}
+	return summary
+}
 
-	return "Calculating..."
+// formatRate formats a speed in bytes per second as MB/s
+func formatRate(bytesPerSecond float64) string {
+	return fmt.Sprintf("%.1f MB/s", bytesPerSecond/(1024*1024))
 }
 
 // formatDuration formats a duration for display
-func (pv *ProgressView) formatDuration(d time.Duration) string {
+func formatDuration(d time.Duration) string {
 	if d < time.Second {
 		return "< 1s"
 	}
@@ -330,6 +772,11 @@ func (pv *ProgressView) formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%ds", seconds)
 }
 
+// FormatBytes formats a byte count with a binary unit (e.g. "1.5 GB")
+func FormatBytes(n int64) string {
+	return units.FormatSize(n)
+}
+
 // clearLines clears the previously printed lines
 func (pv *ProgressView) clearLines() {
 	if pv.lastLines == 0 {
@@ -0,0 +1,94 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Totals sets what a location processed in all, for the summary table shown
+// once the view is finished: the files, their size and the size of their
+// archive
+func (pv *ProgressView) Totals(location string, files int, size, compressed int64) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if item, exists := pv.items[location]; exists {
+		item.totals(files, size, compressed)
+	}
+}
+
+// Warn counts a warning about a location, shown next to its bar while it
+// runs and in the summary table
+func (pv *ProgressView) Warn(location string) {
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if item, exists := pv.items[location]; exists {
+		item.Warnings++
+		pv.render()
+	}
+}
+
+// report creates the summary table of the locations, with their files,
+// sizes, compression ratio, duration and warnings and a total, empty if no
+// location has totals
+func (l *locations) report() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "LOCATION\tFILES\tSIZE\tCOMPRESSED\tRATIO\tDURATION\tWARNINGS\n")
+
+	var total ProgressItem
+	reported := 0
+	for _, location := range l.order {
+		item := l.items[location]
+		total.Warnings += item.Warnings
+		if !item.hasTotals || !item.Done {
+			status := "not done"
+			switch {
+			case item.Failed:
+				status = "failed"
+			case item.Canceled:
+				status = "canceled"
+			case item.Skipped != "":
+				status = "skipped (" + item.Skipped + ")"
+			case item.Done:
+				status = "done"
+			}
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t%d\t%s\n", location, item.Warnings, status)
+			continue
+		}
+
+		reported++
+		total.Files += item.Files
+		total.Size += item.Size
+		total.Compressed += item.Compressed
+		duration := item.finished.Sub(item.begun)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", location, formatCount(item.Files), FormatBytes(item.Size),
+			FormatBytes(item.Compressed), formatRatio(item.Size, item.Compressed), formatDuration(duration), item.Warnings)
+	}
+	if reported == 0 {
+		return ""
+	}
+	fmt.Fprintf(w, "Total\t%s\t%s\t%s\t%s\t%s\t%d\n", formatCount(total.Files), FormatBytes(total.Size),
+		FormatBytes(total.Compressed), formatRatio(total.Size, total.Compressed), formatDuration(time.Since(l.started)), total.Warnings)
+	w.Flush()
+	return b.String()
+}
+
+// formatWarnings returns a count of warnings, e.g. "3 warnings"
+func formatWarnings(n int) string {
+	if n == 1 {
+		return "1 warning"
+	}
+	return formatCount(n) + " warnings"
+}
+
+// formatRatio returns the compressed size as a percentage of the size
+func formatRatio(size, compressed int64) string {
+	if size == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", float64(compressed)*100/float64(size))
+}
@@ -0,0 +1,224 @@
+package tui
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressReporter receives the progress of a backup or restore, location by
+// location: each is added, scanned, reports the file it's at and the bytes
+// processed and ends done, failed or skipped. The ProgressView draws it on a
+// terminal, the other reporters emit it as JSON events, log it or drop it.
+type ProgressReporter interface {
+	// Add adds a location, or starts it over if it was added before
+	Add(location string, progress float64, eta time.Duration)
+	// Expect sets the bytes a location is expected to process before it started
+	Expect(location string, total int64)
+	// Scan updates the files and bytes the scan of a location found so far
+	Scan(location string, files int, size int64)
+	// Set updates the progress of a location, which is done at 1.0
+	Set(location string, progress float64, eta time.Duration)
+	// Bytes updates the bytes processed of a location out of the expected total
+	Bytes(location string, done, total int64)
+	// Compression updates the raw and compressed byte counts of a location
+	Compression(location string, raw, compressed int64)
+	// Totals sets what a location processed in all, for the summary table
+	Totals(location string, files int, size, compressed int64)
+	// Warn counts a warning about a location
+	Warn(location string)
+	// Done marks a location as complete or incomplete
+	Done(location string, done bool)
+	// Fail marks a location as failed
+	Fail(location string)
+	// Skip marks a location as skipped with a short reason
+	Skip(location string, reason string)
+	// Reset clears the progress of a location before it's retried
+	Reset(location string)
+	// Message sets the status message, typically the file being processed
+	Message(message string)
+	// Completed reports a finished file
+	Completed(path string, size int64)
+	// Controls lets the user pause, skip and cancel the run, if supported
+	Controls(cancel func())
+	// Skippable sets how the running location is skipped, nil once none is
+	// running
+	Skippable(skip func())
+	// Wait blocks while the run is paused and returns how long it waited
+	Wait(ctx context.Context) time.Duration
+	// Cancel marks the locations that aren't done yet as canceled and
+	// completes the reporter
+	Cancel()
+	// Finish completes the reporter with a success message
+	Finish(successMessage string)
+	// Clear completes the reporter without a summary, e.g. on errors
+	Clear()
+	// Stored reports where a location went once it is done: the path of a
+	// location and its archive on backup, the archive and the restored path
+	// on restore
+	Stored(from, to string)
+}
+
+var (
+	_ ProgressReporter = (*ProgressView)(nil)
+	_ ProgressReporter = (*JSONReporter)(nil)
+	_ ProgressReporter = (*LogReporter)(nil)
+	_ ProgressReporter = NopReporter{}
+)
+
+// NewReporter creates the reporter of a run for the output that was asked
+// for: JSON events with --json, logs with --quiet or --verbose, otherwise a
+// progress view drawn with the theme. The phase prefixes status messages,
+// e.g. "Archiving".
+func NewReporter(phase string, theme Theme) ProgressReporter {
+	if phase == "" {
+		phase = "Processing"
+	}
+
+	logger := slog.Default()
+	switch {
+	case JSONEnabled():
+		return NewJSONReporter(phase)
+	case !logger.Enabled(context.Background(), slog.LevelInfo) || logger.Enabled(context.Background(), slog.LevelDebug):
+		return NewLogReporter()
+	default:
+		return NewProgressView(phase, theme)
+	}
+}
+
+// LogReporter keeps track of the locations without drawing them and logs the
+// summary table once the run finished, for --quiet and --verbose
+type LogReporter struct {
+	locations
+	mu sync.Mutex
+}
+
+// NewLogReporter creates a reporter that logs the summary of the run
+func NewLogReporter() *LogReporter {
+	return &LogReporter{locations: newLocations()}
+}
+
+// update runs f on a location under the lock, if it was added
+func (r *LogReporter) update(location string, f func(item *ProgressItem)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if item, exists := r.items[location]; exists {
+		f(item)
+	}
+}
+
+func (r *LogReporter) Add(location string, progress float64, eta time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(location, progress, eta)
+}
+
+func (r *LogReporter) Set(location string, progress float64, eta time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.item(location).set(progress, eta)
+}
+
+func (r *LogReporter) Expect(location string, total int64) {
+	r.update(location, func(item *ProgressItem) { item.TotalBytes = total })
+}
+
+func (r *LogReporter) Scan(location string, files int, size int64) {
+	r.update(location, func(item *ProgressItem) { item.scan(files, size) })
+}
+
+func (r *LogReporter) Bytes(location string, done, total int64) {
+	r.update(location, func(item *ProgressItem) { item.bytes(done, total) })
+}
+
+func (r *LogReporter) Compression(location string, raw, compressed int64) {
+	r.update(location, func(item *ProgressItem) { item.RawBytes, item.CompressedBytes = raw, compressed })
+}
+
+func (r *LogReporter) Totals(location string, files int, size, compressed int64) {
+	r.update(location, func(item *ProgressItem) { item.totals(files, size, compressed) })
+}
+
+func (r *LogReporter) Warn(location string) {
+	r.update(location, func(item *ProgressItem) { item.Warnings++ })
+}
+
+func (r *LogReporter) Done(location string, done bool) {
+	r.update(location, func(item *ProgressItem) { item.done(done) })
+}
+
+func (r *LogReporter) Fail(location string) {
+	r.update(location, func(item *ProgressItem) { item.Failed, item.Done = true, false })
+}
+
+func (r *LogReporter) Skip(location string, reason string) {
+	r.update(location, func(item *ProgressItem) { item.skip(reason) })
+}
+
+func (r *LogReporter) Reset(location string) {
+	r.update(location, func(item *ProgressItem) { *item = ProgressItem{Location: location} })
+}
+
+func (r *LogReporter) Message(message string)                 {}
+func (r *LogReporter) Completed(path string, size int64)      {}
+func (r *LogReporter) Controls(cancel func())                 {}
+func (r *LogReporter) Skippable(skip func())                  {}
+func (r *LogReporter) Wait(ctx context.Context) time.Duration { return 0 }
+func (r *LogReporter) Clear()                                 {}
+func (r *LogReporter) Stored(from, to string)                 {}
+
+func (r *LogReporter) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cancel()
+	r.finish("")
+}
+
+func (r *LogReporter) Finish(successMessage string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.finish(successMessage)
+}
+
+// finish logs the summary table and the success message, the caller holds
+// the lock
+func (r *LogReporter) finish(successMessage string) {
+	if report := r.report(); report != "" {
+		slog.Info("Summary:\n" + strings.TrimSuffix(report, "\n"))
+	}
+	if successMessage != "" {
+		slog.Info(successMessage)
+	}
+}
+
+// NopReporter drops all progress, e.g. for runs embedded in other programs
+type NopReporter struct{}
+
+func (NopReporter) Add(location string, progress float64, eta time.Duration)  {}
+func (NopReporter) Expect(location string, total int64)                       {}
+func (NopReporter) Scan(location string, files int, size int64)               {}
+func (NopReporter) Set(location string, progress float64, eta time.Duration)  {}
+func (NopReporter) Bytes(location string, done, total int64)                  {}
+func (NopReporter) Compression(location string, raw, compressed int64)        {}
+func (NopReporter) Totals(location string, files int, size, compressed int64) {}
+func (NopReporter) Warn(location string)                                      {}
+func (NopReporter) Done(location string, done bool)                           {}
+func (NopReporter) Fail(location string)                                      {}
+func (NopReporter) Skip(location string, reason string)                       {}
+func (NopReporter) Reset(location string)                                     {}
+func (NopReporter) Message(message string)                                    {}
+func (NopReporter) Completed(path string, size int64)                         {}
+func (NopReporter) Controls(cancel func())                                    {}
+func (NopReporter) Skippable(skip func())                                     {}
+func (NopReporter) Wait(ctx context.Context) time.Duration                    { return 0 }
+func (NopReporter) Cancel()                                                   {}
+func (NopReporter) Finish(successMessage string)                              {}
+func (NopReporter) Clear()                                                    {}
+func (NopReporter) Stored(from, to string)                                    {}
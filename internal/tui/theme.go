@@ -0,0 +1,126 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Theme is how progress bars and pickers look, set by the theme block of
+// the config
+type Theme struct {
+	Accent string `yaml:"accent"` // Color of finished bars and selections: "green" (default), "blue", "cyan", "magenta", "yellow" or "white"
+	Bar    string `yaml:"bar"`    // Characters of the bars: "braille" (default) or "ascii", for terminals that don't render braille well
+}
+
+// accentColors are the ANSI codes of the accent colors a theme can pick
+var accentColors = map[string]string{
+	"green":   "\033[32m",
+	"blue":    "\033[34m",
+	"cyan":    "\033[36m",
+	"magenta": "\033[35m",
+	"yellow":  "\033[33m",
+	"white":   "\033[97m",
+}
+
+// barStyles are the bar characters a theme can pick
+var barStyles = []string{"braille", "ascii"}
+
+// colorModes are the values of --color
+var colorModes = []string{"auto", "always", "never"}
+
+// colorMode is the value of --color
+var colorMode = "auto"
+
+// Colors of the color mode, see applyColors. Progress views draw with the
+// accent of their theme instead.
+var colorAccent, colorRed, colorYellow, colorGray, colorReset string
+
+func init() {
+	applyColors()
+}
+
+// Spinners animating locations while they are scanned
+var (
+	brailleSpinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	asciiSpinner   = []string{"|", "/", "-", "\\"}
+)
+
+// CheckAccent checks that an accent of a theme is a known color, empty for
+// the default
+func CheckAccent(accent string) error {
+	if _, ok := accentColors[accent]; accent != "" && !ok {
+		names := make([]string, 0, len(accentColors))
+		for name := range accentColors {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("unknown color %q, expected one of %s", accent, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// CheckBar checks that a bar of a theme is a known style, empty for the
+// default
+func CheckBar(bar string) error {
+	if bar != "" && !slices.Contains(barStyles, bar) {
+		return fmt.Errorf("unknown bar %q, expected %q or %q", bar, barStyles[0], barStyles[1])
+	}
+	return nil
+}
+
+// style is what a progress view is drawn with, see Theme.style
+type style struct {
+	accent              string
+	barFilled, barEmpty string
+	spinnerFrames       []string
+}
+
+// style returns the colors and characters of a theme under the color mode.
+// Unknown values keep the default, see CheckAccent and CheckBar.
+func (t Theme) style() style {
+	s := style{accent: colorAccent, barFilled: "⣿", barEmpty: " ", spinnerFrames: brailleSpinner}
+	if accent, ok := accentColors[t.Accent]; ok && colored() {
+		s.accent = accent
+	}
+	if t.Bar == "ascii" {
+		s.barFilled, s.barEmpty, s.spinnerFrames = "#", "-", asciiSpinner
+	}
+	return s
+}
+
+// SetColor sets when output is colored: "auto" colors on a terminal unless
+// NO_COLOR is set, "always" and "never" force it on or off
+func SetColor(mode string) error {
+	if !slices.Contains(colorModes, mode) {
+		return fmt.Errorf("invalid --color %q, expected auto, always or never", mode)
+	}
+	colorMode = mode
+	applyColors()
+	return nil
+}
+
+// colored reports whether output is colored
+func colored() bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return IsTerminal() || term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// applyColors sets the colors of the color mode
+func applyColors() {
+	colorAccent, colorRed, colorYellow, colorGray, colorReset = accentColors["green"], "\033[31m", "\033[33m", "\033[90m", "\033[0m"
+	if !colored() {
+		colorAccent, colorRed, colorYellow, colorGray, colorReset = "", "", "", "", ""
+	}
+}
@@ -0,0 +1,740 @@
+package macup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// appModules capture the setup of the apps, in restore order. Preferences
+// come first, so apps installed afterwards start with them.
+var appModules = []Module{
+	appModule{
+		name:    "defaults",
+		label:   "macOS defaults",
+		enabled: func(config *Config) bool { return len(config.Defaults) > 0 },
+		backup:  func(job *Job) error { return apps.BackupDefaults(job.Store, job.Config.Defaults) },
+		restore: func(job *Job) error { return restoreDefaults(job.Config, job.Store) },
+	},
+	appModule{
+		name:    "keyboard",
+		label:   "Keyboard",
+		enabled: func(config *Config) bool { return config.Apps.Keyboard.Enabled },
+		backup:  func(job *Job) error { return apps.BackupKeyboard(job.Store) },
+		restore: func(job *Job) error { return restoreKeyboard(job.Store) },
+		objects: []string{apps.KeyboardName},
+	},
+	appModule{
+		name:    "homebrew",
+		label:   "Homebrew",
+		enabled: func(config *Config) bool { return config.Apps.Homebrew.Enabled },
+		backup:  func(job *Job) error { return apps.BackupHomebrew(job.Store, job.Config.Apps.Mas.Enabled) },
+		restore: func(job *Job) error { return restoreHomebrew(job.Config, job.Store) },
+		objects: []string{apps.BrewfileName},
+	},
+	appModule{
+		name:    "mas",
+		label:   "App Store",
+		enabled: func(config *Config) bool { return config.Apps.Mas.Enabled },
+		backup: func(job *Job) error {
+			list, err := apps.ListAppStoreApps()
+			job.Manifest.AppStore = list
+			return err
+		},
+		restore: func(job *Job) error { return restoreAppStore(job.Config, job.Store, job.Options.PickApps) },
+	},
+	appModule{
+		name:    "vscode",
+		label:   "VS Code",
+		enabled: func(config *Config) bool { return config.Apps.VSCode.Enabled },
+		backup:  func(job *Job) error { return apps.BackupVSCode(job.Store, job.Config.Apps.VSCode) },
+		restore: func(job *Job) error { return restoreVSCode(job.Config, job.Store) },
+	},
+	appModule{
+		name:    "fonts",
+		label:   "Fonts",
+		enabled: func(config *Config) bool { return config.Fonts || config.SystemFonts },
+		backup:  func(job *Job) error { return apps.BackupFonts(job.Store, job.Config.SystemFonts) },
+		restore: func(job *Job) error { return restoreFonts(job.Store) },
+		objects: []string{apps.FontsArchive},
+	},
+	appModule{
+		name:    "ssh",
+		label:   "SSH",
+		enabled: func(config *Config) bool { return config.Apps.SSH.Enabled },
+		backup:  func(job *Job) error { return apps.BackupSSH(job.Store, job.Config.Apps.SSH) },
+		restore: func(job *Job) error { return restoreSSH(job.Store) },
+		objects: []string{apps.SSHArchive},
+	},
+	appModule{
+		name:    "mail",
+		label:   "Mail",
+		enabled: func(config *Config) bool { return config.Apps.Mail.Enabled },
+		backup: func(job *Job) error {
+			accounts, err := apps.ListMailAccounts()
+			if err != nil {
+				return err
+			}
+			job.Manifest.Mail = accounts
+			return apps.BackupMail(job.Store)
+		},
+		restore: func(job *Job) error { return restoreMail(job.Store) },
+		objects: []string{apps.MailArchive},
+	},
+	appModule{
+		name:    "printers",
+		label:   "Printers",
+		enabled: func(config *Config) bool { return config.Apps.Printers.Enabled },
+		backup:  func(job *Job) error { return apps.BackupPrinters(job.Store) },
+		restore: func(job *Job) error { return restorePrinters(job.Store) },
+		objects: []string{apps.PrintersName},
+	},
+	appModule{
+		name:    "network",
+		label:   "Network",
+		enabled: func(config *Config) bool { return config.Apps.Network.Enabled },
+		backup: func(job *Job) error {
+			if job.Config.Apps.Network.Passwords {
+				slog.Warn(fmt.Sprintf("Wi-Fi passwords are stored in plain text in %s, keep the backup on an encrypted volume", apps.NetworkName))
+			}
+			return apps.BackupNetwork(job.Store, job.Config.Apps.Network)
+		},
+		restore: func(job *Job) error { return restoreNetwork(job.Store) },
+		objects: []string{apps.NetworkName},
+	},
+	appModule{
+		name:    "browsers",
+		label:   "Browsers",
+		enabled: func(config *Config) bool { return config.Apps.Browsers.Enabled },
+		backup: func(job *Job) error {
+			extensions, err := apps.BackupBrowsers(job.Store, job.Config.Apps.Browsers)
+			job.Manifest.Browsers = extensions
+			return err
+		},
+		restore: func(job *Job) error { return restoreBrowsers(job.Store) },
+		objects: []string{apps.BrowsersArchive},
+	},
+	appModule{
+		name:    "docker",
+		label:   "Docker",
+		enabled: func(config *Config) bool { return config.Apps.Docker.Enabled },
+		backup: func(job *Job) error {
+			captured, err := apps.BackupDocker(job.Store, job.Config.Apps.Docker)
+			job.Manifest.Docker = captured
+			return err
+		},
+		restore: func(job *Job) error { return restoreDocker(job.Config, job.Store) },
+	},
+	// Runtimes before packages, npm and pip need node and python
+	appModule{
+		name:    "runtimes",
+		label:   "Runtimes",
+		enabled: func(config *Config) bool { return config.Apps.Runtimes.Enabled },
+		backup: func(job *Job) error {
+			list, err := apps.ListRuntimes(job.Config.Apps.Runtimes)
+			job.Manifest.Runtimes = list
+			return err
+		},
+		restore: func(job *Job) error { return restoreRuntimes(job.Config, job.Store) },
+	},
+	// Global packages are only reinstalled on request
+	appModule{
+		name:    "packages",
+		label:   "Packages",
+		enabled: func(config *Config) bool { return config.Apps.Packages.Enabled },
+		backup: func(job *Job) error {
+			list, err := apps.ListPackages(job.Config.Apps.Packages)
+			job.Manifest.Packages = list
+			return err
+		},
+		restore: func(job *Job) error {
+			if !job.Options.Tools {
+				return nil
+			}
+			return restorePackages(job.Config, job.Store)
+		},
+	},
+	// Jobs last, so they find the tools they run
+	appModule{
+		name:    "jobs",
+		label:   "Jobs",
+		enabled: func(config *Config) bool { return config.Apps.Jobs.Enabled },
+		backup:  func(job *Job) error { return apps.BackupJobs(job.Store) },
+		restore: func(job *Job) error { return restoreJobs(job.Store) },
+		objects: []string{apps.JobsName},
+	},
+	// Tweaks after everything else, they may configure the reinstalled apps
+	appModule{
+		name:    "tweaks",
+		label:   "Tweaks",
+		enabled: func(config *Config) bool { return len(config.Tweaks) > 0 },
+		restore: func(job *Job) error {
+			if !job.Options.Tweaks {
+				return nil
+			}
+			return restoreTweaks(job.Config)
+		},
+	},
+}
+
+// backupApps captures the setup of the selected apps into the backup. Lists
+// of installed apps go into the manifest.
+func backupApps(job *Job, list []appModule) error {
+	list = slices.DeleteFunc(slices.Clone(list), func(m appModule) bool { return m.backup == nil })
+	if len(list) == 0 {
+		return nil
+	}
+
+	pv := job.Config.newReporter("Exporting")
+	for _, m := range list {
+		pv.Add(m.label, 0.0, 0)
+	}
+
+	for _, m := range list {
+		if job.ctx().Err() != nil {
+			pv.Cancel()
+			return job.canceled()
+		}
+		if err := m.Backup(job); err != nil {
+			pv.Clear()
+			return fmt.Errorf("failed to back up %s: %w", m.label, err)
+		}
+		pv.Set(m.label, 1.0, 0)
+		pv.Done(m.label, true)
+		job.completed = append(job.completed, m.label)
+	}
+
+	pv.Finish("")
+
+	return nil
+}
+
+// restoreApps reinstalls the selected apps captured in the backup. A failing
+// app doesn't stop the others, canceling the job does.
+func restoreApps(job *Job, list []appModule) error {
+	var errs []error
+	for _, m := range list {
+		if job.ctx().Err() != nil {
+			return job.canceled()
+		}
+		if err := m.Restore(job); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		job.completed = append(job.completed, m.label)
+	}
+	return errors.Join(errs...)
+}
+
+// restoreFonts installs the fonts of the backup
+func restoreFonts(store storage.Storage) error {
+	if _, err := store.Stat(apps.FontsArchive); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	installed, err := apps.RestoreFonts(store)
+	if err != nil {
+		return fmt.Errorf("failed to restore fonts: %w", err)
+	}
+	slog.Info(fmt.Sprintf("✓ %d fonts installed", installed))
+
+	return nil
+}
+
+// restorePrinters adds the printer queues of the backup
+func restorePrinters(store storage.Storage) error {
+	if _, err := store.Stat(apps.PrintersName); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	added, err := apps.RestorePrinters(store)
+	if err != nil {
+		return fmt.Errorf("failed to restore printers: %w", err)
+	}
+	slog.Info(fmt.Sprintf("✓ %d printers added", added))
+
+	return nil
+}
+
+// restoreJobs puts the crontab and LaunchAgents of the backup back in place
+func restoreJobs(store storage.Storage) error {
+	if _, err := store.Stat(apps.JobsName); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	restored, err := apps.RestoreJobs(store)
+	if err != nil {
+		return fmt.Errorf("failed to restore scheduled jobs: %w", err)
+	}
+	slog.Info(fmt.Sprintf("✓ Crontab and %d LaunchAgents restored", restored))
+
+	return nil
+}
+
+// restoreDefaults applies the macOS preferences stored in the backup
+func restoreDefaults(config *Config, store storage.Storage) error {
+	pv := config.newReporter("Applying")
+	pv.Add("macOS defaults", 0.0, 0)
+
+	if err := apps.RestoreDefaults(store, config.Defaults); err != nil {
+		pv.Fail("macOS defaults")
+		pv.Finish("")
+		return fmt.Errorf("failed to restore macOS defaults: %w", err)
+	}
+
+	pv.Set("macOS defaults", 1.0, 0)
+	pv.Done("macOS defaults", true)
+	pv.Finish("✓ macOS defaults applied successfully!")
+
+	return nil
+}
+
+// restoreTweaks applies the system tweaks of the config in order. Tweaks
+// that fail don't stop the others.
+func restoreTweaks(config *Config) error {
+	// sudo may ask for a password, so authorize before drawing progress
+	if slices.ContainsFunc(config.Tweaks, func(t apps.Tweak) bool { return t.Sudo }) {
+		if err := apps.AuthorizeSudo(); err != nil {
+			return fmt.Errorf("failed to apply tweaks: %w", err)
+		}
+	}
+
+	pv := config.newReporter("Applying")
+	labels := make([]string, len(config.Tweaks))
+	for i, tweak := range config.Tweaks {
+		labels[i] = fmt.Sprintf("%d. %s", i+1, tweak.Label())
+		pv.Add(labels[i], 0.0, 0)
+	}
+
+	var errs []error
+	for i, tweak := range config.Tweaks {
+		applied, err := apps.ApplyTweak(tweak)
+		switch {
+		case err != nil:
+			pv.Fail(labels[i])
+			errs = append(errs, fmt.Errorf("  - %w", err))
+		case !applied:
+			pv.Skip(labels[i], "already applied")
+		default:
+			pv.Set(labels[i], 1.0, 0)
+			pv.Done(labels[i], true)
+		}
+	}
+
+	if len(errs) > 0 {
+		pv.Finish("")
+		return fmt.Errorf("%d of %d tweaks failed:\n%w", len(errs), len(config.Tweaks), errors.Join(errs...))
+	}
+	pv.Finish("✓ Tweaks applied successfully!")
+
+	return nil
+}
+
+// restoreKeyboard restores the keyboard shortcuts and input sources and
+// explains how to import the text replacements
+func restoreKeyboard(store storage.Storage) error {
+	if _, err := store.Stat(apps.KeyboardName); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	path, err := apps.RestoreKeyboard(store)
+	if err != nil {
+		return fmt.Errorf("failed to restore keyboard settings: %w", err)
+	}
+	slog.Info("✓ Keyboard shortcuts and input sources restored, input sources apply after logging out")
+	if path != "" {
+		slog.Info(fmt.Sprintf("Drag the entries of %s into System Settings > Keyboard > Text Replacements", path))
+	}
+
+	return nil
+}
+
+// restoreHomebrew installs Homebrew if needed and everything in the Brewfile
+func restoreHomebrew(config *Config, store storage.Storage) error {
+	if _, err := store.Stat(apps.BrewfileName); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	// The installer may ask for a password, so run it before drawing progress
+	if err := apps.InstallHomebrew(); err != nil {
+		return err
+	}
+
+	pv := config.newReporter("Installing")
+	pv.Add("Homebrew", 0.0, 0)
+
+	err := apps.RestoreHomebrew(store, func(done float64, entry string) {
+		pv.Set("Homebrew", done, 0)
+		pv.Message(entry)
+	})
+	if err != nil {
+		pv.Fail("Homebrew")
+		pv.Finish("")
+		return fmt.Errorf("failed to restore Homebrew: %w", err)
+	}
+
+	pv.Message("")
+	pv.Done("Homebrew", true)
+	pv.Finish("✓ Homebrew packages installed successfully!")
+
+	return nil
+}
+
+// restoreVSCode places the editor config files and reinstalls extensions
+func restoreVSCode(config *Config, store storage.Storage) error {
+	pv := config.newReporter("Installing")
+	pv.Add("VS Code", 0.0, 0)
+
+	err := apps.RestoreVSCode(store, config.Apps.VSCode, func(done float64, entry string) {
+		pv.Set("VS Code", done, 0)
+		pv.Message(entry)
+	})
+	if err != nil {
+		pv.Message("")
+		pv.Fail("VS Code")
+		pv.Finish("")
+		return fmt.Errorf("failed to restore VS Code: %w", err)
+	}
+
+	pv.Message("")
+	pv.Done("VS Code", true)
+	pv.Finish("✓ VS Code settings and extensions restored successfully!")
+
+	return nil
+}
+
+// restoreAppStore reinstalls the App Store apps recorded in the manifest,
+// except those on the skip list or deselected with pick
+func restoreAppStore(config *Config, store storage.Storage, pick func([]AppStoreApp) []AppStoreApp) error {
+	manifest, err := readManifest(store)
+	if err != nil {
+		return err
+	}
+	if manifest == nil || len(manifest.AppStore) == 0 {
+		return nil
+	}
+
+	selected := make([]apps.App, 0, len(manifest.AppStore))
+	for _, app := range manifest.AppStore {
+		if !config.Apps.Mas.Skipped(app) {
+			selected = append(selected, app)
+		}
+	}
+	if pick != nil {
+		selected = pick(selected)
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	if err := apps.InstallMas(); err != nil {
+		return err
+	}
+
+	pv := config.newReporter("Installing")
+	pv.Add("App Store", 0.0, 0)
+
+	var failed []error
+	for i, app := range selected {
+		pv.Message(app.Name)
+		if err := apps.InstallAppStoreApp(app); err != nil {
+			failed = append(failed, fmt.Errorf("  - %w", err))
+		}
+		pv.Set("App Store", float64(i+1)/float64(len(selected)), 0)
+	}
+	pv.Message("")
+
+	if len(failed) > 0 {
+		pv.Fail("App Store")
+		pv.Finish("")
+		return fmt.Errorf("%d of %d App Store apps failed to install (signed in to the App Store?):\n%w",
+			len(failed), len(selected), errors.Join(failed...))
+	}
+
+	pv.Done("App Store", true)
+	pv.Finish("✓ App Store apps installed successfully!")
+
+	return nil
+}
+
+// restoreSSH restores ~/.ssh and reports the hosts and keys that are back
+func restoreSSH(store storage.Storage) error {
+	if _, err := store.Stat(apps.SSHArchive); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	report, err := apps.RestoreSSH(store)
+	if err != nil {
+		return fmt.Errorf("failed to restore SSH: %w", err)
+	}
+
+	msg := fmt.Sprintf("✓ SSH restored, host keys of %d hosts", len(report.Hosts))
+	if report.Hashed > 0 {
+		msg += fmt.Sprintf(" and %d hashed entries", report.Hashed)
+	}
+	if len(report.Hosts) > 0 {
+		msg += "\n  " + strings.Join(report.Hosts, ", ")
+	}
+	slog.Info(msg)
+	if len(report.Keys) > 0 {
+		slog.Info(fmt.Sprintf("✓ Added %d keys to the agent and Keychain", len(report.Keys)))
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("failed to add SSH keys to the agent:\n  - %s", strings.Join(report.Failed, "\n  - "))
+	}
+
+	return nil
+}
+
+// restoreMail restores the rules and signatures of Mail and adds the accounts
+// recorded in the manifest
+func restoreMail(store storage.Storage) error {
+	if _, err := store.Stat(apps.MailArchive); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	manifest, err := readManifest(store)
+	if err != nil {
+		return err
+	}
+
+	// The files first, adding accounts launches Mail
+	if err := apps.RestoreMail(store); err != nil {
+		return fmt.Errorf("failed to restore Mail: %w", err)
+	}
+	slog.Info("✓ Mail rules and signatures restored")
+	if manifest == nil {
+		return nil
+	}
+
+	var errs []error
+	var manual []string
+	added := 0
+	for _, account := range manifest.Mail {
+		if account.Manual() {
+			manual = append(manual, fmt.Sprintf("%s (%s)", account.Name, account.Type))
+			continue
+		}
+		if err := apps.AddMailAccount(account); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		added++
+	}
+	if added > 0 {
+		slog.Info(fmt.Sprintf("✓ Added %d Mail accounts, Mail asks for their passwords", added))
+	}
+	if len(manual) > 0 {
+		slog.Info("Add these accounts in System Settings > Internet Accounts:\n  - " + strings.Join(manual, "\n  - "))
+	}
+
+	return errors.Join(errs...)
+}
+
+// restoreNetwork recreates the network locations and Wi-Fi networks and
+// lists what has to be set up by hand
+func restoreNetwork(store storage.Storage) error {
+	if _, err := store.Stat(apps.NetworkName); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	manual, err := apps.RestoreNetwork(store)
+	if err == nil {
+		slog.Info("✓ Network settings restored")
+	}
+	if len(manual) > 0 {
+		slog.Info("Set up by hand:\n  - " + strings.Join(manual, "\n  - "))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore network settings: %w", err)
+	}
+
+	return nil
+}
+
+// restoreBrowsers puts the browser profiles back in place and lists the
+// extensions that have to be reinstalled by hand
+func restoreBrowsers(store storage.Storage) error {
+	manifest, err := readManifest(store)
+	if err != nil {
+		return err
+	}
+	if manifest == nil || len(manifest.Browsers) == 0 {
+		return nil
+	}
+
+	names := slices.Sorted(maps.Keys(manifest.Browsers))
+	if err := apps.RestoreBrowsers(store, names); err != nil {
+		return fmt.Errorf("failed to restore browsers: %w", err)
+	}
+	slog.Info("✓ Browser profiles restored")
+
+	for _, name := range names {
+		var hints []string
+		for _, id := range manifest.Browsers[name] {
+			if hint := apps.ExtensionHint(name, id); hint != "" {
+				hints = append(hints, hint)
+			}
+		}
+		if len(hints) > 0 {
+			slog.Info(fmt.Sprintf("Reinstall the %s extensions:\n  - %s", name, strings.Join(hints, "\n  - ")))
+		}
+	}
+
+	return nil
+}
+
+// restoreRuntimes reinstalls the runtime versions recorded in the manifest
+// and selects the global ones again
+func restoreRuntimes(config *Config, store storage.Storage) error {
+	manifest, err := readManifest(store)
+	if err != nil {
+		return err
+	}
+	if manifest == nil || len(manifest.Runtimes) == 0 {
+		return nil
+	}
+
+	pv := config.newReporter("Installing")
+	pv.Add("Runtimes", 0.0, 0)
+
+	var failed []error
+	installed := make([]apps.Runtime, 0, len(manifest.Runtimes))
+	for i, runtime := range manifest.Runtimes {
+		pv.Message(runtime.Tool + " " + runtime.Version)
+		if err := apps.InstallRuntime(runtime); err != nil {
+			failed = append(failed, fmt.Errorf("  - %s: %w", runtime.Manager, err))
+		} else {
+			installed = append(installed, runtime)
+		}
+		pv.Set("Runtimes", float64(i+1)/float64(len(manifest.Runtimes)), 0)
+	}
+	pv.Message("")
+
+	// Only versions that were installed can be selected
+	if err := apps.SetGlobalRuntimes(installed); err != nil {
+		failed = append(failed, fmt.Errorf("  - %w", err))
+	}
+
+	if len(failed) > 0 {
+		pv.Fail("Runtimes")
+		pv.Finish("")
+		return fmt.Errorf("%d of %d runtime versions failed to install:\n%w",
+			len(manifest.Runtimes)-len(installed), len(manifest.Runtimes), errors.Join(failed...))
+	}
+
+	pv.Done("Runtimes", true)
+	pv.Finish("✓ Runtimes installed successfully!")
+
+	return nil
+}
+
+// restoreDocker fills the exported volumes again and pulls the recorded images
+func restoreDocker(config *Config, store storage.Storage) error {
+	manifest, err := readManifest(store)
+	if err != nil {
+		return err
+	}
+	if manifest == nil || manifest.Docker == nil {
+		return nil
+	}
+	docker := manifest.Docker
+
+	pv := config.newReporter("Installing")
+	if len(docker.Volumes) > 0 {
+		pv.Add("Docker volumes", 0.0, 0)
+	}
+	if len(docker.Images) > 0 {
+		pv.Add("Docker images", 0.0, 0)
+	}
+
+	var failed []error
+	var kept []string
+	for i, volume := range docker.Volumes {
+		pv.Message(volume)
+		created, err := apps.RestoreDockerVolume(store, volume)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("  - volume %s: %w", volume, err))
+		} else if !created {
+			kept = append(kept, volume)
+		}
+		pv.Set("Docker volumes", float64(i+1)/float64(len(docker.Volumes)), 0)
+	}
+	if len(docker.Volumes) > 0 {
+		pv.Done("Docker volumes", true)
+	}
+
+	for i, image := range docker.Images {
+		pv.Message(image)
+		if err := apps.PullImage(image); err != nil {
+			failed = append(failed, fmt.Errorf("  - %w", err))
+		}
+		pv.Set("Docker images", float64(i+1)/float64(len(docker.Images)), 0)
+	}
+	pv.Message("")
+	if len(docker.Images) > 0 {
+		pv.Done("Docker images", true)
+	}
+
+	if len(failed) > 0 {
+		pv.Finish("")
+		return fmt.Errorf("%d Docker volumes and images failed to restore:\n%w", len(failed), errors.Join(failed...))
+	}
+	pv.Finish("✓ Docker volumes and images restored successfully!")
+	if len(kept) > 0 {
+		slog.Info("Kept the existing volumes " + strings.Join(kept, ", "))
+	}
+
+	return nil
+}
+
+// restorePackages reinstalls the global packages recorded in the manifest
+func restorePackages(config *Config, store storage.Storage) error {
+	manifest, err := readManifest(store)
+	if err != nil {
+		return err
+	}
+	if manifest == nil || len(manifest.Packages) == 0 {
+		return nil
+	}
+
+	managers := slices.Sorted(maps.Keys(manifest.Packages))
+	total := 0
+	for _, manager := range managers {
+		total += len(manifest.Packages[manager])
+	}
+
+	pv := config.newReporter("Installing")
+	pv.Add("Packages", 0.0, 0)
+
+	var failed []error
+	done := 0
+	for _, manager := range managers {
+		for _, pkg := range manifest.Packages[manager] {
+			pv.Message(manager + " " + pkg)
+			if err := apps.InstallPackage(manager, pkg); err != nil {
+				failed = append(failed, fmt.Errorf("  - %s: %w", manager, err))
+			}
+			done++
+			pv.Set("Packages", float64(done)/float64(total), 0)
+		}
+	}
+	pv.Message("")
+
+	if len(failed) > 0 {
+		pv.Fail("Packages")
+		pv.Finish("")
+		return fmt.Errorf("%d of %d packages failed to install:\n%w", len(failed), total, errors.Join(failed...))
+	}
+
+	pv.Done("Packages", true)
+	pv.Finish("✓ Packages installed successfully!")
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package macup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/tui"
+)
+
+// BrowserNodes returns the top of the backup for `macup browse`. The nodes
+// are identified by their path in the BackupFS, and archives are read once
+// their directory is opened.
+func (b *BackupFS) BrowserNodes() []*BrowserNode {
+	return b.browserNodes(b.root, "/")
+}
+
+// browserNodes returns the children of a directory as browser nodes
+func (b *BackupFS) browserNodes(dir *mountNode, dirPath string) []*tui.BrowserNode {
+	nodes := make([]*tui.BrowserNode, 0, len(dir.children))
+	for _, child := range dir.children {
+		node := &tui.BrowserNode{Name: child.name, Path: path.Join(dirPath, child.name), Size: child.size, Dir: child.dir}
+		if child.dir {
+			node.Size = -1
+			node.Load = func() ([]*tui.BrowserNode, error) {
+				if err := b.load(child); err != nil {
+					return nil, err
+				}
+				return b.browserNodes(child, node.Path), nil
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(x, y *tui.BrowserNode) int { return strings.Compare(x.Name, y.Name) })
+	return nodes
+}
+
+// extraction is a file or directory of an archive to extract
+type extraction struct {
+	entry string // Entry name, everything in the archive if empty
+	to    string // Where the entry goes, the entries below it go below
+}
+
+// Extract extracts files and directories of the BackupFS into a directory
+// and returns the extracted paths. Everything keeps its path below the
+// directory holding it, so "/Documents/thesis" is extracted as <to>/thesis.
+func (b *BackupFS) Extract(paths []string, to string) ([]string, error) {
+	to, err := NormalizePath(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each archive is read once for everything selected in it
+	var extracted []string
+	byArchive := make(map[string][]extraction)
+	var archives []string
+	for _, p := range paths {
+		node, err := b.lookup(p)
+		if err != nil {
+			return extracted, fmt.Errorf("failed to find %s: %w", p, err)
+		}
+		target := filepath.Join(to, node.name)
+		if !node.dir && node.entry == "" {
+			if err := b.extractObject(node.object, target); err != nil {
+				return extracted, err
+			}
+			extracted = append(extracted, target)
+			continue
+		}
+
+		entry := node.entry
+		top, rel, _ := strings.Cut(strings.Trim(path.Clean("/"+p), "/"), "/")
+		archiveDir := b.root.children[top]
+		if node.dir {
+			entry = strings.Trim(archiveDir.strip+rel, "/")
+		}
+		if _, ok := byArchive[archiveDir.object]; !ok {
+			archives = append(archives, archiveDir.object)
+		}
+		byArchive[archiveDir.object] = append(byArchive[archiveDir.object], extraction{entry: entry, to: target})
+	}
+
+	for _, archive := range archives {
+		files, err := b.extractEntries(archive, byArchive[archive])
+		extracted = append(extracted, files...)
+		if err != nil {
+			return extracted, err
+		}
+	}
+	return extracted, nil
+}
+
+// extractObject copies an object that isn't an archive, e.g. the Brewfile
+func (b *BackupFS) extractObject(object, target string) error {
+	r, err := b.store.Open(object)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", object, err)
+	}
+	defer r.Close()
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+	if err := extractFile(r, target, 0644); err != nil {
+		return fmt.Errorf("failed to extract file %s: %w", target, err)
+	}
+	return nil
+}
+
+// extractEntries reads an archive and extracts the entries of the extractions
+func (b *BackupFS) extractEntries(archive string, extractions []extraction) ([]string, error) {
+	r, err := openArchive(b.store, archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", archive, err)
+	}
+	defer r.Close()
+	entries, err := newEntryReader(archive, r)
+	if err != nil {
+		return nil, err
+	}
+	defer entries.Close()
+
+	var extracted []string
+	for {
+		header, err := entries.Next()
+		if err == io.EOF {
+			return extracted, nil
+		}
+		if err != nil {
+			return extracted, fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		name := path.Clean(filepath.ToSlash(header.Name))
+		for _, e := range extractions {
+			var rel string
+			switch {
+			case e.entry == "":
+				rel = name
+			case name == e.entry:
+			case strings.HasPrefix(name, e.entry+"/"):
+				rel = strings.TrimPrefix(name, e.entry+"/")
+			default:
+				continue
+			}
+			target := filepath.Join(e.to, filepath.FromSlash(rel))
+			if !within(target, e.to) {
+				return extracted, fmt.Errorf("illegal file path in archive: %s", header.Name)
+			}
+			if err := extractEntry(entries, header, target); err != nil {
+				return extracted, err
+			}
+			extracted = append(extracted, target)
+			break
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package macup
+
+import (
+	"fmt"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// checkOutput makes sure the output is reachable and has room for the backup
+// before spending time on compression
+func checkOutput(store storage.Storage) error {
+	checker, ok := store.(storage.Checker)
+	if !ok {
+		return nil
+	}
+
+	need, err := estimateSize(store)
+	if err != nil {
+		return fmt.Errorf("output %s is not usable: %w", store, err)
+	}
+
+	if err := checker.Check(need); err != nil {
+		return fmt.Errorf("output %s is not usable: %w", store, err)
+	}
+	return nil
+}
+
+// estimateSize estimates the additional space a backup needs from the sizes
+// of the last run. Archives already in the output are replaced one at a time,
+// so only the largest of them is needed twice. Without a previous run the
+// size is unknown and only the health of the output gets checked.
+func estimateSize(store storage.Storage) (int64, error) {
+	previous, err := readManifest(store)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read previous manifest: %w", err)
+	}
+	if previous == nil {
+		return 0, nil
+	}
+
+	var missing, largest int64
+	for _, loc := range previous.archives() {
+		if _, err := statArchive(store, loc.Archive); err == nil {
+			largest = max(largest, loc.Size)
+		} else {
+			missing += loc.Size
+		}
+	}
+
+	return missing + largest, nil
+}
@@ -0,0 +1,84 @@
+package macup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ClearTargets returns the normalized paths of the locations to clear, given
+// by their path or name, or of all locations if only is empty
+func ClearTargets(config *Config, only []string) ([]string, error) {
+	var paths []string
+	matched := make(map[string]bool)
+	for _, loc := range config.Data.Locations {
+		path, err := NormalizePath(loc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalize path %s: %w", loc.Path, err)
+		}
+		selected := len(only) == 0
+		for _, want := range only {
+			if want == loc.Path || want == path || (loc.Name != "" && want == loc.Name) {
+				selected, matched[want] = true, true
+			}
+		}
+		if selected && !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	for _, want := range only {
+		if !matched[want] {
+			return nil, fmt.Errorf("no location with the path or name %q in the config", want)
+		}
+	}
+	return paths, nil
+}
+
+// ClearSingleLocation deletes a single location, or empties it if keepRoot is set
+func ClearSingleLocation(path string, keepRoot bool) error {
+	// Normalize path
+	normalizedPath, err := NormalizePath(path)
+	if err != nil {
+		return fmt.Errorf("failed to normalize path: %w", err)
+	}
+
+	// Check if path exists
+	info, err := os.Stat(normalizedPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("path does not exist: %s", normalizedPath)
+	}
+
+	// Safety check: don't allow deleting root or home directory
+	homeDir, _ := os.UserHomeDir()
+	if normalizedPath == "/" || normalizedPath == homeDir {
+		return fmt.Errorf("refusing to delete protected directory: %s", normalizedPath)
+	}
+
+	// Get absolute path for verification
+	absPath, err := filepath.Abs(normalizedPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	// Additional safety: check path length (avoid deleting too high up)
+	if len(filepath.Clean(absPath)) < 10 {
+		return fmt.Errorf("path too short, refusing to delete: %s", absPath)
+	}
+
+	if !keepRoot || !info.IsDir() {
+		return os.RemoveAll(normalizedPath)
+	}
+
+	// Empty the directory, keeping its permissions and e.g. Finder settings
+	entries, err := os.ReadDir(normalizedPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(normalizedPath, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package macup
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// Changes found by Compare
+const (
+	changeAdded     = "added"
+	changeRemoved   = "removed"
+	changeChanged   = "changed"
+	changeUnchanged = "unchanged"
+)
+
+// Comparison is the difference between two backups
+type Comparison struct {
+	Old       time.Time            `json:"old"` // When the older backup was created
+	New       time.Time            `json:"new"`
+	Locations []LocationComparison `json:"locations"`
+}
+
+// LocationComparison is the difference of a location between two backups
+type LocationComparison struct {
+	Location string       `json:"location"`
+	Change   string       `json:"change"`   // "added", "removed", "changed" or "unchanged"
+	OldSize  int64        `json:"old_size"` // Compressed size of the archive in the older backup
+	NewSize  int64        `json:"new_size"`
+	Files    []FileChange `json:"files,omitempty"`
+}
+
+// FileChange is the difference of a file between two backups. Files count as
+// changed if their size, modification time or link target differ.
+type FileChange struct {
+	Name    string `json:"name"`
+	Change  string `json:"change"` // "added", "removed" or "changed"
+	OldSize int64  `json:"old_size"`
+	NewSize int64  `json:"new_size"`
+}
+
+// Compare reads the manifests of two backups, e.g. an older copy made with
+// `macup sync` and the current one, and lists the files that were added,
+// removed or changed in between. Archives with the same checksum in both
+// are unchanged and aren't read.
+func Compare(older, newer string, opts StorageOptions) (*Comparison, error) {
+	oldStore, oldManifest, err := openComparedBackup(older, opts)
+	if err != nil {
+		return nil, err
+	}
+	newStore, newManifest, err := openComparedBackup(newer, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &Comparison{Old: oldManifest.CreatedAt, New: newManifest.CreatedAt}
+	oldEntries := make(map[string]ManifestLocation)
+	for _, entry := range oldManifest.archives() {
+		oldEntries[entry.Path] = entry
+	}
+	for _, entry := range newManifest.archives() {
+		location := LocationComparison{Location: cmp.Or(entry.Name, entry.Path), NewSize: entry.Size}
+		previous, ok := oldEntries[entry.Path]
+		delete(oldEntries, entry.Path)
+		switch {
+		case !ok:
+			location.Change = changeAdded
+			location.Files, err = diffArchives(nil, nil, newStore, entry, opts)
+		case previous.SHA256 != "" && previous.SHA256 == entry.SHA256:
+			location.Change, location.OldSize = changeUnchanged, previous.Size
+		default:
+			location.Change, location.OldSize = changeChanged, previous.Size
+			location.Files, err = diffArchives(oldStore, &previous, newStore, entry, opts)
+			if err == nil && len(location.Files) == 0 {
+				location.Change = changeUnchanged
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare %s: %w", location.Location, err)
+		}
+		comparison.Locations = append(comparison.Locations, location)
+	}
+
+	// Locations that are only in the older backup were removed
+	for _, entry := range oldManifest.archives() {
+		if _, ok := oldEntries[entry.Path]; !ok {
+			continue
+		}
+		files, err := diffArchives(oldStore, &entry, nil, ManifestLocation{}, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare %s: %w", cmp.Or(entry.Name, entry.Path), err)
+		}
+		comparison.Locations = append(comparison.Locations, LocationComparison{
+			Location: cmp.Or(entry.Name, entry.Path),
+			Change:   changeRemoved,
+			OldSize:  entry.Size,
+			Files:    files,
+		})
+	}
+	return comparison, nil
+}
+
+// openComparedBackup opens a backup to compare, which needs a manifest
+func openComparedBackup(target string, opts storage.Options) (storage.Storage, *Manifest, error) {
+	store, err := storage.New(target, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open backup %s: %w", redactTarget(target), err)
+	}
+	manifest, err := readManifest(store)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest of %s: %w", redactTarget(target), err)
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("%s has no manifest, it was created by an older version", redactTarget(target))
+	}
+	return store, manifest, nil
+}
+
+// diffArchives lists the files that differ between the archive of a location
+// in two backups. A nil old entry or new store stands for a missing archive.
+// Archives in other outputs are opened with opts.
+func diffArchives(oldStore storage.Storage, old *ManifestLocation, newStore storage.Storage, entry ManifestLocation, opts storage.Options) ([]FileChange, error) {
+	oldFiles := make(map[string]FileInfo)
+	if old != nil {
+		err := listEntries(oldStore, ArchiveInfo{Archive: old.Archive, Output: old.Output}, opts, func(file FileInfo) error {
+			if file.Type != "dir" {
+				oldFiles[file.Name] = file
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []FileChange
+	if newStore != nil {
+		err := listEntries(newStore, ArchiveInfo{Archive: entry.Archive, Output: entry.Output}, opts, func(file FileInfo) error {
+			if file.Type == "dir" {
+				return nil
+			}
+			previous, ok := oldFiles[file.Name]
+			delete(oldFiles, file.Name)
+			switch {
+			case !ok:
+				changes = append(changes, FileChange{Name: file.Name, Change: changeAdded, NewSize: file.Size})
+			case previous.Size != file.Size || !previous.ModTime.Equal(file.ModTime) || previous.Link != file.Link:
+				changes = append(changes, FileChange{Name: file.Name, Change: changeChanged, OldSize: previous.Size, NewSize: file.Size})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range oldFiles {
+		changes = append(changes, FileChange{Name: file.Name, Change: changeRemoved, OldSize: file.Size})
+	}
+
+	slices.SortFunc(changes, func(a, b FileChange) int { return cmp.Compare(a.Name, b.Name) })
+	return changes, nil
+}
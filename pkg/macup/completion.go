@@ -0,0 +1,66 @@
+package macup
+
+import (
+	"bytes"
+	"os"
+	"strings"
+)
+
+// ProfileNames returns the profiles of a local config, e.g. for shell
+// completion. Remote configs and configs that fail to load have none.
+func ProfileNames(path string) []string {
+	src, ok := completionSource(path)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, o := range src.takeOverlays("profiles") {
+		names = append(names, strings.TrimPrefix(o.key, "profiles."))
+	}
+	return names
+}
+
+// ConfiguredOutputs returns the output targets of a local config with the
+// output volume, e.g. for shell completion
+func ConfiguredOutputs(path string) []string {
+	src, ok := completionSource(path)
+	if !ok {
+		return nil
+	}
+	source, err := src.bytes()
+	if err != nil {
+		return nil
+	}
+	format := src.format
+	if src.merged || format == "toml" {
+		format = "yaml" // How bytes encodes the merged config
+	}
+	config, err := ReadConfig(bytes.NewReader(source), format)
+	if err != nil {
+		return nil
+	}
+	targets := outputTargets(config)
+	for i, target := range targets {
+		if expanded, err := expandTarget(target); err == nil {
+			targets[i] = expanded
+		}
+	}
+	return targets
+}
+
+// completionSource loads a local config without migrating or checking it,
+// completion must not print warnings
+func completionSource(path string) (*configSource, bool) {
+	if IsRemoteConfig(path) {
+		return nil, false
+	}
+	path, err := NormalizePath(path)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, false
+	}
+	src, err := loadSource(path)
+	return src, err == nil
+}
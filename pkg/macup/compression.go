@@ -0,0 +1,121 @@
+package macup
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+)
+
+// Compression formats of archives
+const (
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+	compressionNone = "none"
+)
+
+// compression is a parsed compression setting, e.g. "gzip-9" or "zstd-1"
+type compression struct {
+	format string
+	level  int // 0 for the default level of the format
+}
+
+// parseCompression parses a compression setting, empty means gzip. Levels
+// range from 1 to 9 for gzip and from 1 to 22 for zstd.
+func parseCompression(s string) (compression, error) {
+	format, level, hasLevel := strings.Cut(strings.ToLower(s), "-")
+	c := compression{format: cmp.Or(format, compressionGzip)}
+
+	maxLevel := 0
+	switch c.format {
+	case compressionGzip:
+		maxLevel = 9
+	case compressionZstd:
+		maxLevel = 22
+	case compressionNone:
+	default:
+		return c, fmt.Errorf("unknown compression %q, expected gzip, zstd or none", s)
+	}
+	if hasLevel {
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 1 || n > maxLevel {
+			if maxLevel == 0 {
+				return c, fmt.Errorf("compression none has no levels")
+			}
+			return c, fmt.Errorf("invalid %s level %q, expected 1 to %d", c.format, level, maxLevel)
+		}
+		c.level = n
+	}
+	return c, nil
+}
+
+// extension returns the file extension of archives in this format
+func (c compression) extension() string {
+	switch c.format {
+	case compressionZstd:
+		return ".tar.zst"
+	case compressionNone:
+		return ".tar"
+	default:
+		return ".tar.gz"
+	}
+}
+
+// newWriter returns a writer compressing into w, using all CPU cores
+func (c compression) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c.format {
+	case compressionZstd:
+		level := zstd.SpeedDefault
+		if c.level > 0 {
+			level = zstd.EncoderLevelFromZstd(c.level)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(runtime.NumCPU()))
+	case compressionNone:
+		return nopWriteCloser{w}, nil
+	default:
+		level := pgzip.DefaultCompression
+		if c.level > 0 {
+			level = c.level
+		}
+		gzipWriter, err := pgzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		// 1MB blocks, use all CPU cores
+		gzipWriter.SetConcurrency(1<<20, runtime.NumCPU())
+		return gzipWriter, nil
+	}
+}
+
+// decompress returns the uncompressed stream of an archive, the format is
+// told by the extension of its name
+func decompress(name string, r io.Reader) (io.ReadCloser, error) {
+	switch {
+	case strings.HasSuffix(name, ".tar.zst"):
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return decoder.IOReadCloser(), nil
+	case strings.HasSuffix(name, ".tar"):
+		return io.NopCloser(r), nil
+	default:
+		gzipReader, err := pgzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		return gzipReader, nil
+	}
+}
+
+// nopWriteCloser writes archives without compression
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,273 @@
+package macup
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/spf13/viper"
+)
+
+type Config struct {
+	Version           int               `yaml:"version"` // Version of the config format, see configVersion
+	Output            []string          `yaml:"output"`  // One or more targets, every archive is written to all of them. $VAR and ~ are expanded.
+	Verify            bool              `yaml:"verify"`
+	Retries           int               `yaml:"retries"`                                              // Retries of failed locations at the end of a run
+	KeepGoing         bool              `yaml:"keep_going" mapstructure:"keep_going"`                 // Back up the remaining locations after one failed
+	OutputVolume      string            `yaml:"output_volume" mapstructure:"output_volume"`           // External volume to back up to, stored in /Volumes/<name>/macup
+	VolumeWait        string            `yaml:"volume_wait" mapstructure:"volume_wait"`               // How long to wait for output_volume to be mounted, e.g. "10m"
+	EjectAfter        bool              `yaml:"eject_after" mapstructure:"eject_after"`               // Verify and eject external output volumes when done
+	SkipUnchanged     bool              `yaml:"skip_unchanged" mapstructure:"skip_unchanged"`         // Skip locations unchanged since the last run
+	OnFileError       string            `yaml:"on_file_error" mapstructure:"on_file_error"`           // "skip" (default) leaves files that can't be read out with a warning, "fail" fails their location
+	Compression       string            `yaml:"compression"`                                          // "gzip", "zstd" or "none", optionally with a level, e.g. "zstd-1"
+	SplitSize         string            `yaml:"split_size" mapstructure:"split_size"`                 // Store archives in parts of this size, e.g. "4GB" for FAT32 volumes
+	UploadLimit       string            `yaml:"upload_limit" mapstructure:"upload_limit"`             // Bandwidth limit for remote uploads, e.g. "5MB/s"
+	UploadConcurrency int               `yaml:"upload_concurrency" mapstructure:"upload_concurrency"` // Parallel part uploads for remote backends
+	S3                S3Options         `yaml:"s3"`
+	Rclone            RcloneOptions     `yaml:"rclone"`
+	WebDAV            WebDAVOptions     `yaml:"webdav"`
+	Server            ServerOptions     `yaml:"server"` // Token for macup:// outputs
+	Data              Data              `yaml:"data"`
+	Dotfiles          Dotfiles          `yaml:"dotfiles"`
+	Apps              AppsConfig        `yaml:"apps"`
+	Defaults          []DefaultsDomain  `yaml:"defaults"`                                 // macOS preferences domains to back up
+	Fonts             bool              `yaml:"fonts"`                                    // Back up the fonts in ~/Library/Fonts
+	SystemFonts       bool              `yaml:"system_fonts" mapstructure:"system_fonts"` // Also back up fonts added to /Library/Fonts
+	Presets           map[string]Preset `yaml:"presets"`                                  // App presets replacing or adding to the built-in ones
+	Tweaks            []Tweak           `yaml:"tweaks"`                                   // Shell snippets applied in order by restore --tweaks
+	Hooks             Hooks             `yaml:"hooks"`                                    // Shell commands run before and after backups and restores
+	Notify            Notifications     `yaml:"notify"`                                   // Notification Center and webhooks told about finished backups
+	Exclude           []string          `yaml:"exclude"`                                  // gitignore style patterns applied to every location
+	Theme             Theme             `yaml:"theme"`                                    // Accent color and bar characters of the progress view
+	// Also exclude .DS_Store, swap files, caches and trashes, on unless turned off
+	DefaultExcludes bool                                `yaml:"use_default_excludes" mapstructure:"use_default_excludes"`
+	merged          []byte                              // The config with its includes and overlays merged in, nil without them
+	profile         string                              // The applied profile, if any
+	path            string                              // The config file, the cached copy of a remote config
+	origin          *ConfigOrigin                       // Where a remote config was fetched from
+	progress        func(phase string) ProgressReporter // Reporters of the engine running the config, see newReporter
+}
+
+// configFormats are the config formats by file extension. Files with other
+// extensions are read as YAML.
+var configFormats = map[string]string{".yaml": "yaml", ".yml": "yaml", ".json": "json", ".toml": "toml"}
+
+// bundledConfigs are the names of the config copy in a backup, which keeps
+// the format of the config file
+var bundledConfigs = []string{"config.yaml", "config.json", "config.toml"}
+
+// configFormat returns the format of a config file
+func configFormat(path string) string {
+	if format, ok := configFormats[strings.ToLower(filepath.Ext(path))]; ok {
+		return format
+	}
+	return "yaml"
+}
+
+// LoadConfig loads a config, see LoadProfile
+func LoadConfig(path string) (*Config, error) {
+	return LoadProfile(path, "")
+}
+
+// LoadProfile loads a config with a profile applied on top of it. Without a
+// profile, the one picked by the hosts block of this Mac applies, if any. The
+// path may also be an https or git+ URL, see remoteConfig.
+func LoadProfile(path, profile string) (*Config, error) {
+
+	var origin *ConfigOrigin
+	var err error
+	if IsRemoteConfig(path) {
+		path, origin, err = fetchConfig(path)
+	} else {
+		path, err = NormalizePath(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := loadSource(path)
+	if err != nil {
+		return nil, err
+	}
+	from, changes, err := src.migrate()
+	if err != nil {
+		return nil, err
+	}
+	printMigration(path, from, changes, "Run `macup config migrate` to save the upgraded config")
+	if err := src.applyOverlays(currentHostname(), profile); err != nil {
+		return nil, err
+	}
+	source, err := src.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	v := newViper()
+	if err := v.ReadConfig(bytes.NewReader(source)); err != nil {
+		return nil, err
+	}
+
+	cfg, err := decodeConfig(v, src)
+	if err != nil {
+		return nil, err
+	}
+	if src.merged {
+		cfg.merged = source
+	}
+	cfg.profile = src.profile
+	cfg.path, cfg.origin = path, origin
+	return cfg, nil
+
+}
+
+// ReadConfig loads a config in a format of configFormats from a reader, e.g.
+// the copy bundled into a backup
+func ReadConfig(r io.Reader, format string) (*Config, error) {
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseNode(format, raw)
+	if err != nil {
+		return nil, err
+	}
+	src := &configSource{raw: raw, format: format, root: root}
+	from, changes, err := src.migrate()
+	if err != nil {
+		return nil, err
+	}
+	printMigration("The config of the backup", from, changes, "")
+	source, err := src.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	v := newViper()
+	if err := v.ReadConfig(bytes.NewReader(source)); err != nil {
+		return nil, err
+	}
+
+	// Configs bundled into backups of older versions may have keys this
+	// version dropped, they must still restore
+	return decodeConfig(v, nil)
+
+}
+
+// newViper creates a viper instance with the config defaults applied
+func newViper() *viper.Viper {
+
+	v := viper.NewWithOptions(viper.KeyDelimiter("|"))
+	v.SetConfigType("yaml")
+
+	v.SetDefault("output", "./backup")
+	v.SetDefault("use_default_excludes", true)
+
+	return v
+
+}
+
+// decodeConfig unmarshals the config read by viper into a backup config. The
+// source of the config is checked for unknown keys and invalid values, if given.
+func decodeConfig(v *viper.Viper, src *configSource) (*Config, error) {
+
+	// `apps: [iterm2, raycast]` is short for `apps: {presets: [iterm2, raycast]}`
+	if list, ok := v.Get("apps").([]any); ok {
+		v.Set("apps", map[string]any{"presets": list})
+	}
+
+	var cfg Config
+	err := v.Unmarshal(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	if err := cfg.applyPresets(); err != nil {
+		return nil, err
+	}
+
+	// The output volume replaces the default output instead of adding to it
+	if cfg.OutputVolume != "" && !v.InConfig("output") {
+		cfg.Output = nil
+	}
+
+	if src != nil {
+		lines, errs := checkKeys(src)
+		errs = append(errs, cfg.validate(lines)...)
+		if len(errs) > 0 {
+			slices.SortStableFunc(errs, compareErrors)
+			for i, err := range errs {
+				errs[i] = fmt.Errorf("  - %w", err)
+			}
+			return nil, fmt.Errorf("invalid config, %d problems found:\n%w", len(errs), errors.Join(errs...))
+		}
+
+		for _, warning := range cfg.overlaps(lines) {
+			slog.Warn(fmt.Sprint(warning))
+		}
+
+		// Bundled configs are only read for their locations, their outputs
+		// may use variables of another Mac
+		for i, target := range cfg.Output {
+			if cfg.Output[i], err = expandTarget(target); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Locations without a compression, split_size or on_file_error of their
+	// own use the config's
+	for i, loc := range cfg.Data.Locations {
+		cfg.Data.Locations[i].Compression = cmp.Or(loc.Compression, cfg.Compression)
+		cfg.Data.Locations[i].SplitSize = cmp.Or(loc.SplitSize, cfg.SplitSize)
+		cfg.Data.Locations[i].OnFileError = cmp.Or(loc.OnFileError, cfg.OnFileError)
+	}
+
+	return &cfg, nil
+
+}
+
+// applyPresets adds the directories and preferences domains of the selected
+// app presets, unless the config already lists them
+func (c *Config) applyPresets() error {
+	for _, name := range c.Apps.Presets {
+		preset, err := apps.LookupPreset(name, c.Presets)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range preset.Paths {
+			exists := slices.ContainsFunc(c.Data.Locations, func(loc Location) bool { return loc.Path == path })
+			if !exists {
+				c.Data.Locations = append(c.Data.Locations, Location{Path: path, Ignore: preset.Ignore, optional: true})
+			}
+		}
+		for _, domain := range preset.Domains() {
+			exists := slices.ContainsFunc(c.Defaults, func(d apps.DefaultsDomain) bool { return d.Domain == domain.Domain })
+			if !exists {
+				c.Defaults = append(c.Defaults, domain)
+			}
+		}
+	}
+	return nil
+}
+
+// StorageOptions returns the backend settings for opening a storage
+func (c *Config) StorageOptions() StorageOptions {
+	return storage.Options{
+		S3:                c.S3,
+		Rclone:            c.Rclone,
+		WebDAV:            c.WebDAV,
+		Server:            c.Server,
+		UploadLimit:       c.UploadLimit,
+		UploadConcurrency: c.UploadConcurrency,
+	}
+}
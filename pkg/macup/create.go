@@ -0,0 +1,168 @@
+package macup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/hinkolas/macup/internal/logging"
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// Create creates a backup of all configured locations and apps, or of the
+// modules selected by the filter. Canceling ctx stops it cleanly with a
+// CanceledError, the parts completed until then are kept.
+func Create(ctx context.Context, config *Config, configPath string, filter ModuleFilter) error {
+	run := &hookRun{start: time.Now()}
+	if targets := outputTargets(config); len(targets) > 0 {
+		run.backupDir = targets[0]
+	}
+	stop := logging.Capture()
+	err := config.Hooks.around("pre_backup", "post_backup", run, func() (*Manifest, error) {
+		return createBackup(ctx, config, configPath, filter)
+	})
+	run.warnings = stop()
+	config.recordRun("create", run)
+	config.notifyResult(run)
+	return err
+}
+
+// createBackup creates the backup of Create and returns its manifest
+func createBackup(ctx context.Context, config *Config, configPath string, filter ModuleFilter) (*Manifest, error) {
+	start := time.Now()
+	selected, err := selectModules(config, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the output volume is ready
+	if config.OutputVolume != "" {
+		if err := prepareVolume(config); err != nil {
+			return nil, err
+		}
+	}
+
+	// Open output storage
+	store, err := openOutput(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output: %w", err)
+	}
+
+	// Fail early if the output can't take the backup
+	if err := checkOutput(store); err != nil {
+		return nil, err
+	}
+
+	// Warn about targets that are unavailable right away
+	multi, _ := store.(*storage.Multi)
+	if multi != nil {
+		for _, err := range multi.Failures() {
+			slog.Warn(fmt.Sprintf("Skipping output %v", err))
+		}
+	}
+
+	// Copy config file to backup directory
+	bundled, err := copyConfigToBackup(cmp.Or(config.path, configPath), config.merged, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy config: %w", err)
+	}
+
+	// A partial backup keeps what the previous run recorded for the other modules
+	manifest := newManifest()
+	if filter.partial() {
+		previous, err := readManifest(store)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous manifest: %w", err)
+		}
+		manifest = previous.carryOver()
+	}
+	manifest.Profile, manifest.Config, manifest.ConfigOrigin = config.profile, bundled, config.origin
+	job := &Job{Config: config, Store: store, Manifest: manifest, Context: ctx}
+
+	// Capture the setup of apps before the data, which ends with the manifest
+	if err := backupApps(job, selectedApps(selected)); err != nil {
+		return nil, err
+	}
+
+	// Dotfiles get an archive of their own, then the data follows
+	for _, m := range slices.Backward(selected) {
+		if _, ok := m.(appModule); ok {
+			continue
+		}
+		if ctx.Err() != nil {
+			return manifest, job.canceled()
+		}
+		if err := m.Backup(job); err != nil {
+			return manifest, err
+		}
+		// The data module reports its locations itself
+		if m.Name() != "data" {
+			job.completed = append(job.completed, m.Name())
+		}
+	}
+	if !hasModule(selected, "data") {
+		if err := writeManifest(store, manifest); err != nil {
+			return nil, fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
+	// Hand external volumes back to the user, the output volume is always ejected
+	targets := outputTargets(config)
+	if multi != nil {
+		targets = multi.Targets()
+	}
+	if !config.EjectAfter {
+		targets = slices.DeleteFunc(targets, func(target string) bool {
+			return config.OutputVolume == "" || target != config.volumeTarget()
+		})
+	}
+	if err := ejectOutputs(targets, config); err != nil {
+		return nil, err
+	}
+
+	// The backup succeeded on the remaining targets, but it is still incomplete
+	if multi != nil {
+		if failures := multi.Failures(); len(failures) > 0 {
+			errs := make([]error, 0, len(failures))
+			for _, err := range failures {
+				errs = append(errs, fmt.Errorf("  - %w", err))
+			}
+			return nil, fmt.Errorf("%w, %d of %d output targets failed:\n%w",
+				ErrIncomplete, len(failures), len(outputTargets(config)), errors.Join(errs...))
+		}
+	}
+
+	slog.Debug("Backup finished", "took", time.Since(start))
+	return manifest, nil
+}
+
+// ErrIncomplete is returned when a backup was stored in some of the output
+// targets only
+var ErrIncomplete = errors.New("backup incomplete")
+
+// outputTargets returns all configured output targets including the output volume
+func outputTargets(config *Config) []string {
+	targets := slices.Clone(config.Output)
+	if config.OutputVolume != "" {
+		targets = append(targets, config.volumeTarget())
+	}
+	return targets
+}
+
+// openOutput opens the configured output targets, fanning out to all of them
+// if there is more than one
+func openOutput(config *Config) (storage.Storage, error) {
+	targets := outputTargets(config)
+	switch len(targets) {
+	case 0:
+		return nil, fmt.Errorf("no output configured")
+	case 1:
+		return storage.New(targets[0], config.StorageOptions())
+	default:
+		return storage.NewMulti(targets, config.StorageOptions())
+	}
+}
@@ -0,0 +1,798 @@
+package macup
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+)
+
+// BackupData creates compressed tar archives for all configured locations and
+// stores them in the manifest of the job, which is written to the backup at
+// the end. Once the job is canceled the archive being written is removed, the
+// other locations keep the archive of the last run.
+func BackupData(job *Job) error {
+	config, store, manifest, ctx := job.Config, job.Store, job.Manifest, job.ctx()
+
+	// Load the manifest of the previous run to detect unchanged locations
+	previous, err := readManifest(store)
+	if err != nil {
+		return fmt.Errorf("failed to read previous manifest: %w", err)
+	}
+
+	// Optional locations, e.g. of apps that aren't installed, have nothing to
+	// back up if they are missing
+	locations := slices.DeleteFunc(slices.Clone(config.Data.Locations), Location.missing)
+
+	// The most important data is safe first if the run is interrupted or the
+	// output fills up, locations of the same priority keep the config's order
+	slices.SortStableFunc(locations, func(a, b Location) int { return cmp.Compare(b.Priority, a.Priority) })
+
+	// Create the progress reporter with "Archiving" prefix
+	pv := config.newReporter("Archiving")
+
+	// Initialize all locations in the reporter
+	// Sizes of the last run estimate the total until a location is scanned
+	for _, loc := range locations {
+		pv.Add(loc.label(), 0.0, 0)
+		if entry, ok := previous.location(loc.Path); ok {
+			pv.Expect(loc.label(), entry.Fingerprint.Size)
+		}
+	}
+
+	// On a terminal keys pause the backup, skip a location or cancel the run
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pv.Controls(cancel)
+
+	// Locations with an output of their own are archived there instead
+	stores := make([]storage.Storage, len(locations))
+	targets := make([][]string, len(locations))
+	for i, loc := range locations {
+		stores[i] = store
+		if len(loc.Output) > 0 {
+			if stores[i], targets[i], err = config.locationOutput(loc); err != nil {
+				pv.Clear()
+				return fmt.Errorf("failed to open output of %s: %w", loc.label(), err)
+			}
+		}
+	}
+
+	// Backup each location. Without retries or keep_going the first failure
+	// aborts the run, otherwise failed locations are retried after all others
+	// are done.
+	results := make(map[int]ManifestLocation)
+	failed := make(map[int]error)
+	var warnings []string // Shown once the progress view is done
+	canceled := false
+	conditions := newConditions()
+	for i, loc := range locations {
+		if ctx.Err() != nil {
+			canceled = true
+			break
+		}
+		// Locations whose conditions aren't met keep the archive of the last run
+		if reason := loc.skipReason(conditions); reason != "" {
+			pv.Skip(loc.label(), reason)
+			continue
+		}
+		result, locWarnings, skipped, err := skippableLocation(ctx, loc, stores[i], config, previous, pv)
+		warnings = append(warnings, locWarnings...)
+		if skipped {
+			pv.Skip(loc.label(), "by hand")
+			warnings = append(warnings, skippedWarning(loc, previous))
+			pv.Warn(loc.label())
+			continue
+		}
+		if err != nil && ctx.Err() != nil {
+			canceled = true
+			break
+		}
+		if err != nil {
+			if config.Retries == 0 && !config.KeepGoing {
+				pv.Clear() // Clear on error
+				return fmt.Errorf("failed to backup %s: %w", loc.label(), err)
+			}
+			pv.Fail(loc.label())
+			failed[i] = err
+			continue
+		}
+		results[i] = result
+		job.completed = append(job.completed, loc.label())
+	}
+
+	// Retry failed locations (e.g. after a transient mount drop)
+	for attempt := 0; attempt < config.Retries && len(failed) > 0 && !canceled; attempt++ {
+		for i, loc := range locations {
+			if _, ok := failed[i]; !ok {
+				continue
+			}
+			if ctx.Err() != nil {
+				canceled = true
+				break
+			}
+			pv.Reset(loc.label())
+			result, locWarnings, skipped, err := skippableLocation(ctx, loc, stores[i], config, previous, pv)
+			warnings = append(warnings, locWarnings...)
+			if skipped {
+				delete(failed, i)
+				pv.Skip(loc.label(), "by hand")
+				warnings = append(warnings, skippedWarning(loc, previous))
+				pv.Warn(loc.label())
+				continue
+			}
+			if err != nil && ctx.Err() != nil {
+				canceled = true
+				break
+			}
+			if err != nil {
+				pv.Fail(loc.label())
+				failed[i] = err
+				continue
+			}
+			results[i] = result
+			delete(failed, i)
+			job.completed = append(job.completed, loc.label())
+		}
+	}
+
+	// Record all archives in the manifest. Failed and canceled locations keep
+	// the entry of the previous run, since their old archive is still in place.
+	for i, loc := range locations {
+		if result, ok := results[i]; ok {
+			result.Output = targets[i]
+			manifest.Locations = append(manifest.Locations, result)
+		} else if entry, ok := previous.location(loc.Path); ok {
+			manifest.Locations = append(manifest.Locations, entry)
+		}
+	}
+	if err := writeManifest(store, manifest); err != nil {
+		pv.Clear()
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if canceled {
+		pv.Cancel()
+		printWarnings(warnings)
+		return job.canceled()
+	}
+
+	if len(failed) > 0 {
+		pv.Finish("")
+		printWarnings(warnings)
+
+		// The outcome of each location, in the order they ran, the summary
+		// table of the progress view shows them as well
+		partial := &PartialError{Retries: config.Retries}
+		for i, loc := range locations {
+			if err, ok := failed[i]; ok {
+				partial.Failed = append(partial.Failed, LocationError{Location: loc.label(), Err: err})
+			} else {
+				partial.Succeeded = append(partial.Succeeded, loc.label())
+			}
+		}
+		return partial
+	}
+
+	// Show final state with success message
+	successMsg := fmt.Sprintf("✓ Backup successfully stored at %s", store)
+	pv.Finish(successMsg)
+	printWarnings(warnings)
+
+	return nil
+}
+
+// locationOutput opens the output targets of a location and returns them
+// with their expanded names
+func (c *Config) locationOutput(loc Location) (storage.Storage, []string, error) {
+	targets := make([]string, len(loc.Output))
+	for i, target := range loc.Output {
+		var err error
+		if targets[i], err = expandTarget(target); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(targets) == 1 {
+		store, err := storage.New(targets[0], c.StorageOptions())
+		return store, targets, err
+	}
+	store, err := storage.NewMulti(targets, c.StorageOptions())
+	return store, targets, err
+}
+
+// backupLocation backs up a single location between its hooks and returns
+// its manifest entry and the warnings about it, see archiveLocation, also if
+// the post hook failed
+func backupLocation(ctx context.Context, loc Location, store storage.Storage, config *Config, previous *Manifest, pv tui.ProgressReporter) (ManifestLocation, []string, error) {
+	// Normalize path for actual file operations
+	path, err := NormalizePath(loc.Path)
+	if err != nil {
+		return ManifestLocation{Name: loc.Name, Path: loc.Path, Archive: loc.archiveName()}, nil, err
+	}
+	if err := loc.Hooks.run("pre", loc.label(), path, nil); err != nil {
+		return ManifestLocation{Name: loc.Name, Path: loc.Path, Archive: loc.archiveName()}, nil, err
+	}
+
+	result, warnings, err := archiveLocation(ctx, loc, path, store, config, previous, pv)
+	if hookErr := loc.Hooks.run("post", loc.label(), path, err); hookErr != nil {
+		warnings = append(warnings, fmt.Sprintf("%s: %v", loc.label(), hookErr))
+		pv.Warn(loc.label())
+	}
+	return result, warnings, err
+}
+
+// errSkipped is the cause of the context of a location skipped with s
+var errSkipped = errors.New("skipped")
+
+// skippableLocation runs backupLocation so that s skips the location, and
+// reports whether it was skipped
+func skippableLocation(ctx context.Context, loc Location, store storage.Storage, config *Config, previous *Manifest, pv tui.ProgressReporter) (ManifestLocation, []string, bool, error) {
+	locCtx, skip := context.WithCancelCause(ctx)
+	defer skip(nil)
+	pv.Skippable(func() { skip(errSkipped) })
+	defer pv.Skippable(nil)
+
+	result, warnings, err := backupLocation(locCtx, loc, store, config, previous, pv)
+	skipped := err != nil && ctx.Err() == nil && errors.Is(context.Cause(locCtx), errSkipped)
+	return result, warnings, skipped, err
+}
+
+// skippedWarning tells that a location was skipped with s and whether the
+// backup still has an archive of it
+func skippedWarning(loc Location, previous *Manifest) string {
+	if _, ok := previous.location(loc.Path); ok {
+		return fmt.Sprintf("%s was skipped, it keeps the archive of the last run", loc.label())
+	}
+	return fmt.Sprintf("%s was skipped, the backup has no archive of it", loc.label())
+}
+
+// archiveLocation creates a backup archive for a single location from its
+// normalized path and returns its manifest entry and the warnings about it:
+// that it exceeds its max_size and the files left out
+func archiveLocation(ctx context.Context, loc Location, path string, store storage.Storage, config *Config, previous *Manifest, pv tui.ProgressReporter) (ManifestLocation, []string, error) {
+	// Generate filename hash from ORIGINAL config path (before normalization)
+	// This ensures the hash is consistent regardless of which user restores
+	filename := loc.archiveName()
+	result := ManifestLocation{Name: loc.Name, Path: loc.Path, Archive: filename}
+	start := time.Now()
+	loc.Path = path
+
+	// A bundle changing while it is archived would be captured half-written.
+	// The archive of the last run stays in place instead.
+	if loc.Bundle {
+		if app := loc.bundleApp(); app != "" && apps.Running(app) {
+			if entry, ok := previous.location(result.Path); ok {
+				if _, err := statArchive(store, filename); err == nil {
+					pv.Skip(loc.label(), app+" is running")
+					return entry, nil, nil
+				}
+			}
+			return result, nil, fmt.Errorf("%s is running, quit it to back up its library", app)
+		}
+	}
+	if loc.GitMode != "" && loc.GitMode != gitModeRemotes {
+		return result, nil, fmt.Errorf("unknown git_mode %q, expected %q", loc.GitMode, gitModeRemotes)
+	}
+
+	// Scan directory
+	if err := loc.scan(ctx, config.excludes(), pv); err != nil {
+		return result, nil, fmt.Errorf("scan failed: %w", err)
+	}
+	slog.Debug("Scanned location", "location", loc.label(), "entries", len(loc.index), "size", units.FormatSize(loc.totalSize), "took", time.Since(start))
+
+	// Catch surprises like a VM image dropped into Documents
+	warning, err := loc.checkSize()
+	if err != nil {
+		return result, nil, err
+	}
+	if warning != "" {
+		loc.warnings = append(loc.warnings, warning)
+		pv.Warn(loc.label())
+	}
+	result.Fingerprint = loc.fingerprint
+	result.Repos = loc.repos
+
+	// Skip locations that provably didn't change since the last run
+	if config.SkipUnchanged {
+		if entry, ok := previous.location(result.Path); ok && entry.Fingerprint.equal(result.Fingerprint) {
+			if _, err := statArchive(store, filename); err == nil {
+				pv.Skip(loc.label(), "unchanged")
+				entry.Repos = loc.repos // Commits don't change the fingerprint
+				entry.BackedUpAt = time.Now().UTC()
+				return entry, loc.warnings, nil
+			}
+		}
+	}
+
+	// Create archive (not visible in the storage until it is complete)
+	writer, err := newArchiveWriter(store, filename, config.Verify, loc.compression(), loc.splitSize())
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	metadata := ArchiveMetadata{Location: result.Path, Name: loc.Name, Source: path, Hostname: hostname, CreatedAt: time.Now().UTC()}
+	if err := writeMetadata(writer, metadata); err != nil {
+		writer.Abort()
+		return result, nil, fmt.Errorf("failed to write archive metadata: %w", err)
+	}
+
+	// Write files
+	if err := loc.writeToArchive(ctx, writer, pv); err != nil {
+		writer.AbortContext(ctx)
+		return result, nil, fmt.Errorf("write failed: %w", err)
+	}
+
+	// Finalize archive
+	if err := writer.Close(); err != nil {
+		return result, nil, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	raw, compressed := writer.Sizes()
+	pv.Compression(loc.label(), raw, compressed)
+	pv.Totals(loc.label(), loc.files, loc.totalSize, compressed)
+	slog.Debug("Archived location", "location", loc.label(), "archive", store.Path(filename), "size", units.FormatSize(compressed), "took", time.Since(start))
+	result.Size = compressed
+	result.SHA256 = writer.Checksum()
+	result.Skipped = loc.skipped
+	result.BackedUpAt = time.Now().UTC()
+
+	// Clear message and mark as done
+	pv.Message("")
+	pv.Done(loc.label(), true)
+
+	pv.Stored(loc.Path, store.Path(filename))
+
+	return result, loc.warnings, nil
+}
+
+// scan walks through the location directory and builds an index of files to
+// backup, leaving out what matches the excludes, the ignore patterns or the
+// .macupignore files found on the way. With include patterns only matching
+// files are added. The scan stops once ctx is canceled.
+func (l *Location) scan(ctx context.Context, excludes []string, pv tui.ProgressReporter) error {
+	l.index = make([]string, 0)
+	l.totalSize = 0
+	l.files = 0
+	l.fingerprint = Fingerprint{}
+	l.repos = nil
+	l.links = make(map[string]bool)
+	l.excluded = make(map[string]int)
+	l.warnings = nil
+	l.skipped = nil
+	rules := parseIgnore(append(slices.Clone(excludes), l.Ignore...))
+	include := parseIgnore(l.Include)
+	whitelist := len(include) > 0 && !l.Bundle
+	indexed := make(map[string]bool) // Directories added in whitelist mode
+	links := newLinkFollower(l.Path, l.FollowSymlinks)
+
+	var visit fs.WalkDirFunc
+	visit = func(path string, d os.DirEntry, err error) error {
+		// Entries that can't be read are left out unless on_file_error is
+		// "fail", only the location itself and bundles, which are never
+		// archived partially, always have to be
+		if err != nil && (path == l.Path || l.Bundle) {
+			return err
+		}
+		if err != nil {
+			if err := l.fileFailed(pv, path, err); err != nil {
+				return err
+			}
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if pv != nil {
+			pv.Wait(ctx)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Repositories are cloned from their remotes on restore instead
+		if l.GitMode == gitModeRemotes && d.IsDir() {
+			repo, ok, err := inspectRepo(path)
+			if err != nil {
+				return err
+			}
+			if ok {
+				repo.Path, _ = filepath.Rel(l.Path, path)
+				l.repos = append(l.repos, repo)
+				return filepath.SkipDir
+			}
+		}
+
+		// Check ignore patterns, bundles are never archived partially
+		rel, _ := filepath.Rel(l.Path, path)
+		rel = filepath.ToSlash(rel)
+		if pattern, ignored := rules.match(rel, d.IsDir()); path != l.Path && !l.Bundle && ignored {
+			l.excluded[pattern]++
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.Type()&fs.ModeSocket != 0 {
+			l.warn(pv, path, errSocket)
+			return nil
+		}
+
+		// Links are archived as links unless follow_symlinks takes their
+		// target, linked directories are walked like one of the location
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, ok := links.follow(path)
+			if !ok {
+				l.links[path] = true
+			} else if target.IsDir() {
+				return filepath.WalkDir(path+string(filepath.Separator), visit)
+			}
+		}
+
+		// Directories may bring their own patterns for their contents
+		if d.IsDir() && !l.Bundle {
+			if rules, err = rules.load(filepath.Join(path, ignoreFile), rel); err != nil {
+				// The directory can't be read either, it is left out like
+				// one that can't be listed
+				if path == l.Path || !errors.Is(err, fs.ErrPermission) {
+					return err
+				}
+				if err := l.fileFailed(pv, path, err); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+		}
+
+		// Skip root directory
+		if path == l.Path {
+			return nil
+		}
+
+		// In whitelist mode directories are only added on the way to a
+		// matching file, so the archive keeps the structure around it
+		if whitelist {
+			if d.IsDir() || !include.includes(rel) {
+				return nil
+			}
+			dir := ""
+			for _, segment := range strings.Split(rel, "/")[:strings.Count(rel, "/")] {
+				dir = filepath.Join(dir, segment)
+				if !indexed[dir] {
+					indexed[dir] = true
+					l.index = append(l.index, filepath.Join(l.Path, dir))
+				}
+			}
+		}
+
+		l.index = append(l.index, path)
+
+		// Calculate total size for progress tracking and the fingerprint
+		info, err := d.Info()
+		if !l.links[path] {
+			info, err = os.Stat(path) // The target of followed links
+		}
+		if err == nil {
+			if !d.IsDir() {
+				l.totalSize += info.Size()
+				l.files++
+			}
+			if info.ModTime().After(l.fingerprint.MaxModTime) {
+				l.fingerprint.MaxModTime = info.ModTime().UTC()
+			}
+		}
+
+		// Large trees take a while, show what was found so far
+		if pv != nil && len(l.index)%100 == 0 {
+			pv.Scan(l.label(), l.files, l.totalSize)
+		}
+
+		return nil
+	}
+
+	if pv != nil {
+		pv.Scan(l.label(), 0, 0)
+	}
+	if err := filepath.WalkDir(l.Path, visit); err != nil {
+		return fmt.Errorf("directory walk failed: %w", err)
+	}
+
+	l.fingerprint.Entries = len(l.index)
+	l.fingerprint.Size = l.totalSize
+
+	return nil
+}
+
+// writeToArchive writes all indexed files to the archive, until ctx is
+// canceled
+func (l *Location) writeToArchive(ctx context.Context, w *ArchiveWriter, pv tui.ProgressReporter) error {
+	var bytesWritten int64
+	startTime := time.Now()
+
+	for i, path := range l.index {
+		startTime = startTime.Add(pv.Wait(ctx)) // ETAs leave pauses out
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Update message every 50 files to reduce flicker
+		var err error
+		if i%50 == 0 {
+			err = l.writeEntry(w, path, pv)
+		} else {
+			err = l.writeEntryNoMessage(w, path, pv)
+		}
+		var fileErr fileError
+		if errors.As(err, &fileErr) {
+			err = l.fileFailed(pv, path, fileErr.err)
+			if err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		slog.Debug("Archived", "path", path)
+
+		// Update progress
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && !l.links[path] {
+			bytesWritten += info.Size()
+			pv.Completed(path, info.Size())
+		}
+
+		// Calculate progress (handle edge case of empty directories)
+		var progress float64
+		if l.totalSize > 0 {
+			progress = float64(bytesWritten) / float64(l.totalSize)
+			if progress > 1.0 {
+				progress = 1.0
+			}
+		} else {
+			// For empty directories, use file count
+			progress = float64(i+1) / float64(len(l.index))
+		}
+
+		// Calculate ETA
+		elapsed := time.Since(startTime)
+		var eta time.Duration
+		if progress > 0 && progress < 1.0 {
+			totalTime := time.Duration(float64(elapsed) / progress)
+			eta = totalTime - elapsed
+			if eta < 0 {
+				eta = 0
+			}
+		}
+
+		// Update progress view (the view itself will decide if it needs to re-render)
+		pv.Bytes(l.label(), bytesWritten, l.totalSize)
+		pv.Set(l.label(), progress, eta)
+		raw, compressed := w.Sizes()
+		pv.Compression(l.label(), raw, compressed)
+	}
+
+	// Final update to ensure we show 100%
+	pv.Set(l.label(), 1.0, 0)
+
+	return nil
+}
+
+// writeEntry writes a single file or directory entry to the archive with message update
+func (l *Location) writeEntry(w *ArchiveWriter, path string, pv tui.ProgressReporter) error {
+	// Update current file in progress view
+	pv.Message(path)
+	return l.writeEntryNoMessage(w, path, pv)
+}
+
+// writeEntryNoMessage writes a single file or directory entry to the archive without updating the message
+func (l *Location) writeEntryNoMessage(w *ArchiveWriter, path string, pv tui.ProgressReporter) error {
+	// Get current file info, of the target for followed links
+	stat, link := os.Stat, ""
+	if l.links[path] {
+		stat = os.Lstat
+	}
+	info, err := stat(path)
+	if err != nil {
+		return fileError{err}
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	// Calculate relative path
+	relPath, err := filepath.Rel(l.Path, path)
+	if err != nil {
+		return err
+	}
+
+	// Create tar header
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+
+	// Prepend original directory name so extraction creates proper folder structure
+	hdr.Name = filepath.Join(filepath.Base(l.Path), relPath)
+	hdr.Format = tar.FormatPAX
+
+	// Files are opened before their header is written, so one that can't be
+	// read is left out of the archive
+	var file *os.File
+	if info.Mode().IsRegular() {
+		if file, err = os.Open(path); err != nil {
+			return fileError{err}
+		}
+		defer file.Close()
+	}
+
+	// Write header
+	if err := w.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	// Write file content
+	if file != nil {
+		missing, err := copyEntry(w, file, hdr.Size)
+		if err != nil {
+			return err
+		}
+		if missing > 0 {
+			l.warn(pv, path, fmt.Errorf("it got %s shorter while it was archived, the rest is zeros", units.FormatSize(missing)))
+		}
+	}
+
+	return nil
+}
+
+// copyEntry copies a file to its entry of size bytes. Files may change after
+// their header was written: one that grew is cut off at the size, one that
+// got shorter or failed to read is padded with zeros, so the archive stays
+// readable. It returns the bytes that were padded, errors reading the file
+// are a fileError.
+func copyEntry(w io.Writer, file io.Reader, size int64) (int64, error) {
+	src := &fileReader{r: file}
+	n, err := io.CopyN(w, src, size)
+	if err == nil {
+		return 0, nil
+	}
+	if src.err == nil && err != io.EOF {
+		return 0, err // Writing the archive failed
+	}
+
+	if _, err := io.CopyN(w, zeros{}, size-n); err != nil {
+		return 0, err
+	}
+	if src.err != nil {
+		return size - n, fileError{src.err}
+	}
+	return size - n, nil
+}
+
+// fileReader keeps the error of reading a file, to tell it from those of
+// writing the archive
+type fileReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// zeros reads zero bytes without end, to pad entries
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// copyFileToArchive copies a file's contents to the archive
+func copyFileToArchive(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// copyConfigToBackup copies the config file to the backup storage and returns
+// the name of the copy, which keeps the format of the file. A config including
+// other files or with overlays is stored merged as YAML, so restoring doesn't
+// need them.
+func copyConfigToBackup(configPath string, merged []byte, store storage.Storage) (string, error) {
+	configPath, err := NormalizePath(configPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Open source config file
+	name := "config.yaml"
+	var src io.Reader = bytes.NewReader(merged)
+	if merged == nil {
+		file, err := os.Open(configPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to open config file: %w", err)
+		}
+		defer file.Close()
+		src = file
+		if format := configFormat(configPath); format != "yaml" {
+			name = "config." + format
+		}
+	}
+
+	// Create destination object
+	dst, err := store.Create(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create config copy: %w", err)
+	}
+
+	// Copy contents
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Abort()
+		return "", fmt.Errorf("failed to copy config: %w", err)
+	}
+
+	return name, dst.Close()
+}
+
+// LocationError is the failure of a single location
+type LocationError struct {
+	Location string
+	Err      error
+}
+
+// PartialError is returned when locations failed in a run that went on with
+// the others. Succeeded also holds skipped locations, they keep their archive.
+type PartialError struct {
+	Succeeded []string
+	Failed    []LocationError
+	Retries   int
+}
+
+func (e *PartialError) Error() string {
+	total := len(e.Succeeded) + len(e.Failed)
+	msg := fmt.Sprintf("backup partially failed, %d of %d locations failed", len(e.Failed), total)
+	if e.Retries > 0 {
+		msg += fmt.Sprintf(" after %d retries", e.Retries)
+	}
+	for _, f := range e.Failed {
+		msg += fmt.Sprintf("\n  - %s: %v", f.Location, f.Err)
+	}
+	return msg
+}
+
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// Total reports whether no location was backed up
+func (e *PartialError) Total() bool {
+	return len(e.Succeeded) == 0
+}
@@ -0,0 +1,114 @@
+package macup
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+// changingWriter runs change once on the first write, to change a file while
+// it is copied
+type changingWriter struct {
+	buf    bytes.Buffer
+	change func() error
+}
+
+func (w *changingWriter) Write(p []byte) (int, error) {
+	if w.change != nil {
+		if err := w.change(); err != nil {
+			return 0, err
+		}
+		w.change = nil
+	}
+	return w.buf.Write(p)
+}
+
+func TestCopyEntry(t *testing.T) {
+	// Larger than a copy buffer, so the file changes halfway
+	data := bytes.Repeat([]byte("0123456789abcdef"), 8<<10)
+	size := int64(len(data))
+
+	tests := []struct {
+		name    string
+		change  func(path string) error
+		padded  bool // Whether the entry ends in zeros after the first chunk
+		missing bool
+	}{
+		{"unchanged", nil, false, false},
+		{"grew", func(path string) error {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Write([]byte("appended"))
+			return err
+		}, false, false},
+		{"shrank", func(path string) error { return os.Truncate(path, 10) }, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			w := &changingWriter{}
+			if tt.change != nil {
+				w.change = func() error { return tt.change(path) }
+			}
+			missing, err := copyEntry(w, file, size)
+			if err != nil {
+				t.Fatalf("copyEntry() = %v", err)
+			}
+			if (missing > 0) != tt.missing {
+				t.Errorf("copyEntry() padded %d bytes", missing)
+			}
+
+			// The entry has the size of its header either way
+			got := w.buf.Bytes()
+			if int64(len(got)) != size {
+				t.Fatalf("copyEntry() wrote %d bytes, want %d", len(got), size)
+			}
+			copied := size - missing
+			if !bytes.Equal(got[:copied], data[:copied]) {
+				t.Errorf("copyEntry() changed the content that was read")
+			}
+			if tt.padded && !bytes.Equal(got[copied:], make([]byte, missing)) {
+				t.Errorf("copyEntry() didn't pad with zeros")
+			}
+		})
+	}
+}
+
+func TestCopyEntryReadError(t *testing.T) {
+	errRead := errors.New("read failed")
+	file := io.MultiReader(bytes.NewReader([]byte("0123456789")), iotest.ErrReader(errRead))
+
+	var w bytes.Buffer
+	missing, err := copyEntry(&w, file, 100)
+	var fileErr fileError
+	if !errors.As(err, &fileErr) || !errors.Is(err, errRead) {
+		t.Fatalf("copyEntry() = %v, want a fileError", err)
+	}
+	if missing != 90 || w.Len() != 100 {
+		t.Errorf("copyEntry() wrote %d bytes and padded %d, want 100 and 90", w.Len(), missing)
+	}
+
+	// Errors writing the archive aren't the file's
+	errWrite := errors.New("write failed")
+	full := &changingWriter{change: func() error { return errWrite }}
+	if _, err := copyEntry(full, bytes.NewReader(make([]byte, 100)), 100); !errors.Is(err, errWrite) || errors.As(err, &fileErr) {
+		t.Errorf("copyEntry() to a failing writer = %v, want the write error", err)
+	}
+}
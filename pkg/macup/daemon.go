@@ -0,0 +1,236 @@
+package macup
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hinkolas/macup/internal/apps"
+)
+
+// daemonStatePath is where a running daemon records its state for `macup status`
+const daemonStatePath = "~/.local/state/macup/daemon.json"
+
+// DaemonOptions configures `macup daemon`
+type DaemonOptions struct {
+	ConfigPath    string
+	Profile       string
+	Interval      time.Duration // Back up this often, never on a schedule if 0
+	Watch         bool          // Also back up once locations changed
+	CheckEvery    time.Duration // How often watched locations are scanned for changes the watcher missed
+	SkipOnBattery bool          // Postpone backups while on battery power
+}
+
+// DaemonState is what a running daemon reports about itself
+type DaemonState struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	LastRun   time.Time `json:"last_run,omitzero"`
+	LastError string    `json:"last_error,omitempty"` // Error of the last run, if it failed
+	NextRun   time.Time `json:"next_run,omitzero"`    // Next run on the interval
+	Watching  bool      `json:"watching"`
+	Waiting   string    `json:"waiting,omitempty"` // Why a due backup is postponed, e.g. "on battery power"
+}
+
+// RunDaemon backs up on an interval and, when watching, after locations
+// changed, until ctx is canceled, which also stops a running backup cleanly.
+// Backups skip unchanged locations and the config is reloaded for each run,
+// so edits apply without a restart. Location conditions like require_ac_power
+// apply as in any run.
+//
+// Changes are seen from file system events and backed up once they settled.
+// The locations are also scanned on start and every CheckEvery, comparing the
+// fingerprints used by skip_unchanged to the last backup, for what happened
+// while the daemon wasn't running or couldn't be watched.
+func RunDaemon(ctx context.Context, opts DaemonOptions) error {
+	if opts.Interval <= 0 && !opts.Watch {
+		return errors.New("nothing to do, give an interval or watch for changes")
+	}
+	statePath, err := NormalizePath(daemonStatePath)
+	if err != nil {
+		return err
+	}
+	config, err := LoadProfile(opts.ConfigPath, opts.Profile)
+	if err != nil {
+		return err
+	}
+	state := &DaemonState{PID: os.Getpid(), StartedAt: time.Now().UTC(), Watching: opts.Watch}
+	defer os.Remove(statePath)
+
+	// The first scheduled run is due once the last backup is an interval old
+	if opts.Interval > 0 {
+		state.NextRun = config.lastBackup().Add(opts.Interval)
+	}
+
+	var watcher *locationWatcher
+	if opts.Watch {
+		if watcher, err = newLocationWatcher(config); err != nil {
+			return err
+		}
+		defer func() { watcher.Close() }()
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	var lastScan time.Time
+	for {
+		due := opts.Interval > 0 && !time.Now().Before(state.NextRun)
+		if !due && watcher != nil {
+			if time.Since(lastScan) >= max(opts.CheckEvery, time.Minute) {
+				changed, err := config.changedLocations()
+				if err != nil {
+					slog.Warn(fmt.Sprintf("Failed to check for changes: %v", err))
+				}
+				var paths []string
+				for path := range changed {
+					paths = append(paths, Location{Path: path}.displayPath())
+				}
+				watcher.mark(paths)
+				lastScan = time.Now()
+			}
+			due = watcher.settled()
+		}
+
+		state.Waiting = ""
+		if due && opts.SkipOnBattery && apps.OnBattery() {
+			state.Waiting, due = "on battery power", false
+		}
+		if due {
+			if watcher != nil {
+				watcher.reset()
+			}
+			config = opts.run(ctx, config, state)
+
+			// Locations added or removed by a reloaded config are watched anew
+			if watcher != nil && !watcher.watches(config) {
+				watcher.Close()
+				if watcher, err = newLocationWatcher(config); err != nil {
+					return err
+				}
+			}
+		}
+		if err := writeDaemonState(statePath, state); err != nil {
+			slog.Warn(fmt.Sprintf("Failed to write daemon state: %v", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// run reloads the config, runs one backup of the daemon and records its
+// outcome. It returns the config to use from now on, the last one if the
+// config fails to load.
+func (opts DaemonOptions) run(ctx context.Context, config *Config, state *DaemonState) *Config {
+	slog.Info("Backup started at " + time.Now().Format(time.DateTime))
+	state.LastRun, state.LastError = time.Now().UTC(), ""
+	if opts.Interval > 0 {
+		state.NextRun = state.LastRun.Add(opts.Interval)
+	}
+
+	if reloaded, err := LoadProfile(opts.ConfigPath, opts.Profile); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to reload config, using the last one: %v", err))
+	} else {
+		config = reloaded
+	}
+	config.SkipUnchanged = true
+	config.Notify.Desktop = cmp.Or(config.Notify.Desktop, NotifyFailure)
+	if err := Create(ctx, config, opts.ConfigPath, ModuleFilter{}); err != nil {
+		state.LastError = err.Error()
+		slog.Error(fmt.Sprintf("Backup failed: %v", err))
+	}
+	return config
+}
+
+// changedLocations scans the locations and returns the fingerprints of those
+// that differ from their last backup
+func (c *Config) changedLocations() (map[string]Fingerprint, error) {
+	store, err := openOutput(c)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := readManifest(store)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]Fingerprint)
+	conditions := newConditions()
+	for _, loc := range c.Data.Locations {
+		if loc.missing() || loc.skipReason(conditions) != "" {
+			continue
+		}
+		path, err := NormalizePath(loc.Path)
+		if err != nil {
+			return nil, err
+		}
+		original := loc.Path
+		loc.Path = path
+		if err := loc.scan(context.Background(), c.excludes(), nil); err != nil {
+			return nil, err
+		}
+		if entry, ok := previous.location(original); !ok || !entry.Fingerprint.equal(loc.fingerprint) {
+			changed[original] = loc.fingerprint
+		}
+	}
+	return changed, nil
+}
+
+// lastBackup returns when a backup was last created in any output target
+func (c *Config) lastBackup() time.Time {
+	var last time.Time
+	for _, output := range c.Status().Outputs {
+		if output.LastBackup.After(last) {
+			last = output.LastBackup
+		}
+	}
+	return last
+}
+
+// writeDaemonState records the state of the running daemon
+func writeDaemonState(path string, state *DaemonState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// readDaemonState returns the state of the running daemon, nil if none runs
+func readDaemonState() (*DaemonState, error) {
+	path, err := NormalizePath(daemonStatePath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state DaemonState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode daemon state: %w", err)
+	}
+
+	// The state of a daemon that was killed stays behind
+	if syscall.Kill(state.PID, 0) != nil {
+		return nil, nil
+	}
+	return &state, nil
+}
@@ -0,0 +1,438 @@
+package macup
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/units"
+)
+
+// Data contains backup configuration for multiple locations
+type Data struct {
+	Locations []Location `yaml:"locations"`
+}
+
+// Location represents a directory to backup with ignore patterns
+type Location struct {
+	Name           string          `yaml:"name"`                                             // e.g. "Projects", shown instead of the path and naming the archive
+	Path           string          `yaml:"path"`                                             // e.g. "~/Documents" or "${PROJECTS_DIR}/app", expanded on the Mac it is used on
+	Output         []string        `yaml:"output"`                                           // Targets for this location's archive instead of the backup's output
+	Compression    string          `yaml:"compression"`                                      // e.g. "zstd-1" or "none", overrides the config's compression
+	SplitSize      string          `yaml:"split_size" mapstructure:"split_size"`             // e.g. "4GB" or "0" for a single archive, overrides the config's split_size
+	Ignore         []string        `yaml:"ignore"`                                           // gitignore style patterns, e.g. "**/node_modules", "*.log" or "!keep.log"
+	Include        []string        `yaml:"include"`                                          // Only archive files matching these patterns, e.g. "**/*.md"
+	MaxSize        string          `yaml:"max_size" mapstructure:"max_size"`                 // e.g. "50GB", warns or aborts if the location grows past it
+	OnMaxSize      string          `yaml:"on_max_size" mapstructure:"on_max_size"`           // "warn" (default) or "abort"
+	OnFileError    string          `yaml:"on_file_error" mapstructure:"on_file_error"`       // "skip" (default) leaves unreadable files out with a warning, "fail" fails the location, overrides the config's
+	Priority       int             `yaml:"priority"`                                         // Higher priorities are archived first, e.g. 10 for documents and keys
+	Bundle         bool            `yaml:"bundle"`                                           // Back up and restore as a whole, e.g. a Photos library. Ignore and include don't apply.
+	App            string          `yaml:"app"`                                              // Process owning the bundle, guessed from the extension if empty
+	FollowSymlinks string          `yaml:"follow_symlinks" mapstructure:"follow_symlinks"`   // Archive the target of links: true, false (default) or "external-only"
+	GitMode        string          `yaml:"git_mode" mapstructure:"git_mode"`                 // "remotes" records git repositories instead of archiving them
+	Optional       bool            `yaml:"optional"`                                         // Skip the location silently if it doesn't exist, e.g. on other Macs
+	RequireAC      bool            `yaml:"require_ac_power" mapstructure:"require_ac_power"` // Skip the location on battery power
+	SkipMetered    bool            `yaml:"skip_on_metered" mapstructure:"skip_on_metered"`   // Skip the location on a personal hotspot
+	AllowOverlap   bool            `yaml:"allow_overlap" mapstructure:"allow_overlap"`       // Don't warn if the location is inside another one or contains one
+	Hooks          LocationHooks   `yaml:"hooks"`                                            // Shell commands run in the location before and after it is backed up
+	optional       bool            // Added by an app preset, skipped if the app isn't installed
+	index          []string        // Paths to include in backup
+	totalSize      int64           // Total size of files to backup
+	files          int             // Number of files to backup, without directories
+	fingerprint    Fingerprint     // Summary of the scanned contents
+	repos          []GitRepo       // Repositories found with git_mode remotes
+	links          map[string]bool // Links archived as links, not with their target
+	excluded       map[string]int  // Entries left out by each exclude or ignore pattern
+	warnings       []string        // Files left out for problems that don't fail the backup, see warn
+	skipped        []string        // Paths of the files left out, recorded in the manifest
+}
+
+// ArchiveWriter wraps tar.Writer with compression. The archive only becomes
+// visible in the storage once Close succeeds.
+type ArchiveWriter struct {
+	tar    *tar.Writer
+	comp   io.WriteCloser // Compresses into output
+	out    storage.Writer
+	verify *io.PipeWriter // Feeds the compressed stream to verifyStream
+	result chan error     // Result of the verification
+	raw    int64          // Uncompressed file content bytes written
+	output *countingWriter
+	hash   hash.Hash // SHA-256 of the compressed archive
+}
+
+// countingWriter counts the bytes passed through to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n atomic.Int64
+}
+
+// Write writes to the underlying writer and counts the written bytes
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader and counts the read bytes
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NormalizePath expands environment variables and the home directory, and
+// converts to an absolute path
+func NormalizePath(path string) (string, error) {
+	path, err := expandEnv(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Expand home directory
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home dir: %w", err)
+		}
+		path = filepath.Join(home, path[1:])
+	}
+
+	// Convert to absolute path
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	return absPath, nil
+}
+
+// expandEnv replaces $VAR and ${VAR} with the value of the environment
+// variable. Unset variables are an error, "${PROJECTS_DIR}/app" silently
+// turning into "/app" would back up or restore the wrong directory.
+func expandEnv(path string) (string, error) {
+	var missing string
+	expanded := os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s in %s isn't set", missing, path)
+	}
+	return expanded, nil
+}
+
+// expandTarget expands an output target. Local paths are normalized, URLs and
+// rclone remotes only get their environment variables replaced.
+func expandTarget(target string) (string, error) {
+	if storage.IsRemote(target) {
+		return expandEnv(target)
+	}
+	return NormalizePath(target)
+}
+
+// displayPath returns the normalized location path, falling back to the configured one
+func (l Location) displayPath() string {
+	if normalized, err := NormalizePath(l.Path); err == nil {
+		return normalized
+	}
+	return l.Path
+}
+
+// label returns the name of the location, or its normalized path if it has none
+func (l Location) label() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	return l.displayPath()
+}
+
+// bundleApps are the apps owning library bundles, by extension
+var bundleApps = map[string]string{
+	".photoslibrary": "Photos",
+	".musiclibrary":  "Music",
+	".tvlibrary":     "TV",
+	".fcpbundle":     "Final Cut Pro",
+	".logicx":        "Logic Pro X",
+	".band":          "GarageBand",
+}
+
+// bundleApp returns the process owning a bundle location. Folders like
+// ~/Music/Music are recognized by the library inside them.
+func (l Location) bundleApp() string {
+	if l.App != "" {
+		return l.App
+	}
+	path := l.displayPath()
+	if app, ok := bundleApps[filepath.Ext(path)]; ok {
+		return app
+	}
+	entries, _ := os.ReadDir(path)
+	for _, entry := range entries {
+		if app, ok := bundleApps[filepath.Ext(entry.Name())]; ok {
+			return app
+		}
+	}
+	return ""
+}
+
+// missing reports whether the location is optional, e.g. of an app preset
+// whose app isn't installed, and doesn't exist
+func (l Location) missing() bool {
+	if !l.optional && !l.Optional {
+		return false
+	}
+	_, err := os.Stat(l.displayPath())
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// conditional reports whether the location may have been left out of a
+// backup, so its archive may be missing on restore
+func (l Location) conditional() bool {
+	return l.optional || l.Optional || l.RequireAC || l.SkipMetered
+}
+
+// conditions is the power and network state of a run, looked up the first
+// time a location asks for it and kept until the run ends
+type conditions struct {
+	onBattery func() bool
+	metered   func() bool
+}
+
+// newConditions creates the conditions of a run
+func newConditions() *conditions {
+	return &conditions{onBattery: sync.OnceValue(apps.OnBattery), metered: sync.OnceValue(apps.Metered)}
+}
+
+// skipReason returns why the location is skipped in a run, e.g. on battery
+// power, or "" if it is backed up
+func (l Location) skipReason(c *conditions) string {
+	switch {
+	case l.RequireAC && c.onBattery():
+		return "on battery power"
+	case l.SkipMetered && c.metered():
+		return "on a personal hotspot"
+	}
+	return ""
+}
+
+// generateFilename creates a unique filename based on the path, with the
+// extension of the compression format
+func generateFilename(path string, c compression) string {
+	h := sha256.New()
+	h.Write([]byte(path))
+	return fmt.Sprintf(
+		"%s-%x%s",
+		filepath.Base(path),
+		h.Sum(nil),
+		c.extension(),
+	)
+}
+
+// compression returns the compression of the location's archive. It is
+// validated when the config is loaded.
+func (l Location) compression() compression {
+	c, _ := parseCompression(l.Compression)
+	return c
+}
+
+// splitSize returns the size of the parts of the location's archive, 0 if it
+// isn't split. It is validated when the config is loaded.
+func (l Location) splitSize() int64 {
+	if l.SplitSize == "" {
+		return 0
+	}
+	size, _ := units.ParseSize(l.SplitSize)
+	return size
+}
+
+// archiveName returns the name of the location's archive. Named locations
+// are archived under their name, e.g. "Projects.tar.gz".
+func (l Location) archiveName() string {
+	if l.Name != "" {
+		return nameSlug(l.Name) + l.compression().extension()
+	}
+	return generateFilename(l.Path, l.compression())
+}
+
+// nameSlug turns a location name into a file name, replacing everything but
+// letters, digits, "-", "_" and "." with "-"
+func nameSlug(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, name)
+	return strings.Trim(slug, "-.")
+}
+
+// newArchiveWriter creates a new compressed tar archive writer, storing the
+// archive in parts of splitSize unless it is 0
+func newArchiveWriter(store storage.Storage, name string, verify bool, c compression, splitSize int64) (*ArchiveWriter, error) {
+	out, err := newSplitWriter(store, name, splitSize)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &ArchiveWriter{out: out}
+
+	// Optionally decode the compressed stream while it is written, so a
+	// corrupt archive is rejected before it is committed
+	var dest io.Writer = out
+	if verify {
+		pr, pw := io.Pipe()
+		w.verify = pw
+		w.result = make(chan error, 1)
+		go func() {
+			err := verifyStream(name, pr)
+			pr.CloseWithError(err)
+			w.result <- err
+		}()
+		dest = io.MultiWriter(out, pw)
+	}
+	w.hash = sha256.New()
+	w.output = &countingWriter{w: io.MultiWriter(dest, w.hash)}
+
+	comp, err := c.newWriter(w.output)
+	if err != nil {
+		w.Abort()
+		return nil, err
+	}
+
+	w.tar = tar.NewWriter(comp)
+	w.comp = comp
+
+	return w, nil
+}
+
+// Close flushes all underlying writers and commits the finished archive.
+// If anything fails the partial archive is discarded instead.
+func (w *ArchiveWriter) Close() error {
+	err := errors.Join(
+		w.tar.Close(),
+		w.comp.Close(),
+	)
+	if w.verify != nil {
+		w.verify.Close()
+		err = errors.Join(err, <-w.result)
+	}
+	if err != nil {
+		w.out.Abort()
+		return err
+	}
+
+	return w.out.Close()
+}
+
+// Abort discards the archive without touching an existing one of the same name
+func (w *ArchiveWriter) Abort() error {
+	if w.tar != nil {
+		w.tar.Close()
+		w.comp.Close()
+	}
+	if w.verify != nil {
+		w.verify.CloseWithError(errors.New("archive aborted"))
+		<-w.result
+	}
+	return w.out.Abort()
+}
+
+// AbortContext discards the archive like Abort, unless ctx was canceled and
+// the storage can keep what was uploaded so far for the next run to resume
+func (w *ArchiveWriter) AbortContext(ctx context.Context) error {
+	suspender, ok := w.out.(storage.Suspender)
+	if ctx.Err() == nil || !ok {
+		return w.Abort()
+	}
+
+	// Suspend first, the flush of the compressor must not be uploaded
+	err := suspender.Suspend()
+	if w.tar != nil {
+		w.tar.Close()
+		w.comp.Close()
+	}
+	if w.verify != nil {
+		w.verify.CloseWithError(errors.New("archive aborted"))
+		<-w.result
+	}
+	return err
+}
+
+// WriteHeader writes a tar header to the archive
+func (w *ArchiveWriter) WriteHeader(hdr *tar.Header) error {
+	return w.tar.WriteHeader(hdr)
+}
+
+// Write writes data to the archive
+func (w *ArchiveWriter) Write(p []byte) (int, error) {
+	n, err := w.tar.Write(p)
+	w.raw += int64(n)
+	return n, err
+}
+
+// Sizes returns the uncompressed bytes written so far and the compressed bytes
+// emitted by the compressor. Compression runs in the background, so the
+// compressed size lags behind until the archive is closed.
+func (w *ArchiveWriter) Sizes() (raw, compressed int64) {
+	return w.raw, w.output.n.Load()
+}
+
+// Checksum returns the hex encoded SHA-256 of the compressed archive. It is
+// only complete after Close.
+func (w *ArchiveWriter) Checksum() string {
+	return hex.EncodeToString(w.hash.Sum(nil))
+}
+
+// verifyStream decodes a compressed archive end to end to make sure it can be extracted
+func verifyStream(name string, r io.Reader) error {
+	decompressed, err := decompress(name, r)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	defer decompressed.Close()
+
+	tarReader := tar.NewReader(decompressed)
+	for {
+		_, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("verification failed: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, tarReader); err != nil {
+			return fmt.Errorf("verification failed: %w", err)
+		}
+	}
+
+	// Drain trailing padding so the writer side never blocks (the wrapper
+	// hides pgzip's WriteTo, which can't resume a partially read stream)
+	if _, err := io.Copy(io.Discard, struct{ io.Reader }{decompressed}); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
@@ -0,0 +1,73 @@
+package macup
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("PROJECTS_DIR", "/Users/me/Projects")
+	t.Setenv("EMPTY", "")
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"$PROJECTS_DIR/app", "/Users/me/Projects/app", false},
+		{"${PROJECTS_DIR}/app", "/Users/me/Projects/app", false},
+		{"/plain/path", "/plain/path", false},
+		{"/set/but/$EMPTY", "/set/but/", false},
+		{"${MACUP_TEST_UNSET}/app", "", true},
+		{"$PROJECTS_DIR/$MACUP_TEST_UNSET", "", true},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.path)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("expandEnv(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PROJECTS_DIR", "~/Projects")
+
+	tests := map[string]string{
+		"~":                 home,
+		"~/Documents":       filepath.Join(home, "Documents"),
+		"$HOME/Documents":   filepath.Join(home, "Documents"),
+		"$PROJECTS_DIR/app": filepath.Join(home, "Projects/app"), // ~ from a variable is expanded as well
+		"/tmp/../var":       "/var",
+	}
+	for path, want := range tests {
+		if got, err := NormalizePath(path); got != want || err != nil {
+			t.Errorf("NormalizePath(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+	if _, err := NormalizePath("$MACUP_TEST_UNSET/Documents"); err == nil {
+		t.Errorf("NormalizePath() with an unset variable succeeded")
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	state := func(value bool) func() bool { return func() bool { return value } }
+	onBattery := &conditions{onBattery: state(true), metered: state(false)}
+
+	tests := []struct {
+		loc        Location
+		conditions *conditions
+		want       string
+	}{
+		{Location{RequireAC: true}, onBattery, "on battery power"},
+		{Location{SkipMetered: true}, onBattery, ""},
+		{Location{SkipMetered: true}, &conditions{onBattery: state(false), metered: state(true)}, "on a personal hotspot"},
+		{Location{}, onBattery, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.loc.skipReason(tt.conditions); got != tt.want {
+			t.Errorf("skipReason() = %q, want %q", got, tt.want)
+		}
+	}
+}
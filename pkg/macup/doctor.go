@@ -0,0 +1,245 @@
+package macup
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/units"
+)
+
+// Diagnosis is the result of a check of `macup doctor`
+type Diagnosis struct {
+	Check   string `json:"check"`             // What was checked, e.g. "Output ~/Backups"
+	Result  string `json:"result"`            // What was found
+	Fix     string `json:"fix,omitempty"`     // How to solve the problem, empty if there is none
+	Warning bool   `json:"warning,omitempty"` // The problem doesn't keep backups from working
+}
+
+// Problem reports whether the check found something to fix
+func (d Diagnosis) Problem() bool {
+	return d.Fix != ""
+}
+
+// protectedDirs need Full Disk Access to be read, e.g. for the mail module
+var protectedDirs = []string{"~/Library/Mail", "~/Library/Safari", "~/Library/Messages"}
+
+// requiredTools are the command line tools modules run, with how to get them
+var requiredTools = map[string]struct{ tool, install string }{
+	"homebrew": {"brew", "Install Homebrew from https://brew.sh"},
+	"mas":      {"mas", "Install it with `brew install mas`"},
+	"vscode":   {"code", "Run \"Shell Command: Install 'code' command in PATH\" in VS Code"},
+	"docker":   {"docker", "Install Docker Desktop or the docker CLI"},
+}
+
+// Doctor checks whether backups with a config can work on this Mac: the
+// config, Full Disk Access, the tools of enabled modules, the outputs with
+// their free space, leftovers of interrupted runs and the archives of the
+// last backup
+func Doctor(configPath, profile string) []Diagnosis {
+	config, err := LoadProfile(configPath, profile)
+	if err != nil {
+		return []Diagnosis{{
+			Check:  "Config",
+			Result: err.Error(),
+			Fix:    "Fix the config, `macup config validate` lists all problems",
+		}}
+	}
+	diagnoses := []Diagnosis{{Check: "Config", Result: cmp.Or(config.path, configPath) + " is valid"}}
+
+	if runtime.GOOS == "darwin" {
+		diagnoses = append(diagnoses, diagnoseFullDiskAccess())
+	}
+	diagnoses = append(diagnoses, config.diagnoseTools()...)
+	for _, target := range outputTargets(config) {
+		diagnoses = append(diagnoses, config.diagnoseOutput(target)...)
+	}
+	if d, ok := diagnoseDaemonState(); ok {
+		diagnoses = append(diagnoses, d)
+	}
+	return diagnoses
+}
+
+// diagnoseFullDiskAccess checks whether folders protected by macOS can be read
+func diagnoseFullDiskAccess() Diagnosis {
+	d := Diagnosis{Check: "Full Disk Access", Result: "granted"}
+	for _, dir := range protectedDirs {
+		path, err := NormalizePath(dir)
+		if err != nil {
+			continue
+		}
+		if _, err := os.ReadDir(path); errors.Is(err, fs.ErrPermission) {
+			d.Result = "can't read " + dir
+			d.Fix = "Grant Full Disk Access to your terminal in System Settings > Privacy & Security > Full Disk Access"
+			return d
+		}
+	}
+	return d
+}
+
+// diagnoseTools checks that the tools of the enabled modules are installed
+func (c *Config) diagnoseTools() []Diagnosis {
+	selected, err := selectModules(c, ModuleFilter{})
+	if err != nil {
+		return nil
+	}
+	var diagnoses []Diagnosis
+	for _, m := range selected {
+		required, ok := requiredTools[m.Name()]
+		if !ok {
+			continue
+		}
+		d := Diagnosis{Check: "Tool " + required.tool, Result: "installed"}
+		if !apps.Installed(required.tool) {
+			d.Result = fmt.Sprintf("not installed, the %s module needs it", m.Name())
+			d.Fix = required.install
+		}
+		diagnoses = append(diagnoses, d)
+	}
+
+	// Repositories are inspected and remote configs fetched with git
+	needsGit := c.origin != nil && strings.HasPrefix(c.origin.URL, "git+")
+	for _, loc := range c.Data.Locations {
+		needsGit = needsGit || loc.GitMode != ""
+	}
+	if needsGit {
+		d := Diagnosis{Check: "Tool git", Result: "installed"}
+		if !apps.Installed("git") {
+			d.Result, d.Fix = "not installed, git_mode and git configs need it", "Install the Xcode Command Line Tools with `xcode-select --install`"
+		}
+		diagnoses = append(diagnoses, d)
+	}
+	return diagnoses
+}
+
+// diagnoseOutput checks that an output is reachable and has room for the
+// next backup, that its last backup is intact and that no interrupted run
+// left files behind
+func (c *Config) diagnoseOutput(target string) []Diagnosis {
+	check := "Output " + redactTarget(target)
+	if c.OutputVolume != "" && target == c.volumeTarget() {
+		if info, err := os.Stat(filepath.Join("/Volumes", c.OutputVolume)); err != nil || !info.IsDir() {
+			return []Diagnosis{{Check: check, Result: "volume " + c.OutputVolume + " is not mounted", Fix: "Plug in the backup volume", Warning: true}}
+		}
+	}
+	store, err := storage.New(target, c.StorageOptions())
+	if err != nil {
+		return []Diagnosis{{Check: check, Result: err.Error(), Fix: "Check the output URL and the credentials in the config or environment"}}
+	}
+
+	d := Diagnosis{Check: check, Result: "reachable"}
+	need, err := estimateSize(store)
+	if err != nil {
+		return []Diagnosis{{Check: check, Result: err.Error(), Fix: "Check that the output is reachable and the credentials are valid"}}
+	}
+	if checker, ok := store.(storage.Checker); ok {
+		if err := checker.Check(need); errors.Is(err, storage.ErrInsufficientSpace) {
+			return []Diagnosis{{Check: check, Result: err.Error(), Fix: "Free up space on the output or back up to a larger one"}}
+		} else if err != nil {
+			return []Diagnosis{{Check: check, Result: err.Error(), Fix: "Check that the output is reachable and the credentials are valid"}}
+		}
+	}
+	if reporter, ok := store.(storage.SpaceReporter); ok {
+		if free, err := reporter.Free(); err == nil && free >= 0 {
+			d.Result += fmt.Sprintf(", %s free", units.FormatSize(free))
+			if need > 0 {
+				d.Result += fmt.Sprintf(", about %s needed", units.FormatSize(need))
+			}
+		}
+	}
+	diagnoses := []Diagnosis{d}
+
+	// Leftovers of interrupted runs take up space until the next run
+	if _, ok := store.(*storage.Local); ok {
+		if leftovers, _ := filepath.Glob(filepath.Join(target, "*.tmp")); len(leftovers) > 0 {
+			diagnoses = append(diagnoses, Diagnosis{
+				Check:   check,
+				Result:  fmt.Sprintf("partial files of an interrupted run, e.g. %s (%d in total)", leftovers[0], len(leftovers)),
+				Fix:     "Remove them with `macup prune` once they are an hour old",
+				Warning: true,
+			})
+		}
+	}
+
+	if lister, ok := store.(storage.UploadLister); ok {
+		if uploads, err := lister.Uploads(); err == nil && len(uploads) > 0 {
+			var size int64
+			for _, upload := range uploads {
+				size += upload.Size
+			}
+			diagnoses = append(diagnoses, Diagnosis{
+				Check:   check,
+				Result:  fmt.Sprintf("unfinished uploads of an interrupted run, e.g. %s (%d in total, %s)", uploads[0].Name, len(uploads), units.FormatSize(size)),
+				Fix:     "The next run resumes them, or remove them with `macup prune` once they are an hour old",
+				Warning: true,
+			})
+		}
+	}
+
+	return append(diagnoses, c.diagnoseManifest(store, check)...)
+}
+
+// diagnoseManifest checks that the archives of the last backup are complete
+func (c *Config) diagnoseManifest(store storage.Storage, check string) []Diagnosis {
+	manifest, err := readManifest(store)
+	if err != nil {
+		return []Diagnosis{{Check: check, Result: err.Error(), Fix: "Run `macup create` to write a new backup"}}
+	}
+	if manifest == nil {
+		return nil
+	}
+
+	var broken []string
+	for _, entry := range manifest.archives() {
+		archived, err := archiveStore(entry.Output, entry.Archive, store, c.StorageOptions())
+		var size int64
+		if err == nil {
+			size, err = statArchive(archived, entry.Archive)
+		}
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			broken = append(broken, entry.Archive+" is missing")
+		case err != nil:
+			broken = append(broken, fmt.Sprintf("%s can't be read: %v", entry.Archive, err))
+		case entry.Size > 0 && size != entry.Size:
+			broken = append(broken, fmt.Sprintf("%s has %s instead of %s", entry.Archive, units.FormatSize(size), units.FormatSize(entry.Size)))
+		}
+	}
+	if len(broken) == 0 {
+		return []Diagnosis{{Check: check, Result: fmt.Sprintf("last backup from %s is complete", manifest.CreatedAt.Local().Format("2006-01-02 15:04"))}}
+	}
+	slices.Sort(broken)
+	d := Diagnosis{Check: check, Result: "last backup is broken:", Fix: "Run `macup create` to replace the broken archives"}
+	for _, problem := range broken {
+		d.Result += "\n  - " + problem
+	}
+	return []Diagnosis{d}
+}
+
+// diagnoseDaemonState reports the state file of a daemon that didn't stop cleanly
+func diagnoseDaemonState() (Diagnosis, bool) {
+	path, err := NormalizePath(daemonStatePath)
+	if err != nil {
+		return Diagnosis{}, false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return Diagnosis{}, false
+	}
+	if state, err := readDaemonState(); err == nil && state != nil {
+		return Diagnosis{Check: "Daemon", Result: fmt.Sprintf("running with PID %d", state.PID)}, true
+	}
+	return Diagnosis{
+		Check:   "Daemon",
+		Result:  "state of a daemon that was killed is left in " + path,
+		Fix:     "Remove it with `rm " + path + "`",
+		Warning: true,
+	}, true
+}
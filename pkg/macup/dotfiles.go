@@ -0,0 +1,313 @@
+package macup
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/klauspost/pgzip"
+)
+
+// dotfilesArchive is the name of the archive holding the dotfiles
+const dotfilesArchive = "dotfiles.tar.gz"
+
+// Dotfiles lists files and directories in the home directory that are backed
+// up into an archive of their own
+type Dotfiles struct {
+	Files     []string                     `yaml:"files"`     // e.g. "~/.zshrc" or "~/.config/nvim"
+	Templates []DotfileTemplate            `yaml:"templates"` // Files rendered for the restoring machine
+	Vars      map[string]map[string]string `yaml:"vars"`      // Template variables by hostname, "default" applies to all
+}
+
+// DotfileTemplate is a dotfile generated from a text/template on restore,
+// e.g. a .gitconfig with a different email address on the work machine
+type DotfileTemplate struct {
+	Path   string `yaml:"path"`   // Where the rendered file is written
+	Source string `yaml:"source"` // The template, e.g. "~/dotfiles/gitconfig.tmpl"
+}
+
+// enabled reports whether any dotfiles are configured
+func (d Dotfiles) enabled() bool {
+	return len(d.Files) > 0 || len(d.Templates) > 0
+}
+
+// vars returns the template variables for a host. Host specific variables
+// override the defaults, and "hostname" is always set.
+func (d Dotfiles) vars(hostname string) map[string]string {
+	// Keys are case-insensitive, since the config loader lowercases them
+	hostname = strings.ToLower(hostname)
+	vars := map[string]string{"hostname": hostname}
+	maps.Copy(vars, d.Vars["default"])
+	maps.Copy(vars, d.Vars[strings.TrimSuffix(hostname, ".local")])
+	maps.Copy(vars, d.Vars[hostname])
+	return vars
+}
+
+// homeRelative returns a path relative to the home directory, so dotfiles
+// are restored into the home of whoever restores them
+func homeRelative(path string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := NormalizePath(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(home, abs)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s is not inside the home directory", path)
+	}
+	return rel, nil
+}
+
+// backupDotfiles archives all configured dotfiles and template sources and
+// records the archive in the manifest
+func backupDotfiles(config *Config, store storage.Storage, manifest *Manifest) error {
+	dotfiles := config.Dotfiles
+	if !dotfiles.enabled() {
+		return nil
+	}
+
+	pv := config.newReporter("Archiving")
+	pv.Add("dotfiles", 0.0, 0)
+
+	writer, err := newArchiveWriter(store, dotfilesArchive, config.Verify, compression{format: compressionGzip}, 0)
+	if err != nil {
+		pv.Clear()
+		return fmt.Errorf("failed to create dotfiles archive: %w", err)
+	}
+
+	total := len(dotfiles.Files) + len(dotfiles.Templates)
+	for i, file := range dotfiles.Files {
+		pv.Message(file)
+		if err := writeDotfiles(writer, file, "files"); err != nil {
+			writer.Abort()
+			pv.Clear()
+			return fmt.Errorf("failed to back up dotfile %s: %w", file, err)
+		}
+		pv.Set("dotfiles", float64(i+1)/float64(total), 0)
+	}
+
+	// Templates are stored under the path they are rendered to
+	for i, tmpl := range dotfiles.Templates {
+		pv.Message(tmpl.Source)
+		rel, err := homeRelative(tmpl.Path)
+		if err == nil {
+			err = writeDotfile(writer, tmpl.Source, filepath.Join("templates", rel))
+		}
+		if err != nil {
+			writer.Abort()
+			pv.Clear()
+			return fmt.Errorf("failed to back up template %s: %w", tmpl.Source, err)
+		}
+		pv.Set("dotfiles", float64(len(dotfiles.Files)+i+1)/float64(total), 0)
+	}
+
+	if err := writer.Close(); err != nil {
+		pv.Clear()
+		return fmt.Errorf("failed to finalize dotfiles archive: %w", err)
+	}
+	_, compressed := writer.Sizes()
+	manifest.Dotfiles = &ManifestLocation{
+		Path:    "dotfiles",
+		Archive: dotfilesArchive,
+		Size:    compressed,
+		SHA256:  writer.Checksum(),
+	}
+
+	pv.Message("")
+	pv.Done("dotfiles", true)
+	pv.Finish("")
+
+	return nil
+}
+
+// writeDotfiles adds a file or a whole directory below prefix to the archive
+func writeDotfiles(w *ArchiveWriter, file, prefix string) error {
+	rel, err := homeRelative(file)
+	if err != nil {
+		return err
+	}
+	path, err := NormalizePath(file)
+	if err != nil {
+		return err
+	}
+
+	// Dotfiles are often links into a dotfiles repository, back up their target
+	root, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(root, func(current string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		sub, err := filepath.Rel(root, current)
+		if err != nil {
+			return err
+		}
+		return writeDotfile(w, current, filepath.Join(prefix, rel, sub))
+	})
+}
+
+// writeDotfile adds a single file or directory entry under name
+func writeDotfile(w *ArchiveWriter, path, name string) error {
+	path, err := NormalizePath(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(name)
+	hdr.Format = tar.FormatPAX
+	if err := w.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return copyFileToArchive(w, path)
+	}
+	return nil
+}
+
+// restoreDotfiles extracts the dotfiles into the home directory and renders
+// the templates with the variables of this machine
+func restoreDotfiles(config *Config, store storage.Storage, target string) error {
+	if !config.Dotfiles.enabled() {
+		return nil
+	}
+
+	size, err := store.Stat(dotfilesArchive)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("archive not found: %s", store.Path(dotfilesArchive))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get archive info: %w", err)
+	}
+
+	home, err := restorePath("~", target)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	vars := config.Dotfiles.vars(hostname)
+
+	pv := config.newReporter("Extracting")
+	pv.Add("dotfiles", 0.0, 0)
+
+	if err := extractDotfiles(store, size, home, vars, pv); err != nil {
+		pv.Fail("dotfiles")
+		pv.Finish("")
+		return fmt.Errorf("failed to restore dotfiles: %w", err)
+	}
+
+	pv.Message("")
+	pv.Done("dotfiles", true)
+	pv.Finish("✓ Dotfiles restored successfully!")
+
+	return nil
+}
+
+// extractDotfiles writes the files of the dotfiles archive into home
+func extractDotfiles(store storage.Storage, size int64, home string, vars map[string]string, pv tui.ProgressReporter) error {
+	file, err := store.Open(dotfilesArchive)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	gzipReader, err := pgzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	var processed int64
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		kind, name, _ := strings.Cut(header.Name, "/")
+		rel := filepath.FromSlash(name)
+		if !filepath.IsLocal(rel) || (kind != "files" && kind != "templates") {
+			return fmt.Errorf("illegal file path in archive: %s", header.Name)
+		}
+		path := filepath.Join(home, rel)
+		pv.Message(path)
+
+		switch {
+		case header.Typeflag == tar.TypeDir:
+			if err := os.MkdirAll(path, os.FileMode(header.Mode)); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", path, err)
+			}
+		case header.Typeflag != tar.TypeReg:
+			continue
+		case kind == "templates":
+			if err := renderDotfile(tarReader, path, os.FileMode(header.Mode), vars); err != nil {
+				return fmt.Errorf("failed to render %s: %w", path, err)
+			}
+		default:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("failed to create parent directory: %w", err)
+			}
+			if err := extractFile(tarReader, path, os.FileMode(header.Mode)); err != nil {
+				return fmt.Errorf("failed to extract file %s: %w", path, err)
+			}
+		}
+
+		processed += header.Size
+		pv.Bytes("dotfiles", processed, size)
+		pv.Set("dotfiles", min(float64(processed)/float64(size), 1.0), 0)
+	}
+
+	pv.Set("dotfiles", 1.0, 0)
+	return nil
+}
+
+// renderDotfile executes a template and writes the result to path. Unknown
+// variables are an error rather than an empty string in the file.
+func renderDotfile(r io.Reader, path string, mode os.FileMode, vars map[string]string) error {
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.Bytes(), mode)
+}
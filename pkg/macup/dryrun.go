@@ -0,0 +1,121 @@
+package macup
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"os"
+	"slices"
+)
+
+// sampleSize is how much of a location is compressed to estimate its archive size
+const sampleSize = 16 << 20
+
+// sampleChunk is read from each file of the sample, so it spans many files
+const sampleChunk = 1 << 20
+
+// ScanReport is what `macup create --dry-run` found for a location
+type ScanReport struct {
+	Location    string         `json:"location"`
+	Files       int            `json:"files"`              // Entries that aren't directories
+	Dirs        int            `json:"dirs"`               // Directories in the archive
+	Repos       int            `json:"repos"`              // Repositories recorded with git_mode remotes
+	Size        int64          `json:"size"`               // Logical size of the files
+	Estimated   int64          `json:"estimated"`          // Estimated size of the compressed archive
+	Compression string         `json:"compression"`        // Archive extension, e.g. ".tar.zst"
+	Excluded    []ExcludeMatch `json:"excluded"`           // Patterns that left out entries, most hits first
+	Warnings    []string       `json:"warnings,omitempty"` // Entries that would be left out since they can't be read
+	Skipped     string         `json:"skipped,omitempty"`  // Why the location isn't backed up in this run
+	Error       string         `json:"error,omitempty"`    // Why scanning failed
+}
+
+// ExcludeMatch counts the entries a pattern left out, a directory counts once
+type ExcludeMatch struct {
+	Pattern string `json:"pattern"`
+	Entries int    `json:"entries"`
+}
+
+// DryRun scans all locations like a backup would, without writing anything,
+// and reports their size along with an estimate of the compressed archives
+func DryRun(config *Config) []ScanReport {
+	locations := slices.DeleteFunc(slices.Clone(config.Data.Locations), Location.missing)
+	slices.SortStableFunc(locations, func(a, b Location) int { return cmp.Compare(b.Priority, a.Priority) })
+
+	reports := make([]ScanReport, 0, len(locations))
+	conditions := newConditions()
+	for _, loc := range locations {
+		report := ScanReport{Location: loc.label(), Compression: loc.compression().extension()}
+		if report.Skipped = loc.skipReason(conditions); report.Skipped != "" {
+			reports = append(reports, report)
+			continue
+		}
+		path, err := NormalizePath(loc.Path)
+		if err != nil {
+			report.Error = err.Error()
+			reports = append(reports, report)
+			continue
+		}
+		loc.Path = path
+		if err := loc.scan(context.Background(), config.excludes(), nil); err != nil {
+			report.Error = err.Error()
+			reports = append(reports, report)
+			continue
+		}
+
+		for _, path := range loc.index {
+			if info, err := os.Stat(path); err == nil && info.IsDir() && !loc.links[path] {
+				report.Dirs++
+			} else {
+				report.Files++
+			}
+		}
+		report.Repos = len(loc.repos)
+		report.Warnings = loc.warnings
+		report.Size = loc.totalSize
+		report.Estimated = loc.estimateCompressed()
+		for pattern, entries := range loc.excluded {
+			report.Excluded = append(report.Excluded, ExcludeMatch{pattern, entries})
+		}
+		slices.SortFunc(report.Excluded, func(a, b ExcludeMatch) int {
+			return cmp.Or(cmp.Compare(b.Entries, a.Entries), cmp.Compare(a.Pattern, b.Pattern))
+		})
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// estimateCompressed compresses the start of the indexed files and applies
+// the ratio to the whole location
+func (l *Location) estimateCompressed() int64 {
+	if l.totalSize == 0 {
+		return 0
+	}
+	counter := &countingWriter{w: io.Discard}
+	w, err := l.compression().newWriter(counter)
+	if err != nil {
+		return l.totalSize
+	}
+
+	var sampled int64
+	for _, path := range l.index {
+		if sampled >= sampleSize {
+			break
+		}
+		if l.links[path] {
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			n, _ := io.Copy(w, io.LimitReader(file, min(sampleChunk, sampleSize-sampled)))
+			sampled += n
+		}
+		file.Close()
+	}
+	if err := w.Close(); err != nil || sampled == 0 {
+		return l.totalSize
+	}
+	return int64(float64(l.totalSize) * float64(counter.n.Load()) / float64(sampled))
+}
@@ -0,0 +1,95 @@
+package macup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/hinkolas/macup/internal/diskutil"
+	"github.com/hinkolas/macup/internal/notify"
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// ejectOutputs verifies the backup on every external volume among the
+// written targets and ejects the volume so it can be unplugged
+func ejectOutputs(targets []string, config *Config) error {
+	for _, target := range targets {
+		volume, ok := storage.Volume(target)
+		if !ok {
+			continue
+		}
+
+		store, err := storage.NewLocal(target)
+		if err != nil {
+			return err
+		}
+		if err := verifyBackup(store, config); err != nil {
+			return fmt.Errorf("backup on %s is damaged: %w", volume, err)
+		}
+
+		if err := diskutil.Eject(volume); err != nil {
+			return fmt.Errorf("failed to eject %s: %w", volume, err)
+		}
+
+		name := filepath.Base(volume)
+		slog.Info(fmt.Sprintf("✓ Ejected %s, it can be unplugged safely", name))
+		notify.Notify("macup", "Backup finished, "+name+" can be unplugged safely")
+	}
+
+	return nil
+}
+
+// verifyBackup checks the part of every module enabled in the config
+func verifyBackup(store storage.Storage, config *Config) error {
+	manifest, err := readManifest(store)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		return fmt.Errorf("manifest is missing")
+	}
+
+	job := &Job{Config: config, Store: store, Manifest: manifest}
+	for _, m := range modules {
+		if !m.Enabled(config) {
+			continue
+		}
+		if err := m.Verify(job); err != nil {
+			return fmt.Errorf("%s: %w", m.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// verifyArchive reads back an archive and compares its size and checksum
+// with the manifest entry
+func verifyArchive(store storage.Storage, loc ManifestLocation) error {
+	r, err := openArchive(store, loc.Archive)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", loc.Archive, err)
+	}
+
+	// Manifests of older versions don't record size and checksum
+	if loc.SHA256 == "" {
+		return nil
+	}
+	if size != loc.Size {
+		return fmt.Errorf("%s has %d bytes, expected %d", loc.Archive, size, loc.Size)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != loc.SHA256 {
+		return fmt.Errorf("%s has a wrong checksum", loc.Archive)
+	}
+
+	return nil
+}
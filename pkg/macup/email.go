@@ -0,0 +1,106 @@
+package macup
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hinkolas/macup/internal/units"
+)
+
+// EmailReport sends a summary of every backup by email, e.g. to whoever looks
+// after the Mac
+type EmailReport struct {
+	To       []string `yaml:"to"`
+	From     string   `yaml:"from"` // Sender, the first recipient if empty
+	SMTP     string   `yaml:"smtp"` // Mail server with STARTTLS, e.g. "smtp.example.com:587", the mail command sends the email if empty
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	On       string   `yaml:"on"` // "always" (default) or "failure"
+}
+
+// enabled reports whether reports are sent
+func (e EmailReport) enabled() bool {
+	return len(e.To) > 0
+}
+
+// send emails the report of a run
+func (e EmailReport) send(summary RunSummary, report string) error {
+	subject := fmt.Sprintf("macup: backup of %s completed", summary.Hostname)
+	if summary.Status != "success" {
+		subject = fmt.Sprintf("macup: backup of %s failed", summary.Hostname)
+	}
+
+	if e.SMTP == "" {
+		cmd := exec.Command("mail", append([]string{"-s", subject}, e.To...)...)
+		cmd.Stdin = strings.NewReader(report)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("mail failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(e.SMTP)
+	if err != nil {
+		return fmt.Errorf("invalid smtp server %q: %w", e.SMTP, err)
+	}
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	from := cmp.Or(e.From, e.To[0])
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: macup <%s>\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(report, "\n", "\r\n"))
+	return smtp.SendMail(e.SMTP, auth, from, e.To, msg.Bytes())
+}
+
+// report describes a finished run for the email report: its outcome, the
+// locations with their size, the warnings and whether archives were verified
+func (c *Config) report(run *hookRun, summary RunSummary) string {
+	var b strings.Builder
+	if run.err != nil {
+		fmt.Fprintf(&b, "The backup of %s failed after %s:\n\n  %s\n\n", summary.Hostname, run.duration(), strings.ReplaceAll(run.err.Error(), "\n", "\n  "))
+	} else {
+		fmt.Fprintf(&b, "The backup of %s completed in %s.\n\n", summary.Hostname, run.duration())
+	}
+	fmt.Fprintf(&b, "Started:  %s\n", run.start.Local().Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "Backup:   %s\n", summary.Backup)
+	fmt.Fprintf(&b, "Size:     %s\n", units.FormatSize(summary.Bytes))
+	verified := "off"
+	if c.Verify {
+		verified = "archives were read back while written"
+	}
+	fmt.Fprintf(&b, "Verified: %s\n", verified)
+
+	if locations := run.locations(); len(locations) > 0 {
+		b.WriteString("\nLocations:\n")
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, loc := range locations {
+			size := units.FormatSize(loc.Size)
+			if loc.Status == "failed" && loc.Size == 0 {
+				size = "-"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", loc.Location, size, loc.Status)
+		}
+		w.Flush()
+	}
+
+	if len(run.warnings) > 0 {
+		b.WriteString("\nWarnings:\n")
+		for _, warning := range run.warnings {
+			fmt.Fprintf(&b, "  - %s\n", strings.ReplaceAll(warning, "\n", "\n    "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,186 @@
+// Package macup creates, restores and inspects backups of a Mac, the engine
+// behind the macup command. Programs embed it through an Engine:
+//
+//	engine, err := macup.NewEngine("~/.config/macup/config.yaml", "")
+//	if err != nil {
+//		return err
+//	}
+//	engine.Progress = func(phase string) macup.ProgressReporter { return myReporter{phase} }
+//	err = engine.Backup(ctx, macup.ModuleFilter{Only: []string{"data"}})
+//
+// Errors of runs that were canceled are a *CanceledError, those of backups
+// that failed for some locations a *PartialError.
+package macup
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/tui"
+)
+
+// ProgressReporter receives the progress of a run location by location, see
+// Engine.Progress
+type ProgressReporter = tui.ProgressReporter
+
+// NopReporter is a ProgressReporter that drops all progress
+type NopReporter = tui.NopReporter
+
+// Theme is the theme block of the config
+type Theme = tui.Theme
+
+// Storage is a directory, bucket or server backups are stored in
+type Storage = storage.Storage
+
+// StorageOptions are the settings of the storage backends, see
+// Config.StorageOptions
+type StorageOptions = storage.Options
+
+// Blocks of the storage backends in the config
+type (
+	S3Options     = storage.S3Options
+	RcloneOptions = storage.RcloneOptions
+	WebDAVOptions = storage.WebDAVOptions
+	ServerOptions = storage.ServerOptions
+)
+
+// Blocks of the apps and their settings in the config
+type (
+	AppsConfig     = apps.Config
+	DefaultsDomain = apps.DefaultsDomain
+	Preset         = apps.Preset
+	Tweak          = apps.Tweak
+)
+
+// What the manifest records about the apps of a Mac
+type (
+	AppStoreApp = apps.App
+	Runtime     = apps.Runtime
+	MailAccount = apps.MailAccount
+	DockerState = apps.Docker
+)
+
+// BrowserNode is a file or directory of a backup, see BackupFS.BrowserNodes
+type BrowserNode = tui.BrowserNode
+
+// Engine creates and restores backups with a config
+type Engine struct {
+	Config     *Config
+	ConfigPath string // Config file bundled into backups, the one Config was loaded from if empty
+
+	// Progress creates the reporter of each phase of a run, e.g. "Archiving"
+	// or "Extracting". Without it progress is drawn on the terminal with the
+	// theme of the config, as by the command.
+	Progress func(phase string) ProgressReporter
+}
+
+// NewEngine creates an engine with the config at path with a profile
+// applied, see LoadProfile
+func NewEngine(path, profile string) (*Engine, error) {
+	config, err := LoadProfile(path, profile)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{Config: config}, nil
+}
+
+// Backup creates a backup of the modules selected by the filter to the
+// outputs of the config, see Create
+func (e *Engine) Backup(ctx context.Context, filter ModuleFilter) error {
+	e.Config.progress = e.Progress
+	return Create(ctx, e.Config, e.ConfigPath, filter)
+}
+
+// Restore restores the backup in a directory or at a URL, see Restore. The
+// backup brings its own config, only the storage options of the engine's are
+// used if opts has none.
+func (e *Engine) Restore(ctx context.Context, backupDir string, opts RestoreOptions) error {
+	if reflect.ValueOf(opts.Storage).IsZero() {
+		opts.Storage = e.Config.StorageOptions()
+	}
+	if opts.Progress == nil {
+		opts.Progress = e.Progress
+	}
+	return Restore(ctx, backupDir, opts)
+}
+
+// Snapshots returns the backups in the outputs of the config, one per output
+// since backups are replaced in place. Outputs without a backup are left out.
+func (e *Engine) Snapshots() ([]Snapshot, error) {
+	var snapshots []Snapshot
+	for _, target := range outputTargets(e.Config) {
+		store, err := storage.New(target, e.Config.StorageOptions())
+		if err != nil {
+			return snapshots, fmt.Errorf("failed to open output %s: %w", redactTarget(target), err)
+		}
+		snapshot, err := readSnapshot(store, target)
+		if err != nil {
+			return snapshots, fmt.Errorf("failed to read output %s: %w", redactTarget(target), err)
+		}
+		if snapshot != nil {
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+// newReporter creates the reporter of a phase of a run with the config, the
+// one of the engine running it if it has one
+func (c *Config) newReporter(phase string) ProgressReporter {
+	if c.progress != nil {
+		return c.progress(phase)
+	}
+	return tui.NewReporter(phase, c.Theme)
+}
+
+// Snapshot describes a backup, read from its manifest
+type Snapshot struct {
+	Target    string        `json:"target"` // Directory or URL of the backup
+	CreatedAt time.Time     `json:"created_at"`
+	Hostname  string        `json:"hostname"`
+	Profile   string        `json:"profile,omitempty"` // Config profile the backup was created with
+	Archives  []ArchiveInfo `json:"archives"`
+	Manifest  *Manifest     `json:"-"` // Everything the backup contains
+}
+
+// OpenSnapshot reads the backup in a directory or at a URL, e.g. one
+// returned by Engine.Snapshots. Without storage options remote credentials
+// come from the environment, see Config.StorageOptions.
+func OpenSnapshot(backupDir string, opts StorageOptions) (*Snapshot, error) {
+	store, err := storage.New(backupDir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	snapshot, err := readSnapshot(store, backupDir)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("no backup found at %s", redactTarget(backupDir))
+	}
+	return snapshot, nil
+}
+
+// readSnapshot reads the backup of a storage, nil if it has no manifest
+func readSnapshot(store storage.Storage, target string) (*Snapshot, error) {
+	manifest, err := readManifest(store)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+	archives, err := listArchives(store, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		Target:    target,
+		CreatedAt: manifest.CreatedAt,
+		Hostname:  manifest.Hostname,
+		Profile:   manifest.Profile,
+		Archives:  archives,
+		Manifest:  manifest,
+	}, nil
+}
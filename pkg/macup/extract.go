@@ -0,0 +1,203 @@
+package macup
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// ExtractOptions selects what `macup extract` takes out of a backup
+type ExtractOptions struct {
+	// e.g. "Projects/thesis/ch3.tex", starting with the name or the directory
+	// name of a location, or a full path like "~/Projects/thesis". Globs
+	// like "Projects/*.tex" match entries of the location.
+	Path    string
+	To      string         // Directory the matches are extracted into
+	Storage StorageOptions // Credentials of the backup's storage, they come from the environment if empty
+}
+
+// entryReader reads the entries of an archive. The metadata macup embeds is
+// no entry of the location, Next keeps it in Metadata instead.
+type entryReader struct {
+	*tar.Reader
+	decompressed io.ReadCloser
+	Metadata     *ArchiveMetadata // nil before the first entry and for archives of older versions
+}
+
+// newEntryReader reads the entries of an archive, decompressed in the format
+// its name tells
+func newEntryReader(name string, r io.Reader) (*entryReader, error) {
+	decompressed, err := decompress(name, r)
+	if err != nil {
+		return nil, err
+	}
+	return &entryReader{Reader: tar.NewReader(decompressed), decompressed: decompressed}, nil
+}
+
+// Next advances to the next entry of the location, io.EOF at the end
+func (r *entryReader) Next() (*tar.Header, error) {
+	for {
+		header, err := r.Reader.Next()
+		if err != nil || header.Typeflag != tar.TypeXGlobalHeader {
+			return header, err
+		}
+		if r.Metadata == nil {
+			r.Metadata = readMetadata(header)
+		}
+	}
+}
+
+// Close closes the decompressor, not the archive
+func (r *entryReader) Close() error {
+	return r.decompressed.Close()
+}
+
+// Extract extracts the files matching a path from the archive of the
+// location holding it and returns the extracted paths. A directory is
+// extracted with everything below it.
+func Extract(backupDir string, opts ExtractOptions) ([]string, error) {
+	store, err := storage.New(backupDir, opts.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	config, err := loadBundledConfig(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config from backup: %w", err)
+	}
+
+	loc, pattern, err := config.locationOf(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	to, err := NormalizePath(opts.To)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err = locationStore(loc, store, opts.Storage)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := openArchive(store, loc.archiveName())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive of %s: %w", loc.label(), err)
+	}
+	defer archive.Close()
+	entries, err := newEntryReader(loc.archiveName(), archive)
+	if err != nil {
+		return nil, err
+	}
+	defer entries.Close()
+
+	// Matches keep their path below the parent of the pattern, so
+	// "Projects/thesis" is extracted as <to>/thesis
+	parent := path.Dir(pattern)
+	var extracted []string
+	for {
+		header, err := entries.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return extracted, fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		name := path.Clean(filepath.ToSlash(header.Name))
+		if !matchEntry(pattern, name) {
+			continue
+		}
+
+		rel := strings.TrimPrefix(name, parent+"/")
+		target := filepath.Join(to, filepath.FromSlash(rel))
+		if !within(target, to) {
+			return extracted, fmt.Errorf("illegal file path in archive: %s", header.Name)
+		}
+		if err := extractEntry(entries, header, target); err != nil {
+			return extracted, err
+		}
+		extracted = append(extracted, target)
+	}
+
+	if len(extracted) == 0 {
+		return nil, fmt.Errorf("nothing in the archive of %s matches %s", loc.label(), opts.Path)
+	}
+	return extracted, nil
+}
+
+// locationOf finds the location holding a path and returns it with the
+// path as an entry name of its archive, e.g. "Documents/thesis/ch3.tex"
+func (c *Config) locationOf(p string) (Location, string, error) {
+	full := p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, "/") || strings.HasPrefix(p, "$")
+	if full {
+		expanded, err := NormalizePath(p)
+		if err != nil {
+			return Location{}, "", err
+		}
+		for _, loc := range c.Data.Locations {
+			root := loc.displayPath()
+			if within(expanded, root) {
+				rel, _ := filepath.Rel(root, expanded)
+				return loc, path.Join(filepath.Base(root), filepath.ToSlash(rel)), nil
+			}
+		}
+		return Location{}, "", fmt.Errorf("%s isn't in any location of the backup", p)
+	}
+
+	first, rest, _ := strings.Cut(filepath.ToSlash(p), "/")
+	for _, loc := range c.Data.Locations {
+		base := filepath.Base(loc.displayPath())
+		if strings.EqualFold(loc.Name, first) || base == first {
+			return loc, path.Join(base, rest), nil
+		}
+	}
+	return Location{}, "", fmt.Errorf("no location is named %s, start the path with the name or directory of a location, or give the full path", first)
+}
+
+// matchEntry reports whether an archive entry is the pattern, below it or
+// matches it as a glob
+func matchEntry(pattern, name string) bool {
+	if name == pattern || strings.HasPrefix(name, pattern+"/") {
+		return true
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return false
+	}
+	// A matching directory brings everything below it
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		if ok, _ := path.Match(pattern, strings.Join(segments[:i+1], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// extractEntry writes a single archive entry to target
+func extractEntry(r io.Reader, header *tar.Header, target string) error {
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, os.FileMode(header.Mode))
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create parent directory: %w", err)
+		}
+		if err := extractFile(r, target, os.FileMode(header.Mode)); err != nil {
+			return fmt.Errorf("failed to extract file %s: %w", target, err)
+		}
+	case tar.TypeSymlink:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create parent directory: %w", err)
+		}
+		os.Remove(target)
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %w", target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package macup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// gitModeRemotes backs up the remotes of git repositories instead of their contents
+const gitModeRemotes = "remotes"
+
+// GitRepo describes a git repository that is re-cloned on restore
+type GitRepo struct {
+	Path     string            `json:"path"`    // Relative to the location
+	Remotes  map[string]string `json:"remotes"` // Fetch URLs by remote name
+	Branch   string            `json:"branch,omitempty"`
+	Commit   string            `json:"commit"`
+	Dirty    []string          `json:"dirty,omitempty"`    // Files with uncommitted changes
+	Unpushed int               `json:"unpushed,omitempty"` // Commits missing in the upstream branch
+}
+
+// git runs git in a repository and returns its trimmed output
+func git(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	return strings.TrimRight(string(out), "\n"), err
+}
+
+// inspectRepo reads the remotes and state of the repository in dir. A
+// directory without a repository or remotes yields false.
+func inspectRepo(dir string) (GitRepo, bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, fs.ErrNotExist) {
+		return GitRepo{}, false, nil
+	}
+
+	out, err := git(dir, "remote", "-v")
+	if err != nil {
+		return GitRepo{}, false, fmt.Errorf("git remote %s: %w", dir, err)
+	}
+	repo := GitRepo{Remotes: make(map[string]string)}
+	for _, line := range strings.Split(out, "\n") {
+		// Lines look like "origin  git@github.com:user/repo.git (fetch)"
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[2] == "(fetch)" {
+			repo.Remotes[fields[0]] = fields[1]
+		}
+	}
+	if len(repo.Remotes) == 0 {
+		return GitRepo{}, false, nil // Can't be cloned, archived as usual
+	}
+
+	repo.Branch, _ = git(dir, "symbolic-ref", "--short", "-q", "HEAD") // Empty when detached
+	repo.Commit, _ = git(dir, "rev-parse", "HEAD")                     // Fails without commits
+	if out, err := git(dir, "rev-list", "--count", "@{upstream}..HEAD"); err == nil {
+		repo.Unpushed, _ = strconv.Atoi(out)
+	}
+
+	out, err = git(dir, "status", "--porcelain")
+	if err != nil {
+		return GitRepo{}, false, fmt.Errorf("git status %s: %w", dir, err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		// Lines look like " M main.go" or "?? notes.txt"
+		if len(line) > 3 {
+			repo.Dirty = append(repo.Dirty, line[3:])
+		}
+	}
+
+	return repo, true, nil
+}
+
+// cloneRepo clones a repository into dir, adds its other remotes and checks
+// out the branch or commit of the backup
+func cloneRepo(dir string, repo GitRepo) error {
+	origin := "origin"
+	if _, ok := repo.Remotes[origin]; !ok {
+		for name := range repo.Remotes {
+			origin = name
+			break
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	// git may ask for credentials
+	cmd := exec.Command("git", "clone", "--origin", origin, repo.Remotes[origin], dir)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git clone %s: %w", repo.Remotes[origin], err)
+	}
+
+	for name, url := range repo.Remotes {
+		if name == origin {
+			continue
+		}
+		if _, err := git(dir, "remote", "add", name, url); err != nil {
+			return fmt.Errorf("git remote add %s: %w", name, err)
+		}
+	}
+
+	ref := repo.Branch
+	if ref == "" {
+		ref = repo.Commit
+	}
+	if current, _ := git(dir, "symbolic-ref", "--short", "-q", "HEAD"); ref == "" || ref == current {
+		return nil
+	}
+	if out, err := exec.Command("git", "-C", dir, "checkout", "-q", ref).CombinedOutput(); err != nil {
+		return fmt.Errorf("git checkout %s: %s", ref, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// restoreRepos clones the repositories recorded for git_mode locations, below
+// target if given, and reports the ones that had uncommitted, i.e. lost, changes
+func restoreRepos(locations []Location, manifest *Manifest, target string) error {
+	var errs []error
+	var dirty []string
+	for _, loc := range locations {
+		entry, ok := manifest.location(loc.Path)
+		if !ok || len(entry.Repos) == 0 {
+			continue
+		}
+		root, err := restorePath(loc.Path, target)
+		if err != nil {
+			return err
+		}
+
+		for _, repo := range entry.Repos {
+			if !filepath.IsLocal(repo.Path) {
+				errs = append(errs, fmt.Errorf("illegal repository path in manifest: %s", repo.Path))
+				continue
+			}
+			dir := filepath.Join(root, repo.Path)
+			if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+				slog.Info(fmt.Sprintf("✓ %s exists already", dir))
+			} else if err := cloneRepo(dir, repo); err != nil {
+				errs = append(errs, fmt.Errorf("failed to clone %s: %w", dir, err))
+				continue
+			} else {
+				slog.Info("✓ Cloned " + dir)
+			}
+
+			if len(repo.Dirty) > 0 || repo.Unpushed > 0 {
+				dirty = append(dirty, fmt.Sprintf("%s: %d uncommitted files, %d unpushed commits", dir, len(repo.Dirty), repo.Unpushed))
+			}
+		}
+	}
+
+	if len(dirty) > 0 {
+		slog.Warn("These repositories had changes that weren't pushed at backup time:\n  - " + strings.Join(dirty, "\n  - "))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,151 @@
+package macup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// historyPath is the log every backup and restore appends a line of JSON to
+const historyPath = "~/.local/state/macup/history.jsonl"
+
+// Run is a past backup or restore recorded in the history
+type Run struct {
+	Command   string        `json:"command"` // "create" or "restore"
+	Status    string        `json:"status"`  // "success" or "failure"
+	StartedAt time.Time     `json:"started_at"`
+	EndedAt   time.Time     `json:"ended_at"`
+	Profile   string        `json:"profile,omitempty"`
+	Backup    string        `json:"backup"`
+	Bytes     int64         `json:"bytes"` // Size of the archives of the backup
+	Locations []RunLocation `json:"locations,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Warnings  []string      `json:"warnings,omitempty"`
+}
+
+// Duration returns how long the run took
+func (r Run) Duration() time.Duration {
+	return r.EndedAt.Sub(r.StartedAt)
+}
+
+// RunLocation is the outcome of a location in a backup
+type RunLocation struct {
+	Location string `json:"location"`
+	Size     int64  `json:"size"`   // Of its archive
+	Status   string `json:"status"` // "backed up", "kept" with the archive of an earlier run, or "failed"
+	Error    string `json:"error,omitempty"`
+}
+
+// locations returns the outcome of each location of a backup, in the order
+// of the manifest, failed ones without an earlier archive last
+func (r *hookRun) locations() []RunLocation {
+	var locations []RunLocation
+	for _, entry := range r.manifest.archives() {
+		status := "backed up"
+		if entry.BackedUpAt.Before(r.start) {
+			status = "kept"
+		}
+		locations = append(locations, RunLocation{Location: Location{Name: entry.Name, Path: entry.Path}.label(), Size: entry.Size, Status: status})
+	}
+	var partial *PartialError
+	if errors.As(r.err, &partial) {
+		for _, failed := range partial.Failed {
+			// The entry of the archive kept from the last run is replaced
+			i := slices.IndexFunc(locations, func(l RunLocation) bool { return l.Location == failed.Location })
+			if i < 0 {
+				locations = append(locations, RunLocation{Location: failed.Location})
+				i = len(locations) - 1
+			}
+			locations[i].Status, locations[i].Error = "failed", failed.Err.Error()
+		}
+	}
+	return locations
+}
+
+// recordRun appends a finished run to the history. Failing to write it only
+// warns, the run is done.
+func (c *Config) recordRun(command string, run *hookRun) {
+	entry := Run{
+		Command:   command,
+		Status:    "success",
+		StartedAt: run.start.UTC(),
+		EndedAt:   time.Now().UTC(),
+		Profile:   c.profile,
+		Backup:    redactTarget(run.backupDir),
+		Bytes:     run.bytes(),
+		Warnings:  run.warnings,
+	}
+	if command == "create" {
+		entry.Locations = run.locations()
+	}
+	if run.err != nil {
+		entry.Status, entry.Error = "failure", run.err.Error()
+	}
+	if err := appendHistory(entry); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to record the run in the history: %v", err))
+	}
+}
+
+// appendHistory adds a run to the history file
+func appendHistory(run Run) error {
+	path, err := NormalizePath(historyPath)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// History returns the recorded runs, the latest first. Lines that can't be
+// decoded, e.g. of a run killed while writing, are skipped.
+func History() ([]Run, error) {
+	path, err := NormalizePath(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []Run
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	slices.Reverse(runs)
+	return runs, nil
+}
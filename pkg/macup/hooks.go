@@ -0,0 +1,157 @@
+package macup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Hooks are shell commands run around backups and restores, e.g. to stop a
+// database before its files are backed up or to ping a health check after.
+// They run with /bin/sh and learn about the run from MACUP_ variables, see
+// hookRun.
+type Hooks struct {
+	PreBackup   string `yaml:"pre_backup" mapstructure:"pre_backup"`     // Fails the backup if it fails
+	PostBackup  string `yaml:"post_backup" mapstructure:"post_backup"`   // Also runs after a failed backup, see MACUP_STATUS
+	PreRestore  string `yaml:"pre_restore" mapstructure:"pre_restore"`   // Fails the restore if it fails
+	PostRestore string `yaml:"post_restore" mapstructure:"post_restore"` // Also runs after a failed restore, see MACUP_STATUS
+	OnError     string `yaml:"on_error" mapstructure:"on_error"`         // Runs once a backup or restore failed
+}
+
+// hookRun is the backup or restore hooks run for
+type hookRun struct {
+	backupDir string // Where the backup is stored, its first output target when creating it
+	start     time.Time
+	manifest  *Manifest // Manifest of the backup once the run finished
+	err       error     // Why the run failed
+	warnings  []string  // Logged during the run
+}
+
+// env returns the variables describing the run to a hook. Hooks running
+// before the run only learn the hook and the backup dir.
+func (r hookRun) env(hook string) []string {
+	env := []string{"MACUP_HOOK=" + hook, "MACUP_BACKUP_DIR=" + r.backupDir}
+	if strings.HasPrefix(hook, "pre_") {
+		return env
+	}
+
+	status := "success"
+	if r.err != nil {
+		status = "failure"
+		env = append(env, "MACUP_ERROR="+r.err.Error())
+	}
+	return append(env,
+		"MACUP_STATUS="+status,
+		fmt.Sprintf("MACUP_DURATION=%d", int(time.Since(r.start).Seconds())), // Seconds
+		fmt.Sprintf("MACUP_BYTES=%d", r.bytes()),
+	)
+}
+
+// bytes returns the size of the archives of the backup
+func (r hookRun) bytes() int64 {
+	var bytes int64
+	for _, entry := range r.manifest.archives() {
+		bytes += entry.Size
+	}
+	return bytes
+}
+
+// command returns the command of a hook by its config key
+func (h Hooks) command(hook string) string {
+	switch hook {
+	case "pre_backup":
+		return h.PreBackup
+	case "post_backup":
+		return h.PostBackup
+	case "pre_restore":
+		return h.PreRestore
+	case "post_restore":
+		return h.PostRestore
+	case "on_error":
+		return h.OnError
+	}
+	return ""
+}
+
+// run runs a hook if it is configured. Its output goes to stderr, so it
+// doesn't mix with the output of --json.
+func (h Hooks) run(hook string, run hookRun) error {
+	command := h.command(hook)
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+	slog.Debug("Running hook", "hook", hook)
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	cmd.Env = append(os.Environ(), run.env(hook)...)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %w", hook, err)
+	}
+	return nil
+}
+
+// around runs fn between a pre and a post hook, and on_error if the pre hook
+// or fn fail. The run records the outcome. A failing post or on_error hook is only reported, the run is
+// done by then.
+func (h Hooks) around(pre, post string, run *hookRun, fn func() (*Manifest, error)) error {
+	if err := h.run(pre, *run); err != nil {
+		run.err = err
+		if err := h.run("on_error", *run); err != nil {
+			slog.Warn(err.Error())
+		}
+		return err
+	}
+
+	run.manifest, run.err = fn()
+	if err := h.run(post, *run); err != nil {
+		slog.Warn(err.Error())
+	}
+	if run.err != nil {
+		if err := h.run("on_error", *run); err != nil {
+			slog.Warn(err.Error())
+		}
+	}
+	return run.err
+}
+
+// LocationHooks are shell commands run in the folder of a location around
+// its backup, e.g. to dump a database into it first. Their output is only
+// shown if they fail, the progress view owns the terminal.
+type LocationHooks struct {
+	Pre  string `yaml:"pre"`  // Fails the location if it fails, e.g. "pg_dump mydb > dump.sql"
+	Post string `yaml:"post"` // Runs once the location is done, also if it failed
+}
+
+// run runs the pre or post hook of a location in its expanded path, with
+// MACUP_LOCATION and MACUP_LOCATION_PATH and, after the backup, MACUP_STATUS
+// in its environment
+func (h LocationHooks) run(hook, label, dir string, failed error) error {
+	command := h.Pre
+	if hook == "post" {
+		command = h.Post
+	}
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+	slog.Debug("Running location hook", "location", label, "hook", hook)
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "MACUP_HOOK="+hook, "MACUP_LOCATION="+label, "MACUP_LOCATION_PATH="+dir)
+	if hook == "post" {
+		status := "success"
+		if failed != nil {
+			status = "failure"
+		}
+		cmd.Env = append(cmd.Env, "MACUP_STATUS="+status)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if lines := strings.Split(strings.TrimSpace(string(out)), "\n"); lines[0] != "" {
+			return fmt.Errorf("%s hook failed: %s", hook, strings.TrimSpace(lines[len(lines)-1]))
+		}
+		return fmt.Errorf("%s hook failed: %w", hook, err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package macup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreFile holds gitignore style patterns for the directory it is in
+const ignoreFile = ".macupignore"
+
+// defaultExcludes are left out of every location unless use_default_excludes
+// is turned off. node_modules isn't among them, some projects need theirs
+// restored as is, add it to exclude instead.
+var defaultExcludes = []string{".DS_Store", "*.swp", "Caches", ".Trash", ".Trashes"}
+
+// excludes returns the patterns applied to every location. The patterns of a
+// location come after them, so it can include files again with "!".
+func (c *Config) excludes() []string {
+	excludes := make([]string, 0, len(defaultExcludes)+len(c.Exclude))
+	if c.DefaultExcludes {
+		excludes = append(excludes, defaultExcludes...)
+	}
+	return append(excludes, c.Exclude...)
+}
+
+// ignorePattern is a single gitignore style pattern
+type ignorePattern struct {
+	text     string   // The pattern as written, e.g. "**/node_modules"
+	segments []string // Glob per path segment, "**" matches any number of segments
+	negate   bool     // Re-includes what earlier patterns excluded
+	dirOnly  bool     // Only matches directories
+}
+
+// ignoreRules are gitignore style patterns. Like in git, the last matching
+// pattern decides and nothing inside an excluded directory can be included
+// again, since the directory isn't walked.
+type ignoreRules []ignorePattern
+
+// parseIgnore compiles gitignore style patterns, e.g. "node_modules",
+// "**/build/", "/notes/*.txt" or "!keep.log". Blank lines and comments
+// starting with # are skipped.
+func parseIgnore(patterns []string) ignoreRules {
+	rules := make(ignoreRules, 0, len(patterns))
+	for _, pattern := range patterns {
+		if p, ok := parsePattern(pattern); ok {
+			rules = append(rules, p)
+		}
+	}
+	return rules
+}
+
+// parsePattern compiles a single pattern
+func parsePattern(pattern string) (ignorePattern, bool) {
+	// Trailing spaces are ignored unless escaped
+	if !strings.HasSuffix(pattern, `\ `) {
+		pattern = strings.TrimRight(pattern, " \t")
+	}
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return ignorePattern{}, false
+	}
+
+	p := ignorePattern{text: pattern}
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return ignorePattern{}, false
+	}
+
+	// Patterns without a slash match at any depth, others relative to the root
+	if !strings.Contains(pattern, "/") {
+		p.segments = []string{"**", pattern}
+	} else {
+		p.segments = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	}
+	return p, true
+}
+
+// load adds the patterns of an ignore file in the directory base, relative to
+// the location. They only apply inside that directory and win over the
+// patterns of its parents. A missing file adds nothing.
+func (r ignoreRules) load(file, base string) (ignoreRules, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	defer f.Close()
+
+	// Directory names are matched literally
+	var prefix []string
+	if base != "." {
+		escape := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+		prefix = strings.Split(escape.Replace(base), "/")
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := parsePattern(scanner.Text()); ok {
+			p.segments = append(append([]string{}, prefix...), p.segments...)
+			p.text = path.Join(base, ignoreFile) + ": " + p.text
+			r = append(r, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return r, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return r, nil
+}
+
+// includes reports whether a file or one of its directories matches the
+// patterns, when they are used as include patterns
+func (r ignoreRules) includes(rel string) bool {
+	if r.ignored(rel, false) {
+		return true
+	}
+	for i := range strings.Count(rel, "/") {
+		if dir := strings.Join(strings.Split(rel, "/")[:i+1], "/"); r.ignored(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored reports whether a path, relative to the location and separated by
+// slashes, is excluded
+func (r ignoreRules) ignored(rel string, dir bool) bool {
+	_, ignored := r.match(rel, dir)
+	return ignored
+}
+
+// match returns the pattern deciding about a path and whether it excludes it
+func (r ignoreRules) match(rel string, dir bool) (string, bool) {
+	segments := strings.Split(rel, "/")
+	pattern, ignored := "", false
+	for _, p := range r {
+		if p.dirOnly && !dir {
+			continue
+		}
+		if matchSegments(p.segments, segments) {
+			pattern, ignored = p.text, !p.negate
+		}
+	}
+	return pattern, ignored
+}
+
+// matchSegments matches path segments against the globs of a pattern
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// A trailing "**" matches everything inside, but not the directory itself
+			if len(pattern) == 1 {
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
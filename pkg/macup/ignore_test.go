@@ -0,0 +1,91 @@
+package macup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		dir      bool
+		want     bool
+	}{
+		{"name at the root", []string{"node_modules"}, "node_modules", true, true},
+		{"name at any depth", []string{"node_modules"}, "web/app/node_modules", true, true},
+		{"name is a whole segment", []string{"node_modules"}, "web/node_modules_old", true, false},
+		{"glob in a segment", []string{"*.log"}, "logs/build.log", false, true},
+		{"glob doesn't cross slashes", []string{"logs/*.log"}, "logs/old/build.log", false, false},
+		{"anchored to the root", []string{"/build"}, "build", true, true},
+		{"anchored isn't nested", []string{"/build"}, "web/build", true, false},
+		{"slash inside anchors", []string{"notes/*.txt"}, "notes/a.txt", false, true},
+		{"slash inside anchors, nested", []string{"notes/*.txt"}, "old/notes/a.txt", false, false},
+		{"leading ** at the root", []string{"**/build"}, "build", true, true},
+		{"leading ** nested", []string{"**/build"}, "a/b/build", true, true},
+		{"middle ** matches no segments", []string{"a/**/b"}, "a/b", true, true},
+		{"middle ** matches many segments", []string{"a/**/b"}, "a/x/y/b", true, true},
+		{"trailing ** matches inside", []string{"cache/**"}, "cache/x/y", false, true},
+		{"trailing ** not the directory itself", []string{"cache/**"}, "cache", true, false},
+		{"dir-only matches directories", []string{"build/"}, "web/build", true, true},
+		{"dir-only skips files", []string{"build/"}, "web/build", false, false},
+		{"negation includes again", []string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{"negation leaves the others", []string{"*.log", "!keep.log"}, "other.log", false, true},
+		{"last match decides", []string{"!keep.log", "*.log"}, "keep.log", false, true},
+		{"escaped ! is literal", []string{`\!important`}, "!important", false, true},
+		{"escaped # is literal", []string{`\#notes`}, "#notes", false, true},
+		{"comments are skipped", []string{"# notes"}, "# notes", false, false},
+		{"trailing spaces are trimmed", []string{"notes.txt  "}, "notes.txt", false, true},
+		{"escaped trailing space is kept", []string{`notes\ `}, "notes ", false, true},
+		{"no patterns", nil, "anything", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseIgnore(tt.patterns).ignored(tt.path, tt.dir); got != tt.want {
+				t.Errorf("%q ignored(%q, %v) = %v, want %v", tt.patterns, tt.path, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, ignoreFile)
+	if err := os.WriteFile(file, []byte("# nested rules\nbuild/\n/local.txt\n!keep.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The parent excludes logs, the nested file of web/a*b includes one again
+	rules, err := parseIgnore([]string{"*.log"}).load(file, "web/a*b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		dir  bool
+		want bool
+	}{
+		{"web/a*b/build", true, true},
+		{"web/a*b/src/build", true, true},
+		{"web/build", true, false},
+		{"web/a*b/local.txt", false, true},
+		{"web/a*b/src/local.txt", false, false},
+		{"web/a*b/keep.log", false, false},
+		{"web/a*b/other.log", false, true},
+		{"keep.log", false, true},
+		{"web/axb/build", true, false}, // Directory names match literally
+	}
+	for _, tt := range tests {
+		if got := rules.ignored(tt.path, tt.dir); got != tt.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+
+	// A directory without an ignore file adds nothing
+	if rules, err := parseIgnore(nil).load(filepath.Join(dir, "missing", ignoreFile), "missing"); err != nil || len(rules) != 0 {
+		t.Errorf("load() of a missing file = %v, %v, want no rules", rules, err)
+	}
+}
@@ -0,0 +1,233 @@
+package macup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// configSource is a config file with the files it includes merged in.
+// Included files are merged in the listed order, then the config file itself,
+// so it has the last word: maps are merged, lists are appended and other
+// values replace those of earlier files.
+type configSource struct {
+	raw      []byte                // The config file as written
+	format   string                // Format of the config file, see configFormats
+	root     *yaml.Node            // Top-level mapping of the merged config, without the include key
+	files    map[*yaml.Node]string // Included file of each node, relative to the config file
+	overlays []overlay             // Profiles and hosts blocks, including those that don't apply
+	profile  string                // The applied profile
+	merged   bool                  // The config differs from the file as written
+}
+
+// bytes returns the merged config as YAML
+func (s *configSource) bytes() ([]byte, error) {
+	if !s.merged && s.format != "toml" {
+		return s.raw, nil
+	}
+	return encodeNode("yaml", s.root)
+}
+
+// loadSource reads a config file and merges the files listed in its include
+// key, e.g. "locations.d/*.yaml". Patterns are relative to the config file.
+func loadSource(path string) (*configSource, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseNode(configFormat(path), raw)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &configSource{raw: raw, format: configFormat(path), root: root, files: make(map[*yaml.Node]string)}
+	i := mappingIndex(root, "include")
+	if i < 0 {
+		return src, nil
+	}
+	includes := root.Content[i+1]
+	root.Content = slices.Delete(root.Content, i, i+2)
+	src.merged = true
+
+	// Single files may be given without a list
+	patterns := []*yaml.Node{includes}
+	if includes.Kind == yaml.SequenceNode {
+		patterns = includes.Content
+	}
+
+	dir := filepath.Dir(path)
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, pattern := range patterns {
+		files, err := includeFiles(pattern.Value, dir)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: include: %w", pattern.Line, err)
+		}
+		for _, file := range files {
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				rel = file
+			}
+			source, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read included %s: %w", rel, err)
+			}
+			node, err := parseNode(configFormat(file), source)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", rel, err)
+			}
+			if key := mappingKey(node, "include"); key != nil {
+				return nil, fmt.Errorf("line %d of %s: include: only the main config file can include files", key.Line, rel)
+			}
+			markFile(node, rel, src.files)
+			merged = mergeNode(merged, node)
+		}
+	}
+	src.root = mergeNode(merged, root)
+
+	return src, nil
+}
+
+// parseNode parses a config in a format of configFormats and returns the
+// top-level mapping, which is empty for an empty file. TOML files have no
+// line numbers, they are decoded and converted.
+func parseNode(format string, source []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if format == "toml" {
+		var values map[string]any
+		if err := toml.Unmarshal(source, &values); err != nil {
+			return nil, err
+		}
+		var node yaml.Node
+		if err := node.Encode(values); err != nil {
+			return nil, err
+		}
+		doc.Content = []*yaml.Node{&node}
+	} else if err := yaml.Unmarshal(source, &doc); err != nil {
+		// JSON is parsed as YAML, which it is a subset of
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of config keys", doc.Content[0].Line)
+	}
+	return doc.Content[0], nil
+}
+
+// encodeNode writes a config mapping in a format of configFormats
+func encodeNode(format string, node *yaml.Node) ([]byte, error) {
+	switch format {
+	case "json", "toml":
+		var values map[string]any
+		if err := node.Decode(&values); err != nil {
+			return nil, err
+		}
+		if format == "toml" {
+			return toml.Marshal(values)
+		}
+		source, err := json.MarshalIndent(values, "", "  ")
+		return append(source, '\n'), err
+	default:
+		var b bytes.Buffer
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err := enc.Encode(node); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), enc.Close()
+	}
+}
+
+// includeFiles returns the files matching an include pattern in name order.
+// A pattern without wildcards must match an existing file.
+func includeFiles(pattern, dir string) ([]string, error) {
+	pattern, err := expandEnv(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if pattern != "~" && !strings.HasPrefix(pattern, "~/") && !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	if pattern, err = NormalizePath(pattern); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+	if len(files) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		return nil, fmt.Errorf("%s doesn't exist", pattern)
+	}
+	return files, nil
+}
+
+// mergeNode merges src into dst and returns the result. Mappings are merged
+// by key, sequences are appended and other values are replaced by src.
+func mergeNode(dst, src *yaml.Node) *yaml.Node {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			j := mappingIndex(dst, key.Value)
+			if j < 0 {
+				dst.Content = append(dst.Content, key, value)
+				continue
+			}
+			merged := mergeNode(dst.Content[j+1], value)
+			if merged == value {
+				// Replaced values are reported at the key of the file they came from
+				dst.Content[j] = key
+			}
+			dst.Content[j+1] = merged
+		}
+		return dst
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode:
+		dst.Content = append(dst.Content, src.Content...)
+		return dst
+	default:
+		return src
+	}
+}
+
+// mappingIndex returns the index of a key in a mapping node, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingKey returns the key node of a key in a mapping node, or nil
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(node, key); i >= 0 {
+		return node.Content[i]
+	}
+	return nil
+}
+
+// mappingValue returns the value node of a key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(node, key); i >= 0 {
+		return node.Content[i+1]
+	}
+	return nil
+}
+
+// markFile records the included file of a node and everything below it
+func markFile(node *yaml.Node, file string, files map[*yaml.Node]string) {
+	files[node] = file
+	for _, child := range node.Content {
+		markFile(child, file, files)
+	}
+}
@@ -0,0 +1,93 @@
+package macup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files below a directory, creating their parents
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": "include: [locations.d/*.yaml, retries.yaml]\n" +
+			"retries: 3\n" +
+			"data:\n  locations:\n    - path: /main\n",
+		"locations.d/a.yaml": "data:\n  locations:\n    - path: /a\n",
+		"locations.d/b.yaml": "verify: true\ndata:\n  locations:\n    - path: /b\n",
+		"retries.yaml":       "retries: 1\nexclude: ['*.log']\n",
+	})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() = %v", err)
+	}
+
+	// Lists are appended in the listed order, the config file itself last
+	var paths []string
+	for _, loc := range cfg.Data.Locations {
+		paths = append(paths, loc.Path)
+	}
+	if want := []string{"/a", "/b", "/main"}; !slices.Equal(paths, want) {
+		t.Errorf("locations = %v, want %v", paths, want)
+	}
+	// Values only set by includes are kept, the config file has the last word
+	if !cfg.Verify || cfg.Retries != 3 || !slices.Equal(cfg.Exclude, []string{"*.log"}) {
+		t.Errorf("verify = %v, retries = %d, exclude = %v, want true, 3 and [*.log]", cfg.Verify, cfg.Retries, cfg.Exclude)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "problem in an included file",
+			files: map[string]string{"config.yaml": "include: extra.yaml", "extra.yaml": "verify: true\nretires: 1"},
+			want:  "line 2 of extra.yaml: retires: unknown key",
+		},
+		{
+			name:  "nested include",
+			files: map[string]string{"config.yaml": "include: extra.yaml", "extra.yaml": "include: more.yaml", "more.yaml": ""},
+			want:  "line 1 of extra.yaml: include: only the main config file can include files",
+		},
+		{
+			name:  "missing file",
+			files: map[string]string{"config.yaml": "verify: true\ninclude: [missing.yaml]"},
+			want:  "line 2: include:",
+		},
+		{
+			name:  "pattern without matches",
+			files: map[string]string{"config.yaml": "include: [locations.d/*.yaml]\nretries: -1"},
+			want:  "line 2: retries: must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			_, err := LoadConfig(filepath.Join(dir, "config.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package macup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// devIgnore are patterns worth leaving out of development folders, they are
+// rebuilt from the sources
+var devIgnore = []string{"node_modules", ".venv", "target", "build/", ".build/", "DerivedData"}
+
+// InitOptions are the answers of `macup init`
+type InitOptions struct {
+	Locations    []string // e.g. "~/Documents"
+	DevLocations []string // Locations with source code, they get devIgnore
+	Output       string   // Path, URL or rclone remote
+	OutputVolume string   // Name of an external volume, used instead of Output
+	Presets      []string
+	Homebrew     bool
+	Mas          bool
+	VSCode       bool
+	SSH          bool
+	Fonts        bool
+}
+
+// RenderConfig writes a commented config from the answers of `macup init`
+func RenderConfig(opts InitOptions) []byte {
+	var b strings.Builder
+	b.WriteString("# macup config, check it with `macup config validate` after editing\n")
+	fmt.Fprintf(&b, "version: %d\n\n", configVersion)
+
+	if opts.OutputVolume != "" {
+		b.WriteString("# External volume, backups go to /Volumes/<name>/macup\n")
+		fmt.Fprintf(&b, "output_volume: %q\n", opts.OutputVolume)
+		b.WriteString("eject_after: true\n\n")
+	} else {
+		b.WriteString("# Where backups go: a path, an s3://, https://, webdav:// or sftp:// URL, or an\n")
+		b.WriteString("# rclone remote. List several targets to write every backup to all of them.\n")
+		fmt.Fprintf(&b, "output:\n  - %q\n\n", opts.Output)
+	}
+
+	b.WriteString("# Skip locations that didn't change since the last backup\n")
+	b.WriteString("skip_unchanged: true\n\n")
+
+	b.WriteString("# Directories to back up. ignore takes gitignore style patterns, e.g. \"*.log\"\n")
+	b.WriteString("data:\n  locations:\n")
+	if len(opts.Locations)+len(opts.DevLocations) == 0 {
+		b.WriteString("    # - path: ~/Documents\n")
+	}
+	for _, path := range opts.Locations {
+		fmt.Fprintf(&b, "    - path: %q\n", path)
+	}
+	for _, path := range opts.DevLocations {
+		fmt.Fprintf(&b, "    - path: %q\n", path)
+		fmt.Fprintf(&b, "      ignore: [%s]\n", quoteAll(devIgnore))
+		b.WriteString("      # git_mode: remotes  # Re-clone repositories instead of archiving them\n")
+	}
+	b.WriteString("\n")
+
+	b.WriteString("# Setup of apps, restored on the new Mac\n")
+	b.WriteString("apps:\n")
+	if len(opts.Presets) > 0 {
+		b.WriteString("  # Settings of popular apps, `macup apps scan` suggests more\n")
+		fmt.Fprintf(&b, "  presets: [%s]\n", quoteAll(opts.Presets))
+	}
+	modules := []struct {
+		name    string
+		comment string
+		enabled bool
+	}{
+		{"homebrew", "Taps, formulae and casks, reinstalled from a Brewfile", opts.Homebrew},
+		{"mas", "App Store apps", opts.Mas},
+		{"vscode", "VS Code settings, keybindings and extensions", opts.VSCode},
+		{"ssh", "SSH config, known hosts and keys", opts.SSH},
+	}
+	for _, m := range modules {
+		fmt.Fprintf(&b, "  %s:  # %s\n    enabled: %t\n", m.name, m.comment, m.enabled)
+	}
+	b.WriteString("\n")
+
+	b.WriteString("# Fonts in ~/Library/Fonts\n")
+	fmt.Fprintf(&b, "fonts: %t\n", opts.Fonts)
+
+	return []byte(b.String())
+}
+
+// quoteAll quotes strings for a YAML flow sequence
+func quoteAll(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,130 @@
+package macup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// metadataPrefix namespaces the PAX records macup embeds in its archives
+const metadataPrefix = "MACUP."
+
+// ageHeader starts files encrypted with age, e.g. archives encrypted by hand
+// before they were handed around
+var ageHeader = []byte("age-encryption.org/")
+
+// ArchiveMetadata is embedded at the start of every location archive as a PAX
+// global header, so a bare archive still tells where it came from. Tar tools
+// ignore it.
+type ArchiveMetadata struct {
+	Location  string    `json:"location"`       // Path as written in the config
+	Name      string    `json:"name,omitempty"` // Name of the location, if it has one
+	Source    string    `json:"source"`         // Expanded path the archive was created from
+	Hostname  string    `json:"hostname"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ArchiveInspection is what `macup inspect` reports about an archive file
+type ArchiveInspection struct {
+	Path             string           `json:"path"`
+	Compression      string           `json:"compression"` // "gzip", "zstd" or "none", empty if encrypted
+	Encrypted        bool             `json:"encrypted"`
+	Files            int              `json:"files"`
+	Dirs             int              `json:"dirs"`
+	Symlinks         int              `json:"symlinks"`
+	CompressedSize   int64            `json:"compressed_size"`
+	UncompressedSize int64            `json:"uncompressed_size"`  // Size of the files it contains
+	Metadata         *ArchiveMetadata `json:"metadata,omitempty"` // nil for archives of older versions
+}
+
+// writeMetadata embeds the metadata of a location into its archive
+func writeMetadata(w *ArchiveWriter, m ArchiveMetadata) error {
+	records := map[string]string{
+		metadataPrefix + "location":   m.Location,
+		metadataPrefix + "source":     m.Source,
+		metadataPrefix + "hostname":   m.Hostname,
+		metadataPrefix + "created_at": m.CreatedAt.Format(time.RFC3339),
+	}
+	if m.Name != "" {
+		records[metadataPrefix+"name"] = m.Name
+	}
+	return w.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, PAXRecords: records})
+}
+
+// readMetadata returns the metadata of a PAX global header, or nil if the
+// header wasn't written by macup
+func readMetadata(header *tar.Header) *ArchiveMetadata {
+	location, ok := header.PAXRecords[metadataPrefix+"location"]
+	if !ok {
+		return nil
+	}
+	createdAt, _ := time.Parse(time.RFC3339, header.PAXRecords[metadataPrefix+"created_at"])
+	return &ArchiveMetadata{
+		Location:  location,
+		Name:      header.PAXRecords[metadataPrefix+"name"],
+		Source:    header.PAXRecords[metadataPrefix+"source"],
+		Hostname:  header.PAXRecords[metadataPrefix+"hostname"],
+		CreatedAt: createdAt,
+	}
+}
+
+// Inspect reads an archive file without extracting it. The compression is
+// told by the contents rather than the name, so renamed archives work too.
+// Encrypted archives are only recognized, their contents can't be read.
+func Inspect(path string) (*ArchiveInspection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	inspection := &ArchiveInspection{Path: path, CompressedSize: info.Size()}
+
+	r := bufio.NewReader(file)
+	magic, _ := r.Peek(len(ageHeader))
+	switch {
+	case bytes.HasPrefix(magic, ageHeader):
+		inspection.Encrypted = true
+		return inspection, nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		inspection.Compression = compressionGzip
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		inspection.Compression = compressionZstd
+	default:
+		inspection.Compression = compressionNone
+	}
+
+	entries, err := newEntryReader(compression{format: inspection.Compression}.extension(), r)
+	if err != nil {
+		return nil, err
+	}
+	defer entries.Close()
+
+	for {
+		header, err := entries.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s, it is no archive or damaged: %w", path, err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			inspection.Dirs++
+		case tar.TypeSymlink:
+			inspection.Symlinks++
+		default:
+			inspection.Files++
+			inspection.UncompressedSize += header.Size
+		}
+	}
+	inspection.Metadata = entries.Metadata
+	return inspection, nil
+}
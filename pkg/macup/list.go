@@ -0,0 +1,153 @@
+package macup
+
+import (
+	"archive/tar"
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// ArchiveInfo describes an archive of a backup
+type ArchiveInfo struct {
+	Archive  string   `json:"archive"`
+	Location string   `json:"location,omitempty"` // Name or path of the location, "dotfiles" for the dotfiles
+	Size     int64    `json:"size"`
+	Output   []string `json:"output,omitempty"` // Targets holding the archive instead of the backup
+}
+
+// FileInfo is an entry of an archive
+type FileInfo struct {
+	Archive string    `json:"archive"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Type    string    `json:"type"`           // "file", "dir" or "symlink"
+	Link    string    `json:"link,omitempty"` // Target of a symlink
+}
+
+// ListArchives returns the archives of a backup. Backups without a manifest
+// list the archives found in the storage. Remote credentials come from opts,
+// or else the environment.
+func ListArchives(backupDir string, opts StorageOptions) ([]ArchiveInfo, error) {
+	store, manifest, err := openBackup(backupDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return listArchives(store, manifest)
+}
+
+// listArchives returns the archives of a backup from its manifest, or else
+// from the storage
+func listArchives(store storage.Storage, manifest *Manifest) ([]ArchiveInfo, error) {
+	if manifest != nil {
+		var archives []ArchiveInfo
+		for _, loc := range manifest.Locations {
+			archives = append(archives, ArchiveInfo{Archive: loc.Archive, Location: cmp.Or(loc.Name, loc.Path), Size: loc.Size, Output: loc.Output})
+		}
+		if manifest.Dotfiles != nil {
+			archives = append(archives, ArchiveInfo{Archive: dotfilesArchive, Location: "dotfiles", Size: manifest.Dotfiles.Size})
+		}
+		return archives, nil
+	}
+
+	names, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup: %w", err)
+	}
+	var archives []ArchiveInfo
+	for _, name := range joinParts(names) {
+		if !isArchive(name) {
+			continue
+		}
+		size, err := statArchive(store, name)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, ArchiveInfo{Archive: name, Size: size})
+	}
+	return archives, nil
+}
+
+// isArchive reports whether an object name is that of a tar archive
+func isArchive(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar.zst") || strings.HasSuffix(name, ".tar")
+}
+
+// ListFiles reads the entries of an archive, given by its name or the name or
+// path of its location, and passes them to fn without extracting anything
+func ListFiles(backupDir, archive string, opts StorageOptions, fn func(FileInfo) error) error {
+	store, manifest, err := openBackup(backupDir, opts)
+	if err != nil {
+		return err
+	}
+	archives, err := listArchives(store, manifest)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(archives, func(a ArchiveInfo) bool {
+		return a.Archive == archive || strings.EqualFold(a.Location, archive)
+	})
+	if i < 0 {
+		return fmt.Errorf("the backup has no archive %s", archive)
+	}
+	return listEntries(store, archives[i], opts, fn)
+}
+
+// listEntries reads the entries of an archive of a backup and passes them to
+// fn. Archives in other outputs are opened with opts.
+func listEntries(store storage.Storage, archive ArchiveInfo, opts storage.Options, fn func(FileInfo) error) error {
+	store, err := archiveStore(archive.Output, archive.Archive, store, opts)
+	if err != nil {
+		return err
+	}
+	r, err := openArchive(store, archive.Archive)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer r.Close()
+	entries, err := newEntryReader(archive.Archive, r)
+	if err != nil {
+		return err
+	}
+	defer entries.Close()
+
+	for {
+		header, err := entries.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		file := FileInfo{Archive: archive.Archive, Name: header.Name, Size: header.Size, ModTime: header.ModTime.UTC(), Type: "file"}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			file.Type = "dir"
+		case tar.TypeSymlink:
+			file.Type, file.Link = "symlink", header.Linkname
+		}
+		if err := fn(file); err != nil {
+			return err
+		}
+	}
+}
+
+// openBackup opens the storage of a backup and reads its manifest, which is
+// nil for backups of older versions
+func openBackup(backupDir string, opts storage.Options) (storage.Storage, *Manifest, error) {
+	store, err := storage.New(backupDir, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	manifest, err := readManifest(store)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return store, manifest, nil
+}
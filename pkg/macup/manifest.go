@@ -0,0 +1,155 @@
+package macup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// manifestName is the name of the manifest object inside a backup
+const manifestName = "manifest.json"
+
+// Manifest describes the contents of a backup
+type Manifest struct {
+	CreatedAt    time.Time           `json:"created_at"`
+	Hostname     string              `json:"hostname"`
+	Profile      string              `json:"profile,omitempty"`       // Config profile the backup was created with
+	Config       string              `json:"config,omitempty"`        // Name of the bundled config, config.yaml if empty
+	ConfigOrigin *ConfigOrigin       `json:"config_origin,omitempty"` // Remote config the backup was created with
+	Locations    []ManifestLocation  `json:"locations"`
+	Dotfiles     *ManifestLocation   `json:"dotfiles,omitempty"`  // Archive of the dotfiles, if configured
+	AppStore     []AppStoreApp       `json:"app_store,omitempty"` // Apps installed from the Mac App Store
+	Packages     map[string][]string `json:"packages,omitempty"`  // Global packages by package manager
+	Browsers     map[string][]string `json:"browsers,omitempty"`  // Extensions of the backed up browsers
+	Runtimes     []Runtime           `json:"runtimes,omitempty"`  // Versions installed with version managers
+	Mail         []MailAccount       `json:"mail,omitempty"`      // Accounts set up in Mail
+	Docker       *DockerState        `json:"docker,omitempty"`    // Pulled images and exported volumes
+}
+
+// ManifestLocation describes the archive of a single location
+type ManifestLocation struct {
+	Name        string      `json:"name,omitempty"` // Name of the location, if it has one
+	Path        string      `json:"path"`           // Path as written in the config
+	Archive     string      `json:"archive"`
+	Size        int64       `json:"size"`   // Compressed archive size
+	SHA256      string      `json:"sha256"` // Checksum of the compressed archive
+	Fingerprint Fingerprint `json:"fingerprint"`
+	Repos       []GitRepo   `json:"repos,omitempty"`   // Repositories to clone instead of extracting
+	Output      []string    `json:"output,omitempty"`  // Targets of a location with an output of its own
+	BackedUpAt  time.Time   `json:"backed_up_at"`      // Last run the archive was created or found unchanged in
+	Skipped     []string    `json:"skipped,omitempty"` // Files left out of the archive, e.g. since they couldn't be read
+}
+
+// Fingerprint is a cheap summary of a location's contents. If it is unchanged
+// between two runs, the location is considered unchanged as well.
+type Fingerprint struct {
+	MaxModTime time.Time `json:"max_mod_time"`
+	Entries    int       `json:"entries"`
+	Size       int64     `json:"size"`
+}
+
+// newManifest creates an empty manifest for the current machine
+func newManifest() *Manifest {
+	hostname, _ := os.Hostname()
+	return &Manifest{
+		CreatedAt: time.Now().UTC(),
+		Hostname:  hostname,
+		Locations: make([]ManifestLocation, 0),
+	}
+}
+
+// carryOver starts the manifest of a new run from this one, keeping the
+// entries of modules the run leaves out
+func (m *Manifest) carryOver() *Manifest {
+	next := newManifest()
+	if m == nil {
+		return next
+	}
+	carried := *m
+	carried.CreatedAt, carried.Hostname = next.CreatedAt, next.Hostname
+	return &carried
+}
+
+// readManifest loads the manifest of a backup. A missing manifest (e.g. in a
+// fresh output or a backup made by an older version) yields nil without error.
+func readManifest(store storage.Storage) (*Manifest, error) {
+	r, err := store.Open(manifestName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	return &m, nil
+}
+
+// writeManifest stores the manifest in the backup
+func writeManifest(store storage.Storage, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	w, err := store.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+
+	return w.Close()
+}
+
+// location returns the manifest entry for a configured location path
+func (m *Manifest) location(path string) (ManifestLocation, bool) {
+	if m == nil {
+		return ManifestLocation{}, false
+	}
+	for _, loc := range m.Locations {
+		if loc.Path == path {
+			return loc, true
+		}
+	}
+	return ManifestLocation{}, false
+}
+
+// archives returns the entries of all archives in the backup
+func (m *Manifest) archives() []ManifestLocation {
+	if m == nil {
+		return nil
+	}
+	if m.Dotfiles == nil {
+		return m.Locations
+	}
+	return append(slices.Clone(m.Locations), *m.Dotfiles)
+}
+
+// archive returns the manifest entry for an archive name
+func (m *Manifest) archive(name string) (ManifestLocation, bool) {
+	for _, loc := range m.archives() {
+		if loc.Archive == name {
+			return loc, true
+		}
+	}
+	return ManifestLocation{}, false
+}
+
+// equal reports whether two fingerprints describe the same contents
+func (f Fingerprint) equal(other Fingerprint) bool {
+	return f.MaxModTime.Equal(other.MaxModTime) && f.Entries == other.Entries && f.Size == other.Size
+}
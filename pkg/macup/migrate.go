@@ -0,0 +1,217 @@
+package macup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// configVersion is the version of the config format this macup reads. Configs
+// without a version are version 1, older versions are upgraded when loaded.
+const configVersion = 2
+
+// migrations upgrade a config mapping by one version, migrations[0] from
+// version 1 to 2. They return what they changed, with keys below prefix.
+var migrations = []func(node *yaml.Node, prefix string) []string{
+	migrateV2,
+}
+
+// migrateV2 turns a single output target into a list and renames
+// data.location, which the first versions documented, to data.locations
+func migrateV2(node *yaml.Node, prefix string) []string {
+	var changes []string
+	if output := mappingValue(node, "output"); output != nil && output.Kind == yaml.ScalarNode {
+		target := *output
+		*output = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: target.Line, Column: target.Column, Content: []*yaml.Node{&target}}
+		changes = append(changes, prefix+"output: the single target became a list")
+	}
+	if data := mappingValue(node, "data"); data != nil && data.Kind == yaml.MappingNode {
+		if i := mappingIndex(data, "location"); i >= 0 {
+			if locations := mappingValue(data, "locations"); locations != nil && locations.Kind == yaml.SequenceNode {
+				locations.Content = append(locations.Content, data.Content[i+1].Content...)
+				data.Content = append(data.Content[:i], data.Content[i+2:]...)
+				changes = append(changes, prefix+"data.location: merged into data.locations")
+			} else {
+				data.Content[i].Value = "locations"
+				changes = append(changes, prefix+"data.location: renamed to data.locations")
+			}
+		}
+	}
+	return changes
+}
+
+// versionOf returns the version of a config mapping
+func versionOf(root *yaml.Node) (int, error) {
+	node := mappingValue(root, "version")
+	if node == nil {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(node.Value)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("line %d: version: invalid version %q", node.Line, node.Value)
+	}
+	if version > configVersion {
+		return 0, fmt.Errorf("line %d: version: config version %d is newer than this macup reads (%d), please update macup", node.Line, version, configVersion)
+	}
+	return version, nil
+}
+
+// migrateConfig upgrades a config mapping and its profiles and hosts blocks
+// from a version to the current one, and returns what changed. The version
+// key is left to the caller, included files have none.
+func migrateConfig(root *yaml.Node, from int) []string {
+	var changes []string
+	for version := from; version < configVersion; version++ {
+		migrate := migrations[version-1]
+		changes = append(changes, migrate(root, "")...)
+		for _, key := range []string{"profiles", "hosts"} {
+			block := mappingValue(root, key)
+			if block == nil || block.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 0; i+1 < len(block.Content); i += 2 {
+				if block.Content[i+1].Kind == yaml.MappingNode {
+					changes = append(changes, migrate(block.Content[i+1], key+"."+block.Content[i].Value+".")...)
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// setVersion sets the version of a config mapping to the current one, a new
+// version key goes first
+func setVersion(root *yaml.Node) {
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(configVersion)}
+	if i := mappingIndex(root, "version"); i >= 0 {
+		root.Content[i+1] = value
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	root.Content = append([]*yaml.Node{key, value}, root.Content...)
+}
+
+// migrate upgrades the merged config and returns the version it had and
+// what changed
+func (s *configSource) migrate() (int, []string, error) {
+	from, err := versionOf(s.root)
+	if err != nil {
+		return 0, nil, err
+	}
+	changes := migrateConfig(s.root, from)
+	if len(changes) > 0 {
+		setVersion(s.root)
+		s.merged = true
+	}
+	return from, changes, nil
+}
+
+// MigrateFile upgrades a config file and the files it includes to the current
+// version in place and returns what changed. The old files are kept with a
+// .bak suffix.
+func MigrateFile(path string) ([]string, error) {
+	if IsRemoteConfig(path) {
+		return nil, fmt.Errorf("remote configs can't be migrated in place, migrate the file at its source")
+	}
+	path, err := NormalizePath(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseNode(configFormat(path), raw)
+	if err != nil {
+		return nil, err
+	}
+	from, err := versionOf(root)
+	if err != nil || from == configVersion {
+		return nil, err
+	}
+
+	// Included files are written in the version of the config including them
+	dir := filepath.Dir(path)
+	type file struct {
+		path string
+		root *yaml.Node
+	}
+	var included []file
+	if includes := mappingValue(root, "include"); includes != nil {
+		patterns := []*yaml.Node{includes}
+		if includes.Kind == yaml.SequenceNode {
+			patterns = includes.Content
+		}
+		for _, pattern := range patterns {
+			paths, err := includeFiles(pattern.Value, dir)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: include: %w", pattern.Line, err)
+			}
+			for _, p := range paths {
+				source, err := os.ReadFile(p)
+				if err != nil {
+					return nil, err
+				}
+				node, err := parseNode(configFormat(p), source)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", p, err)
+				}
+				included = append(included, file{p, node})
+			}
+		}
+	}
+
+	changes := migrateConfig(root, from)
+	setVersion(root)
+	changes = append(changes, fmt.Sprintf("version: set to %d", configVersion))
+	updates := []file{{path, root}}
+	for _, f := range included {
+		fileChanges := migrateConfig(f.root, from)
+		if len(fileChanges) == 0 {
+			continue
+		}
+		rel, err := filepath.Rel(dir, f.path)
+		if err != nil {
+			rel = f.path
+		}
+		for _, change := range fileChanges {
+			changes = append(changes, rel+": "+change)
+		}
+		updates = append(updates, f)
+	}
+
+	for _, f := range updates {
+		source, err := encodeNode(configFormat(f.path), f.root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", f.path, err)
+		}
+		if err := os.Rename(f.path, f.path+".bak"); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(f.path, source, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// printMigration tells what changed upgrading a config, followed by a hint
+// what to do about it if there is one
+func printMigration(name string, from int, changes []string, hint string) {
+	if len(changes) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("%s has config version %d, upgraded to %d:", name, from, configVersion)
+	for _, change := range changes {
+		msg += "\n  - " + change
+	}
+	if hint != "" {
+		msg += "\n  " + hint
+	}
+	slog.Warn(msg)
+}
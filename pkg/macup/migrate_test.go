@@ -0,0 +1,158 @@
+package macup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// decodeYAML decodes a config for comparing it regardless of formatting
+func decodeYAML(t *testing.T, node *yaml.Node) map[string]any {
+	t.Helper()
+	var values map[string]any
+	if err := node.Decode(&values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		changes []string
+	}{
+		{
+			name:    "scalar output becomes a list",
+			config:  "output: /Volumes/Backup",
+			want:    "output: [/Volumes/Backup]",
+			changes: []string{"output: the single target became a list"},
+		},
+		{
+			name:   "output list is kept",
+			config: "output: [/Volumes/Backup, s3://bucket]",
+			want:   "output: [/Volumes/Backup, s3://bucket]",
+		},
+		{
+			name:    "location is renamed",
+			config:  "data:\n  location:\n    - path: ~/Documents",
+			want:    "data:\n  locations:\n    - path: ~/Documents",
+			changes: []string{"data.location: renamed to data.locations"},
+		},
+		{
+			name:    "location is merged into locations",
+			config:  "data:\n  locations:\n    - path: ~/Projects\n  location:\n    - path: ~/Documents",
+			want:    "data:\n  locations:\n    - path: ~/Projects\n    - path: ~/Documents",
+			changes: []string{"data.location: merged into data.locations"},
+		},
+		{
+			name:   "profiles and hosts blocks",
+			config: "output: /Volumes/Backup\nprofiles:\n  work:\n    output: /Volumes/Work\n    data:\n      location: [{path: ~/Work}]\nhosts:\n  laptop:\n    output: s3://bucket",
+			want:   "output: [/Volumes/Backup]\nprofiles:\n  work:\n    output: [/Volumes/Work]\n    data:\n      locations: [{path: ~/Work}]\nhosts:\n  laptop:\n    output: [s3://bucket]",
+			changes: []string{
+				"output: the single target became a list",
+				"profiles.work.output: the single target became a list",
+				"profiles.work.data.location: renamed to data.locations",
+				"hosts.laptop.output: the single target became a list",
+			},
+		},
+		{
+			name:   "current config is unchanged",
+			config: "output: [/Volumes/Backup]\ndata:\n  locations:\n    - path: ~/Documents",
+			want:   "output: [/Volumes/Backup]\ndata:\n  locations:\n    - path: ~/Documents",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseNode("yaml", []byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := parseNode("yaml", []byte(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changes := migrateConfig(root, 1)
+			if !slices.Equal(changes, tt.changes) {
+				t.Errorf("changes = %q, want %q", changes, tt.changes)
+			}
+			if got, want := decodeYAML(t, root), decodeYAML(t, want); !reflect.DeepEqual(got, want) {
+				t.Errorf("migrated to %v, want %v", got, want)
+			}
+
+			// Configs of the current version are left alone
+			if changes := migrateConfig(root, configVersion); len(changes) > 0 {
+				t.Errorf("migrating the current version changed %q", changes)
+			}
+		})
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml":              "output: /Volumes/Backup\ninclude: [locations.d/*.yaml]\n",
+		"locations.d/work.yaml":    "data:\n  location:\n    - path: ~/Work\n",
+		"locations.d/current.yaml": "data:\n  locations:\n    - path: ~/Documents\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := MigrateFile(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatalf("MigrateFile() = %v", err)
+	}
+	want := []string{
+		"output: the single target became a list",
+		"version: set to 2",
+		filepath.Join("locations.d", "work.yaml") + ": data.location: renamed to data.locations",
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+
+	// Changed files are rewritten and backed up, the others left alone
+	expected := map[string]string{
+		"config.yaml":           "version: 2\noutput: [/Volumes/Backup]\ninclude: [locations.d/*.yaml]",
+		"locations.d/work.yaml": "data:\n  locations:\n    - path: ~/Work",
+	}
+	for name, content := range expected {
+		source, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseNode("yaml", source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := parseNode("yaml", []byte(content))
+		if !reflect.DeepEqual(decodeYAML(t, got), decodeYAML(t, want)) {
+			t.Errorf("%s = %s, want %s", name, source, content)
+		}
+		if backup, err := os.ReadFile(filepath.Join(dir, name+".bak")); err != nil || string(backup) != files[name] {
+			t.Errorf("%s.bak = %q, %v, want the old file", name, backup, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "locations.d/current.yaml.bak")); err == nil {
+		t.Errorf("unchanged include was backed up")
+	}
+
+	// A second run finds nothing to do
+	if changes, err := MigrateFile(filepath.Join(dir, "config.yaml")); err != nil || len(changes) > 0 {
+		t.Errorf("second MigrateFile() = %q, %v, want no changes", changes, err)
+	}
+}
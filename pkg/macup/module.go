@@ -0,0 +1,238 @@
+package macup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// appsGroup selects all app modules at once
+const appsGroup = "apps"
+
+// Module is a part of a backup that is created, restored and verified on its own
+type Module interface {
+	Name() string
+	Enabled(config *Config) bool // Whether the config asks for the module
+	Backup(job *Job) error
+	Restore(job *Job) error
+	Verify(job *Job) error // Checks the part of the backup written by the module
+}
+
+// Job is the state the modules of a run share
+type Job struct {
+	Config    *Config
+	Store     Storage
+	Manifest  *Manifest // Being written on backup, read from the backup otherwise
+	Options   RestoreOptions
+	Context   context.Context // Canceled e.g. by Ctrl+C, the run then stops cleanly
+	completed []string        // Modules and locations done, reported if the run is canceled
+}
+
+// ctx returns the context of the job, one that is never canceled if it has none
+func (j *Job) ctx() context.Context {
+	if j.Context == nil {
+		return context.Background()
+	}
+	return j.Context
+}
+
+// canceled returns the error of the canceled job with what it completed
+func (j *Job) canceled() error {
+	return &CanceledError{Completed: slices.Clone(j.completed)}
+}
+
+// CanceledError is returned when a run was canceled, e.g. with Ctrl+C
+type CanceledError struct {
+	Completed []string // Modules and locations done before
+}
+
+func (e *CanceledError) Error() string {
+	if len(e.Completed) == 0 {
+		return "canceled before anything was completed"
+	}
+	msg := "canceled, completed before:"
+	for _, done := range e.Completed {
+		msg += "\n  ✓ " + done
+	}
+	return msg
+}
+
+func (e *CanceledError) Unwrap() error {
+	return context.Canceled
+}
+
+// ModuleFilter selects the modules of a run by name, e.g. "data" or "homebrew".
+// "apps" stands for all app modules. An empty filter selects all of them.
+type ModuleFilter struct {
+	Only []string
+	Skip []string
+}
+
+// partial reports whether the filter leaves out modules
+func (f ModuleFilter) partial() bool {
+	return len(f.Only) > 0 || len(f.Skip) > 0
+}
+
+// modules are all modules in restore order: the data first, then the setup
+// of the apps on top of it
+var modules = append([]Module{dataModule{}, dotfilesModule{}}, appModules...)
+
+// ModuleNames returns the names the filter accepts
+func ModuleNames() []string {
+	names := make([]string, 0, len(modules)+1)
+	for _, m := range modules[:2] {
+		names = append(names, m.Name())
+	}
+	names = append(names, appsGroup)
+	for _, m := range appModules {
+		names = append(names, m.Name())
+	}
+	return names
+}
+
+// selectModules returns the modules enabled in the config and passing the
+// filter, in restore order
+func selectModules(config *Config, filter ModuleFilter) ([]Module, error) {
+	only, err := moduleSet(filter.Only)
+	if err != nil {
+		return nil, err
+	}
+	skip, err := moduleSet(filter.Skip)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]Module, 0, len(modules))
+	for _, m := range modules {
+		if !m.Enabled(config) || skip[m.Name()] || (len(only) > 0 && !only[m.Name()]) {
+			continue
+		}
+		selected = append(selected, m)
+	}
+	return selected, nil
+}
+
+// moduleSet resolves module names, expanding the apps group
+func moduleSet(names []string) (map[string]bool, error) {
+	set := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == appsGroup {
+			for _, m := range appModules {
+				set[m.Name()] = true
+			}
+			continue
+		}
+		if !slices.ContainsFunc(modules, func(m Module) bool { return m.Name() == name }) {
+			return nil, fmt.Errorf("unknown module %q, available are %s", name, strings.Join(ModuleNames(), ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// hasModule reports whether a module is among the selected ones
+func hasModule(selected []Module, name string) bool {
+	return slices.ContainsFunc(selected, func(m Module) bool { return m.Name() == name })
+}
+
+// dataModule archives the data locations
+type dataModule struct{}
+
+func (dataModule) Name() string { return "data" }
+
+func (dataModule) Enabled(config *Config) bool { return len(config.Data.Locations) > 0 }
+
+func (dataModule) Backup(job *Job) error {
+	// A partial run starts from the previous manifest, whose locations are replaced
+	job.Manifest.Locations = make([]ManifestLocation, 0)
+	return BackupData(job)
+}
+
+func (dataModule) Restore(job *Job) error {
+	return restoreData(job)
+}
+
+func (dataModule) Verify(job *Job) error {
+	for _, loc := range job.Manifest.Locations {
+		// Archives with an output of their own aren't part of this backup
+		if len(loc.Output) > 0 {
+			continue
+		}
+		if err := verifyArchive(job.Store, loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dotfilesModule archives the dotfiles and templates
+type dotfilesModule struct{}
+
+func (dotfilesModule) Name() string { return "dotfiles" }
+
+func (dotfilesModule) Enabled(config *Config) bool { return config.Dotfiles.enabled() }
+
+func (dotfilesModule) Backup(job *Job) error {
+	return backupDotfiles(job.Config, job.Store, job.Manifest)
+}
+
+func (dotfilesModule) Restore(job *Job) error {
+	return restoreDotfiles(job.Config, job.Store, job.Options.Target)
+}
+
+func (dotfilesModule) Verify(job *Job) error {
+	if job.Manifest.Dotfiles == nil {
+		return fmt.Errorf("%s is missing in the manifest", dotfilesArchive)
+	}
+	return verifyArchive(job.Store, *job.Manifest.Dotfiles)
+}
+
+// appModule captures the setup of an app. The app modules share one
+// progress view, which is why they are run by backupApps and restoreApps.
+type appModule struct {
+	name    string // Key of the module in the config
+	label   string // Shown in the progress view
+	enabled func(config *Config) bool
+	backup  func(job *Job) error // nil if there is nothing to back up
+	restore func(job *Job) error
+	objects []string // Objects the backup has to contain
+}
+
+func (m appModule) Name() string { return m.name }
+
+func (m appModule) Enabled(config *Config) bool { return m.enabled(config) }
+
+func (m appModule) Backup(job *Job) error {
+	if m.backup == nil {
+		return nil
+	}
+	return m.backup(job)
+}
+
+func (m appModule) Restore(job *Job) error { return m.restore(job) }
+
+func (m appModule) Verify(job *Job) error {
+	for _, name := range m.objects {
+		if _, err := job.Store.Stat(name); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s is missing", name)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectedApps returns the app modules among the selected modules
+func selectedApps(selected []Module) []appModule {
+	list := make([]appModule, 0, len(selected))
+	for _, m := range selected {
+		if app, ok := m.(appModule); ok {
+			list = append(list, app)
+		}
+	}
+	return list
+}
@@ -0,0 +1,543 @@
+package macup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// BackupFS is a read-only view of a backup, mounted with FUSE by `macup
+// mount` and shown by `macup browse`. Every archive is a directory named
+// after its location, the other objects of the backup, e.g. the manifest and
+// the Brewfile, are files next to them. Archives are only read once a directory is opened, and files are
+// streamed out of their archive when they are read.
+type BackupFS struct {
+	store    storage.Storage
+	opts     storage.Options
+	root     *mountNode
+	mu       sync.Mutex
+	archives map[*mountNode]ManifestLocation // Directories whose archive wasn't read yet
+	streams  map[string]*archiveStream       // Streams of the archives no file is reading, by archive
+}
+
+// mountNode is a file or directory of a BackupFS
+type mountNode struct {
+	name     string
+	dir      bool
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	children map[string]*mountNode
+
+	object string // Object holding the file, its archive for archive entries and directories
+	entry  string // Name of the entry in the archive, empty for plain objects
+	index  int    // Position of the entry in the archive
+	strip  string // Leading directory of the entries of an archive directory
+}
+
+// archiveStream is an archive being read entry by entry. BackupFS keeps one
+// per archive, so files read in archive order, as when a directory is
+// copied, continue where the last one left off instead of decompressing the
+// archive from the start.
+type archiveStream struct {
+	object  io.ReadCloser
+	entries *entryReader
+	index   int // Entry the stream is at, -1 before the first
+}
+
+func (s *archiveStream) Close() error {
+	return errors.Join(s.entries.Close(), s.object.Close())
+}
+
+// NewBackupFS opens a backup to mount it. Backups without a manifest show
+// their archives under the archive names.
+func NewBackupFS(target string, opts StorageOptions) (*BackupFS, error) {
+	store, err := storage.New(target, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	manifest, err := readManifest(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	names, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup: %w", err)
+	}
+	names = joinParts(names)
+
+	var created time.Time
+	if manifest != nil {
+		created = manifest.CreatedAt
+	}
+	b := &BackupFS{
+		store:    store,
+		opts:     opts,
+		root:     &mountNode{dir: true, mode: fs.ModeDir | 0555, modTime: created, children: make(map[string]*mountNode)},
+		archives: make(map[*mountNode]ManifestLocation),
+		streams:  make(map[string]*archiveStream),
+	}
+
+	// Archives become directories, named after their location
+	entries := manifest.archives()
+	for _, name := range names {
+		if isArchive(name) && !slices.ContainsFunc(entries, func(e ManifestLocation) bool { return e.Archive == name }) {
+			entries = append(entries, ManifestLocation{Path: name, Archive: name})
+		}
+	}
+	for _, entry := range entries {
+		if len(entry.Output) > 0 {
+			continue // Stored in another output
+		}
+		dir := &mountNode{name: b.dirName(entry), dir: true, mode: fs.ModeDir | 0555, modTime: cmp.Or(entry.BackedUpAt, created), children: make(map[string]*mountNode), object: entry.Archive}
+		b.root.children[dir.name] = dir
+		b.archives[dir] = entry
+	}
+
+	// Everything else is shown as is
+	for _, name := range names {
+		if isArchive(name) {
+			continue
+		}
+		size, err := store.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		b.root.children[name] = &mountNode{name: name, size: size, mode: 0444, modTime: created, object: name}
+	}
+	return b, nil
+}
+
+// String returns where the mounted backup is stored
+func (b *BackupFS) String() string {
+	return b.store.String()
+}
+
+// Close closes the archive streams kept for the next files read
+func (b *BackupFS) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var errs []error
+	for object, stream := range b.streams {
+		errs = append(errs, stream.Close())
+		delete(b.streams, object)
+	}
+	return errors.Join(errs...)
+}
+
+// dirName returns the name of the directory of an archive: the name of its
+// location, the last element of its path, or the archive name if either
+// is taken
+func (b *BackupFS) dirName(entry ManifestLocation) string {
+	name := entry.Name
+	if name == "" {
+		name = path.Base(filepath.ToSlash(entry.Path))
+	}
+	name = nameSlug(name)
+	if _, taken := b.root.children[name]; taken || name == "" {
+		return entry.Archive
+	}
+	return name
+}
+
+// lookup finds the node of a slash separated path, reading the archives on
+// the way
+func (b *BackupFS) lookup(name string) (*mountNode, error) {
+	node := b.root
+	for _, elem := range strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/") {
+		if elem == "" {
+			continue
+		}
+		if err := b.load(node); err != nil {
+			return nil, err
+		}
+		child, ok := node.children[elem]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		node = child
+	}
+	return node, b.load(node)
+}
+
+// load reads the entries of an archive directory once it is first opened
+func (b *BackupFS) load(dir *mountNode) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.archives[dir]
+	if !ok {
+		return nil
+	}
+	var files []FileInfo
+	err := listEntries(b.store, ArchiveInfo{Archive: entry.Archive}, b.opts, func(file FileInfo) error {
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", entry.Archive, err)
+	}
+
+	// Entries start with the folder of the location, which the directory
+	// stands for already
+	if len(files) > 0 {
+		first, _, _ := strings.Cut(path.Clean(files[0].Name), "/")
+		if !slices.ContainsFunc(files, func(f FileInfo) bool { return !strings.HasPrefix(path.Clean(f.Name)+"/", first+"/") }) {
+			dir.strip = first + "/"
+		}
+	}
+	for i, file := range files {
+		rel := strings.Trim(strings.TrimPrefix(path.Clean(file.Name)+"/", dir.strip), "/")
+		if rel == "" || file.Type == "symlink" {
+			continue
+		}
+		node := dir.add(rel)
+		node.modTime = file.ModTime
+		if file.Type != "dir" {
+			node.dir, node.mode, node.size = false, 0444, file.Size
+			node.object, node.entry, node.index = entry.Archive, file.Name, i
+			node.children = nil
+		}
+	}
+	delete(b.archives, dir)
+	return nil
+}
+
+// stream returns a stream of the archive of a node at its entry. The kept
+// stream of the archive goes on if it is still before the entry, otherwise
+// the archive is read from the start.
+func (b *BackupFS) stream(node *mountNode) (*archiveStream, error) {
+	b.mu.Lock()
+	s := b.streams[node.object]
+	delete(b.streams, node.object)
+	b.mu.Unlock()
+
+	if s != nil && s.index >= node.index {
+		s.Close()
+		s = nil
+	}
+	if s == nil {
+		r, err := openArchive(b.store, node.object)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := newEntryReader(node.object, r)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		s = &archiveStream{object: r, entries: entries, index: -1}
+	}
+
+	for {
+		header, err := s.entries.Next()
+		if err != nil {
+			s.Close()
+			if err == io.EOF {
+				return nil, fmt.Errorf("%s is missing in %s", node.entry, node.object)
+			}
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+		s.index++
+		if header.Name == node.entry {
+			return s, nil
+		}
+	}
+}
+
+// keep keeps the stream of an archive for the next file read from it, in
+// place of the one kept before
+func (b *BackupFS) keep(object string, s *archiveStream) {
+	b.mu.Lock()
+	old := b.streams[object]
+	b.streams[object] = s
+	b.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+}
+
+// add returns the node of a relative path below a directory, creating it
+// and its parents as directories
+func (n *mountNode) add(rel string) *mountNode {
+	node := n
+	for _, elem := range strings.Split(rel, "/") {
+		child, ok := node.children[elem]
+		if !ok {
+			child = &mountNode{name: elem, dir: true, mode: fs.ModeDir | 0555, modTime: n.modTime, children: make(map[string]*mountNode)}
+			node.children[elem] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// Mount is a backup mounted with FUSE
+type Mount struct {
+	server *fuse.Server
+	done   chan struct{}
+}
+
+// Mount mounts the backup read-only at mountPoint with FUSE, which needs
+// macFUSE on macOS. It stays mounted until Unmount, or until it is ejected
+// in Finder, which closes Done.
+func (b *BackupFS) Mount(mountPoint string) (*Mount, error) {
+	timeout := time.Hour // Nothing in a backup changes
+	options := []string{"ro"}
+	if runtime.GOOS == "darwin" {
+		options = append(options, "volname="+path.Base(filepath.ToSlash(b.String())))
+	}
+	server, err := fusefs.Mount(mountPoint, &fuseNode{fs: b, node: b.root}, &fusefs.Options{
+		MountOptions: fuse.MountOptions{FsName: b.String(), Name: "macup", Options: options},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+	})
+	if err != nil {
+		if runtime.GOOS == "darwin" {
+			return nil, fmt.Errorf("failed to mount backup, is macFUSE installed?: %w", err)
+		}
+		return nil, fmt.Errorf("failed to mount backup: %w", err)
+	}
+
+	m := &Mount{server: server, done: make(chan struct{})}
+	go func() {
+		server.Wait()
+		close(m.done)
+	}()
+	return m, nil
+}
+
+// Done is closed once the backup is unmounted
+func (m *Mount) Done() <-chan struct{} {
+	return m.done
+}
+
+// Unmount unmounts the backup, unless it was ejected already
+func (m *Mount) Unmount() error {
+	select {
+	case <-m.done:
+		return nil
+	default:
+	}
+	if err := m.server.Unmount(); err != nil {
+		return fmt.Errorf("failed to unmount backup: %w", err)
+	}
+	<-m.done
+	return nil
+}
+
+// fuseNode is a file or directory of a mounted BackupFS
+type fuseNode struct {
+	fusefs.Inode
+	fs   *BackupFS
+	node *mountNode
+}
+
+var (
+	_ fusefs.NodeGetattrer = (*fuseNode)(nil)
+	_ fusefs.NodeLookuper  = (*fuseNode)(nil)
+	_ fusefs.NodeReaddirer = (*fuseNode)(nil)
+	_ fusefs.NodeOpener    = (*fuseNode)(nil)
+)
+
+func (n *fuseNode) Getattr(ctx context.Context, f fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	n.node.attr(&out.Attr)
+	return 0
+}
+
+func (n *fuseNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	if err := n.fs.load(n.node); err != nil {
+		return nil, errno(err)
+	}
+	child, ok := n.node.children[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	child.attr(&out.Attr)
+	if inode := n.GetChild(name); inode != nil {
+		return inode, 0
+	}
+	return n.NewInode(ctx, &fuseNode{fs: n.fs, node: child}, fusefs.StableAttr{Mode: out.Attr.Mode & syscall.S_IFMT}), 0
+}
+
+func (n *fuseNode) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
+	if err := n.fs.load(n.node); err != nil {
+		return nil, errno(err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(n.node.children))
+	for _, child := range n.node.children {
+		var attr fuse.Attr
+		child.attr(&attr)
+		entries = append(entries, fuse.DirEntry{Name: child.name, Mode: attr.Mode})
+	}
+	slices.SortFunc(entries, func(a, b fuse.DirEntry) int { return strings.Compare(a.Name, b.Name) })
+	return fusefs.NewListDirStream(entries), 0
+}
+
+func (n *fuseNode) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC|syscall.O_APPEND) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	return &fuseFile{file: &mountFile{fs: n.fs, node: n.node}}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// fuseFile is an open file of a mounted BackupFS. The kernel may read it
+// from several threads, which take turns on the stream.
+type fuseFile struct {
+	mu   sync.Mutex
+	file *mountFile
+}
+
+var (
+	_ fusefs.FileReader   = (*fuseFile)(nil)
+	_ fusefs.FileReleaser = (*fuseFile)(nil)
+)
+
+func (f *fuseFile) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.file.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, errno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (f *fuseFile) Release(ctx context.Context) syscall.Errno {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return errno(f.file.Close())
+}
+
+// attr fills in the attributes of a node, owned by the user who mounted it
+func (n *mountNode) attr(out *fuse.Attr) {
+	out.Mode = uint32(n.mode.Perm())
+	if n.dir {
+		out.Mode |= syscall.S_IFDIR
+	} else {
+		out.Mode |= syscall.S_IFREG
+	}
+	out.Size = uint64(n.size)
+	out.Blocks = (out.Size + 511) / 512
+	out.Nlink = 1
+	out.Owner = *fuse.CurrentOwner()
+	modTime := n.modTime
+	out.SetTimes(nil, &modTime, &modTime)
+}
+
+// errno returns the error number a failed FUSE call reports. Reading a
+// backup can fail in more ways than an error number tells, so the error
+// is logged.
+func errno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, fs.ErrNotExist):
+		return syscall.ENOENT
+	}
+	slog.Warn(fmt.Sprintf("Failed to read backup: %v", err))
+	return syscall.EIO
+}
+
+// mountFile is an open file of a BackupFS. Files are streamed from their
+// object when read, archive entries from the stream of their archive, and
+// reading an earlier position starts the stream over.
+type mountFile struct {
+	fs     *BackupFS
+	node   *mountNode
+	offset int64 // Position of the next Read
+	pos    int64 // Position of r
+	r      io.Reader
+	object io.Closer      // Plain object being read
+	stream *archiveStream // Stream of the archive, given back to fs once closed
+}
+
+// ReadAt reads len(p) bytes from a position, fewer only at the end of the
+// file
+func (f *mountFile) ReadAt(p []byte, off int64) (int, error) {
+	f.offset = off
+	n, err := io.ReadFull(f, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *mountFile) Read(p []byte) (int, error) {
+	if f.node.dir {
+		return 0, errors.New("is a directory")
+	}
+	if f.offset >= f.node.size {
+		return 0, io.EOF
+	}
+
+	// Streams can't go back, an earlier position starts over
+	if f.r == nil || f.offset < f.pos {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.offset > f.pos {
+		n, err := io.CopyN(io.Discard, f.r, f.offset-f.pos)
+		f.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.r.Read(p)
+	f.pos += int64(n)
+	f.offset = f.pos
+	return n, err
+}
+
+// open starts streaming the file from the start
+func (f *mountFile) open() error {
+	f.Close()
+	if f.node.entry != "" {
+		stream, err := f.fs.stream(f.node)
+		if err != nil {
+			return err
+		}
+		f.stream, f.r, f.pos = stream, stream.entries, 0
+		return nil
+	}
+
+	r, err := openArchive(f.fs.store, f.node.object)
+	if err != nil {
+		return err
+	}
+	f.object, f.r, f.pos = r, r, 0
+	return nil
+}
+
+func (f *mountFile) Close() error {
+	var err error
+	if f.object != nil {
+		err = f.object.Close()
+	}
+	if f.stream != nil {
+		f.fs.keep(f.node.object, f.stream)
+	}
+	f.object, f.stream, f.r = nil, nil, nil
+	return err
+}
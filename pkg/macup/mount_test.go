@@ -0,0 +1,109 @@
+package macup
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+func TestMountFileReadAt(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "Projects")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(src, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := newArchiveWriter(store, "Projects.tar.gz", false, compression{format: compressionGzip}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Location{Path: src}
+	for _, name := range []string{".", "a.txt", "b.txt"} {
+		if err := l.writeEntryNoMessage(w, filepath.Join(src, name), NopReporter{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBackupFS(dir, StorageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if len(b.root.children) != 1 {
+		t.Fatalf("NewBackupFS() has %d top level nodes, want the archive directory", len(b.root.children))
+	}
+	var archiveDir string
+	for name := range b.root.children {
+		archiveDir = name
+	}
+
+	node, err := b.lookup(archiveDir + "/b.txt")
+	if err != nil {
+		t.Fatalf("lookup() = %v", err)
+	}
+	f := &mountFile{fs: b, node: node}
+
+	// Reads go forward, back to the start and past the end like the kernel
+	// reads a file
+	tests := []struct {
+		name string
+		off  int64
+		len  int
+		want []byte
+		eof  bool
+	}{
+		{"start", 0, 100, data[:100], false},
+		{"ahead", 5000, 100, data[5000:5100], false},
+		{"back", 50, 100, data[50:150], false},
+		{"end", 9950, 100, data[9950:], true},
+		{"past the end", 20000, 100, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.len)
+			n, err := f.ReadAt(p, tt.off)
+			if (err == io.EOF) != tt.eof || (err != nil && err != io.EOF) {
+				t.Fatalf("ReadAt(%d) = %v", tt.off, err)
+			}
+			if !bytes.Equal(p[:n], tt.want) {
+				t.Errorf("ReadAt(%d) read %d bytes, want %d", tt.off, n, len(tt.want))
+			}
+		})
+	}
+
+	// The stream is kept for the next file, and an earlier file starts the
+	// archive over
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b.streams[node.object] == nil {
+		t.Errorf("Close() didn't keep the stream of %s", node.object)
+	}
+	node, err = b.lookup(archiveDir + "/a.txt")
+	if err != nil {
+		t.Fatalf("lookup() = %v", err)
+	}
+	f = &mountFile{fs: b, node: node}
+	p := make([]byte, len(data))
+	if n, err := f.ReadAt(p, 0); err != nil || !bytes.Equal(p[:n], data) {
+		t.Errorf("ReadAt() of the earlier file read %d bytes, %v", n, err)
+	}
+	f.Close()
+}
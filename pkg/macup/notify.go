@@ -0,0 +1,197 @@
+package macup
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hinkolas/macup/internal/notify"
+	"github.com/hinkolas/macup/internal/units"
+)
+
+// Notifications announce finished backups in Notification Center and to
+// webhooks, so backups that stop working don't go unnoticed
+type Notifications struct {
+	Desktop  string      `yaml:"desktop"` // Notification Center: "always", "failure" or "never"
+	Webhooks []Webhook   `yaml:"webhooks"`
+	Email    EmailReport `yaml:"email"`
+}
+
+// Webhook is an endpoint told about every finished backup
+type Webhook struct {
+	URL     string `yaml:"url"`
+	FailURL string `yaml:"fail_url" mapstructure:"fail_url"` // Called instead of url after a failure, url + "/fail" for healthchecks
+	Format  string `yaml:"format"`                           // "json" (default), "slack", "discord", "ntfy" or "healthchecks"
+	On      string `yaml:"on"`                               // "always" (default) or "failure"
+}
+
+// When notifications are posted. Backups started by hand post none in
+// Notification Center unless desktop is set, scheduled backups default to
+// NotifyAlways and those of the daemon to NotifyFailure.
+const (
+	NotifyAlways  = "always"
+	NotifyFailure = "failure"
+	NotifyNever   = "never"
+)
+
+// webhookFormats are the payloads webhooks can take
+var webhookFormats = []string{"json", "slack", "discord", "ntfy", "healthchecks"}
+
+// webhookTimeout limits calling a webhook
+const webhookTimeout = 10 * time.Second
+
+// RunSummary is the JSON payload of webhooks
+type RunSummary struct {
+	Status    string    `json:"status"` // "success" or "failure"
+	Hostname  string    `json:"hostname"`
+	Profile   string    `json:"profile,omitempty"`
+	Backup    string    `json:"backup"` // First output target
+	StartedAt time.Time `json:"started_at"`
+	Duration  float64   `json:"duration_seconds"`
+	Bytes     int64     `json:"bytes"` // Size of the archives of the backup
+	Locations int       `json:"locations"`
+	Error     string    `json:"error,omitempty"`
+	Warnings  []string  `json:"warnings,omitempty"`
+}
+
+// notifyResult announces a finished backup as configured by notify, with how
+// long it took and how large it is, or why it failed, and emails the report. Notifications that
+// can't be delivered are only warned about.
+func (c *Config) notifyResult(run *hookRun) {
+	message := fmt.Sprintf("Backup completed in %s, %s stored", run.duration(), units.FormatSize(run.bytes()))
+	if run.err != nil {
+		reason, _, _ := strings.Cut(run.err.Error(), "\n")
+		message = fmt.Sprintf("Backup failed after %s: %s", run.duration(), reason)
+	}
+
+	if wanted(c.Notify.Desktop, run.err) {
+		if err := notify.Notify("macup", message); err != nil {
+			slog.Debug("Failed to post notification", "error", err)
+		}
+	}
+
+	summary := c.runSummary(run)
+	for _, hook := range c.Notify.Webhooks {
+		if !wanted(cmp.Or(hook.On, NotifyAlways), run.err) {
+			continue
+		}
+		if err := hook.call(summary, message); err != nil {
+			slog.Warn(fmt.Sprintf("Failed to call webhook %s: %v", redactWebhook(hook.URL), err))
+		}
+	}
+
+	if email := c.Notify.Email; email.enabled() && wanted(cmp.Or(email.On, NotifyAlways), run.err) {
+		if err := email.send(summary, c.report(run, summary)); err != nil {
+			slog.Warn(fmt.Sprintf("Failed to email the report: %v", err))
+		}
+	}
+}
+
+// wanted reports whether a run with an outcome is announced when set to
+// always, failure or never
+func wanted(when string, err error) bool {
+	return when == NotifyAlways || (when == NotifyFailure && err != nil)
+}
+
+// runSummary describes a finished run to webhooks
+func (c *Config) runSummary(run *hookRun) RunSummary {
+	hostname, _ := os.Hostname()
+	summary := RunSummary{
+		Status:    "success",
+		Hostname:  hostname,
+		Profile:   c.profile,
+		Backup:    redactTarget(run.backupDir),
+		StartedAt: run.start.UTC(),
+		Duration:  time.Since(run.start).Seconds(),
+		Bytes:     run.bytes(),
+		Warnings:  run.warnings,
+	}
+	if run.manifest != nil {
+		summary.Locations = len(run.manifest.Locations)
+	}
+	if run.err != nil {
+		summary.Status, summary.Error = "failure", run.err.Error()
+	}
+	return summary
+}
+
+// call posts the summary of a run to the webhook in its format
+func (h Webhook) call(summary RunSummary, message string) error {
+	target := h.URL
+	if summary.Status != "success" {
+		switch {
+		case h.FailURL != "":
+			target = h.FailURL
+		case h.Format == "healthchecks":
+			target = strings.TrimSuffix(h.URL, "/") + "/fail"
+		}
+	}
+
+	var body []byte
+	var err error
+	contentType := "application/json"
+	switch h.Format {
+	case "slack":
+		body, err = json.Marshal(map[string]string{"text": "macup: " + message})
+	case "discord":
+		body, err = json.Marshal(map[string]string{"content": "macup: " + message})
+	case "ntfy", "healthchecks":
+		body, contentType = []byte(message), "text/plain"
+	default:
+		body, err = json.Marshal(summary)
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if h.Format == "ntfy" {
+		req.Header.Set("Title", "macup")
+		if summary.Status != "success" {
+			req.Header.Set("Priority", "high")
+			req.Header.Set("Tags", "warning")
+		}
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error would repeat the URL with its secret
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// redactWebhook hides the path and query of a webhook URL, which usually
+// hold its secret
+func redactWebhook(webhook string) string {
+	u, err := url.Parse(webhook)
+	if err != nil || u.Host == "" {
+		return redact(webhook)
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+// duration returns how long the run took, to the second
+func (r hookRun) duration() time.Duration {
+	return time.Since(r.start).Round(time.Second)
+}
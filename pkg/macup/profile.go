@@ -0,0 +1,123 @@
+package macup
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// overlay is a block of config keys merged into the config on some Macs only
+type overlay struct {
+	key  string // e.g. "profiles.work" or "hosts.work-mbp"
+	node *yaml.Node
+}
+
+// applyOverlays merges the hosts block of this Mac and then the selected
+// profile into the config, like included files are merged:
+//
+//	profiles:
+//	  work:
+//	    data:
+//	      locations:
+//	        - path: ~/Work
+//	hosts:
+//	  work-mbp:
+//	    profile: work  # Used unless --profile picks another one
+//
+// An empty profile takes the one named by the hosts block, if any.
+func (s *configSource) applyOverlays(hostname, profile string) error {
+	profiles := s.takeOverlays("profiles")
+	hosts := s.takeOverlays("hosts")
+	if len(profiles)+len(hosts) == 0 && profile == "" {
+		return nil
+	}
+	s.merged = true
+
+	// The profile of a hosts block isn't a config key, it is taken out of all
+	// of them before their keys are checked
+	for _, host := range hosts {
+		defaultProfile := ""
+		if i := mappingIndex(host.node, "profile"); i >= 0 {
+			defaultProfile = host.node.Content[i+1].Value
+			host.node.Content = slices.Delete(host.node.Content, i, i+2)
+		}
+		if !sameHost(strings.TrimPrefix(host.key, "hosts."), hostname) {
+			continue
+		}
+		if profile == "" {
+			profile = defaultProfile
+		}
+		s.root = mergeNode(s.root, s.clone(host.node))
+	}
+
+	if profile == "" {
+		return nil
+	}
+	i := slices.IndexFunc(profiles, func(o overlay) bool { return o.key == "profiles."+profile })
+	if i < 0 {
+		names := make([]string, len(profiles))
+		for j, o := range profiles {
+			names[j] = strings.TrimPrefix(o.key, "profiles.")
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q, the config has no profiles", profile)
+		}
+		return fmt.Errorf("unknown profile %q, expected one of: %s", profile, strings.Join(names, ", "))
+	}
+	s.root = mergeNode(s.root, s.clone(profiles[i].node))
+	s.profile = profile
+
+	return nil
+}
+
+// takeOverlays removes a block of overlays from the config and returns them.
+// They are kept to check their keys, even if they don't apply to this Mac.
+func (s *configSource) takeOverlays(key string) []overlay {
+	i := mappingIndex(s.root, key)
+	if i < 0 {
+		return nil
+	}
+	block := s.root.Content[i+1]
+	s.root.Content = slices.Delete(s.root.Content, i, i+2)
+
+	var overlays []overlay
+	for j := 0; j+1 < len(block.Content); j += 2 {
+		o := overlay{key: key + "." + block.Content[j].Value, node: block.Content[j+1]}
+		if o.node.Kind != yaml.MappingNode {
+			o.node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		overlays = append(overlays, o)
+	}
+	s.overlays = append(s.overlays, overlays...)
+	return overlays
+}
+
+// clone copies a node and everything below it, so merging doesn't change the
+// overlays. The copies keep the file they came from.
+func (s *configSource) clone(node *yaml.Node) *yaml.Node {
+	clone := *node
+	clone.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		clone.Content[i] = s.clone(child)
+	}
+	if file, ok := s.files[node]; ok {
+		s.files[&clone] = file
+	}
+	return &clone
+}
+
+// sameHost reports whether a hosts block is meant for a hostname, ignoring
+// case and the ".local" suffix
+func sameHost(name, hostname string) bool {
+	trim := func(s string) string { return strings.TrimSuffix(strings.ToLower(s), ".local") }
+	return trim(name) == trim(hostname)
+}
+
+// currentHostname returns the hostname overlays are selected by
+func currentHostname() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}
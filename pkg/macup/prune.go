@@ -0,0 +1,138 @@
+package macup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// partialFileAge is how old a partial file has to be before prune considers
+// its run interrupted rather than still running
+const partialFileAge = time.Hour
+
+// PruneCandidate is an object that prune removes from an output target
+type PruneCandidate struct {
+	Target string `json:"target"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+
+	upload *storage.Upload // Unfinished upload the candidate is, if any
+}
+
+// Prune finds what is left behind in the output targets: archives that the
+// last backup no longer contains, e.g. of locations that were removed from
+// the config or renamed, and partial files and unfinished uploads of
+// interrupted runs. They are
+// removed unless dryRun is set. Backups are replaced in place, so there are
+// no older generations to remove. Targets without a manifest are left alone,
+// since it is unknown which of their objects belong to a backup.
+func Prune(config *Config, dryRun bool) ([]PruneCandidate, error) {
+	var candidates []PruneCandidate
+	for _, target := range outputTargets(config) {
+		store, err := storage.New(target, config.StorageOptions())
+		if err != nil {
+			return candidates, fmt.Errorf("failed to open output %s: %w", redactTarget(target), err)
+		}
+		found, err := pruneCandidates(store, target)
+		if err != nil {
+			return candidates, fmt.Errorf("failed to read output %s: %w", redactTarget(target), err)
+		}
+
+		for _, c := range found {
+			if !dryRun {
+				if err := pruneObject(store, target, c); err != nil {
+					return candidates, fmt.Errorf("failed to remove %s: %w", store.Path(c.Name), err)
+				}
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+
+// pruneCandidates returns the objects of an output target that no backup needs
+func pruneCandidates(store storage.Storage, target string) ([]PruneCandidate, error) {
+	manifest, err := readManifest(store)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		slog.Warn(fmt.Sprintf("Skipping output %s, it holds no manifest", redactTarget(target)))
+		return nil, nil
+	}
+
+	// The archives of the last backup are kept, as are those of the apps
+	keep := make(map[string]bool)
+	for _, entry := range manifest.archives() {
+		keep[entry.Archive] = true
+	}
+	for _, m := range appModules {
+		for _, name := range m.(appModule).objects {
+			keep[name] = true
+		}
+	}
+
+	names, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []PruneCandidate
+	for _, name := range joinParts(names) {
+		if !isArchive(name) || keep[name] || strings.HasPrefix(name, "docker-") {
+			continue
+		}
+		size, err := statArchive(store, name)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, PruneCandidate{Target: redactTarget(target), Name: name, Size: size, Reason: "not in the last backup"})
+	}
+
+	// Storages hide partial files, only local ones can be looked at
+	if _, ok := store.(*storage.Local); ok {
+		partial, _ := filepath.Glob(filepath.Join(target, "*.tmp"))
+		for _, path := range partial {
+			info, err := os.Stat(path)
+			if err != nil || time.Since(info.ModTime()) < partialFileAge {
+				continue
+			}
+			candidates = append(candidates, PruneCandidate{Target: target, Name: filepath.Base(path), Size: info.Size(), Reason: "partial file of an interrupted run"})
+		}
+	}
+
+	// Uploads kept for resuming that no run resumed
+	if lister, ok := store.(storage.UploadLister); ok {
+		uploads, err := lister.Uploads()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list unfinished uploads: %w", err)
+		}
+		for _, upload := range uploads {
+			if time.Since(upload.Initiated) < partialFileAge {
+				continue
+			}
+			candidates = append(candidates, PruneCandidate{Target: redactTarget(target), Name: upload.Name, Size: upload.Size, Reason: "unfinished upload of an interrupted run", upload: &upload})
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b PruneCandidate) int { return strings.Compare(a.Name, b.Name) })
+	return candidates, nil
+}
+
+// pruneObject removes an object, a partial file which the storage hides or
+// an unfinished upload
+func pruneObject(store storage.Storage, target string, c PruneCandidate) error {
+	if c.upload != nil {
+		return store.(storage.UploadLister).AbortUpload(*c.upload)
+	}
+	if strings.HasSuffix(c.Name, ".tmp") {
+		return os.Remove(filepath.Join(target, c.Name))
+	}
+	return removeArchive(store, c.Name)
+}
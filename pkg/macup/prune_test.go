@@ -0,0 +1,102 @@
+package macup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{
+		Locations: []ManifestLocation{{Path: "~/Projects", Archive: "Projects.tar.gz"}},
+		Dotfiles:  &ManifestLocation{Path: "dotfiles", Archive: dotfilesArchive},
+	}
+	if err := writeManifest(store, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * partialFileAge)
+	files := map[string]time.Time{
+		"Projects.tar.gz":      {},  // In the last backup
+		dotfilesArchive:        {},  // In the last backup as the dotfiles
+		apps.FontsArchive:      {},  // Written by an app module
+		"docker-volumes.tar":   {},  // Docker exports are kept
+		"notes.txt":            {},  // Not an archive
+		"Removed.tar.zst":      {},  // Of a location no longer configured
+		"Renamed.tar":          {},  // Of a location no longer configured
+		"Projects.tar.gz.tmp":  old, // Partial file of an interrupted run
+		"Documents.tar.gz.tmp": {},  // Partial file of a run that may still go on
+	}
+	for name, mtime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if !mtime.IsZero() {
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	want := []string{"Projects.tar.gz.tmp", "Removed.tar.zst", "Renamed.tar"}
+	config := &Config{Output: []string{dir}}
+
+	// A dry run only reports what would be removed
+	candidates, err := Prune(config, true)
+	if err != nil {
+		t.Fatalf("Prune() = %v", err)
+	}
+	var names []string
+	for _, c := range candidates {
+		names = append(names, c.Name)
+		if c.Size != int64(len(c.Name)) {
+			t.Errorf("%s has size %d, want %d", c.Name, c.Size, len(c.Name))
+		}
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("Prune() found %v, want %v", names, want)
+	}
+	for _, name := range want {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("dry run removed %s", name)
+		}
+	}
+
+	// A real run removes them and leaves the rest
+	if _, err := Prune(config, false); err != nil {
+		t.Fatalf("Prune() = %v", err)
+	}
+	for name := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if removed := os.IsNotExist(err); removed != slices.Contains(want, name) {
+			t.Errorf("%s removed = %v", name, removed)
+		}
+	}
+}
+
+func TestPruneWithoutManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Projects.tar.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a manifest it is unknown which archives belong to a backup
+	candidates, err := Prune(&Config{Output: []string{dir}}, false)
+	if err != nil || len(candidates) > 0 {
+		t.Errorf("Prune() = %v, %v, want nothing to prune", candidates, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Projects.tar.gz")); err != nil {
+		t.Errorf("Prune() removed an archive of a target without a manifest")
+	}
+}
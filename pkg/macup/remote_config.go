@@ -0,0 +1,208 @@
+package macup
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fetchTimeout limits downloading a remote config
+const fetchTimeout = 30 * time.Second
+
+// ConfigOrigin records the remote config a backup was created with
+type ConfigOrigin struct {
+	URL      string `json:"url"`      // Without credentials
+	Revision string `json:"revision"` // Commit of a git config, SHA-256 of a downloaded one
+}
+
+// remoteConfig is a config URL, e.g. "https://gist.githubusercontent.com/…/config.yaml"
+// or "git+ssh://git@github.com/team/onboarding.git". The fragment takes
+// options, e.g. "#ref=v2&path=macup/config.yaml&sha256=…".
+type remoteConfig struct {
+	url    string // Without the fragment and the git+ prefix
+	git    bool
+	ref    string // Branch, tag or commit of a git config, the default branch if empty
+	path   string // Config file inside a git repository, config.yaml if empty
+	sha256 string // Pinned checksum of the config file
+}
+
+// IsRemoteConfig reports whether a config path is a URL to fetch
+func IsRemoteConfig(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "git+")
+}
+
+// parseRemoteConfig parses a config URL and its options
+func parseRemoteConfig(rawURL string) (remoteConfig, error) {
+	base, fragment, _ := strings.Cut(rawURL, "#")
+	options, err := url.ParseQuery(fragment)
+	if err != nil {
+		return remoteConfig{}, fmt.Errorf("invalid options in config URL: %w", err)
+	}
+	r := remoteConfig{url: base, ref: options.Get("ref"), path: options.Get("path"), sha256: strings.ToLower(options.Get("sha256"))}
+	if rest, ok := strings.CutPrefix(base, "git+"); ok {
+		r.url, r.git = rest, true
+	} else if r.ref != "" || r.path != "" {
+		return r, fmt.Errorf("ref and path only apply to git+ config URLs")
+	}
+	return r, nil
+}
+
+// fetchConfig fetches a remote config into the cache and returns the path of
+// the copy and where it came from. If fetching fails, e.g. offline, the
+// cached copy of the last fetch is used.
+func fetchConfig(rawURL string) (string, *ConfigOrigin, error) {
+	r, err := parseRemoteConfig(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get cache dir: %w", err)
+	}
+	sum := sha256.Sum256([]byte(r.url + "#" + r.ref))
+	dir := filepath.Join(cacheDir, "macup", "configs", hex.EncodeToString(sum[:8]))
+
+	origin := &ConfigOrigin{URL: redactTarget(strings.SplitN(rawURL, "#", 2)[0])}
+	var configPath string
+	if r.git {
+		configPath, origin.Revision, err = r.fetchGit(dir)
+	} else {
+		configPath, err = r.download(dir)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The checksum is that of the file as fetched, a pinned git config must
+	// not change even if its ref moves
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", nil, err
+	}
+	digest := sha256.Sum256(data)
+	checksum := hex.EncodeToString(digest[:])
+	if r.sha256 != "" && r.sha256 != checksum {
+		return "", nil, fmt.Errorf("config %s has checksum %s, expected the pinned %s", origin.URL, checksum, r.sha256)
+	}
+	origin.Revision = cmp.Or(origin.Revision, checksum)
+
+	return configPath, origin, nil
+}
+
+// download fetches a config over HTTPS into dir and returns its path
+func (r remoteConfig) download(dir string) (string, error) {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return "", fmt.Errorf("invalid config URL: %w", err)
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = "config.yaml"
+	}
+	cached := filepath.Join(dir, name)
+
+	err = r.downloadTo(cached)
+	if err == nil {
+		return cached, nil
+	}
+	if _, statErr := os.Stat(cached); statErr != nil {
+		return "", err
+	}
+	slog.Warn(fmt.Sprintf("%v, using the cached config", err))
+	return cached, nil
+}
+
+// downloadTo downloads the config to a file, replacing it once complete. A
+// download that doesn't match the pinned checksum leaves the file alone.
+func (r remoteConfig) downloadTo(file string) error {
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(r.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch config %s: %s", redactTarget(r.url), resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to fetch config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if checksum := hex.EncodeToString(h.Sum(nil)); r.sha256 != "" && r.sha256 != checksum {
+		return fmt.Errorf("config %s has checksum %s, expected the pinned %s", redactTarget(r.url), checksum, r.sha256)
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// fetchGit checks out the ref of a git config in dir and returns the path of
+// the config file and the commit
+func (r remoteConfig) fetchGit(dir string) (string, string, error) {
+	repo := filepath.Join(dir, "repo")
+	configPath := filepath.Join(repo, filepath.FromSlash(cmp.Or(r.path, "config.yaml")))
+
+	err := r.checkout(repo)
+	if err != nil {
+		if _, statErr := os.Stat(configPath); statErr != nil {
+			return "", "", err
+		}
+		slog.Warn(fmt.Sprintf("%v, using the cached config", err))
+	}
+
+	commit, err := git(repo, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read the commit of %s: %w", redactTarget(r.url), err)
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return "", "", fmt.Errorf("%s has no %s", redactTarget(r.url), cmp.Or(r.path, "config.yaml"))
+	}
+	return configPath, commit, nil
+}
+
+// checkout fetches the ref of a git config into a shallow repository
+func (r remoteConfig) checkout(repo string) error {
+	if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+		if err := os.MkdirAll(repo, 0700); err != nil {
+			return err
+		}
+		if err := runGit(repo, "init", "--quiet"); err != nil {
+			return err
+		}
+	}
+	if err := runGit(repo, "fetch", "--quiet", "--depth", "1", "--", r.url, cmp.Or(r.ref, "HEAD")); err != nil {
+		return fmt.Errorf("failed to fetch config from %s: %w", redactTarget(r.url), err)
+	}
+	return runGit(repo, "checkout", "--quiet", "--force", "--detach", "FETCH_HEAD")
+}
+
+// runGit runs git in a repository, failing with its error output
+func runGit(dir string, args ...string) error {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return err
+}
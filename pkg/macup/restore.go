@@ -0,0 +1,184 @@
+package macup
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hinkolas/macup/internal/logging"
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// RestoreOptions controls how a backup is restored
+type RestoreOptions struct {
+	WaitForRetrieval bool           // Wait for archives in cold storage instead of failing
+	Tools            bool           // Reinstall the global packages of language package managers
+	Tweaks           bool           // Apply the system tweaks of the config
+	Modules          ModuleFilter   // Parts of the backup to restore
+	Locations        []string       // Data locations to restore by name or path, all if empty
+	Target           string         // Directory to restore the data and dotfiles below instead of their original paths
+	Jobs             int            // Archives extracted at the same time, and files written at the same time per archive
+	Storage          StorageOptions // Credentials of the backup's storage, they come from the environment if empty
+
+	// PickApps lets the user deselect App Store apps before they are
+	// reinstalled, all are reinstalled without it
+	PickApps func(apps []AppStoreApp) []AppStoreApp
+	// Progress creates the reporters of the phases like Engine.Progress,
+	// without it progress is drawn on the terminal
+	Progress func(phase string) ProgressReporter
+}
+
+// Restore restores a backup from the specified backup directory or URL.
+// Canceling ctx stops it cleanly with a CanceledError.
+func Restore(ctx context.Context, backupDir string, opts RestoreOptions) error {
+	// Open backup storage
+	store, err := storage.New(backupDir, opts.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+
+	opts.Jobs = max(opts.Jobs, 1)
+	if opts.Target != "" {
+		if opts.Target, err = NormalizePath(opts.Target); err != nil {
+			return err
+		}
+	}
+
+	// Load config from backup directory
+	config, err := loadBundledConfig(store)
+	if err != nil {
+		return fmt.Errorf("failed to load config from backup: %w", err)
+	}
+	config.progress = opts.Progress
+
+	run := &hookRun{backupDir: backupDir, start: time.Now()}
+	stop := logging.Capture()
+	err = config.Hooks.around("pre_restore", "post_restore", run, func() (*Manifest, error) {
+		return restore(ctx, config, store, opts)
+	})
+	run.warnings = stop()
+	config.recordRun("restore", run)
+	return err
+}
+
+// restore restores the modules of a backup selected by the options and
+// returns its manifest
+func restore(ctx context.Context, config *Config, store storage.Storage, opts RestoreOptions) (*Manifest, error) {
+	var err error
+	if len(opts.Locations) > 0 {
+		if config.Data.Locations, err = selectLocations(config.Data.Locations, opts.Locations); err != nil {
+			return nil, err
+		}
+	}
+
+	selected, err := selectModules(config, opts.Modules)
+	if err != nil {
+		return nil, err
+	}
+
+	// Archives in cold storage have to be retrieved first
+	if hasModule(selected, "data") || hasModule(selected, "dotfiles") {
+		if err := retrieveArchives(config, store, opts.WaitForRetrieval); err != nil {
+			return nil, err
+		}
+	}
+
+	// Bundles are verified against the manifest
+	manifest, err := readManifest(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	// The data comes first, apps are reinstalled once it is back
+	job := &Job{Config: config, Store: store, Manifest: manifest, Options: opts, Context: ctx}
+	for _, m := range selected {
+		if _, ok := m.(appModule); ok {
+			continue
+		}
+		if ctx.Err() != nil {
+			return manifest, job.canceled()
+		}
+		if err := m.Restore(job); err != nil {
+			return manifest, err
+		}
+		if m.Name() != "data" {
+			job.completed = append(job.completed, m.Name())
+		}
+	}
+
+	if err := restoreApps(job, selectedApps(selected)); err != nil {
+		return manifest, err
+	}
+
+	return manifest, nil
+}
+
+// RestoreChoice is a data location or a module of a backup that can be
+// picked for restoring
+type RestoreChoice struct {
+	Name     string // Name or path of a location, name of a module
+	Size     int64  // Size of its archives and objects, 0 if unknown
+	Location bool
+}
+
+// RestoreChoices returns the data locations and the modules other than data
+// a backup can restore, e.g. to pick some of them for RestoreOptions
+func RestoreChoices(backupDir string, opts StorageOptions) ([]RestoreChoice, error) {
+	store, manifest, err := openBackup(backupDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadBundledConfig(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config from backup: %w", err)
+	}
+	selected, err := selectModules(config, ModuleFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	var choices []RestoreChoice
+	for _, loc := range config.Data.Locations {
+		entry, ok := manifest.location(loc.Path)
+		if !ok && loc.conditional() {
+			continue // Wasn't backed up
+		}
+		choices = append(choices, RestoreChoice{Name: cmp.Or(loc.Name, loc.Path), Size: entry.Size, Location: true})
+	}
+	for _, m := range selected {
+		choice := RestoreChoice{Name: m.Name()}
+		switch m := m.(type) {
+		case dataModule:
+			continue
+		case dotfilesModule:
+			if manifest != nil && manifest.Dotfiles != nil {
+				choice.Size = manifest.Dotfiles.Size
+			}
+		case appModule:
+			for _, name := range m.objects {
+				size, _ := store.Stat(name)
+				choice.Size += size
+			}
+		}
+		choices = append(choices, choice)
+	}
+	return choices, nil
+}
+
+// loadBundledConfig reads the config that was copied into a backup, in
+// whichever format it was written
+func loadBundledConfig(store storage.Storage) (*Config, error) {
+	var errs []error
+	for _, name := range bundledConfigs {
+		r, err := store.Open(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		defer r.Close()
+		return ReadConfig(r, configFormat(name))
+	}
+	// Report why config.yaml, the usual name, couldn't be opened
+	return nil, errs[0]
+}
@@ -0,0 +1,499 @@
+package macup
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hinkolas/macup/internal/apps"
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/tui"
+)
+
+// bufferedFileSize is the size up to which files are read into memory and
+// written in the background while the archive is read on
+const bufferedFileSize = 1 << 20
+
+// restoreData extracts all data locations of the backup and clones the
+// repositories of git_mode locations, below the target of the job if given. Up
+// to its jobs archives are extracted at the same time. Once the job is
+// canceled no more locations are started and the running ones stop.
+func restoreData(job *Job) error {
+	config, store, manifest, ctx := job.Config, job.Store, job.Manifest, job.ctx()
+	target, jobs := job.Options.Target, job.Options.Jobs
+
+	// Preset locations of apps that weren't installed and locations whose
+	// conditions weren't met have no archive
+	var stores []storage.Storage
+	var locations []Location
+	for _, loc := range config.Data.Locations {
+		locStore, err := locationStore(loc, store, job.Options.Storage)
+		if err != nil {
+			return fmt.Errorf("failed to find the archive of %s: %w", loc.label(), err)
+		}
+		if _, err := statArchive(locStore, loc.archiveName()); loc.conditional() && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		stores = append(stores, locStore)
+		locations = append(locations, loc)
+	}
+
+	// Create the progress reporter with "Extracting" prefix
+	pv := config.newReporter("Extracting")
+
+	// Initialize all locations in the reporter
+	for _, loc := range locations {
+		pv.Add(loc.label(), 0.0, 0)
+		if entry, ok := manifest.location(loc.Path); ok {
+			pv.Expect(loc.label(), entry.Size)
+		}
+	}
+
+	// Restore the locations in parallel. A location inside another one, or
+	// holding one, waits for it, so the archive restored last wins like when
+	// restoring one by one.
+	sem := make(chan struct{}, max(jobs, 1))
+	done := make([]chan struct{}, len(locations))
+	var mu sync.Mutex
+	var failure error
+	var wg sync.WaitGroup
+	for i, loc := range locations {
+		done[i] = make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			for j, other := range locations[:i] {
+				if within(loc.displayPath(), other.displayPath()) || within(other.displayPath(), loc.displayPath()) {
+					<-done[j]
+				}
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// Locations not started yet are left out after the first failure
+			mu.Lock()
+			failed := failure != nil
+			mu.Unlock()
+			if failed || ctx.Err() != nil {
+				return
+			}
+			err := restoreLocation(ctx, loc, stores[i], manifest, target, jobs, pv)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				job.completed = append(job.completed, loc.label())
+			} else if failure == nil {
+				failure = fmt.Errorf("failed to restore %s: %w", loc.label(), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		pv.Cancel()
+		return job.canceled()
+	}
+	if failure != nil {
+		pv.Clear() // Clear on error
+		return failure
+	}
+
+	// Show final state with success message
+	pv.Finish("✓ Restore completed successfully!")
+
+	return restoreRepos(locations, manifest, target)
+}
+
+// selectLocations returns the locations picked by name or path, e.g. with
+// `restore --location Projects`
+func selectLocations(locations []Location, picked []string) ([]Location, error) {
+	selected := make([]Location, 0, len(picked))
+	for _, pick := range picked {
+		i := slices.IndexFunc(locations, func(loc Location) bool {
+			return strings.EqualFold(loc.Name, pick) || loc.Path == pick || loc.displayPath() == expandedPath(pick)
+		})
+		if i < 0 {
+			labels := make([]string, len(locations))
+			for j, loc := range locations {
+				labels[j] = cmp.Or(loc.Name, loc.Path)
+			}
+			return nil, fmt.Errorf("unknown location %q, expected one of: %s", pick, strings.Join(labels, ", "))
+		}
+		if !slices.ContainsFunc(selected, func(loc Location) bool { return loc.Path == locations[i].Path }) {
+			selected = append(selected, locations[i])
+		}
+	}
+	return selected, nil
+}
+
+// locationStore returns the storage holding the archive of a location: the
+// first of its own output targets that has it, or else the backup, e.g. if the
+// archive was copied there
+func locationStore(loc Location, backup storage.Storage, opts storage.Options) (storage.Storage, error) {
+	return archiveStore(loc.Output, loc.archiveName(), backup, opts)
+}
+
+// archiveStore returns the first of the output targets that has an archive,
+// or else the backup. Targets that can't be opened or read are an error, the
+// archive there may be newer than a copy in the backup.
+func archiveStore(targets []string, name string, backup storage.Storage, opts storage.Options) (storage.Storage, error) {
+	for _, target := range targets {
+		target, err := expandTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		store, err := storage.New(target, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open output %s: %w", redactTarget(target), err)
+		}
+		_, err = statArchive(store, name)
+		if err == nil {
+			return store, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read output %s: %w", redactTarget(target), err)
+		}
+	}
+	return backup, nil
+}
+
+// restoreLocation restores a single location from its archive. The manifest
+// may be nil for backups of older versions.
+func restoreLocation(ctx context.Context, loc Location, store storage.Storage, manifest *Manifest, target string, jobs int, pv tui.ProgressReporter) error {
+	// Generate the archive filename based on the ORIGINAL config path (before normalization)
+	// This must match the hash used during backup creation
+	archiveName := loc.archiveName()
+	start := time.Now()
+
+	// Normalize the target path for actual file operations
+	targetPath, err := restorePath(loc.Path, target)
+	if err != nil {
+		return fmt.Errorf("failed to normalize path: %w", err)
+	}
+
+	// Check if archive exists and get its size for progress tracking
+	archiveSize, err := statArchive(store, archiveName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("archive not found: %s", store.Path(archiveName))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get archive info: %w", err)
+	}
+
+	// Extract the archive with progress tracking
+	if loc.Bundle {
+		entry, _ := manifest.location(loc.Path)
+		if err := restoreBundle(ctx, loc, store, archiveName, archiveSize, targetPath, entry, jobs, pv); err != nil {
+			return err
+		}
+	} else if err := extractArchive(ctx, store, archiveName, archiveSize, loc.label(), filepath.Dir(targetPath), jobs, pv); err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+
+	// Mark as done
+	pv.Message("")
+	pv.Done(loc.label(), true)
+	slog.Debug("Restored location", "location", loc.label(), "target", targetPath, "took", time.Since(start))
+
+	pv.Stored(store.Path(archiveName), targetPath)
+
+	return nil
+}
+
+// restorePath returns where a path is restored to. Below a target directory
+// paths in the home directory keep their path relative to it, e.g.
+// ~/Documents becomes <target>/Documents, others their full path.
+func restorePath(path, target string) (string, error) {
+	path, err := NormalizePath(path)
+	if err != nil || target == "" {
+		return path, err
+	}
+	if home, err := os.UserHomeDir(); err == nil && within(path, home) {
+		rel, _ := filepath.Rel(home, path)
+		return filepath.Join(target, rel), nil
+	}
+	return filepath.Join(target, path), nil
+}
+
+// restoreBundle extracts a bundle next to its target and only replaces the
+// target once the extracted bundle is complete. An incomplete bundle is
+// discarded, so the target is either the old or the backed up version.
+func restoreBundle(ctx context.Context, loc Location, store storage.Storage, archiveName string, archiveSize int64, targetPath string, entry ManifestLocation, jobs int, pv tui.ProgressReporter) error {
+	if app := loc.bundleApp(); app != "" && apps.Running(app) {
+		return fmt.Errorf("%s is running, quit it to restore its library", app)
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(targetPath), ".macup-restore-")
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return err
+		}
+		staging, err = os.MkdirTemp(filepath.Dir(targetPath), ".macup-restore-")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := extractArchive(ctx, store, archiveName, archiveSize, loc.label(), staging, jobs, pv); err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+	extracted := filepath.Join(staging, filepath.Base(targetPath))
+	if err := os.MkdirAll(extracted, 0755); err != nil { // Empty bundles have no entries
+		return err
+	}
+
+	// The extracted bundle has to hold what was scanned during the backup
+	if entry.Archive != "" {
+		check := Location{Path: extracted, Bundle: true}
+		if err := check.scan(ctx, nil, pv); err != nil {
+			return fmt.Errorf("failed to verify restored bundle: %w", err)
+		}
+		if check.fingerprint.Entries != entry.Fingerprint.Entries || check.fingerprint.Size != entry.Fingerprint.Size {
+			return fmt.Errorf("restored bundle is inconsistent, got %d entries (%s) instead of %d (%s)",
+				check.fingerprint.Entries, tui.FormatBytes(check.fingerprint.Size),
+				entry.Fingerprint.Entries, tui.FormatBytes(entry.Fingerprint.Size))
+		}
+	}
+
+	// Swap the bundles, the old one is removed last
+	old := filepath.Join(staging, "old")
+	if err := os.Rename(targetPath, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to move %s aside: %w", targetPath, err)
+	}
+	if err := os.Rename(extracted, targetPath); err != nil {
+		os.Rename(old, targetPath)
+		return fmt.Errorf("failed to move restored bundle in place: %w", err)
+	}
+
+	return nil
+}
+
+// extractArchive extracts a tar archive into parentDir with progress
+// tracking. Progress is reported for label. Small files are written by up to
+// jobs writers while the archive is read on, directories and links are
+// created in order, so they always exist before what's inside them. The
+// extraction stops between files once ctx is canceled.
+func extractArchive(ctx context.Context, store storage.Storage, archiveName string, archiveSize int64, label string, parentDir string, jobs int, pv tui.ProgressReporter) error {
+	// Open the archive (streamed for remote storages)
+	file, err := openArchive(store, archiveName)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	// Decompress in the format of the archive, counting the compressed bytes
+	// read for the transfer speed
+	read := &countingReader{r: file}
+	entries, err := newEntryReader(archiveName, read)
+	if err != nil {
+		return err
+	}
+	defer entries.Close()
+
+	writers := newFileWriters(jobs)
+	defer writers.wait()
+
+	// Track progress
+	var bytesProcessed int64
+	startTime := time.Now()
+	fileCount := 0
+	files := 0 // Regular files, for the summary table
+
+	// Extract all files
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := entries.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		fileCount++
+		bytesProcessed += header.Size
+
+		// Construct the full path for extraction
+		// The archive contains paths like "foldername/subfolder/file.txt"
+		// We want to extract to "parentDir/foldername/subfolder/file.txt"
+		extractPath := filepath.Join(parentDir, header.Name)
+
+		// Security check: ensure the path doesn't escape the target directory
+		cleanPath := filepath.Clean(extractPath)
+		cleanParent := filepath.Clean(parentDir)
+		if !strings.HasPrefix(cleanPath, cleanParent+string(filepath.Separator)) &&
+			cleanPath != cleanParent {
+			return fmt.Errorf("illegal file path in archive: %s", header.Name)
+		}
+		slog.Debug("Extracting", "path", extractPath, "size", header.Size)
+
+		// Update progress every 50 files
+		if fileCount%50 == 0 {
+			pv.Message(extractPath)
+
+			// Calculate progress and ETA
+			progress := float64(bytesProcessed) / float64(archiveSize)
+			if progress > 1.0 {
+				progress = 1.0
+			}
+
+			elapsed := time.Since(startTime)
+			var eta time.Duration
+			if progress > 0 && progress < 1.0 {
+				totalTime := time.Duration(float64(elapsed) / progress)
+				eta = totalTime - elapsed
+				if eta < 0 {
+					eta = 0
+				}
+			}
+
+			pv.Bytes(label, read.n, archiveSize)
+			pv.Set(label, progress, eta)
+		}
+
+		if err := writers.err(); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			// Create directory
+			if err := os.MkdirAll(extractPath, os.FileMode(header.Mode)); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", extractPath, err)
+			}
+
+		case tar.TypeReg:
+			files++
+
+			// Create parent directories if they don't exist
+			if err := os.MkdirAll(filepath.Dir(extractPath), 0755); err != nil {
+				return fmt.Errorf("failed to create parent directory: %w", err)
+			}
+
+			// Small files are written in the background, large ones right away
+			if header.Size <= bufferedFileSize {
+				if err := writers.write(entries, extractPath, header, pv); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := extractFile(entries, extractPath, os.FileMode(header.Mode)); err != nil {
+				return fmt.Errorf("failed to extract file %s: %w", extractPath, err)
+			}
+			pv.Completed(extractPath, header.Size)
+
+		case tar.TypeSymlink:
+			// Create parent directories if they don't exist
+			if err := os.MkdirAll(filepath.Dir(extractPath), 0755); err != nil {
+				return fmt.Errorf("failed to create parent directory: %w", err)
+			}
+
+			// Replace what is there, e.g. the link restored by an earlier run
+			if err := os.Remove(extractPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to replace %s: %w", extractPath, err)
+			}
+			if err := os.Symlink(header.Linkname, extractPath); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", extractPath, err)
+			}
+		}
+	}
+
+	// Final progress update
+	if err := writers.wait(); err != nil {
+		return err
+	}
+	pv.Totals(label, files, bytesProcessed, read.n)
+	pv.Set(label, 1.0, 0)
+
+	return nil
+}
+
+// extractFile extracts a single file from the tar reader
+func extractFile(tarReader io.Reader, path string, mode os.FileMode) error {
+	// Create the file
+	outFile, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	// Copy content
+	if _, err := io.Copy(outFile, tarReader); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// fileWriters writes files of an archive in the background, bounded by the
+// number of jobs. The first error is kept and stops the extraction.
+type fileWriters struct {
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	failure error
+}
+
+// newFileWriters returns writers for up to jobs files at the same time
+func newFileWriters(jobs int) *fileWriters {
+	return &fileWriters{sem: make(chan struct{}, max(jobs, 1))}
+}
+
+// write reads the current file of the tar reader into memory and writes it
+// to path in the background
+func (w *fileWriters) write(r io.Reader, path string, header *tar.Header, pv tui.ProgressReporter) error {
+	w.sem <- struct{}{} // Bounds the memory held as well
+	data, err := io.ReadAll(r)
+	if err != nil {
+		<-w.sem
+		return fmt.Errorf("failed to extract file %s: %w", path, err)
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.sem }()
+		if err := extractFile(bytes.NewReader(data), path, os.FileMode(header.Mode)); err != nil {
+			w.fail(fmt.Errorf("failed to extract file %s: %w", path, err))
+			return
+		}
+		pv.Completed(path, header.Size)
+	}()
+	return nil
+}
+
+// fail records the first error of a writer
+func (w *fileWriters) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failure == nil {
+		w.failure = err
+	}
+}
+
+// err returns the first error of a writer so far
+func (w *fileWriters) err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failure
+}
+
+// wait waits for the running writers and returns their first error
+func (w *fileWriters) wait() error {
+	w.wg.Wait()
+	return w.err()
+}
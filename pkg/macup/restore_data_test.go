@@ -0,0 +1,75 @@
+package macup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+func TestRestoreLinks(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "Projects")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"latest", "replaced"} {
+		if err := os.Symlink("notes.txt", filepath.Join(src, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Links are archived as links, as with the default follow_symlinks
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := newArchiveWriter(store, "Projects.tar.gz", false, compression{format: compressionGzip}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Location{Path: src, links: map[string]bool{filepath.Join(src, "latest"): true, filepath.Join(src, "replaced"): true}}
+	for _, name := range []string{".", "notes.txt", "latest", "replaced"} {
+		if err := l.writeEntryNoMessage(w, filepath.Join(src, name), NopReporter{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	size, err := statArchive(store, "Projects.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore over a location that has the links already, one pointing
+	// elsewhere, and a file where the archive has a link
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "Projects")
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("elsewhere", filepath.Join(dst, "latest")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "replaced"), []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for run := range 2 {
+		if err := extractArchive(context.Background(), store, "Projects.tar.gz", size, "Projects", parent, 2, NopReporter{}); err != nil {
+			t.Fatalf("restore %d: extractArchive() = %v", run+1, err)
+		}
+		for _, link := range []string{"latest", "replaced"} {
+			if target, err := os.Readlink(filepath.Join(dst, link)); err != nil || target != "notes.txt" {
+				t.Errorf("restore %d: %s links to %q, %v, want notes.txt", run+1, link, target, err)
+			}
+		}
+		if content, err := os.ReadFile(filepath.Join(dst, "latest")); err != nil || string(content) != "notes" {
+			t.Errorf("restore %d: reading through the link = %q, %v", run+1, content, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package macup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"time"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// retrievalPoll is how often restore checks on archives being retrieved
+const retrievalPoll = 5 * time.Minute
+
+// retrieveArchives requests the retrieval of archives in cold storage. Unless
+// wait is set, restore can't continue until they are readable again.
+func retrieveArchives(config *Config, store storage.Storage, wait bool) error {
+	cold, ok := store.(storage.ColdStorage)
+	if !ok {
+		return nil
+	}
+
+	frozen, err := frozenArchives(config, store, cold)
+	if err != nil || len(frozen) == 0 {
+		return err
+	}
+
+	for _, name := range frozen {
+		if err := cold.Retrieve(name); err != nil {
+			return fmt.Errorf("failed to request retrieval of %s: %w", name, err)
+		}
+	}
+
+	slog.Info(fmt.Sprintf("%d of %d archives are in cold storage, their retrieval was requested.", len(frozen), len(archiveNames(config))))
+	slog.Info("Retrieval usually takes 3-5 hours (up to 48 hours from deep archive).")
+	if !wait {
+		return fmt.Errorf("archives are not retrieved yet, run restore again later or pass --wait")
+	}
+
+	for len(frozen) > 0 {
+		slog.Info(fmt.Sprintf("Waiting for %d archives, checking again at %s", len(frozen), time.Now().Add(retrievalPoll).Format("15:04")))
+		time.Sleep(retrievalPoll)
+
+		if frozen, err = frozenArchives(config, store, cold); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// archiveNames returns the names of all archives the config produces
+func archiveNames(config *Config) []string {
+	names := make([]string, 0, len(config.Data.Locations)+1)
+	for _, loc := range config.Data.Locations {
+		names = append(names, loc.archiveName())
+	}
+	if config.Dotfiles.enabled() {
+		names = append(names, dotfilesArchive)
+	}
+	return names
+}
+
+// frozenArchives returns all archives of the config that are in cold storage,
+// the parts of split ones each
+func frozenArchives(config *Config, store storage.Storage, cold storage.ColdStorage) ([]string, error) {
+	var frozen []string
+	for _, name := range archiveNames(config) {
+		objects, _, err := archiveObjects(store, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // Reported when restoring the location
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to check storage class of %s: %w", name, err)
+		}
+		for _, object := range objects {
+			isFrozen, err := cold.Frozen(object)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check storage class of %s: %w", object, err)
+			}
+			if isFrozen {
+				frozen = append(frozen, object)
+			}
+		}
+	}
+	return frozen, nil
+}
@@ -0,0 +1,165 @@
+package macup
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// redacted replaces secrets in the effective config
+const redacted = "[redacted]"
+
+// Effective returns the config the way macup uses it, as YAML: with includes,
+// overlays, presets and defaults applied, paths expanded and secrets redacted.
+// Comments tell where locations came from and which are missing.
+func (c *Config) Effective() ([]byte, error) {
+	shown := *c
+	shown.Output = make([]string, len(c.Output))
+	for i, target := range c.Output {
+		shown.Output[i] = redactTarget(target)
+	}
+	shown.S3.SecretAccessKey = redact(c.S3.SecretAccessKey)
+	shown.WebDAV.Password = redact(c.WebDAV.Password)
+	shown.WebDAV.Token = redact(c.WebDAV.Token)
+	shown.Server.Token = redact(c.Server.Token)
+	shown.Notify.Webhooks = make([]Webhook, len(c.Notify.Webhooks))
+	for i, hook := range c.Notify.Webhooks {
+		hook.URL, hook.FailURL = redactWebhook(hook.URL), redactWebhook(hook.FailURL)
+		shown.Notify.Webhooks[i] = hook
+	}
+	shown.Notify.Email.Password = redact(c.Notify.Email.Password)
+
+	shown.Data.Locations = make([]Location, len(c.Data.Locations))
+	for i, loc := range c.Data.Locations {
+		loc.Path = loc.displayPath()
+		loc.Output = make([]string, len(c.Data.Locations[i].Output))
+		for j, target := range c.Data.Locations[i].Output {
+			if expanded, err := expandTarget(target); err == nil {
+				target = expanded
+			}
+			loc.Output[j] = redactTarget(target)
+		}
+		shown.Data.Locations[i] = loc
+	}
+	shown.Dotfiles.Files = make([]string, len(c.Dotfiles.Files))
+	for i, file := range c.Dotfiles.Files {
+		shown.Dotfiles.Files[i] = expandedPath(file)
+	}
+	shown.Dotfiles.Templates = make([]DotfileTemplate, len(c.Dotfiles.Templates))
+	for i, tmpl := range c.Dotfiles.Templates {
+		shown.Dotfiles.Templates[i] = DotfileTemplate{Path: expandedPath(tmpl.Path), Source: expandedPath(tmpl.Source)}
+	}
+
+	var root yaml.Node
+	if err := root.Encode(shown); err != nil {
+		return nil, err
+	}
+	pruneNode(&root)
+
+	// Explain what isn't in the config file itself
+	if c.profile != "" {
+		root.HeadComment = "Profile " + c.profile
+	}
+	if key := mappingKey(&root, "use_default_excludes"); key != nil {
+		key.LineComment = strings.Join(defaultExcludes, ", ")
+	} else {
+		// Turned off, unlike the other settings it defaults to on
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "use_default_excludes"},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "false"})
+	}
+	if data := mappingValue(&root, "data"); data != nil {
+		if locations := mappingValue(data, "locations"); locations != nil {
+			for i, loc := range c.Data.Locations {
+				locations.Content[i].HeadComment = locationComment(loc)
+			}
+		}
+	}
+
+	return encodeNode("yaml", &root)
+}
+
+// locationComment tells where a location came from and whether it exists
+func locationComment(loc Location) string {
+	_, err := os.Stat(loc.displayPath())
+	switch {
+	case loc.optional && err != nil:
+		return "From an app preset, skipped since it doesn't exist"
+	case loc.optional:
+		return "From an app preset"
+	case loc.Optional && err != nil:
+		return "Skipped since it doesn't exist"
+	case err != nil:
+		return "Doesn't exist on this Mac"
+	}
+	return ""
+}
+
+// expandedPath returns a path with environment variables and ~ expanded, or
+// as written if that fails
+func expandedPath(path string) string {
+	if expanded, err := NormalizePath(path); err == nil {
+		return expanded
+	}
+	return path
+}
+
+// redact hides a secret, keeping whether it is set
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactTarget hides the password of an output URL
+func redactTarget(target string) string {
+	if !strings.Contains(target, "://") {
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	return u.Redacted()
+}
+
+// pruneNode removes the keys of a mapping and everything below it that hold
+// the zero value, so the config only shows what is set
+func pruneNode(node *yaml.Node) {
+	for _, child := range node.Content {
+		pruneNode(child)
+	}
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	content := node.Content[:0]
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if !emptyNode(node.Content[i+1]) {
+			content = append(content, node.Content[i], node.Content[i+1])
+		}
+	}
+	node.Content = content
+}
+
+// emptyNode reports whether a node holds no value
+func emptyNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!null":
+			return true
+		case "!!str":
+			return node.Value == ""
+		case "!!bool":
+			return node.Value == "false"
+		case "!!int":
+			return node.Value == "0"
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package macup
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/hinkolas/macup/internal/units"
+)
+
+// Actions when a location exceeds its max_size
+const (
+	overSizeWarn  = "warn"
+	overSizeAbort = "abort"
+)
+
+// largestFiles is the number of files listed when a location exceeds its max_size
+const largestFiles = 10
+
+// checkSize compares the scanned size of a location to its max_size. Over
+// budget it returns a warning listing the largest files, or fails the
+// location if on_max_size is "abort".
+func (l *Location) checkSize() (string, error) {
+	if l.MaxSize == "" {
+		return "", nil
+	}
+	limit, err := units.ParseSize(l.MaxSize)
+	if err != nil || limit == 0 || l.totalSize <= limit {
+		return "", nil
+	}
+
+	msg := fmt.Sprintf("%s is over the max_size of %s, the largest files are:", units.FormatSize(l.totalSize), l.MaxSize)
+	for _, file := range l.largestFiles() {
+		msg += "\n  - " + file
+	}
+	if l.OnMaxSize == overSizeAbort {
+		return "", errors.New(msg)
+	}
+	return l.label() + ": " + msg, nil
+}
+
+// largestFiles returns the largest files of the index with their size
+func (l *Location) largestFiles() []string {
+	type file struct {
+		path string
+		size int64
+	}
+	var files []file
+	for _, path := range l.index {
+		if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+			files = append(files, file{path, info.Size()})
+		}
+	}
+	slices.SortFunc(files, func(a, b file) int { return cmp.Compare(b.size, a.size) })
+
+	list := make([]string, 0, largestFiles)
+	for _, f := range files[:min(len(files), largestFiles)] {
+		rel, err := filepath.Rel(l.Path, f.path)
+		if err != nil {
+			rel = f.path
+		}
+		list = append(list, fmt.Sprintf("%s (%s)", rel, units.FormatSize(f.size)))
+	}
+	return list
+}
+
+// printWarnings shows the warnings of a run, after its progress view
+func printWarnings(warnings []string) {
+	for _, warning := range warnings {
+		slog.Warn(warning)
+	}
+}
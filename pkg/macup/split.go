@@ -0,0 +1,275 @@
+package macup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// Archives with a split_size are stored in parts named after the archive,
+// e.g. "Projects.tar.zst.001", which concatenated are the archive. Stores are
+// read through openArchive and statArchive, which find either form.
+
+// partName returns the name of part n of a split archive, counting from 1
+func partName(name string, n int) string {
+	return fmt.Sprintf("%s.%03d", name, n)
+}
+
+// partOf returns the archive an object is a part of, or "" if it is none
+func partOf(name string) string {
+	i := strings.LastIndex(name, ".")
+	if i < 0 || len(name)-i-1 < 3 || !isArchive(name[:i]) {
+		return ""
+	}
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return ""
+	}
+	return name[:i]
+}
+
+// joinParts replaces the parts of split archives in a listing with the
+// archive they belong to
+func joinParts(names []string) []string {
+	joined := make([]string, 0, len(names))
+	for _, name := range names {
+		if base := partOf(name); base != "" {
+			name = base
+		}
+		if !slices.Contains(joined, name) {
+			joined = append(joined, name)
+		}
+	}
+	return joined
+}
+
+// archiveObjects returns the objects an archive is stored in, the archive
+// itself or its parts in order. Archives that don't exist are an
+// fs.ErrNotExist error.
+func archiveObjects(store storage.Storage, name string) ([]string, []int64, error) {
+	size, err := store.Stat(name)
+	if err == nil {
+		return []string{name}, []int64{size}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	var parts []string
+	var sizes []int64
+	for n := 1; ; n++ {
+		size, partErr := store.Stat(partName(name, n))
+		if errors.Is(partErr, fs.ErrNotExist) {
+			break
+		}
+		if partErr != nil {
+			return nil, nil, partErr
+		}
+		parts = append(parts, partName(name, n))
+		sizes = append(sizes, size)
+	}
+	if len(parts) == 0 {
+		return nil, nil, err
+	}
+	return parts, sizes, nil
+}
+
+// statArchive returns the size of an archive, of all its parts if it is split
+func statArchive(store storage.Storage, name string) (int64, error) {
+	_, sizes, err := archiveObjects(store, name)
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	return total, err
+}
+
+// openArchive streams an archive, joining its parts if it is split
+func openArchive(store storage.Storage, name string) (io.ReadCloser, error) {
+	r, err := store.Open(name)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
+	part, partErr := store.Open(partName(name, 1))
+	if errors.Is(partErr, fs.ErrNotExist) {
+		return nil, err
+	}
+	if partErr != nil {
+		return nil, partErr
+	}
+	return &partReader{store: store, name: name, n: 1, part: part}, nil
+}
+
+// removeArchive removes an archive with all its parts
+func removeArchive(store storage.Storage, name string) error {
+	objects, _, err := archiveObjects(store, name)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := store.Remove(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partReader reads the parts of a split archive one after another
+type partReader struct {
+	store storage.Storage
+	name  string
+	n     int // Number of the part being read
+	part  io.ReadCloser
+}
+
+func (r *partReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.part.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+
+		// Go on with the next part, the archive ends with the last one
+		next, openErr := r.store.Open(partName(r.name, r.n+1))
+		if errors.Is(openErr, fs.ErrNotExist) {
+			return n, io.EOF
+		}
+		if openErr != nil {
+			return n, fmt.Errorf("failed to open part %d: %w", r.n+1, openErr)
+		}
+		r.part.Close()
+		r.part, r.n = next, r.n+1
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *partReader) Close() error {
+	return r.part.Close()
+}
+
+// splitWriter writes an archive in parts of a fixed size, or as a single
+// object without one. The parts are committed together once the archive is
+// complete, then whatever an earlier backup of another split size left
+// behind is removed.
+type splitWriter struct {
+	store   storage.Storage
+	name    string
+	size    int64 // Bytes per part, 0 writes a single object
+	parts   []storage.Writer
+	written int64 // Bytes written to the last part
+}
+
+var _ storage.Suspender = (*splitWriter)(nil)
+
+// newSplitWriter creates the first object of an archive in the storage
+func newSplitWriter(store storage.Storage, name string, size int64) (*splitWriter, error) {
+	w := &splitWriter{store: store, name: name, size: size}
+	if err := w.nextPart(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// nextPart starts another part, or the single object without a split size
+func (w *splitWriter) nextPart() error {
+	name := w.name
+	if w.size > 0 {
+		name = partName(w.name, len(w.parts)+1)
+	}
+	part, err := w.store.Create(name)
+	if err != nil {
+		return err
+	}
+	w.parts = append(w.parts, part)
+	w.written = 0
+	return nil
+}
+
+func (w *splitWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.size > 0 && w.written == w.size {
+			if err := w.nextPart(); err != nil {
+				return total, err
+			}
+		}
+		chunk := p
+		if w.size > 0 {
+			chunk = p[:min(int64(len(p)), w.size-w.written)]
+		}
+		n, err := w.parts[len(w.parts)-1].Write(chunk)
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close commits the parts in order and removes those of an earlier backup
+// that are no longer needed
+func (w *splitWriter) Close() error {
+	for i, part := range w.parts {
+		if err := part.Close(); err != nil {
+			for _, rest := range w.parts[i+1:] {
+				rest.Abort()
+			}
+			return err
+		}
+	}
+
+	// An archive written whole replaces all parts, a split one the whole
+	// archive and the parts beyond its last
+	var stale []string
+	first := 1
+	if w.size > 0 {
+		if _, err := w.store.Stat(w.name); err == nil {
+			stale = append(stale, w.name)
+		}
+		first = len(w.parts) + 1
+	}
+	for n := first; ; n++ {
+		if _, err := w.store.Stat(partName(w.name, n)); err != nil {
+			break
+		}
+		stale = append(stale, partName(w.name, n))
+	}
+	for _, name := range stale {
+		if err := w.store.Remove(name); err != nil {
+			return fmt.Errorf("failed to remove %s of an earlier backup: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Abort discards all parts
+func (w *splitWriter) Abort() error {
+	var errs []error
+	for _, part := range w.parts {
+		errs = append(errs, part.Abort())
+	}
+	return errors.Join(errs...)
+}
+
+// Suspend keeps the parts of storages that can resume them and discards the
+// others
+func (w *splitWriter) Suspend() error {
+	var errs []error
+	for _, part := range w.parts {
+		if s, ok := part.(storage.Suspender); ok {
+			errs = append(errs, s.Suspend())
+		} else {
+			errs = append(errs, part.Abort())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,106 @@
+package macup
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// writeSplit writes data as an archive in parts of size
+func writeSplit(t *testing.T, store storage.Storage, name string, data []byte, size int64) {
+	t.Helper()
+	w, err := newSplitWriter(store, name, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Odd writes cross the part boundaries
+	for chunk := range slices.Chunk(data, 7) {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitArchive(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10)
+
+	tests := []struct {
+		name    string
+		sizes   []int64 // Split sizes of successive backups
+		objects []string
+	}{
+		{"whole", []int64{0}, []string{"a.tar.gz"}},
+		{"split", []int64{30}, []string{"a.tar.gz.001", "a.tar.gz.002", "a.tar.gz.003", "a.tar.gz.004"}},
+		{"exact parts", []int64{50}, []string{"a.tar.gz.001", "a.tar.gz.002"}},
+		{"split after whole", []int64{0, 50}, []string{"a.tar.gz.001", "a.tar.gz.002"}},
+		{"whole after split", []int64{30, 0}, []string{"a.tar.gz"}},
+		{"fewer parts", []int64{30, 50}, []string{"a.tar.gz.001", "a.tar.gz.002"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := storage.NewLocal(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, size := range tt.sizes {
+				writeSplit(t, store, "a.tar.gz", data, size)
+			}
+
+			names, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.objects) {
+				t.Errorf("objects = %v, want %v", names, tt.objects)
+			}
+			if joined := joinParts(names); !slices.Equal(joined, []string{"a.tar.gz"}) {
+				t.Errorf("joinParts() = %v, want [a.tar.gz]", joined)
+			}
+
+			size, err := statArchive(store, "a.tar.gz")
+			if err != nil || size != int64(len(data)) {
+				t.Errorf("statArchive() = %d, %v, want %d", size, err, len(data))
+			}
+			r, err := openArchive(store, "a.tar.gz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, err := io.ReadAll(r)
+			r.Close()
+			if err != nil || !bytes.Equal(read, data) {
+				t.Errorf("openArchive() read %q, %v", read, err)
+			}
+
+			if err := removeArchive(store, "a.tar.gz"); err != nil {
+				t.Fatal(err)
+			}
+			if names, _ := store.List(); len(names) != 0 {
+				t.Errorf("removeArchive() left %v", names)
+			}
+		})
+	}
+}
+
+func TestPartOf(t *testing.T) {
+	tests := map[string]string{
+		"Projects.tar.zst.001": "Projects.tar.zst",
+		"Projects.tar.1000":    "Projects.tar",
+		"Projects.tar.zst":     "",
+		"Projects.tar.zst.1":   "",
+		"Brewfile.001":         "",
+		"notes.txt.abc":        "",
+	}
+	for name, want := range tests {
+		if got := partOf(name); got != want {
+			t.Errorf("partOf(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
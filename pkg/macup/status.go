@@ -0,0 +1,84 @@
+package macup
+
+import (
+	"time"
+
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// Status is what `macup status` reports about the backups of a config
+type Status struct {
+	Outputs   []OutputStatus   `json:"outputs"`
+	Locations []LocationStatus `json:"locations"`
+	Daemon    *DaemonState     `json:"daemon,omitempty"` // The running `macup daemon`, if any
+}
+
+// OutputStatus describes the backup in an output target
+type OutputStatus struct {
+	Target     string    `json:"target"`
+	LastBackup time.Time `json:"last_backup"`     // Zero if the target holds no backup yet
+	Free       int64     `json:"free"`            // Free space in bytes, -1 if unknown
+	Error      string    `json:"error,omitempty"` // Why the target couldn't be read
+}
+
+// LocationStatus describes the last backup of a location
+type LocationStatus struct {
+	Location   string    `json:"location"`
+	Path       string    `json:"path"`
+	LastBackup time.Time `json:"last_backup"` // Zero if it was never backed up
+	Size       int64     `json:"size"`        // Compressed size of the last archive
+	Missing    bool      `json:"missing"`     // Optional and not on this Mac, nothing to back up
+}
+
+// Status reads the manifests of all output targets and reports when each
+// location was backed up last, in any of them
+func (c *Config) Status() Status {
+	var status Status
+	latest := make(map[string]ManifestLocation)
+	for _, target := range outputTargets(c) {
+		output := OutputStatus{Target: redactTarget(target), Free: -1}
+		store, err := storage.New(target, c.StorageOptions())
+		if err != nil {
+			output.Error = err.Error()
+			status.Outputs = append(status.Outputs, output)
+			continue
+		}
+		if reporter, ok := store.(storage.SpaceReporter); ok {
+			if free, err := reporter.Free(); err == nil {
+				output.Free = free
+			}
+		}
+		manifest, err := readManifest(store)
+		if err != nil {
+			output.Error = err.Error()
+		}
+		if manifest != nil {
+			output.LastBackup = manifest.CreatedAt
+			for _, entry := range manifest.Locations {
+				// Manifests of older versions only have the time of the run
+				if entry.BackedUpAt.IsZero() {
+					entry.BackedUpAt = manifest.CreatedAt
+				}
+				if entry.BackedUpAt.After(latest[entry.Path].BackedUpAt) {
+					latest[entry.Path] = entry
+				}
+			}
+		}
+		status.Outputs = append(status.Outputs, output)
+	}
+
+	for _, loc := range c.Data.Locations {
+		entry := latest[loc.Path]
+		status.Locations = append(status.Locations, LocationStatus{
+			Location:   loc.label(),
+			Path:       loc.displayPath(),
+			LastBackup: entry.BackedUpAt,
+			Size:       entry.Size,
+			Missing:    loc.missing(),
+		})
+	}
+	if state, err := readDaemonState(); err == nil {
+		status.Daemon = state
+	}
+	return status
+}
@@ -0,0 +1,78 @@
+package macup
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Values of follow_symlinks
+const (
+	symlinksKeep     = "false"
+	symlinksFollow   = "true"
+	symlinksExternal = "external-only"
+)
+
+// symlinkPolicy normalizes a follow_symlinks value. Written as a bool it is
+// decoded as "1" or "0".
+func symlinkPolicy(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", "false", "0":
+		return symlinksKeep, nil
+	case "true", "1":
+		return symlinksFollow, nil
+	case symlinksExternal:
+		return symlinksExternal, nil
+	}
+	return "", fmt.Errorf("unknown follow_symlinks %q, expected true, false or %q", s, symlinksExternal)
+}
+
+// linkFollower decides which links of a location are archived with their
+// target instead of as links
+type linkFollower struct {
+	policy  string
+	root    string          // The location with its links resolved
+	visited map[string]bool // Directories walked so far, none is walked twice
+}
+
+// newLinkFollower creates a linkFollower for a location and its follow_symlinks
+func newLinkFollower(root, policy string) *linkFollower {
+	policy, _ = symlinkPolicy(policy) // Validated when the config is loaded
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	return &linkFollower{policy: policy, root: root, visited: map[string]bool{root: true}}
+}
+
+// follow reports whether a link is archived with its target and returns the
+// target. Dangling links, loops and links to directories that were walked
+// already stay links.
+func (f *linkFollower) follow(path string) (fs.FileInfo, bool) {
+	if f.policy == symlinksKeep {
+		return nil, false
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil || (f.policy == symlinksExternal && within(target, f.root)) {
+		return nil, false
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, false
+	}
+	if info.IsDir() {
+		parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil || f.visited[target] || within(parent, target) {
+			return nil, false
+		}
+		f.visited[target] = true
+	}
+	return info, true
+}
+
+// within reports whether a path is dir or below it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
@@ -0,0 +1,163 @@
+package macup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/hinkolas/macup/internal/storage"
+	"github.com/hinkolas/macup/internal/tui"
+)
+
+// Sync replicates a backup from one storage to another. Objects that already
+// exist at the destination with the same size and checksum are skipped, and
+// every copied archive is verified against the checksum in the manifest.
+func Sync(from, to string, opts StorageOptions) error {
+	src, err := storage.New(from, opts)
+	if err != nil {
+		return fmt.Errorf("failed to open source: %w", err)
+	}
+	dst, err := storage.New(to, opts)
+	if err != nil {
+		return fmt.Errorf("failed to open destination: %w", err)
+	}
+
+	names, err := src.List()
+	if err != nil {
+		return fmt.Errorf("failed to list source: %w", err)
+	}
+	if !slices.ContainsFunc(bundledConfigs, func(name string) bool { return slices.Contains(names, name) }) {
+		return fmt.Errorf("%s doesn't contain a backup", src)
+	}
+
+	// Copy the manifest last so the destination only references complete archives
+	names = slices.DeleteFunc(names, func(name string) bool { return name == manifestName })
+	srcManifest, err := readManifest(src)
+	if err != nil {
+		return fmt.Errorf("failed to read source manifest: %w", err)
+	}
+	dstManifest, err := readManifest(dst)
+	if err != nil {
+		return fmt.Errorf("failed to read destination manifest: %w", err)
+	}
+
+	// Create the progress reporter with "Copying" prefix
+	pv := tui.NewReporter("Copying", Theme{})
+	for _, name := range names {
+		pv.Add(name, 0.0, 0)
+		if expected, ok := srcManifest.archive(name); ok {
+			pv.Expect(name, expected.Size)
+		}
+	}
+
+	for _, name := range names {
+		expected, _ := srcManifest.archive(name)
+
+		// Skip objects the destination already has
+		if existing, ok := dstManifest.archive(name); ok && expected.SHA256 != "" && existing.SHA256 == expected.SHA256 {
+			if size, err := dst.Stat(name); err == nil && size == expected.Size {
+				pv.Skip(name, "up to date")
+				continue
+			}
+		}
+
+		if err := syncObject(src, dst, name, expected.SHA256, pv); err != nil {
+			pv.Clear()
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+
+	if srcManifest != nil {
+		if err := writeManifest(dst, srcManifest); err != nil {
+			pv.Clear()
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
+	pv.Finish(fmt.Sprintf("✓ Backup synchronized from %s to %s", src, dst))
+
+	return nil
+}
+
+// syncObject copies a single object and verifies its size and checksum
+func syncObject(src, dst storage.Storage, name, checksum string, pv tui.ProgressReporter) error {
+	size, err := src.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	r, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := dst.Create(name)
+	if err != nil {
+		return err
+	}
+
+	// Copy while hashing and reporting progress
+	h := sha256.New()
+	progress := &progressReader{r: r, total: size, name: name, pv: pv, start: time.Now()}
+	if _, err := io.Copy(io.MultiWriter(w, h), progress); err != nil {
+		w.Abort()
+		return err
+	}
+	if progress.read != size {
+		w.Abort()
+		return fmt.Errorf("size mismatch: expected %d bytes, got %d", size, progress.read)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); checksum != "" && sum != checksum {
+		w.Abort()
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", checksum, sum)
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// Verify what arrived at the destination
+	if copied, err := dst.Stat(name); err != nil {
+		return err
+	} else if copied != size {
+		return fmt.Errorf("size mismatch at destination: expected %d bytes, got %d", size, copied)
+	}
+
+	pv.Message("")
+	pv.Done(name, true)
+
+	return nil
+}
+
+// progressReader reports the progress of reading an object to the progress view
+type progressReader struct {
+	r     io.Reader
+	read  int64
+	total int64
+	name  string
+	pv    tui.ProgressReporter
+	start time.Time
+}
+
+// Read reads from the underlying reader and updates progress and ETA
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+
+	if p.total > 0 {
+		progress := min(float64(p.read)/float64(p.total), 1.0)
+		elapsed := time.Since(p.start)
+		var eta time.Duration
+		if progress > 0 && progress < 1.0 {
+			eta = max(time.Duration(float64(elapsed)/progress)-elapsed, 0)
+		}
+		p.pv.Bytes(p.name, p.read, p.total)
+		p.pv.Set(p.name, progress, eta)
+	}
+
+	return n, err
+}
@@ -0,0 +1,459 @@
+package macup
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hinkolas/macup/internal/tui"
+	"github.com/hinkolas/macup/internal/units"
+	"go.yaml.in/yaml/v3"
+)
+
+// ConfigError is a problem in a config file, located by the line of its key
+type ConfigError struct {
+	File string // Included file the key is in, relative to the config file
+	Line int    // 0 if the key isn't in the file, e.g. for preset locations, or in a TOML file
+	Key  string // e.g. "data.locations[0].path"
+	Msg  string
+}
+
+func (e *ConfigError) Error() string {
+	switch {
+	case e.Line > 0 && e.File != "":
+		return fmt.Sprintf("line %d of %s: %s: %s", e.Line, e.File, e.Key, e.Msg)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Key, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Key, e.Msg)
+}
+
+// compareErrors orders errors by file and line, the config file itself and
+// errors without a line come first
+func compareErrors(a, b error) int {
+	var errA, errB *ConfigError
+	if !errors.As(a, &errA) {
+		errA = &ConfigError{}
+	}
+	if !errors.As(b, &errB) {
+		errB = &ConfigError{}
+	}
+	if c := strings.Compare(errA.File, errB.File); c != 0 {
+		return c
+	}
+	return errA.Line - errB.Line
+}
+
+// keyPosition is where a key is written
+type keyPosition struct {
+	file string // "" for the config file itself
+	line int
+}
+
+// configLines maps the keys of a config to their position
+type configLines map[string]keyPosition
+
+// problem returns a ConfigError for a key
+func (l configLines) problem(key, format string, args ...any) error {
+	pos := l[key]
+	return &ConfigError{File: pos.file, Line: pos.line, Key: key, Msg: fmt.Sprintf(format, args...)}
+}
+
+// checkKeys reports the keys of a config that no config field takes, which
+// viper would silently drop, e.g. a misspelled "locaton"
+func checkKeys(src *configSource) (configLines, []error) {
+	lines := make(configLines)
+	var errs []error
+	checkNode(src.root, reflect.TypeFor[Config](), "", src.files, lines, &errs)
+	for _, o := range src.overlays {
+		checkNode(o.node, reflect.TypeFor[Config](), o.key, src.files, lines, &errs)
+	}
+	return lines, errs
+}
+
+// checkNode checks the keys of a node against the type it is decoded into
+func checkNode(node *yaml.Node, t reflect.Type, key string, files map[*yaml.Node]string, lines configLines, errs *[]error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) > 0 {
+			checkNode(node.Content[0], t, key, files, lines, errs)
+		}
+		return
+	case yaml.AliasNode:
+		checkNode(node.Alias, t, key, files, lines, errs)
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			child := joinKey(key, k.Value)
+			lines[child] = keyPosition{files[k], k.Line}
+			field, ok := fieldForKey(t, k.Value)
+			if !ok {
+				msg := "unknown key"
+				if reason, ok := unsupportedKeys[strings.ToLower(k.Value)]; ok {
+					msg += ", " + reason
+				} else if suggestion := suggestKey(t, k.Value); suggestion != "" {
+					msg += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				*errs = append(*errs, lines.problem(child, "%s", msg))
+				continue
+			}
+			checkNode(v, field.Type, child, files, lines, errs)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			child := joinKey(key, node.Content[i].Value)
+			lines[child] = keyPosition{files[node.Content[i]], node.Content[i].Line}
+			checkNode(node.Content[i+1], t.Elem(), child, files, lines, errs)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			child := fmt.Sprintf("%s[%d]", key, i)
+			lines[child] = keyPosition{files[item], item.Line}
+			checkNode(item, t.Elem(), child, files, lines, errs)
+		}
+	}
+	// Values of the wrong type are reported by the decoder
+}
+
+// unsupportedKeys are settings macup doesn't have, with what to do instead
+var unsupportedKeys = map[string]string{
+	"encryption": "macup doesn't encrypt archives, back up to an encrypted volume instead",
+}
+
+// joinKey appends a key to the path of its parent
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// keyName returns the key a field is decoded from, like mapstructure does
+func keyName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
+
+// fieldForKey finds the exported field a key is decoded into
+func fieldForKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	for _, field := range reflect.VisibleFields(t) {
+		if field.IsExported() && strings.EqualFold(keyName(field), key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// suggestKey returns the known key closest to a misspelled one
+func suggestKey(t reflect.Type, key string) string {
+	best, bestDistance := "", 3 // Only suggest close matches
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() {
+			continue
+		}
+		name := keyName(field)
+		if d := editDistance(strings.ToLower(key), name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance of two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// validate checks the values of a decoded config
+func (c *Config) validate(lines configLines) []error {
+	var errs []error
+
+	if c.VolumeWait != "" {
+		if _, err := time.ParseDuration(c.VolumeWait); err != nil {
+			errs = append(errs, lines.problem("volume_wait", "invalid duration %q, e.g. \"10m\"", c.VolumeWait))
+		}
+	}
+	if c.Retries < 0 {
+		errs = append(errs, lines.problem("retries", "must not be negative"))
+	}
+	for i, target := range c.Output {
+		if _, err := expandEnv(target); err != nil {
+			errs = append(errs, lines.problem(fmt.Sprintf("output[%d]", i), "%v", err))
+		}
+	}
+	if _, err := parseCompression(c.Compression); err != nil {
+		errs = append(errs, lines.problem("compression", "%v", err))
+	}
+	if c.SplitSize != "" {
+		if _, err := units.ParseSize(c.SplitSize); err != nil {
+			errs = append(errs, lines.problem("split_size", "%v", err))
+		}
+	}
+	if c.OnFileError != "" && c.OnFileError != fileErrorSkip && c.OnFileError != fileErrorFail {
+		errs = append(errs, lines.problem("on_file_error", "unknown action %q, expected %q or %q", c.OnFileError, fileErrorSkip, fileErrorFail))
+	}
+	if d := c.Notify.Desktop; d != "" && d != NotifyAlways && d != NotifyFailure && d != NotifyNever {
+		errs = append(errs, lines.problem("notify.desktop", "unknown value %q, expected %q, %q or %q", d, NotifyAlways, NotifyFailure, NotifyNever))
+	}
+	for i, hook := range c.Notify.Webhooks {
+		key := fmt.Sprintf("notify.webhooks[%d]", i)
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, lines.problem(key+".url", "expected an http or https URL"))
+		}
+		if hook.Format != "" && !slices.Contains(webhookFormats, hook.Format) {
+			errs = append(errs, lines.problem(key+".format", "unknown format %q, expected one of %s", hook.Format, strings.Join(webhookFormats, ", ")))
+		}
+		if hook.On != "" && hook.On != NotifyAlways && hook.On != NotifyFailure {
+			errs = append(errs, lines.problem(key+".on", "unknown value %q, expected %q or %q", hook.On, NotifyAlways, NotifyFailure))
+		}
+	}
+	if _, ok := lines["notify.email"]; ok {
+		email := c.Notify.Email
+		if len(email.To) == 0 {
+			errs = append(errs, lines.problem("notify.email", "to is required"))
+		}
+		if email.SMTP != "" {
+			if _, _, err := net.SplitHostPort(email.SMTP); err != nil {
+				errs = append(errs, lines.problem("notify.email.smtp", "expected host:port, e.g. \"smtp.example.com:587\""))
+			}
+		}
+		if email.On != "" && email.On != NotifyAlways && email.On != NotifyFailure {
+			errs = append(errs, lines.problem("notify.email.on", "unknown value %q, expected %q or %q", email.On, NotifyAlways, NotifyFailure))
+		}
+	}
+	if err := tui.CheckAccent(c.Theme.Accent); err != nil {
+		errs = append(errs, lines.problem("theme.accent", "%v", err))
+	}
+	if err := tui.CheckBar(c.Theme.Bar); err != nil {
+		errs = append(errs, lines.problem("theme.bar", "%v", err))
+	}
+	for i, pattern := range c.Exclude {
+		if err := checkPattern(pattern); err != nil {
+			errs = append(errs, lines.problem(fmt.Sprintf("exclude[%d]", i), "%v", err))
+		}
+	}
+
+	seen := make(map[string]string)
+	names := make(map[string]string) // Archive names of named locations, in lower case
+	for i, loc := range c.Data.Locations {
+		key := fmt.Sprintf("data.locations[%d]", i)
+		if loc.Path == "" {
+			errs = append(errs, lines.problem(key, "path is required"))
+			continue
+		}
+		if err := checkPath(loc.Path); err != nil {
+			errs = append(errs, lines.problem(key+".path", "%v", err))
+		}
+		if other, ok := seen[loc.Path]; ok {
+			errs = append(errs, lines.problem(key+".path", "%s is listed twice, see %s", loc.Path, other))
+		}
+		seen[loc.Path] = key
+		if loc.Name != "" {
+			// Archive names must differ on case-insensitive volumes as well
+			slug := strings.ToLower(nameSlug(loc.Name))
+			switch other, ok := names[slug]; {
+			case slug == "":
+				errs = append(errs, lines.problem(key+".name", "%q has no letters or digits to name the archive by", loc.Name))
+			case slug == strings.TrimSuffix(dotfilesArchive, ".tar.gz"):
+				errs = append(errs, lines.problem(key+".name", "%q is taken by the dotfiles archive", loc.Name))
+			case ok:
+				errs = append(errs, lines.problem(key+".name", "%q names the same archive as %s", loc.Name, other))
+			}
+			names[slug] = key
+		}
+		for j, target := range loc.Output {
+			if _, err := expandEnv(target); err != nil {
+				errs = append(errs, lines.problem(fmt.Sprintf("%s.output[%d]", key, j), "%v", err))
+			}
+		}
+		if loc.Compression != "" {
+			if _, err := parseCompression(loc.Compression); err != nil {
+				errs = append(errs, lines.problem(key+".compression", "%v", err))
+			}
+		}
+		if loc.SplitSize != "" {
+			if _, err := units.ParseSize(loc.SplitSize); err != nil {
+				errs = append(errs, lines.problem(key+".split_size", "%v", err))
+			}
+		}
+		if loc.MaxSize != "" {
+			if _, err := units.ParseSize(loc.MaxSize); err != nil {
+				errs = append(errs, lines.problem(key+".max_size", "%v", err))
+			}
+		}
+		if loc.OnMaxSize != "" && loc.OnMaxSize != overSizeWarn && loc.OnMaxSize != overSizeAbort {
+			errs = append(errs, lines.problem(key+".on_max_size", "unknown action %q, expected %q or %q", loc.OnMaxSize, overSizeWarn, overSizeAbort))
+		}
+		if loc.OnFileError != "" && loc.OnFileError != fileErrorSkip && loc.OnFileError != fileErrorFail {
+			errs = append(errs, lines.problem(key+".on_file_error", "unknown action %q, expected %q or %q", loc.OnFileError, fileErrorSkip, fileErrorFail))
+		}
+		if _, err := symlinkPolicy(loc.FollowSymlinks); err != nil {
+			errs = append(errs, lines.problem(key+".follow_symlinks", "%v", err))
+		}
+		if loc.GitMode != "" && loc.GitMode != gitModeRemotes {
+			errs = append(errs, lines.problem(key+".git_mode", "unknown git_mode %q, expected %q", loc.GitMode, gitModeRemotes))
+		}
+		for j, pattern := range loc.Ignore {
+			if err := checkPattern(pattern); err != nil {
+				errs = append(errs, lines.problem(fmt.Sprintf("%s.ignore[%d]", key, j), "%v", err))
+			}
+		}
+		for j, pattern := range loc.Include {
+			if err := checkPattern(pattern); err != nil {
+				errs = append(errs, lines.problem(fmt.Sprintf("%s.include[%d]", key, j), "%v", err))
+			}
+		}
+	}
+
+	for i, file := range c.Dotfiles.Files {
+		key := fmt.Sprintf("dotfiles.files[%d]", i)
+		if file == "" {
+			errs = append(errs, lines.problem(key, "path is required"))
+		} else if _, err := expandEnv(file); err != nil {
+			errs = append(errs, lines.problem(key, "%v", err))
+		}
+	}
+	for i, tmpl := range c.Dotfiles.Templates {
+		key := fmt.Sprintf("dotfiles.templates[%d]", i)
+		if tmpl.Path == "" || tmpl.Source == "" {
+			errs = append(errs, lines.problem(key, "path and source are required"))
+			continue
+		}
+		for _, field := range []struct{ name, path string }{{"path", tmpl.Path}, {"source", tmpl.Source}} {
+			if _, err := expandEnv(field.path); err != nil {
+				errs = append(errs, lines.problem(key+"."+field.name, "%v", err))
+			}
+		}
+	}
+	for i, domain := range c.Defaults {
+		if domain.Domain == "" {
+			errs = append(errs, lines.problem(fmt.Sprintf("defaults[%d]", i), "domain is required"))
+		}
+	}
+	for i, tweak := range c.Tweaks {
+		if tweak.Run == "" {
+			errs = append(errs, lines.problem(fmt.Sprintf("tweaks[%d]", i), "run is required"))
+		}
+	}
+
+	return errs
+}
+
+// overlaps finds locations inside other locations, whose files would be
+// archived twice and restored in an ambiguous order. Directories the outer
+// location ignores and locations with allow_overlap are left out.
+func (c *Config) overlaps(lines configLines) []error {
+	var warnings []error
+	for i, inner := range c.Data.Locations {
+		for j, outer := range c.Data.Locations {
+			if i == j || inner.Path == outer.Path || inner.AllowOverlap || outer.AllowOverlap {
+				continue
+			}
+			rel, err := filepath.Rel(outer.displayPath(), inner.displayPath())
+			if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+				continue
+			}
+			key := fmt.Sprintf("data.locations[%d].path", i)
+			switch {
+			case rel == "." && i > j:
+				warnings = append(warnings, lines.problem(key, "%s is the same directory as data.locations[%d]", inner.Path, j))
+			case rel != "." && !outer.ignores(filepath.ToSlash(rel), c.excludes()):
+				warnings = append(warnings, lines.problem(key, "%s is inside %s of data.locations[%d] and archived twice, ignore it there or set allow_overlap", inner.Path, outer.Path, j))
+			}
+		}
+	}
+	slices.SortStableFunc(warnings, compareErrors)
+	return warnings
+}
+
+// ignores reports whether the location leaves out a directory below it,
+// given relative to the location. Bundles are archived as a whole.
+func (l Location) ignores(rel string, excludes []string) bool {
+	if l.Bundle {
+		return false
+	}
+	rules := parseIgnore(append(slices.Clone(excludes), l.Ignore...))
+	segments := strings.Split(rel, "/")
+	for i := range segments {
+		if rules.ignored(strings.Join(segments[:i+1], "/"), true) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPath reports location paths with unset environment variables and
+// relative paths, which depend on the working directory
+func checkPath(path string) error {
+	expanded, err := expandEnv(path)
+	if err != nil {
+		return err
+	}
+	if expanded != "~" && !strings.HasPrefix(expanded, "~/") && !strings.HasPrefix(expanded, "/") {
+		return fmt.Errorf("relative path %q depends on the working directory, start it with /, ~/ or $HOME", path)
+	}
+	return nil
+}
+
+// checkPattern reports malformed globs in a gitignore style pattern
+func checkPattern(pattern string) error {
+	p, ok := parsePattern(pattern)
+	if !ok {
+		return nil
+	}
+	for _, segment := range p.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// MissingLocations returns the configured locations that don't exist on this
+// Mac. Optional locations and those of app presets are left out, they are
+// skipped if missing.
+func (c *Config) MissingLocations() []string {
+	var missing []string
+	for _, loc := range c.Data.Locations {
+		if loc.optional || loc.Optional {
+			continue
+		}
+		if _, err := os.Stat(loc.displayPath()); errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, loc.Path)
+		}
+	}
+	return missing
+}
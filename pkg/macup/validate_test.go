@@ -0,0 +1,83 @@
+package macup
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{"known keys", "verify: true\ndata:\n  locations:\n    - path: ~/Documents\n      git_mode: remotes", nil},
+		{"misspelled key", "verfiy: true", []string{`line 1: verfiy: unknown key, did you mean "verify"?`}},
+		{"nested key", "data:\n  locations:\n    - path: ~/Documents\n      ignroe: [x]", []string{`line 4: data.locations[0].ignroe: unknown key, did you mean "ignore"?`}},
+		{"mapstructure name", "skip_unchaged: true", []string{`line 1: skip_unchaged: unknown key, did you mean "skip_unchanged"?`}},
+		{"unsupported key", "data:\n  locations:\n    - path: ~/Documents\n      encryption: age", []string{"line 4: data.locations[0].encryption: unknown key, macup doesn't encrypt archives, back up to an encrypted volume instead"}},
+		{"nothing close", "colour_scheme: dark", []string{"line 1: colour_scheme: unknown key"}},
+		{"map keys are free", "presets:\n  my-app:\n    paths: [~/Library/MyApp]", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseNode("yaml", []byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, errs := checkKeys(&configSource{root: root})
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("checkKeys() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string // Part of the error, "" if the config is valid
+	}{
+		{"valid", "data:\n  locations:\n    - path: ~/Documents\n      ignore: ['*.log']", ""},
+		{"missing path", "data:\n  locations:\n    - ignore: [x]", "line 3: data.locations[0]: path is required"},
+		{"relative path", "data:\n  locations:\n    - path: Documents", "line 3: data.locations[0].path: relative path"},
+		{"listed twice", "data:\n  locations:\n    - path: ~/Documents\n    - path: ~/Documents", "line 4: data.locations[1].path: ~/Documents is listed twice, see data.locations[0]"},
+		{"git mode", "data:\n  locations:\n    - path: ~/Code\n      git_mode: all", `unknown git_mode "all"`},
+		{"invalid pattern", "data:\n  locations:\n    - path: ~/Code\n      ignore: ['[a']", `line 4: data.locations[0].ignore[0]: invalid pattern "[a"`},
+		{"unset variable", "data:\n  locations:\n    - path: $MACUP_TEST_UNSET/Documents", "line 3: data.locations[0].path: environment variable MACUP_TEST_UNSET in $MACUP_TEST_UNSET/Documents isn't set"},
+		{"variable path", "data:\n  locations:\n    - path: $HOME/Documents", ""},
+		{"unset output variable", "output: [$MACUP_TEST_UNSET/backups]", "line 1: output[0]: environment variable MACUP_TEST_UNSET"},
+		{"names", "data:\n  locations:\n    - path: /a\n      name: Work Notes\n    - path: /b\n      name: Photos", ""},
+		{"names of the same archive", "data:\n  locations:\n    - path: /a\n      name: Work Notes\n    - path: /b\n      name: work/notes", `line 6: data.locations[1].name: "work/notes" names the same archive as data.locations[0]`},
+		{"name without letters", "data:\n  locations:\n    - path: /a\n      name: '...'", `"..." has no letters or digits`},
+		{"name of the dotfiles archive", "data:\n  locations:\n    - path: /a\n      name: Dotfiles", `"Dotfiles" is taken by the dotfiles archive`},
+		{"volume wait", "volume_wait: soon", `line 1: volume_wait: invalid duration "soon"`},
+		{"negative retries", "retries: -1", "line 1: retries: must not be negative"},
+		{"problems by line", "retries: -1\nverfiy: true", "2 problems found:\n  - line 1: retries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(path)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("LoadConfig() = %v, want no error", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("LoadConfig() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package macup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hinkolas/macup/internal/diskutil"
+)
+
+// volumeDir is the directory on an output volume that holds the backup
+const volumeDir = "macup"
+
+// volumeTarget returns the output path on the configured output volume
+func (c *Config) volumeTarget() string {
+	return filepath.Join("/Volumes", c.OutputVolume, volumeDir)
+}
+
+// prepareVolume waits for the output volume to be mounted, if configured to,
+// and makes sure a backup can be stored on it
+func prepareVolume(config *Config) error {
+	mountPoint := filepath.Join("/Volumes", config.OutputVolume)
+
+	if config.VolumeWait != "" {
+		timeout, err := time.ParseDuration(config.VolumeWait)
+		if err != nil {
+			return fmt.Errorf("invalid volume_wait: %w", err)
+		}
+		if err := waitForVolume(mountPoint, timeout); err != nil {
+			return err
+		}
+	}
+
+	if info, err := os.Stat(mountPoint); err != nil || !info.IsDir() {
+		return fmt.Errorf("volume %s is not mounted", config.OutputVolume)
+	}
+
+	return checkVolume(mountPoint)
+}
+
+// waitForVolume polls until mountPoint exists or the timeout expires
+func waitForVolume(mountPoint string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	waiting := false
+
+	for {
+		if _, err := os.Stat(mountPoint); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("volume %s was not mounted within %s", filepath.Base(mountPoint), timeout)
+		}
+		if !waiting {
+			slog.Info(fmt.Sprintf("Waiting for %s to be mounted...", filepath.Base(mountPoint)))
+			waiting = true
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// checkVolume makes sure the volume is writable and its filesystem can hold
+// the backup
+func checkVolume(mountPoint string) error {
+	name := filepath.Base(mountPoint)
+
+	fsType, err := diskutil.Filesystem(mountPoint)
+	if err != nil {
+		return fmt.Errorf("can't inspect volume %s: %w", name, err)
+	}
+	switch fsType {
+	case "msdos":
+		slog.Warn(name + " is formatted as FAT32, archives larger than 4 GB will fail")
+	case "ntfs":
+		return fmt.Errorf("volume %s is formatted as NTFS, which macOS can't write to", name)
+	}
+
+	// Atomic writes need to create and rename files on the volume
+	probe := filepath.Join(mountPoint, ".macup-probe")
+	if err := os.WriteFile(probe+".tmp", nil, 0644); err != nil {
+		return fmt.Errorf("volume %s is not writable: %w", name, err)
+	}
+	defer os.Remove(probe)
+	if err := os.Rename(probe+".tmp", probe); err != nil {
+		os.Remove(probe + ".tmp")
+		return fmt.Errorf("volume %s doesn't support renaming files: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package macup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/hinkolas/macup/internal/tui"
+)
+
+// Actions when a file of a location can't be archived
+const (
+	fileErrorSkip = "skip"
+	fileErrorFail = "fail"
+)
+
+// errSocket leaves sockets out of archives, tar can't hold them
+var errSocket = errors.New("sockets can't be archived")
+
+// fileError is a problem with a single file that leaves it out of the backup
+// instead of failing the location, e.g. a file that can't be read or was
+// deleted since the scan
+type fileError struct {
+	err error
+}
+
+func (e fileError) Error() string {
+	return e.err.Error()
+}
+
+func (e fileError) Unwrap() error {
+	return e.err
+}
+
+// warn records that a file was left out of the location and why, counted
+// live by the reporter, which is nil during dry runs. The warnings are
+// shown once the backup is done and recorded in its history, the paths in
+// its manifest.
+func (l *Location) warn(pv tui.ProgressReporter, path string, reason error) {
+	// The path is shown already
+	var pathErr *fs.PathError
+	if errors.As(reason, &pathErr) {
+		reason = pathErr.Err
+	}
+	l.warnings = append(l.warnings, fmt.Sprintf("%s was left out: %v", path, reason))
+	l.skipped = append(l.skipped, path)
+	if pv != nil {
+		pv.Warn(l.label())
+	}
+}
+
+// fileFailed handles a file that can't be read: it is left out with a
+// warning, or with on_file_error "fail" the location fails with the error
+func (l *Location) fileFailed(pv tui.ProgressReporter, path string, err error) error {
+	if l.OnFileError == fileErrorFail {
+		return err
+	}
+	l.warn(pv, path, err)
+	return nil
+}
@@ -0,0 +1,209 @@
+package macup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hinkolas/macup/internal/storage"
+)
+
+// watchSettle is how long changed locations have to stay quiet before the
+// daemon backs them up
+const watchSettle = time.Minute
+
+// locationWatcher marks the locations of a config that changed, from file
+// system events of their directories. Directories matching the excludes or
+// ignore patterns aren't watched, .macupignore files aren't read for that.
+// Locations that can't be watched in full, e.g. past the open file limit,
+// are only found changed by the daemon's periodic scan.
+type locationWatcher struct {
+	watcher *fsnotify.Watcher
+	roots   map[string]watchedLocation // By the normalized path of the location
+	own     []string                   // Directories macup writes to itself
+
+	mu         sync.Mutex
+	changed    map[string]bool // Normalized paths of the changed locations
+	lastChange time.Time
+}
+
+// watchedLocation is a location with the patterns of what isn't watched
+type watchedLocation struct {
+	Location
+	rules ignoreRules
+}
+
+// newLocationWatcher starts watching the locations of a config
+func newLocationWatcher(c *Config) (*locationWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch locations: %w", err)
+	}
+	w := &locationWatcher{watcher: watcher, roots: make(map[string]watchedLocation), changed: make(map[string]bool)}
+
+	// Writing the daemon state or a backup to an output inside a location
+	// doesn't change it
+	if state, err := NormalizePath(daemonStatePath); err == nil {
+		w.own = append(w.own, filepath.Dir(state))
+	}
+	targets := outputTargets(c)
+	for _, loc := range c.Data.Locations {
+		targets = append(targets, loc.Output...)
+	}
+	for _, target := range targets {
+		if dir, err := expandTarget(target); err == nil && !storage.IsRemote(dir) {
+			w.own = append(w.own, dir)
+		}
+	}
+
+	for _, l := range c.Data.Locations {
+		path, err := NormalizePath(l.Path)
+		if err != nil || l.missing() {
+			continue
+		}
+		l.Path = path
+		loc := watchedLocation{Location: l, rules: parseIgnore(append(c.excludes(), l.Ignore...))}
+		w.roots[path] = loc
+		if err := w.add(loc, path); err != nil {
+			slog.Warn(fmt.Sprintf("Failed to watch %s, its changes are only found by the periodic scan: %v", loc.label(), err))
+		}
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// add watches a directory of a location and the directories below it
+func (w *locationWatcher) add(loc watchedLocation, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil // Unreadable directories are left out like in the scan
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if w.isOwn(path) {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(loc.Path, path)
+		if path != loc.Path && !loc.Bundle && loc.rules.ignored(filepath.ToSlash(rel), true) {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+// run handles the events of the watched directories until the watcher is
+// closed
+func (w *locationWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events got lost, any location may have changed
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.mark(slices.Collect(maps.Keys(w.roots)))
+				continue
+			}
+			slog.Warn(fmt.Sprintf("Failed to watch locations: %v", err))
+		}
+	}
+}
+
+// handle marks the locations an event is in as changed and watches
+// directories created inside them
+func (w *locationWatcher) handle(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod || w.isOwn(event.Name) {
+		return // Only metadata changed, e.g. by Spotlight, or macup wrote it
+	}
+	var changed []string
+	for root, loc := range w.roots {
+		if !within(event.Name, root) {
+			continue
+		}
+		rel, _ := filepath.Rel(root, event.Name)
+		if !loc.Bundle && loc.rules.ignored(filepath.ToSlash(rel), false) {
+			continue
+		}
+		changed = append(changed, root)
+		if info, err := os.Lstat(event.Name); err == nil && info.IsDir() && event.Has(fsnotify.Create) {
+			if err := w.add(loc, event.Name); err != nil {
+				slog.Warn(fmt.Sprintf("Failed to watch %s: %v", event.Name, err))
+			}
+		}
+	}
+	w.mark(changed)
+}
+
+// isOwn reports whether macup itself writes to a path
+func (w *locationWatcher) isOwn(path string) bool {
+	return slices.ContainsFunc(w.own, func(dir string) bool { return within(path, dir) })
+}
+
+// mark records locations as changed, given by their normalized path
+func (w *locationWatcher) mark(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, path := range paths {
+		w.changed[path] = true
+	}
+	w.lastChange = time.Now()
+}
+
+// settled reports whether locations changed and then stayed quiet for
+// watchSettle
+func (w *locationWatcher) settled() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.changed) > 0 && time.Since(w.lastChange) >= watchSettle
+}
+
+// reset forgets the changes, once a backup of them starts
+func (w *locationWatcher) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	clear(w.changed)
+}
+
+// watches reports whether the watcher watches the locations of a config
+func (w *locationWatcher) watches(c *Config) bool {
+	var paths []string
+	for _, loc := range c.Data.Locations {
+		if path, err := NormalizePath(loc.Path); err == nil && !loc.missing() {
+			paths = append(paths, path)
+		}
+	}
+	return len(paths) == len(w.roots) && !slices.ContainsFunc(paths, func(path string) bool {
+		_, ok := w.roots[path]
+		return !ok
+	})
+}
+
+// Close stops watching
+func (w *locationWatcher) Close() error {
+	return w.watcher.Close()
+}
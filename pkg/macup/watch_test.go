@@ -0,0 +1,90 @@
+package macup
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// changedPaths returns the locations the watcher marked, in order
+func changedPaths(w *locationWatcher) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Sorted(maps.Keys(w.changed))
+}
+
+// waitChanged waits for the watcher to mark locations and returns them
+func waitChanged(w *locationWatcher) []string {
+	for range 200 {
+		if changed := changedPaths(w); len(changed) > 0 {
+			return changed
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestLocationWatcher(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	projects, docs, output := filepath.Join(home, "Projects"), filepath.Join(home, "Docs"), filepath.Join(home, "Projects", "backups")
+	for _, dir := range []string{filepath.Join(projects, "node_modules"), docs, output} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := &Config{
+		Output:  []string{output},
+		Exclude: []string{"*.tmp"},
+		Data:    Data{Locations: []Location{{Path: "~/Projects", Ignore: []string{"node_modules"}}, {Path: "~/Docs"}}},
+	}
+
+	w, err := newLocationWatcher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	write := func(path string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte("changed"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Excluded and ignored files and what macup writes itself are no change
+	write(filepath.Join(projects, "build.tmp"))
+	write(filepath.Join(projects, "node_modules", "index.js"))
+	write(filepath.Join(output, "Projects.tar.gz"))
+	time.Sleep(200 * time.Millisecond)
+	if changed := changedPaths(w); len(changed) > 0 {
+		t.Fatalf("ignored files marked %v as changed", changed)
+	}
+
+	// Files in new directories are seen as well
+	if err := os.MkdirAll(filepath.Join(docs, "new"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if changed := waitChanged(w); !slices.Equal(changed, []string{docs}) {
+		t.Fatalf("changed = %v, want %v", changed, []string{docs})
+	}
+	w.reset()
+	write(filepath.Join(docs, "new", "notes.txt"))
+	if changed := waitChanged(w); !slices.Equal(changed, []string{docs}) {
+		t.Errorf("changed = %v, want %v", changed, []string{docs})
+	}
+	if w.settled() {
+		t.Errorf("settled() right after a change")
+	}
+
+	if !w.watches(config) {
+		t.Errorf("watches() = false for the config it watches")
+	}
+	config.Data.Locations = config.Data.Locations[:1]
+	if w.watches(config) {
+		t.Errorf("watches() = true for a config with a location less")
+	}
+}